@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config 认证服务配置
+type Config struct {
+	// 服务器配置
+	Server ServerConfig
+
+	// 令牌配置
+	Token TokenConfig
+
+	// 存储配置
+	Store StoreConfig
+
+	// 账户配置
+	Account AccountConfig
+
+	// 两步验证配置
+	MFA MFAConfig
+
+	// 账户安全配置
+	Security SecurityConfig
+
+	// OAuth2 配置
+	OAuth OAuthConfig
+
+	// 日志配置
+	Logging LoggingConfig
+}
+
+// ServerConfig 服务器配置
+type ServerConfig struct {
+	Port            string
+	Host            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+
+	TrustProxyHeaders bool // 信任 X-Forwarded-For / X-Real-IP（部署在网关之后时开启）
+}
+
+// TokenConfig 令牌配置
+type TokenConfig struct {
+	Issuer          string        // 令牌签发者（iss），同时作为对外地址
+	Audience        []string      // 访问令牌的 aud
+	SigningKeyFile  string        // RSA 签名私钥（PEM），不存在时自动生成
+	AccessTokenTTL  time.Duration // 访问令牌有效期
+	RefreshTokenTTL time.Duration // 刷新令牌有效期
+	DefaultScopes   []string      // 登录签发的默认授权范围
+
+	AuthorizationCodeTTL time.Duration // 授权码有效期
+	PasswordResetTTL     time.Duration // 密码重置令牌有效期
+}
+
+// StoreConfig 存储配置
+type StoreConfig struct {
+	Type     string // "memory", "file"
+	FilePath string // file 存储的数据文件
+}
+
+// AccountConfig 账户配置
+type AccountConfig struct {
+	AllowRegistration bool   // 是否允许自助注册
+	AdminUsername     string // 启动时创建的初始管理员
+	AdminPassword     string
+
+	SessionTTL time.Duration // 浏览器登录会话有效期（授权页面使用）
+}
+
+// MFAConfig 两步验证配置
+type MFAConfig struct {
+	Issuer         string        // 验证器应用中显示的发行方名称
+	RequiredRoles  []string      // 拥有任一角色的用户必须启用两步验证
+	RequiredScopes []string      // 拥有任一授权范围的用户必须启用两步验证
+	Skew           int           // 允许前后偏移的时间步数（每步 30 秒）
+	ChallengeTTL   time.Duration // 密码验证后完成第二因素的时限
+	MaxAttempts    int           // 每次登录允许的验证码错误次数
+	RecoveryCodes  int           // 每次生成的恢复码数量
+}
+
+// SecurityConfig 账户安全配置
+type SecurityConfig struct {
+	// 登录失败跟踪
+	LockoutThreshold   int           // 账户失败次数达到后临时锁定，0 表示不锁定
+	IPLockoutThreshold int           // 同一 IP 失败次数达到后临时锁定，0 表示不锁定
+	LockoutDuration    time.Duration // 锁定时长
+	FailureWindow      time.Duration // 超过该时间没有新的失败时计数清零
+	DelayBase          time.Duration // 超出免等待次数后的首次等待时间，之后每次翻倍
+	DelayMax           time.Duration // 等待时间上限
+
+	// 密码策略
+	PasswordMinLength     int
+	PasswordMaxLength     int
+	PasswordMinClasses    int    // 至少包含的字符类别数（小写、大写、数字、符号）
+	BreachedPasswordsFile string // 按哈希排序的泄露密码 SHA-1 列表（HIBP 格式）
+
+	// 密码重置
+	PasswordResetWebhook string // 接收重置链接的地址（例如发信服务），为空时只能由管理员发起重置
+}
+
+// OAuthConfig OAuth2 配置
+type OAuthConfig struct {
+	Clients []ClientConfig // 启动时注册/更新的客户端（AUTH_CLIENTS_FILE）
+}
+
+// LoggingConfig 日志配置
+type LoggingConfig struct {
+	Level    string // "debug", "info", "warn", "error"
+	Format   string // "json", "text"
+	Output   string // "stdout", "stderr", "file"
+	FilePath string // 日志文件路径
+}
+
+// LoadConfig 加载配置
+func LoadConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            getEnv("AUTH_PORT", "8090"),
+			Host:            getEnv("AUTH_HOST", "0.0.0.0"),
+			ReadTimeout:     getDurationEnv("AUTH_READ_TIMEOUT", 15*time.Second),
+			WriteTimeout:    getDurationEnv("AUTH_WRITE_TIMEOUT", 15*time.Second),
+			IdleTimeout:     getDurationEnv("AUTH_IDLE_TIMEOUT", 60*time.Second),
+			ShutdownTimeout: getDurationEnv("AUTH_SHUTDOWN_TIMEOUT", 5*time.Second),
+
+			TrustProxyHeaders: getBoolEnv("AUTH_TRUST_PROXY_HEADERS", false),
+		},
+		Token: TokenConfig{
+			Issuer:          strings.TrimSuffix(getEnv("AUTH_ISSUER", "http://localhost:8090"), "/"),
+			Audience:        getSliceEnv("AUTH_AUDIENCE", []string{"gateway"}),
+			SigningKeyFile:  getEnv("AUTH_SIGNING_KEY_FILE", "signing.key"),
+			AccessTokenTTL:  getDurationEnv("AUTH_ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTokenTTL: getDurationEnv("AUTH_REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			DefaultScopes:   getSliceEnv("AUTH_DEFAULT_SCOPES", []string{}),
+
+			AuthorizationCodeTTL: getDurationEnv("AUTH_CODE_TTL", 60*time.Second),
+			PasswordResetTTL:     getDurationEnv("AUTH_PASSWORD_RESET_TTL", 30*time.Minute),
+		},
+		Store: StoreConfig{
+			Type:     getEnv("AUTH_STORE", "file"),
+			FilePath: getEnv("AUTH_STORE_FILE", "auth-data.json"),
+		},
+		Account: AccountConfig{
+			AllowRegistration: getBoolEnv("AUTH_ALLOW_REGISTRATION", false),
+			AdminUsername:     getEnv("AUTH_ADMIN_USERNAME", ""),
+			AdminPassword:     getEnv("AUTH_ADMIN_PASSWORD", ""),
+
+			SessionTTL: getDurationEnv("AUTH_SESSION_TTL", 12*time.Hour),
+		},
+		MFA: MFAConfig{
+			Issuer:         getEnv("AUTH_MFA_ISSUER", "Auth"),
+			RequiredRoles:  getSliceEnv("AUTH_MFA_REQUIRED_ROLES", []string{}),
+			RequiredScopes: getSliceEnv("AUTH_MFA_REQUIRED_SCOPES", []string{}),
+			Skew:           getIntEnv("AUTH_MFA_SKEW", 1),
+			ChallengeTTL:   getDurationEnv("AUTH_MFA_CHALLENGE_TTL", 5*time.Minute),
+			MaxAttempts:    getIntEnv("AUTH_MFA_MAX_ATTEMPTS", 5),
+			RecoveryCodes:  getIntEnv("AUTH_MFA_RECOVERY_CODES", 10),
+		},
+		Security: SecurityConfig{
+			LockoutThreshold:   getIntEnv("AUTH_LOCKOUT_THRESHOLD", 10),
+			IPLockoutThreshold: getIntEnv("AUTH_LOCKOUT_IP_THRESHOLD", 100),
+			LockoutDuration:    getDurationEnv("AUTH_LOCKOUT_DURATION", 15*time.Minute),
+			FailureWindow:      getDurationEnv("AUTH_LOCKOUT_WINDOW", 15*time.Minute),
+			DelayBase:          getDurationEnv("AUTH_LOGIN_DELAY_BASE", time.Second),
+			DelayMax:           getDurationEnv("AUTH_LOGIN_DELAY_MAX", 30*time.Second),
+
+			PasswordMinLength:     getIntEnv("AUTH_PASSWORD_MIN_LENGTH", 8),
+			PasswordMaxLength:     getIntEnv("AUTH_PASSWORD_MAX_LENGTH", 128),
+			PasswordMinClasses:    getIntEnv("AUTH_PASSWORD_MIN_CLASSES", 0),
+			BreachedPasswordsFile: getEnv("AUTH_BREACHED_PASSWORDS_FILE", ""),
+
+			PasswordResetWebhook: getEnv("AUTH_PASSWORD_RESET_WEBHOOK", ""),
+		},
+		OAuth: OAuthConfig{
+			Clients: loadClients(getEnv("AUTH_CLIENTS_FILE", "")),
+		},
+		Logging: LoggingConfig{
+			Level:    getEnv("LOG_LEVEL", "info"),
+			Format:   getEnv("LOG_FORMAT", "json"),
+			Output:   getEnv("LOG_OUTPUT", "stdout"),
+			FilePath: getEnv("LOG_FILE_PATH", "auth.log"),
+		},
+	}
+}
+
+// 辅助函数
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getIntEnv(key string, fallback int) int {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return fallback
+}
+
+func getBoolEnv(key string, fallback bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+func getSliceEnv(key string, fallback []string) []string {
+	if value := os.Getenv(key); value != "" {
+		return strings.Split(value, ",")
+	}
+	return fallback
+}
+
+// loadClients 从 JSON 文件加载客户端配置
+func loadClients(path string) []ClientConfig {
+	var clients []ClientConfig
+	if err := loadJSONFile(path, &clients); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load clients: %v, ignoring\n", err)
+		return nil
+	}
+	return clients
+}
+
+// loadJSONFile 读取 JSON 配置文件，路径为空时不做任何事
+func loadJSONFile(path string, v interface{}) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
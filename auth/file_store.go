@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// FileStore 嵌入式文件存储：数据常驻内存，每次修改后整体写入 JSON 文件
+// 写入先落临时文件再 rename，进程崩溃不会留下半截数据
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore 创建文件存储，文件不存在时从空数据开始
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		loaded := newStoreData()
+		if err := json.Unmarshal(data, loaded); err != nil {
+			return nil, err
+		}
+		store.data = loaded
+		store.data.ensureMaps()
+	}
+
+	store.persist = store.write
+	return store, nil
+}
+
+// write 原子写入数据文件
+func (s *FileStore) write(data *storeData) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// maxBodySize 请求体上限
+const maxBodySize = 1 << 20
+
+// Handler 认证服务 HTTP 处理器
+type Handler struct {
+	service *AuthService
+	signer  *TokenSigner
+	config  *Config
+	guard   *LoginGuard
+}
+
+// NewHandler 创建 HTTP 处理器
+func NewHandler(config *Config, service *AuthService, signer *TokenSigner) *Handler {
+	return &Handler{
+		service: service,
+		signer:  signer,
+		config:  config,
+		guard:   NewLoginGuard(config.Security),
+	}
+}
+
+// Register 注册路由
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/register", h.RegisterUser)
+	mux.HandleFunc("POST /api/v1/login", h.Login)
+	mux.HandleFunc("POST /api/v1/token/refresh", h.RefreshToken)
+	mux.HandleFunc("POST /api/v1/logout", h.Logout)
+	mux.HandleFunc("GET /api/v1/me", h.Me)
+	mux.HandleFunc("GET /.well-known/jwks.json", h.JWKS)
+	mux.HandleFunc("GET /health", HealthCheckHandler)
+
+	// 浏览器登录
+	mux.HandleFunc("GET /{$}", h.Home)
+	mux.HandleFunc("GET /login", h.LoginPage)
+	mux.HandleFunc("POST /login", h.LoginSubmit)
+	mux.HandleFunc("GET /login/mfa", h.MFAPage)
+	mux.HandleFunc("POST /login/mfa", h.MFASubmit)
+	mux.HandleFunc("GET /password/reset", h.ResetPasswordPage)
+	mux.HandleFunc("POST /password/reset", h.ResetPasswordSubmit)
+
+	// 两步验证
+	mux.HandleFunc("POST /api/v1/login/mfa", h.LoginMFA)
+	mux.HandleFunc("GET /api/v1/mfa", h.MFAStatus)
+	mux.HandleFunc("POST /api/v1/mfa/totp", h.EnrollTOTP)
+	mux.HandleFunc("POST /api/v1/mfa/totp/confirm", h.ConfirmTOTP)
+	mux.HandleFunc("DELETE /api/v1/mfa/totp", h.DisableTOTP)
+	mux.HandleFunc("POST /api/v1/mfa/recovery-codes", h.RegenerateRecoveryCodes)
+
+	// 密码重置
+	mux.HandleFunc("POST /api/v1/password/reset", h.RequestPasswordReset)
+	mux.HandleFunc("POST /api/v1/password/reset/confirm", h.ConfirmPasswordReset)
+
+	// OAuth2
+	mux.HandleFunc("GET /oauth/authorize", h.Authorize)
+	mux.HandleFunc("POST /oauth/authorize", h.Authorize)
+	mux.HandleFunc("POST /oauth/token", h.Token)
+	mux.HandleFunc("POST /oauth/introspect", h.Introspect)
+	mux.HandleFunc("POST /oauth/revoke", h.Revoke)
+	mux.HandleFunc("GET /.well-known/oauth-authorization-server", h.AuthorizationServerMetadata)
+
+	// OpenID Connect
+	mux.HandleFunc("GET /.well-known/openid-configuration", h.OpenIDConfiguration)
+	mux.HandleFunc("GET /oauth/userinfo", h.UserInfo)
+	mux.HandleFunc("POST /oauth/userinfo", h.UserInfo)
+	mux.HandleFunc("GET /oauth/logout", h.EndSession)
+	mux.HandleFunc("POST /oauth/logout", h.EndSession)
+
+	// 客户端管理（需要 admin 授权范围）
+	mux.HandleFunc("GET /api/v1/clients", h.ListClients)
+	mux.HandleFunc("POST /api/v1/clients", h.CreateClient)
+	mux.HandleFunc("GET /api/v1/clients/{id}", h.GetClient)
+	mux.HandleFunc("PUT /api/v1/clients/{id}", h.UpdateClient)
+	mux.HandleFunc("DELETE /api/v1/clients/{id}", h.DeleteClient)
+	mux.HandleFunc("POST /api/v1/clients/{id}/secret", h.RotateClientSecret)
+
+	// RBAC 管理（需要 admin 授权范围）
+	mux.HandleFunc("GET /api/v1/users", h.ListUsers)
+	mux.HandleFunc("POST /api/v1/users", h.CreateUser)
+	mux.HandleFunc("GET /api/v1/users/{id}", h.GetUser)
+	mux.HandleFunc("PUT /api/v1/users/{id}", h.UpdateUser)
+	mux.HandleFunc("DELETE /api/v1/users/{id}", h.DeleteUser)
+	mux.HandleFunc("DELETE /api/v1/users/{id}/mfa", h.ResetUserMFA)
+	mux.HandleFunc("DELETE /api/v1/users/{id}/lockout", h.UnlockUser)
+	mux.HandleFunc("POST /api/v1/users/{id}/password-reset", h.IssueUserPasswordReset)
+	mux.HandleFunc("GET /api/v1/permissions", h.ListPermissions)
+	mux.HandleFunc("POST /api/v1/permissions", h.CreatePermission)
+	mux.HandleFunc("GET /api/v1/permissions/{name}", h.GetPermission)
+	mux.HandleFunc("PUT /api/v1/permissions/{name}", h.UpdatePermission)
+	mux.HandleFunc("DELETE /api/v1/permissions/{name}", h.DeletePermission)
+	mux.HandleFunc("GET /api/v1/roles", h.ListRoles)
+	mux.HandleFunc("POST /api/v1/roles", h.CreateRole)
+	mux.HandleFunc("GET /api/v1/roles/{name}", h.GetRole)
+	mux.HandleFunc("PUT /api/v1/roles/{name}", h.UpdateRole)
+	mux.HandleFunc("DELETE /api/v1/roles/{name}", h.DeleteRole)
+	mux.HandleFunc("GET /api/v1/route-bindings", h.ListRouteBindings)
+	mux.HandleFunc("POST /api/v1/route-bindings", h.CreateRouteBinding)
+	mux.HandleFunc("GET /api/v1/route-bindings/{id}", h.GetRouteBinding)
+	mux.HandleFunc("PUT /api/v1/route-bindings/{id}", h.UpdateRouteBinding)
+	mux.HandleFunc("DELETE /api/v1/route-bindings/{id}", h.DeleteRouteBinding)
+
+	// 网关拉取授权策略（需要 rbac:read 授权范围）
+	mux.HandleFunc("GET /api/v1/rbac/policy", h.Policy)
+}
+
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Scope    string `json:"scope"`
+	Name     string `json:"name"`  // 注册时可选
+	Email    string `json:"email"` // 注册时可选
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"` // 注销时吊销该用户的全部会话
+}
+
+// userResponse 对外展示的用户信息（不含密码哈希）
+type userResponse struct {
+	ID            string   `json:"id"`
+	Username      string   `json:"username"`
+	Name          string   `json:"name,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	Scopes        []string `json:"scopes,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	Disabled      bool     `json:"disabled,omitempty"`
+	CreatedAt     string   `json:"created_at"`
+}
+
+func newUserResponse(user *User) userResponse {
+	return userResponse{
+		ID:            user.ID,
+		Username:      user.Username,
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Scopes:        user.Scopes,
+		Roles:         user.Roles,
+		Disabled:      user.Disabled,
+		CreatedAt:     user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// RegisterUser 自助注册（AUTH_ALLOW_REGISTRATION=true 时开放）
+func (h *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
+	if !h.config.Account.AllowRegistration {
+		writeError(w, http.StatusForbidden, "registration_disabled", "self-service registration is disabled")
+		return
+	}
+
+	var req credentialsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.service.CreateUser(&User{Username: req.Username, Name: req.Name, Email: req.Email}, req.Password)
+	switch {
+	case errors.Is(err, ErrInvalidUsername), errors.Is(err, ErrInvalidEmail), errors.Is(err, ErrWeakPassword):
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	case errors.Is(err, ErrConflict):
+		writeError(w, http.StatusConflict, "username_taken", "username is already registered")
+		return
+	case err != nil:
+		h.serverError(w, r, "Failed to create user", err)
+		return
+	}
+
+	GetLogger().InfoWithRequestID(getRequestID(r), "User registered", map[string]interface{}{
+		"user_id":  user.ID,
+		"username": user.Username,
+	})
+
+	writeJSON(w, http.StatusCreated, newUserResponse(user))
+}
+
+// Login 密码登录，需要第二因素时返回 mfa_token，由 /api/v1/login/mfa 完成登录
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req credentialsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ip := getClientIP(r)
+	if throttle := h.guard.Check(req.Username, ip); throttle != nil {
+		writeThrottled(w, r, req.Username, throttle)
+		return
+	}
+
+	tokens, user, err := h.service.Login(req.Username, req.Password, req.Scope)
+	var challenge *MFAChallengeError
+	switch {
+	case errors.As(err, &challenge):
+		h.writeMFAChallenge(w, r, user, challenge)
+		return
+	case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrUserDisabled):
+		GetLogger().WarnWithRequestID(getRequestID(r), "Login failed", map[string]interface{}{
+			"username":  req.Username,
+			"reason":    err.Error(),
+			"remote_ip": ip,
+		})
+		h.recordLoginFailure(r, req.Username, ip)
+		// 不区分用户不存在、密码错误和账户禁用
+		writeError(w, http.StatusUnauthorized, "invalid_grant", ErrInvalidCredentials.Error())
+		return
+	case err != nil:
+		h.serverError(w, r, "Login error", err)
+		return
+	}
+
+	h.guard.Succeed(user.Username)
+	GetLogger().InfoWithRequestID(getRequestID(r), "Login succeeded", map[string]interface{}{
+		"user_id":   user.ID,
+		"remote_ip": ip,
+	})
+
+	writeTokens(w, tokens)
+}
+
+// RefreshToken 使用刷新令牌换取新令牌
+func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.RefreshToken == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+		return
+	}
+
+	tokens, old, err := h.service.Refresh(req.RefreshToken, nil, "")
+	switch {
+	case errors.Is(err, ErrTokenReused):
+		GetLogger().WarnWithRequestID(getRequestID(r), "Refresh token reuse detected, family revoked", map[string]interface{}{
+			"user_id":   old.UserID,
+			"family_id": old.FamilyID,
+			"remote_ip": getClientIP(r),
+		})
+		writeError(w, http.StatusBadRequest, "invalid_grant", ErrInvalidGrant.Error())
+		return
+	case errors.Is(err, ErrInvalidGrant), errors.Is(err, ErrUserDisabled):
+		writeError(w, http.StatusBadRequest, "invalid_grant", ErrInvalidGrant.Error())
+		return
+	case err != nil:
+		h.serverError(w, r, "Refresh error", err)
+		return
+	}
+
+	writeTokens(w, tokens)
+}
+
+// Logout 吊销刷新令牌
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.RefreshToken == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+		return
+	}
+
+	token, err := h.service.Revoke(req.RefreshToken, req.All)
+	if err != nil {
+		h.serverError(w, r, "Logout error", err)
+		return
+	}
+
+	if token != nil {
+		GetLogger().InfoWithRequestID(getRequestID(r), "Logged out", map[string]interface{}{
+			"user_id":   token.UserID,
+			"family_id": token.FamilyID,
+			"all":       req.All,
+		})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Me 返回访问令牌对应的用户
+func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="auth"`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", "missing bearer token")
+		return
+	}
+
+	_, user, err := h.service.VerifyAccessToken(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="auth", error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", err.Error())
+		return
+	}
+	if user == nil {
+		writeError(w, http.StatusForbidden, "invalid_token", "token is not bound to a user")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// JWKS 公钥集合，供网关 JWT_JWKS_URL 使用
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, h.signer.JWKS())
+}
+
+// HealthCheckHandler 健康检查
+func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&healthy) == 1 {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+		return
+	}
+	writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unhealthy"})
+}
+
+func (h *Handler) serverError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	GetLogger().ErrorWithRequestID(getRequestID(r), message, map[string]interface{}{
+		"error": err.Error(),
+	})
+	writeError(w, http.StatusInternalServerError, "server_error", "internal server error")
+}
+
+// 辅助函数
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "malformed JSON body")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 写入 OAuth2 风格的错误响应
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeTokens(w http.ResponseWriter, tokens *TokenResponse) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
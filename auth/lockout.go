@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 前几次失败不需要等待（输错密码很常见），之后每次失败等待时间翻倍
+// 同一 IP 后面可能有多个用户（NAT、代理），免等待次数更多
+const (
+	accountFreeFailures = 2
+	ipFreeFailures      = 10
+)
+
+// 登录限制的范围
+const (
+	ThrottleScopeAccount = "account"
+	ThrottleScopeIP      = "ip"
+)
+
+// 账户安全审计事件（日志 event 字段）
+const (
+	securityEventLoginThrottled  = "security.login_throttled"
+	securityEventAccountLocked   = "security.account_locked"
+	securityEventIPLocked        = "security.ip_locked"
+	securityEventAccountUnlocked = "security.account_unlocked"
+)
+
+// LoginThrottle 登录尝试被拒绝的原因
+type LoginThrottle struct {
+	Scope      string        // ThrottleScopeAccount / ThrottleScopeIP
+	Locked     bool          // 失败次数达到阈值被临时锁定，否则为逐次增加的等待
+	RetryAfter time.Duration // 距离下次允许尝试的时间
+}
+
+// failureRecord 一个账户或 IP 的失败记录
+type failureRecord struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginGuard 登录失败跟踪：按账户和 IP 分别计数，逐次增加等待时间，达到阈值后临时锁定
+// 账户按用户名计数（不区分是否存在），不会泄露用户名是否注册；记录只保存在内存中，重启后清零
+type LoginGuard struct {
+	config    SecurityConfig
+	records   map[string]*failureRecord
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// NewLoginGuard 创建登录失败跟踪器
+func NewLoginGuard(config SecurityConfig) *LoginGuard {
+	return &LoginGuard{
+		config:    config,
+		records:   make(map[string]*failureRecord),
+		lastSweep: time.Now(),
+	}
+}
+
+// guardKeys 账户和 IP 的记录键，用户名不区分大小写；为空的一项不参与
+func guardKeys(username, ip string) []string {
+	var keys []string
+	if username != "" {
+		keys = append(keys, "user:"+strings.ToLower(username))
+	}
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	return keys
+}
+
+// limits 返回记录键的免等待次数和锁定阈值
+func (g *LoginGuard) limits(key string) (int, int) {
+	if strings.HasPrefix(key, "ip:") {
+		return ipFreeFailures, g.config.IPLockoutThreshold
+	}
+	return accountFreeFailures, g.config.LockoutThreshold
+}
+
+// delay 超出免等待次数后第 n 次失败的等待时间：DelayBase 起每次翻倍，不超过 DelayMax
+func (g *LoginGuard) delay(n int) time.Duration {
+	d := g.config.DelayBase
+	for i := 1; i < n && d < g.config.DelayMax; i++ {
+		d *= 2
+	}
+	if d > g.config.DelayMax {
+		d = g.config.DelayMax
+	}
+	return d
+}
+
+// Check 检查账户和 IP 是否允许尝试登录，允许时返回 nil
+func (g *LoginGuard) Check(username, ip string) *LoginThrottle {
+	now := time.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range guardKeys(username, ip) {
+		record := g.records[key]
+		if record == nil {
+			continue
+		}
+
+		scope := ThrottleScopeAccount
+		if strings.HasPrefix(key, "ip:") {
+			scope = ThrottleScopeIP
+		}
+		if now.Before(record.lockedUntil) {
+			return &LoginThrottle{Scope: scope, Locked: true, RetryAfter: record.lockedUntil.Sub(now)}
+		}
+
+		free, _ := g.limits(key)
+		if record.failures <= free || now.Sub(record.lastFailure) > g.config.FailureWindow {
+			continue
+		}
+		if until := record.lastFailure.Add(g.delay(record.failures - free)); now.Before(until) {
+			return &LoginThrottle{Scope: scope, RetryAfter: until.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// Fail 记录一次失败，返回账户和 IP 是否因此被锁定
+// 锁定后计数清零，锁定结束后重新开始计数
+func (g *LoginGuard) Fail(username, ip string) (accountLocked, ipLocked bool) {
+	now := time.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range guardKeys(username, ip) {
+		record := g.records[key]
+		if record == nil || now.Sub(record.lastFailure) > g.config.FailureWindow {
+			record = &failureRecord{lockedUntil: g.lockedUntil(key)}
+			g.records[key] = record
+		}
+		record.failures++
+		record.lastFailure = now
+
+		_, threshold := g.limits(key)
+		if threshold > 0 && record.failures >= threshold {
+			record.failures = 0
+			record.lockedUntil = now.Add(g.config.LockoutDuration)
+			if strings.HasPrefix(key, "ip:") {
+				ipLocked = true
+			} else {
+				accountLocked = true
+			}
+		}
+	}
+
+	g.sweep(now)
+	return accountLocked, ipLocked
+}
+
+// lockedUntil 记录的锁定截止时间（调用方持有锁）
+func (g *LoginGuard) lockedUntil(key string) time.Time {
+	if record := g.records[key]; record != nil {
+		return record.lockedUntil
+	}
+	return time.Time{}
+}
+
+// Succeed 登录成功后清除账户的失败记录，IP 的记录保留到过期
+func (g *LoginGuard) Succeed(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range guardKeys(username, "") {
+		delete(g.records, key)
+	}
+}
+
+// Unlock 解除账户锁定并清除失败记录，返回账户之前是否被限制
+func (g *LoginGuard) Unlock(username string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := guardKeys(username, "")[0]
+	_, exists := g.records[key]
+	delete(g.records, key)
+	return exists
+}
+
+// sweep 每个失败窗口清理一次过期记录（调用方持有锁）
+func (g *LoginGuard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < g.config.FailureWindow {
+		return
+	}
+	g.lastSweep = now
+
+	for key, record := range g.records {
+		if now.Sub(record.lastFailure) > g.config.FailureWindow && now.After(record.lockedUntil) {
+			delete(g.records, key)
+		}
+	}
+}
+
+// auditSecurity 记录账户安全审计事件
+func auditSecurity(r *http.Request, message, event string, fields map[string]interface{}) {
+	fields["event"] = event
+	fields["remote_ip"] = getClientIP(r)
+	GetLogger().WarnWithRequestID(getRequestID(r), message, fields)
+}
+
+// recordLoginFailure 记录密码或第二因素验证失败，达到阈值时记录锁定事件
+func (h *Handler) recordLoginFailure(r *http.Request, username, ip string) {
+	accountLocked, ipLocked := h.guard.Fail(username, ip)
+	if accountLocked {
+		auditSecurity(r, "Account locked after repeated login failures", securityEventAccountLocked, map[string]interface{}{
+			"username":   username,
+			"locked_for": h.config.Security.LockoutDuration.String(),
+		})
+	}
+	if ipLocked {
+		auditSecurity(r, "IP address locked after repeated login failures", securityEventIPLocked, map[string]interface{}{
+			"ip":         ip,
+			"locked_for": h.config.Security.LockoutDuration.String(),
+		})
+	}
+}
+
+// logThrottled 记录被拒绝的登录尝试，返回 Retry-After 秒数
+func logThrottled(r *http.Request, username string, throttle *LoginThrottle) int {
+	retryAfter := int((throttle.RetryAfter + time.Second - 1) / time.Second)
+	auditSecurity(r, "Login attempt throttled", securityEventLoginThrottled, map[string]interface{}{
+		"username":    username,
+		"scope":       throttle.Scope,
+		"locked":      throttle.Locked,
+		"retry_after": retryAfter,
+	})
+	return retryAfter
+}
+
+// writeThrottled 返回 429，不区分账户和 IP 限制
+func writeThrottled(w http.ResponseWriter, r *http.Request, username string, throttle *LoginThrottle) {
+	retryAfter := logThrottled(r, username, throttle)
+	w.Header().Set("Retry-After", fmt.Sprint(retryAfter))
+	writeError(w, http.StatusTooManyRequests, "too_many_attempts",
+		fmt.Sprintf("too many failed attempts, try again in %d seconds", retryAfter))
+}
+
+// UnlockUser 管理员解除账户的登录锁定（需要 admin 授权范围）
+func (h *Handler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	user, err := h.service.store.GetUser(r.PathValue("id"))
+	if err != nil {
+		h.writeAdminError(w, r, "user", err)
+		return
+	}
+
+	locked := h.guard.Unlock(user.Username)
+	GetLogger().InfoWithRequestID(getRequestID(r), "Account unlocked", map[string]interface{}{
+		"event":        securityEventAccountUnlocked,
+		"user_id":      user.ID,
+		"had_failures": locked,
+		"by":           claims["sub"],
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1 +1,191 @@
 package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var (
+	healthy int32
+	cfg     *Config
+	logger  *Logger
+)
+
+func init() {
+	// 加载配置
+	cfg = LoadConfig()
+
+	// 初始化日志
+	logger = InitLogger(cfg.Logging)
+
+	trustProxyHeaders = cfg.Server.TrustProxyHeaders
+}
+
+func main() {
+	logger.Info("Starting auth service", map[string]interface{}{
+		"port":   cfg.Server.Port,
+		"issuer": cfg.Token.Issuer,
+		"store":  cfg.Store.Type,
+	})
+
+	// 创建存储
+	store, err := NewStore(cfg.Store)
+	if err != nil {
+		logger.Error("Failed to open store", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	// 加载签名私钥
+	signer, err := LoadOrCreateSigner(cfg.Token.SigningKeyFile)
+	if err != nil {
+		logger.Error("Failed to load signing key", map[string]interface{}{
+			"file":  cfg.Token.SigningKeyFile,
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	// 密码策略
+	passwords, err := NewPasswordPolicy(cfg.Security)
+	if err != nil {
+		logger.Error("Failed to load password policy", map[string]interface{}{
+			"breached_passwords_file": cfg.Security.BreachedPasswordsFile,
+			"error":                   err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	service := NewAuthService(cfg.Token, cfg.MFA, passwords, store, signer)
+
+	// 初始管理员
+	if cfg.Account.AdminUsername != "" {
+		user, created, err := service.EnsureUser(cfg.Account.AdminUsername, cfg.Account.AdminPassword, []string{"admin"})
+		if err != nil {
+			logger.Error("Failed to create admin user", map[string]interface{}{
+				"username": cfg.Account.AdminUsername,
+				"error":    err.Error(),
+			})
+			os.Exit(1)
+		}
+		if created {
+			logger.Info("Admin user created", map[string]interface{}{
+				"user_id":  user.ID,
+				"username": user.Username,
+			})
+		}
+	}
+
+	// 客户端文件中的 OAuth2 客户端
+	for _, clientConfig := range cfg.OAuth.Clients {
+		client, created, err := service.UpsertClient(clientConfig)
+		if err != nil {
+			logger.Error("Failed to register client", map[string]interface{}{
+				"client_id": clientConfig.ID,
+				"error":     err.Error(),
+			})
+			continue
+		}
+		logger.Info("Client registered from file", map[string]interface{}{
+			"client_id": client.ID,
+			"created":   created,
+		})
+	}
+
+	// 定期清理过期的令牌、授权码和会话
+	stopCleanup := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if removed, err := store.DeleteExpired(time.Now()); err != nil {
+					logger.Error("Failed to clean up expired data", map[string]interface{}{
+						"error": err.Error(),
+					})
+				} else if removed > 0 {
+					logger.Debug("Expired records removed", map[string]interface{}{
+						"count": removed,
+					})
+				}
+			case <-stopCleanup:
+				return
+			}
+		}
+	}()
+
+	// 创建路由
+	mux := http.NewServeMux()
+	NewHandler(cfg, service, signer).Register(mux)
+
+	var handler http.Handler = mux
+	handler = LoggingMiddleware(logger)(handler)
+	handler = RecoveryMiddleware(handler)
+	handler = RequestIDMiddleware(handler)
+
+	srv := &http.Server{
+		Handler:      handler,
+		Addr:         cfg.Server.Host + ":" + cfg.Server.Port,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+
+	go func() {
+		atomic.StoreInt32(&healthy, 1)
+
+		logger.Info("HTTP server started", map[string]interface{}{
+			"address": srv.Addr,
+		})
+
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+	}()
+
+	// 等待中断信号
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	<-quit
+
+	logger.Info("Shutting down server gracefully...", nil)
+
+	atomic.StoreInt32(&healthy, 0)
+	close(stopCleanup)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("Server forced to shutdown", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	logger.Info("Server stopped", nil)
+}
+
+// NewStore 根据配置创建存储
+func NewStore(config StoreConfig) (Store, error) {
+	switch config.Type {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "file":
+		return NewFileStore(config.FilePath)
+	default:
+		return nil, fmt.Errorf("unknown store type %q", config.Type)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidMFACode      = errors.New("invalid verification code")
+	ErrMFACodeReused       = errors.New("verification code has already been used")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolling     = errors.New("no pending two-factor enrollment")
+	ErrMFARequiredByPolicy = errors.New("two-factor authentication is required for this account")
+	ErrMFAChallengeExpired = errors.New("sign-in has expired, please sign in again")
+	ErrMFATooManyAttempts  = errors.New("too many invalid verification codes, please sign in again")
+)
+
+// 第二因素的验证方式
+const (
+	MFAMethodTOTP         = "totp"
+	MFAMethodRecoveryCode = "recovery_code"
+)
+
+// MFAChallengeError 密码正确但还需要第二因素，Token 用于提交验证码
+type MFAChallengeError struct {
+	Token  string
+	Enroll bool // 策略要求两步验证但用户尚未启用，需要先完成注册
+	MFA    *MFA // Enroll 时为待确认的注册
+}
+
+func (e *MFAChallengeError) Error() string {
+	if e.Enroll {
+		return "two-factor enrollment required"
+	}
+	return "two-factor authentication required"
+}
+
+// MFAResult 第二因素验证结果
+type MFAResult struct {
+	Method        string
+	Enrolled      bool     // 本次登录同时完成了注册
+	RecoveryCodes []string // 注册时生成的恢复码明文，只返回这一次
+	Remaining     int      // 使用恢复码后剩余的数量
+}
+
+// MFARequired 用户是否被策略要求启用两步验证（拥有 AUTH_MFA_REQUIRED_ROLES / AUTH_MFA_REQUIRED_SCOPES 中的任一项）
+func (s *AuthService) MFARequired(user *User) bool {
+	// 不能用 intersectScopes：它把空的请求列表视为全部
+	if len(s.mfa.RequiredRoles) > 0 && len(intersectScopes(s.mfa.RequiredRoles, user.Roles)) > 0 {
+		return true
+	}
+	return len(s.mfa.RequiredScopes) > 0 && len(intersectScopes(s.mfa.RequiredScopes, s.userScopes(user))) > 0
+}
+
+// GetMFA 获取用户的两步验证状态，没有时返回 nil
+func (s *AuthService) GetMFA(userID string) (*MFA, error) {
+	mfa, err := s.store.GetMFA(userID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return mfa, err
+}
+
+// BeginTOTPEnrollment 生成新的 TOTP 密钥，替换之前未确认的注册
+func (s *AuthService) BeginTOTPEnrollment(user *User) (*MFA, error) {
+	existing, err := s.GetMFA(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	mfa := &MFA{
+		UserID:     user.ID,
+		TOTPSecret: newTOTPSecret(),
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := s.store.SaveMFA(mfa); err != nil {
+		return nil, err
+	}
+	return mfa, nil
+}
+
+// TOTPURI 返回注册用的 otpauth URI
+func (s *AuthService) TOTPURI(user *User, mfa *MFA) string {
+	return otpauthURI(s.mfa.Issuer, user.Username, mfa.TOTPSecret)
+}
+
+// ConfirmTOTPEnrollment 用第一个验证码确认注册，启用两步验证并返回恢复码明文
+func (s *AuthService) ConfirmTOTPEnrollment(user *User, code string) ([]string, error) {
+	mfa, err := s.GetMFA(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, ErrMFANotEnrolling
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := matchTOTP(mfa.TOTPSecret, strings.TrimSpace(code), time.Now(), s.mfa.Skew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes := newRecoveryCodes(s.mfa.RecoveryCodes)
+	now := time.Now().UTC()
+	mfa.Enabled = true
+	mfa.EnabledAt = now
+	mfa.LastStep = step
+	mfa.RecoveryCodes = hashes
+
+	if err := s.store.SaveMFA(mfa); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor 校验 TOTP 验证码或恢复码，两者都只能使用一次
+func (s *AuthService) VerifySecondFactor(user *User, code string) (*MFAResult, error) {
+	mfa, err := s.GetMFA(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		step, ok := matchTOTP(mfa.TOTPSecret, code, time.Now(), s.mfa.Skew)
+		if !ok {
+			return nil, ErrInvalidMFACode
+		}
+		err := s.store.UseTOTPStep(user.ID, step)
+		if errors.Is(err, ErrTokenReused) {
+			return nil, ErrMFACodeReused
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &MFAResult{Method: MFAMethodTOTP}, nil
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if n := len(normalized); n != recoveryCodeLength && n != legacyRecoveryCodeLength {
+		return nil, ErrInvalidMFACode
+	}
+	remaining, err := s.store.UseRecoveryCode(user.ID, hashToken(normalized))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidMFACode
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &MFAResult{Method: MFAMethodRecoveryCode, Remaining: remaining}, nil
+}
+
+// DisableTOTP 验证第二因素后关闭两步验证，策略要求的用户不能关闭
+func (s *AuthService) DisableTOTP(user *User, code string) (*MFAResult, error) {
+	if s.MFARequired(user) {
+		return nil, ErrMFARequiredByPolicy
+	}
+
+	result, err := s.VerifySecondFactor(user, code)
+	if err != nil {
+		return nil, err
+	}
+	return result, s.store.DeleteMFA(user.ID)
+}
+
+// RegenerateRecoveryCodes 验证第二因素后生成新的恢复码，旧恢复码全部作废
+func (s *AuthService) RegenerateRecoveryCodes(user *User, code string) ([]string, *MFAResult, error) {
+	result, err := s.VerifySecondFactor(user, code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 重新读取，保留验证时更新的时间步
+	mfa, err := s.store.GetMFA(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	codes, hashes := newRecoveryCodes(s.mfa.RecoveryCodes)
+	mfa.RecoveryCodes = hashes
+
+	if err := s.store.SaveMFA(mfa); err != nil {
+		return nil, nil, err
+	}
+	return codes, result, nil
+}
+
+// ResetMFA 管理员清除用户的两步验证（例如丢失设备），策略要求的用户下次登录时重新注册
+func (s *AuthService) ResetMFA(userID string) error {
+	if _, err := s.store.GetUser(userID); err != nil {
+		return err
+	}
+	err := s.store.DeleteMFA(userID)
+	if errors.Is(err, ErrNotFound) {
+		return ErrMFANotEnabled
+	}
+	return err
+}
+
+// checkSecondFactor 密码验证通过后，用户启用了两步验证或被策略要求时创建第二因素登录挑战
+// 不需要第二因素时返回 nil
+func (s *AuthService) checkSecondFactor(user *User, scope string) error {
+	mfa, err := s.GetMFA(user.ID)
+	if err != nil {
+		return err
+	}
+
+	enabled := mfa != nil && mfa.Enabled
+	if !enabled && !s.MFARequired(user) {
+		return nil
+	}
+
+	challengeErr := &MFAChallengeError{Enroll: !enabled}
+	if challengeErr.Enroll {
+		if challengeErr.MFA, err = s.BeginTOTPEnrollment(user); err != nil {
+			return err
+		}
+	}
+
+	token := randomToken(32)
+	err = s.store.CreateMFAChallenge(&MFAChallenge{
+		Hash:      hashToken(token),
+		UserID:    user.ID,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(s.mfa.ChallengeTTL).UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	challengeErr.Token = token
+	return challengeErr
+}
+
+// PasswordLogin 浏览器登录的密码验证，需要第二因素时返回 *MFAChallengeError
+func (s *AuthService) PasswordLogin(username, password string) (*User, error) {
+	user, err := s.Authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSecondFactor(user, ""); err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// GetMFAChallenge 获取有效的第二因素登录挑战及其用户和两步验证状态
+func (s *AuthService) GetMFAChallenge(token string) (*MFAChallenge, *User, *MFA, error) {
+	challenge, err := s.store.GetMFAChallenge(hashToken(token))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil, nil, ErrMFAChallengeExpired
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		s.store.DeleteMFAChallenge(challenge.Hash)
+		return nil, nil, nil, ErrMFAChallengeExpired
+	}
+
+	user, err := s.store.GetUser(challenge.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil, nil, ErrMFAChallengeExpired
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if user.Disabled {
+		return nil, nil, nil, ErrUserDisabled
+	}
+
+	mfa, err := s.GetMFA(user.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if mfa == nil {
+		// 注册在挑战期间被管理员清除
+		return nil, nil, nil, ErrMFAChallengeExpired
+	}
+	return challenge, user, mfa, nil
+}
+
+// CompleteMFAChallenge 提交第二因素完成登录，挑战只能成功使用一次
+// 用户尚未启用两步验证时，验证码用于确认注册
+// 错误次数达到 AUTH_MFA_MAX_ATTEMPTS 时挑战作废，需要重新输入密码
+func (s *AuthService) CompleteMFAChallenge(token, code string) (*MFAChallenge, *User, *MFAResult, error) {
+	challenge, user, mfa, err := s.GetMFAChallenge(token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var result *MFAResult
+	if mfa.Enabled {
+		result, err = s.VerifySecondFactor(user, code)
+	} else {
+		var codes []string
+		codes, err = s.ConfirmTOTPEnrollment(user, code)
+		result = &MFAResult{Method: MFAMethodTOTP, Enrolled: true, RecoveryCodes: codes}
+	}
+
+	if errors.Is(err, ErrInvalidMFACode) || errors.Is(err, ErrMFACodeReused) {
+		attempts, attemptErr := s.store.AddMFAChallengeAttempt(challenge.Hash)
+		if errors.Is(attemptErr, ErrNotFound) {
+			return nil, user, nil, ErrMFAChallengeExpired
+		}
+		if attemptErr != nil {
+			return nil, user, nil, attemptErr
+		}
+		if attempts >= s.mfa.MaxAttempts {
+			s.store.DeleteMFAChallenge(challenge.Hash)
+			return challenge, user, nil, ErrMFATooManyAttempts
+		}
+		return challenge, user, nil, err
+	}
+	if err != nil {
+		return nil, user, nil, err
+	}
+
+	// 并发提交时只有一个请求能完成登录
+	if err := s.store.DeleteMFAChallenge(challenge.Hash); errors.Is(err, ErrNotFound) {
+		return nil, user, nil, ErrMFAChallengeExpired
+	} else if err != nil {
+		return nil, user, nil, err
+	}
+	return challenge, user, result, nil
+}
+
+// CompleteMFALogin 完成 /api/v1/login 的第二因素，签发令牌
+func (s *AuthService) CompleteMFALogin(token, code string) (*TokenResponse, *User, *MFAResult, error) {
+	challenge, user, result, err := s.CompleteMFAChallenge(token, code)
+	if err != nil {
+		return nil, user, nil, err
+	}
+
+	scopes := intersectScopes(strings.Fields(challenge.Scope), s.userScopes(user))
+	tokens, err := s.issueTokens(tokenGrant{User: user, Scopes: scopes, FamilyID: randomID(), AuthTime: time.Now()})
+	return tokens, user, result, err
+}
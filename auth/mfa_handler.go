@@ -0,0 +1,477 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// mfaCookieName 浏览器登录中等待第二因素的挑战令牌
+const mfaCookieName = "auth_mfa"
+
+// 两步验证审计事件（日志 event 字段）
+const (
+	mfaEventEnrollmentStarted       = "mfa.enrollment_started"
+	mfaEventEnrolled                = "mfa.enrolled"
+	mfaEventDisabled                = "mfa.disabled"
+	mfaEventReset                   = "mfa.reset"
+	mfaEventVerified                = "mfa.verified"
+	mfaEventFailed                  = "mfa.failed"
+	mfaEventRecoveryCodesRegenerate = "mfa.recovery_codes_regenerated"
+)
+
+// auditMFA 记录两步验证审计事件，失败事件为 WARN 级别
+func auditMFA(r *http.Request, message, event string, user *User, fields map[string]interface{}) {
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	fields["event"] = event
+	fields["user_id"] = user.ID
+	fields["remote_ip"] = getClientIP(r)
+
+	if event == mfaEventFailed {
+		GetLogger().WarnWithRequestID(getRequestID(r), message, fields)
+		return
+	}
+	GetLogger().InfoWithRequestID(getRequestID(r), message, fields)
+}
+
+// auditMFAResult 记录第二因素验证成功，使用恢复码时记录剩余数量
+func auditMFAResult(r *http.Request, user *User, result *MFAResult, fields map[string]interface{}) {
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	fields["method"] = result.Method
+	if result.Method == MFAMethodRecoveryCode {
+		fields["recovery_codes_remaining"] = result.Remaining
+	}
+	if result.Enrolled {
+		auditMFA(r, "TOTP enrolled", mfaEventEnrolled, user, fields)
+		return
+	}
+	auditMFA(r, "Second factor verified", mfaEventVerified, user, fields)
+}
+
+// auditMFAFailure 记录第二因素验证失败
+func auditMFAFailure(r *http.Request, user *User, err error) {
+	auditMFA(r, "Second factor verification failed", mfaEventFailed, user, map[string]interface{}{
+		"reason": err.Error(),
+	})
+}
+
+// isMFACodeError 验证码错误或被重放（计入失败次数的错误）
+func isMFACodeError(err error) bool {
+	return errors.Is(err, ErrInvalidMFACode) || errors.Is(err, ErrMFACodeReused) || errors.Is(err, ErrMFATooManyAttempts)
+}
+
+// writeMFAError 将两步验证的业务错误映射为 HTTP 响应
+func (h *Handler) writeMFAError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrMFACodeReused):
+		writeError(w, http.StatusBadRequest, "invalid_mfa_code", err.Error())
+	case errors.Is(err, ErrMFAAlreadyEnabled):
+		writeError(w, http.StatusConflict, "mfa_enabled", err.Error())
+	case errors.Is(err, ErrMFANotEnabled), errors.Is(err, ErrMFANotEnrolling):
+		writeError(w, http.StatusConflict, "mfa_not_enabled", err.Error())
+	case errors.Is(err, ErrMFARequiredByPolicy):
+		writeError(w, http.StatusForbidden, "mfa_required", err.Error())
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "user not found")
+	default:
+		h.serverError(w, r, "MFA error", err)
+	}
+}
+
+// authorizeUser 校验 Bearer 访问令牌并返回其用户，客户端凭证令牌被拒绝
+func (h *Handler) authorizeUser(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	token := bearerToken(r)
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="auth"`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", "missing bearer token")
+		return nil, false
+	}
+
+	_, user, err := h.service.VerifyAccessToken(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="auth", error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", err.Error())
+		return nil, false
+	}
+	if user == nil {
+		writeError(w, http.StatusForbidden, "invalid_token", "token is not bound to a user")
+		return nil, false
+	}
+	return user, true
+}
+
+type mfaCodeRequest struct {
+	MFAToken string `json:"mfa_token"` // 仅 /api/v1/login/mfa
+	Code     string `json:"code"`      // TOTP 验证码或恢复码
+}
+
+// mfaChallengeResponse /api/v1/login 需要第二因素时的响应
+type mfaChallengeResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	MFAToken         string `json:"mfa_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	TOTPSecret       string `json:"totp_secret,omitempty"` // 需要先注册时返回
+	OTPAuthURI       string `json:"otpauth_uri,omitempty"`
+}
+
+// writeMFAChallenge 返回第二因素挑战：已启用时为 mfa_required，需要注册时为 mfa_enrollment_required
+func (h *Handler) writeMFAChallenge(w http.ResponseWriter, r *http.Request, user *User, challenge *MFAChallengeError) {
+	response := mfaChallengeResponse{
+		Error:            "mfa_required",
+		ErrorDescription: "a verification code from the authenticator app is required",
+		MFAToken:         challenge.Token,
+		ExpiresIn:        int64(h.config.MFA.ChallengeTTL / time.Second),
+	}
+	if challenge.Enroll {
+		response.Error = "mfa_enrollment_required"
+		response.ErrorDescription = ErrMFARequiredByPolicy.Error() + ", add the key to an authenticator app and submit a code"
+		response.TOTPSecret = challenge.MFA.TOTPSecret
+		response.OTPAuthURI = h.service.TOTPURI(user, challenge.MFA)
+		auditMFA(r, "TOTP enrollment started", mfaEventEnrollmentStarted, user, map[string]interface{}{"required": true})
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusUnauthorized, response)
+}
+
+// LoginMFA 提交第二因素完成 /api/v1/login，需要注册时同时返回恢复码
+func (h *Handler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req mfaCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.MFAToken == "" || req.Code == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "mfa_token and code are required")
+		return
+	}
+
+	ip := getClientIP(r)
+	if throttle := h.guard.Check("", ip); throttle != nil {
+		writeThrottled(w, r, "", throttle)
+		return
+	}
+
+	tokens, user, result, err := h.service.CompleteMFALogin(req.MFAToken, req.Code)
+	if user != nil && isMFACodeError(err) {
+		auditMFAFailure(r, user, err)
+		h.recordLoginFailure(r, user.Username, ip)
+	}
+	switch {
+	case errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrMFACodeReused):
+		writeError(w, http.StatusUnauthorized, "invalid_mfa_code", err.Error())
+		return
+	case errors.Is(err, ErrMFATooManyAttempts), errors.Is(err, ErrMFAChallengeExpired), errors.Is(err, ErrUserDisabled):
+		writeError(w, http.StatusUnauthorized, "invalid_grant", ErrMFAChallengeExpired.Error())
+		return
+	case err != nil:
+		h.serverError(w, r, "MFA login error", err)
+		return
+	}
+
+	h.guard.Succeed(user.Username)
+	auditMFAResult(r, user, result, nil)
+	GetLogger().InfoWithRequestID(getRequestID(r), "Login succeeded", map[string]interface{}{
+		"user_id":   user.ID,
+		"mfa":       result.Method,
+		"remote_ip": ip,
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, http.StatusOK, struct {
+		*TokenResponse
+		RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	}{tokens, result.RecoveryCodes})
+}
+
+// MFAStatus 当前用户的两步验证状态
+func (h *Handler) MFAStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeUser(w, r)
+	if !ok {
+		return
+	}
+
+	mfa, err := h.service.GetMFA(user.ID)
+	if err != nil {
+		h.serverError(w, r, "Failed to load MFA", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"totp_enabled": mfa != nil && mfa.Enabled,
+		"required":     h.service.MFARequired(user),
+	}
+	if mfa != nil && mfa.Enabled {
+		response["enabled_at"] = mfa.EnabledAt.Format(time.RFC3339)
+		response["recovery_codes_remaining"] = len(mfa.RecoveryCodes)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// EnrollTOTP 开始注册 TOTP，返回密钥和 otpauth URI（二维码内容），需要再提交验证码确认
+func (h *Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeUser(w, r)
+	if !ok {
+		return
+	}
+
+	mfa, err := h.service.BeginTOTPEnrollment(user)
+	if err != nil {
+		h.writeMFAError(w, r, err)
+		return
+	}
+
+	auditMFA(r, "TOTP enrollment started", mfaEventEnrollmentStarted, user, nil)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]string{
+		"totp_secret": mfa.TOTPSecret,
+		"otpauth_uri": h.service.TOTPURI(user, mfa),
+	})
+}
+
+// ConfirmTOTP 用验证码确认注册，返回恢复码（只返回这一次）
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req mfaCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	codes, err := h.service.ConfirmTOTPEnrollment(user, req.Code)
+	if err != nil {
+		if isMFACodeError(err) {
+			auditMFAFailure(r, user, err)
+		}
+		h.writeMFAError(w, r, err)
+		return
+	}
+
+	auditMFAResult(r, user, &MFAResult{Method: MFAMethodTOTP, Enrolled: true}, nil)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// DisableTOTP 验证第二因素后关闭两步验证
+func (h *Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req mfaCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	result, err := h.service.DisableTOTP(user, req.Code)
+	if err != nil {
+		if isMFACodeError(err) {
+			auditMFAFailure(r, user, err)
+		}
+		h.writeMFAError(w, r, err)
+		return
+	}
+
+	auditMFA(r, "TOTP disabled", mfaEventDisabled, user, map[string]interface{}{"method": result.Method})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes 验证第二因素后生成新的恢复码
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req mfaCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	codes, result, err := h.service.RegenerateRecoveryCodes(user, req.Code)
+	if err != nil {
+		if isMFACodeError(err) {
+			auditMFAFailure(r, user, err)
+		}
+		h.writeMFAError(w, r, err)
+		return
+	}
+
+	auditMFA(r, "Recovery codes regenerated", mfaEventRecoveryCodesRegenerate, user, map[string]interface{}{"method": result.Method})
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// ResetUserMFA 管理员清除用户的两步验证（需要 admin 授权范围）
+func (h *Handler) ResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := h.service.ResetMFA(id); err != nil {
+		h.writeMFAError(w, r, err)
+		return
+	}
+
+	auditMFA(r, "MFA reset by admin", mfaEventReset, &User{ID: id}, map[string]interface{}{"by": claims["sub"]})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startMFALogin 浏览器登录密码正确但需要第二因素，保存挑战 cookie 并跳转到验证页
+func (h *Handler) startMFALogin(w http.ResponseWriter, r *http.Request, user *User, challenge *MFAChallengeError, returnTo string) {
+	if challenge.Enroll {
+		auditMFA(r, "TOTP enrollment started", mfaEventEnrollmentStarted, user, map[string]interface{}{"required": true})
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     mfaCookieName,
+		Value:    challenge.Token,
+		Path:     "/login/mfa",
+		Expires:  time.Now().Add(h.config.MFA.ChallengeTTL),
+		HttpOnly: true,
+		Secure:   h.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login/mfa?return_to="+url.QueryEscape(returnTo), http.StatusSeeOther)
+}
+
+// clearMFACookie 删除挑战 cookie
+func (h *Handler) clearMFACookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     mfaCookieName,
+		Value:    "",
+		Path:     "/login/mfa",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// mfaChallengeToken 读取挑战 cookie
+func mfaChallengeToken(r *http.Request) string {
+	if cookie, err := r.Cookie(mfaCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// renderMFAPage 渲染验证码页，用户尚未启用两步验证时同时展示注册密钥
+func (h *Handler) renderMFAPage(w http.ResponseWriter, r *http.Request, status int, user *User, mfa *MFA, returnTo, message string) {
+	data := pageData{
+		Title:    "Two-factor authentication",
+		Error:    message,
+		CSRF:     h.csrfToken(w, r),
+		ReturnTo: returnTo,
+		Username: user.Username,
+	}
+	if !mfa.Enabled {
+		data.Secret = mfa.TOTPSecret
+		data.OTPAuthURI = h.service.TOTPURI(user, mfa)
+	}
+	renderPage(w, status, "mfa", data)
+}
+
+// restartLogin 挑战失效时回到登录页重新输入密码
+func (h *Handler) restartLogin(w http.ResponseWriter, r *http.Request, status int, returnTo, message string) {
+	h.clearMFACookie(w)
+	renderPage(w, status, "login", pageData{
+		Title:    "Sign in",
+		Error:    message,
+		CSRF:     h.csrfToken(w, r),
+		ReturnTo: returnTo,
+	})
+}
+
+// MFAPage 浏览器登录的第二因素页
+func (h *Handler) MFAPage(w http.ResponseWriter, r *http.Request) {
+	returnTo := safeReturnTo(r.URL.Query().Get("return_to"))
+
+	_, user, mfa, err := h.service.GetMFAChallenge(mfaChallengeToken(r))
+	switch {
+	case errors.Is(err, ErrMFAChallengeExpired), errors.Is(err, ErrUserDisabled):
+		h.clearMFACookie(w)
+		http.Redirect(w, r, "/login?return_to="+url.QueryEscape(returnTo), http.StatusFound)
+		return
+	case err != nil:
+		h.serverError(w, r, "Failed to load MFA challenge", err)
+		return
+	}
+
+	h.renderMFAPage(w, r, http.StatusOK, user, mfa, returnTo, "")
+}
+
+// MFASubmit 提交第二因素，成功后建立会话；本次完成注册时先展示恢复码
+func (h *Handler) MFASubmit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := r.ParseForm(); err != nil || !h.checkCSRF(r) {
+		renderError(w, http.StatusBadRequest, "Invalid request", "The form has expired. Please start again.")
+		return
+	}
+
+	returnTo := safeReturnTo(r.PostFormValue("return_to"))
+	token := mfaChallengeToken(r)
+
+	ip := getClientIP(r)
+	if throttle := h.guard.Check("", ip); throttle != nil {
+		retryAfter := logThrottled(r, "", throttle)
+		w.Header().Set("Retry-After", fmt.Sprint(retryAfter))
+		renderError(w, http.StatusTooManyRequests, "Too many attempts",
+			fmt.Sprintf("Too many failed attempts. Please try again in %d seconds.", retryAfter))
+		return
+	}
+
+	_, user, result, err := h.service.CompleteMFAChallenge(token, r.PostFormValue("code"))
+	if user != nil && isMFACodeError(err) {
+		auditMFAFailure(r, user, err)
+		h.recordLoginFailure(r, user.Username, ip)
+	}
+	switch {
+	case errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrMFACodeReused):
+		_, user, mfa, err := h.service.GetMFAChallenge(token)
+		if err != nil {
+			h.restartLogin(w, r, http.StatusUnauthorized, returnTo, ErrMFAChallengeExpired.Error())
+			return
+		}
+		h.renderMFAPage(w, r, http.StatusUnauthorized, user, mfa, returnTo, "Invalid verification code.")
+		return
+	case errors.Is(err, ErrMFATooManyAttempts):
+		h.restartLogin(w, r, http.StatusUnauthorized, returnTo, "Too many invalid verification codes. Please sign in again.")
+		return
+	case errors.Is(err, ErrMFAChallengeExpired), errors.Is(err, ErrUserDisabled):
+		h.restartLogin(w, r, http.StatusUnauthorized, returnTo, "Your sign-in has expired. Please sign in again.")
+		return
+	case err != nil:
+		h.serverError(w, r, "MFA login error", err)
+		return
+	}
+
+	h.clearMFACookie(w)
+	if !h.startSession(w, r, user) {
+		return
+	}
+	auditMFAResult(r, user, result, map[string]interface{}{"session": true})
+
+	if result.Enrolled {
+		renderPage(w, http.StatusOK, "recovery_codes", pageData{
+			Title:         "Recovery codes",
+			ReturnTo:      returnTo,
+			RecoveryCodes: result.RecoveryCodes,
+		})
+		return
+	}
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// contextKey context key 类型
+type contextKey string
+
+// RequestIDKey 请求 ID 的 context key
+const RequestIDKey contextKey = "request_id"
+
+// trustProxyHeaders 是否信任 X-Forwarded-For / X-Real-IP（部署在网关之后时开启）
+var trustProxyHeaders bool
+
+// statusRecorder 记录响应状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (rw *statusRecorder) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// RequestIDMiddleware 请求 ID 中间件
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			b := make([]byte, 16)
+			rand.Read(b)
+			requestID = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), RequestIDKey, requestID)))
+	})
+}
+
+// LoggingMiddleware 访问日志中间件
+func LoggingMiddleware(logger *Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+
+			next.ServeHTTP(rw, r)
+
+			logger.InfoWithRequestID(getRequestID(r), "Request completed", map[string]interface{}{
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"status_code": rw.statusCode,
+				"duration_ms": time.Since(start).Milliseconds(),
+				"remote_ip":   getClientIP(r),
+			})
+		})
+	}
+}
+
+// RecoveryMiddleware panic 恢复中间件
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				GetLogger().ErrorWithRequestID(getRequestID(r), "Panic recovered", map[string]interface{}{
+					"error": err,
+					"path":  r.URL.Path,
+				})
+
+				writeError(w, http.StatusInternalServerError, "server_error", "internal server error")
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getRequestID 获取请求 ID
+func getRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(RequestIDKey).(string)
+	return requestID
+}
+
+// getClientIP 获取客户端 IP，仅在信任代理时读取转发头
+func getClientIP(r *http.Request) string {
+	if trustProxyHeaders {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			return strings.TrimSpace(strings.Split(xff, ",")[0])
+		}
+		if xri := r.Header.Get("X-Real-IP"); xri != "" {
+			return xri
+		}
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OAuth2 授权类型
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// OAuthError OAuth2 错误（RFC 6749 第 5.2 节）
+type OAuthError struct {
+	Code        string
+	Description string
+	Status      int
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(status int, code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description, Status: status}
+}
+
+var (
+	errInvalidClient        = oauthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	errUnauthorizedClient   = oauthError(http.StatusBadRequest, "unauthorized_client", "client is not allowed to use this grant type")
+	errInvalidAuthCode      = oauthError(http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+	errInvalidCodeVerifier  = oauthError(http.StatusBadRequest, "invalid_grant", "code_verifier does not match code_challenge")
+	errUnsupportedGrantType = oauthError(http.StatusBadRequest, "unsupported_grant_type", "unsupported grant_type")
+)
+
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// ClientConfig 客户端注册参数（客户端文件与管理 API 共用）
+type ClientConfig struct {
+	ID           string   `json:"client_id"`
+	Secret       string   `json:"client_secret,omitempty"` // 为空时为机密客户端生成随机密钥
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	GrantTypes   []string `json:"grant_types"` // 为空时使用默认授权类型
+	Public       bool     `json:"public"`
+	Trusted      bool     `json:"trusted"`
+
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris"` // OIDC 登出后的回调地址
+}
+
+// allowsGrant 检查客户端是否允许使用授权类型
+func (c *Client) allowsGrant(grantType string) bool {
+	for _, g := range c.GrantTypes {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRedirectURI 检查回调地址是否已注册（精确匹配）
+func (c *Client) hasRedirectURI(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPostLogoutRedirectURI 检查登出回调地址是否已注册（精确匹配）
+func (c *Client) hasPostLogoutRedirectURI(uri string) bool {
+	for _, registered := range c.PostLogoutRedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// buildClient 校验注册参数并生成客户端，返回明文密钥（公共客户端为空）
+func buildClient(config ClientConfig) (*Client, string, error) {
+	if config.ID == "" {
+		config.ID = randomID()
+	}
+	if config.Name == "" {
+		config.Name = config.ID
+	}
+
+	if len(config.GrantTypes) == 0 {
+		config.GrantTypes = []string{GrantAuthorizationCode, GrantRefreshToken}
+		if !config.Public {
+			config.GrantTypes = append(config.GrantTypes, GrantClientCredentials)
+		}
+	}
+	for _, grantType := range config.GrantTypes {
+		switch grantType {
+		case GrantAuthorizationCode, GrantRefreshToken:
+		case GrantClientCredentials:
+			if config.Public {
+				return nil, "", errors.New("public clients cannot use client_credentials")
+			}
+		default:
+			return nil, "", errors.New("unsupported grant type " + grantType)
+		}
+	}
+
+	for _, uri := range append(append([]string(nil), config.RedirectURIs...), config.PostLogoutRedirectURIs...) {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return nil, "", errors.New("redirect URI must be absolute without fragment: " + uri)
+		}
+	}
+	client := &Client{
+		ID:                     config.ID,
+		Name:                   config.Name,
+		RedirectURIs:           config.RedirectURIs,
+		PostLogoutRedirectURIs: config.PostLogoutRedirectURIs,
+		Scopes:                 config.Scopes,
+		GrantTypes:             config.GrantTypes,
+		Public:                 config.Public,
+		Trusted:                config.Trusted,
+	}
+	if client.allowsGrant(GrantAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return nil, "", errors.New("authorization_code clients need at least one redirect URI")
+	}
+
+	if config.Public {
+		if config.Secret != "" {
+			return nil, "", errors.New("public clients must not have a secret")
+		}
+		return client, "", nil
+	}
+
+	secret := config.Secret
+	if secret == "" {
+		secret = randomToken(32)
+	}
+	// 客户端密钥只做 SHA-256，要求足够长的随机串，不能使用可猜测的口令
+	if len(secret) < 32 {
+		return nil, "", errors.New("client secret must be at least 32 characters")
+	}
+	client.SecretHash = hashToken(secret)
+
+	return client, secret, nil
+}
+
+// RegisterClient 注册客户端
+func (s *AuthService) RegisterClient(config ClientConfig) (*Client, string, error) {
+	client, secret, err := buildClient(config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	client.CreatedAt = now
+	client.UpdatedAt = now
+
+	if err := s.store.CreateClient(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// UpdateClient 更新客户端配置，Secret 为空时保留原密钥
+func (s *AuthService) UpdateClient(config ClientConfig) (*Client, error) {
+	existing, err := s.store.GetClient(config.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	client, _, err := buildClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Secret == "" && !client.Public && existing.SecretHash != "" {
+		client.SecretHash = existing.SecretHash
+	}
+
+	client.CreatedAt = existing.CreatedAt
+	client.UpdatedAt = time.Now().UTC()
+
+	if err := s.store.UpdateClient(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// RotateClientSecret 为机密客户端生成新密钥，旧密钥立即失效
+func (s *AuthService) RotateClientSecret(id string) (*Client, string, error) {
+	client, err := s.store.GetClient(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if client.Public {
+		return nil, "", errors.New("public clients have no secret")
+	}
+
+	secret := randomToken(32)
+	client.SecretHash = hashToken(secret)
+	client.UpdatedAt = time.Now().UTC()
+
+	if err := s.store.UpdateClient(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// UpsertClient 客户端文件中的客户端：不存在时注册，存在时更新
+func (s *AuthService) UpsertClient(config ClientConfig) (*Client, bool, error) {
+	if _, err := s.store.GetClient(config.ID); errors.Is(err, ErrNotFound) {
+		client, _, err := s.RegisterClient(config)
+		return client, true, err
+	}
+
+	client, err := s.UpdateClient(config)
+	return client, false, err
+}
+
+// AuthenticateClient 校验客户端凭证，公共客户端不得携带密钥
+func (s *AuthService) AuthenticateClient(clientID, secret string) (*Client, error) {
+	client, err := s.store.GetClient(clientID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, errInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Public {
+		if secret != "" {
+			return nil, errInvalidClient
+		}
+		return client, nil
+	}
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, errInvalidClient
+	}
+	return client, nil
+}
+
+// AuthorizeRequest 授权请求参数
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+
+	// OIDC 参数
+	Nonce     string
+	Prompt    string
+	MaxAge    string
+	LoginHint string
+}
+
+// parseAuthorizeRequest 从查询参数解析授权请求
+func parseAuthorizeRequest(values url.Values) *AuthorizeRequest {
+	return &AuthorizeRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Nonce:               values.Get("nonce"),
+		Prompt:              values.Get("prompt"),
+		MaxAge:              values.Get("max_age"),
+		LoginHint:           values.Get("login_hint"),
+	}
+}
+
+// ValidateClientRedirect 校验授权请求的客户端和回调地址
+// 失败时不能重定向回客户端，只能直接向用户展示错误
+func (s *AuthService) ValidateClientRedirect(req *AuthorizeRequest) (*Client, *OAuthError) {
+	client, err := s.store.GetClient(req.ClientID)
+	if err != nil {
+		return nil, oauthError(http.StatusBadRequest, "invalid_client", "unknown client_id")
+	}
+	if req.RedirectURI == "" || !client.hasRedirectURI(req.RedirectURI) {
+		return nil, oauthError(http.StatusBadRequest, "invalid_request", "redirect_uri is missing or not registered for this client")
+	}
+	return client, nil
+}
+
+// ValidateAuthorizeRequest 校验授权请求的其余参数，返回请求的授权范围
+// 失败时通过回调地址返回错误
+func (s *AuthService) ValidateAuthorizeRequest(client *Client, req *AuthorizeRequest) ([]string, *OAuthError) {
+	if req.ResponseType != "code" {
+		return nil, oauthError(http.StatusBadRequest, "unsupported_response_type", "only response_type=code is supported")
+	}
+	if !client.allowsGrant(GrantAuthorizationCode) {
+		return nil, oauthError(http.StatusBadRequest, "unauthorized_client", "client is not allowed to use the authorization code flow")
+	}
+
+	// 公共客户端必须使用 PKCE，只接受 S256
+	if req.CodeChallenge == "" {
+		if client.Public {
+			return nil, oauthError(http.StatusBadRequest, "invalid_request", "code_challenge is required for public clients")
+		}
+	} else if req.CodeChallengeMethod != "S256" {
+		return nil, oauthError(http.StatusBadRequest, "invalid_request", "code_challenge_method must be S256")
+	}
+
+	if oerr := validateOIDCParams(req); oerr != nil {
+		return nil, oerr
+	}
+
+	requested := strings.Fields(req.Scope)
+	if !containsAll(client.Scopes, requested) {
+		return nil, oauthError(http.StatusBadRequest, "invalid_scope", "requested scope is not allowed for this client")
+	}
+	if len(requested) == 0 {
+		requested = client.Scopes
+	}
+	return requested, nil
+}
+
+// GrantableScopes 用户在授权请求中实际能获得的范围，OIDC 范围对所有用户开放；
+// requested 为空时结果为空
+func (s *AuthService) GrantableScopes(user *User, requested []string) []string {
+	return retainScopes(requested, append(s.userScopes(user), oidcScopes...))
+}
+
+// NeedsConsent 检查是否需要展示授权确认页
+func (s *AuthService) NeedsConsent(client *Client, user *User, scopes []string) (bool, error) {
+	if client.Trusted {
+		return false, nil
+	}
+
+	consent, err := s.store.GetConsent(user.ID, client.ID)
+	if errors.Is(err, ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !containsAll(consent.Scopes, scopes), nil
+}
+
+// GrantConsent 记录用户授权，与已有授权合并
+func (s *AuthService) GrantConsent(client *Client, user *User, scopes []string) error {
+	granted := scopes
+	if consent, err := s.store.GetConsent(user.ID, client.ID); err == nil {
+		granted = intersectScopes(nil, append(consent.Scopes, scopes...))
+	}
+
+	return s.store.SaveConsent(&Consent{
+		UserID:    user.ID,
+		ClientID:  client.ID,
+		Scopes:    granted,
+		GrantedAt: time.Now().UTC(),
+	})
+}
+
+// IssueAuthorizationCode 签发授权码
+func (s *AuthService) IssueAuthorizationCode(client *Client, user *User, session *Session, req *AuthorizeRequest, scopes []string) (string, error) {
+	code := randomToken(32)
+
+	err := s.store.CreateAuthorizationCode(&AuthorizationCode{
+		Hash:                hashToken(code),
+		ClientID:            client.ID,
+		UserID:              user.ID,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              scopes,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            session.AuthTime,
+		FamilyID:            randomID(),
+		ExpiresAt:           time.Now().Add(s.config.AuthorizationCodeTTL).UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeAuthorizationCode 用授权码换取令牌
+// 授权码被重放时吊销由它签发的刷新令牌（RFC 6749 第 4.1.2 节）
+func (s *AuthService) ExchangeAuthorizationCode(client *Client, code, redirectURI, codeVerifier string) (*TokenResponse, *AuthorizationCode, error) {
+	if !client.allowsGrant(GrantAuthorizationCode) {
+		return nil, nil, errUnauthorizedClient
+	}
+
+	authCode, err := s.store.ConsumeAuthorizationCode(hashToken(code))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, nil, errInvalidAuthCode
+	case errors.Is(err, ErrTokenReused):
+		if authCode.ClientID == client.ID {
+			if revokeErr := s.store.RevokeRefreshTokenFamily(authCode.FamilyID); revokeErr != nil {
+				return nil, authCode, revokeErr
+			}
+		}
+		return nil, authCode, ErrTokenReused
+	case err != nil:
+		return nil, nil, err
+	}
+
+	if authCode.ClientID != client.ID || authCode.RedirectURI != redirectURI || time.Now().After(authCode.ExpiresAt) {
+		return nil, authCode, errInvalidAuthCode
+	}
+
+	if authCode.CodeChallenge != "" {
+		if !codeVerifierPattern.MatchString(codeVerifier) {
+			return nil, authCode, errInvalidCodeVerifier
+		}
+		sum := sha256.Sum256([]byte(codeVerifier))
+		challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+		if subtle.ConstantTimeCompare([]byte(challenge), []byte(authCode.CodeChallenge)) != 1 {
+			return nil, authCode, errInvalidCodeVerifier
+		}
+	} else if codeVerifier != "" {
+		return nil, authCode, errInvalidCodeVerifier
+	}
+
+	user, err := s.store.GetUser(authCode.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, authCode, errInvalidAuthCode
+	}
+	if err != nil {
+		return nil, authCode, err
+	}
+	if user.Disabled {
+		return nil, authCode, errInvalidAuthCode
+	}
+
+	grant := tokenGrant{
+		User:     user,
+		ClientID: client.ID,
+		Scopes:   authCode.Scopes,
+		AuthTime: authCode.AuthTime,
+		Nonce:    authCode.Nonce,
+	}
+	if client.allowsGrant(GrantRefreshToken) {
+		grant.FamilyID = authCode.FamilyID
+	}
+
+	tokens, err := s.issueTokens(grant)
+	return tokens, authCode, err
+}
+
+// ClientCredentials 客户端凭证模式，令牌代表客户端本身
+func (s *AuthService) ClientCredentials(client *Client, scope string) (*TokenResponse, error) {
+	if client.Public || !client.allowsGrant(GrantClientCredentials) {
+		return nil, errUnauthorizedClient
+	}
+
+	requested := strings.Fields(scope)
+	if !containsAll(client.Scopes, requested) {
+		return nil, oauthError(http.StatusBadRequest, "invalid_scope", "requested scope is not allowed for this client")
+	}
+
+	return s.issueTokens(tokenGrant{
+		ClientID: client.ID,
+		Scopes:   intersectScopes(requested, client.Scopes),
+	})
+}
+
+// Introspect 令牌自省（RFC 7662），无效令牌只返回 {"active": false}
+func (s *AuthService) Introspect(token, tokenTypeHint string) (map[string]interface{}, error) {
+	inactive := map[string]interface{}{"active": false}
+
+	introspectAccess := func() (map[string]interface{}, error) {
+		claims, user, err := s.VerifyAccessToken(token)
+		if err != nil {
+			if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrUserDisabled) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		result := map[string]interface{}{
+			"active":     true,
+			"token_type": "Bearer",
+		}
+		for _, claim := range []string{"scope", "client_id", "sub", "aud", "iss", "exp", "iat", "nbf", "jti", "roles"} {
+			if value, ok := claims[claim]; ok {
+				result[claim] = value
+			}
+		}
+		if user != nil {
+			result["username"] = user.Username
+		}
+		return result, nil
+	}
+
+	introspectRefresh := func() (map[string]interface{}, error) {
+		refresh, err := s.store.GetRefreshToken(hashToken(token))
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if refresh.Used || refresh.Revoked || time.Now().After(refresh.ExpiresAt) {
+			return nil, nil
+		}
+
+		user, err := s.store.GetUser(refresh.UserID)
+		if err != nil || user.Disabled {
+			return nil, nil
+		}
+
+		result := map[string]interface{}{
+			"active":     true,
+			"token_type": "refresh_token",
+			"sub":        refresh.UserID,
+			"username":   user.Username,
+			"iss":        s.config.Issuer,
+			"iat":        refresh.CreatedAt.Unix(),
+			"exp":        refresh.ExpiresAt.Unix(),
+		}
+		if len(refresh.Scopes) > 0 {
+			result["scope"] = strings.Join(refresh.Scopes, " ")
+		}
+		if refresh.ClientID != "" {
+			result["client_id"] = refresh.ClientID
+		}
+		return result, nil
+	}
+
+	// 按提示的类型优先查找，找不到时再尝试另一种（RFC 7662 第 2.1 节）
+	lookups := []func() (map[string]interface{}, error){introspectAccess, introspectRefresh}
+	if tokenTypeHint == "refresh_token" {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		result, err := lookup()
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			return result, nil
+		}
+	}
+	return inactive, nil
+}
+
+// RevokeToken 令牌吊销（RFC 7009），只能吊销签发给该客户端的令牌，未知令牌不视为错误
+func (s *AuthService) RevokeToken(client *Client, token, tokenTypeHint string) error {
+	revokeRefresh := func() (bool, error) {
+		refresh, err := s.store.GetRefreshToken(hashToken(token))
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if refresh.ClientID != client.ID {
+			return true, nil
+		}
+		return true, s.store.RevokeRefreshTokenFamily(refresh.FamilyID)
+	}
+
+	revokeAccess := func() (bool, error) {
+		claims, err := s.signer.Verify(token, TokenTypeAccess)
+		if err != nil {
+			return false, nil
+		}
+		if clientID, _ := claims["client_id"].(string); clientID != client.ID {
+			return true, nil
+		}
+
+		jti, _ := claims["jti"].(string)
+		exp, _ := claims["exp"].(float64)
+		if jti == "" {
+			return true, nil
+		}
+		return true, s.store.RevokeAccessToken(jti, time.Unix(int64(exp), 0).UTC())
+	}
+
+	lookups := []func() (bool, error){revokeRefresh, revokeAccess}
+	if tokenTypeHint == "access_token" {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		found, err := lookup()
+		if err != nil || found {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Authorize 授权端点（GET 发起授权，POST 提交授权确认）
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	rawQuery := r.URL.RawQuery
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		if err := r.ParseForm(); err != nil || !h.checkCSRF(r) {
+			renderError(w, http.StatusBadRequest, "Invalid request", "The form has expired. Please start again.")
+			return
+		}
+		rawQuery = r.PostFormValue("request")
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		renderError(w, http.StatusBadRequest, "Invalid request", "Malformed authorization request.")
+		return
+	}
+	req := parseAuthorizeRequest(query)
+
+	client, oerr := h.service.ValidateClientRedirect(req)
+	if oerr != nil {
+		renderError(w, oerr.Status, "Invalid request", oerr.Description)
+		return
+	}
+
+	scopes, oerr := h.service.ValidateAuthorizeRequest(client, req)
+	if oerr != nil {
+		redirectWithError(w, r, req, oerr.Code, oerr.Description, h.config.Token.Issuer)
+		return
+	}
+
+	// 未登录或需要重新登录时先跳转登录页，登录后回到授权请求
+	session, user := h.currentSession(r)
+	if user == nil || (r.Method == http.MethodGet && req.requiresLogin(session)) {
+		if req.hasPrompt(PromptNone) {
+			redirectWithError(w, r, req, "login_required", "the user is not signed in", h.config.Token.Issuer)
+			return
+		}
+
+		login := url.Values{}
+		login.Set("return_to", "/oauth/authorize?"+reauthenticationQuery(query).Encode())
+		if req.LoginHint != "" {
+			login.Set("login_hint", req.LoginHint)
+		}
+		if user != nil {
+			login.Set("prompt", PromptLogin)
+		}
+		http.Redirect(w, r, "/login?"+login.Encode(), http.StatusFound)
+		return
+	}
+
+	scopes = h.service.GrantableScopes(user, scopes)
+	if len(scopes) == 0 {
+		redirectWithError(w, r, req, "invalid_scope", "none of the requested scopes can be granted to this user", h.config.Token.Issuer)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if r.PostFormValue("decision") != "allow" {
+			GetLogger().InfoWithRequestID(getRequestID(r), "Authorization denied", map[string]interface{}{
+				"user_id":   user.ID,
+				"client_id": client.ID,
+			})
+			redirectWithError(w, r, req, "access_denied", "the user denied the request", h.config.Token.Issuer)
+			return
+		}
+		if err := h.service.GrantConsent(client, user, scopes); err != nil {
+			h.serverError(w, r, "Failed to save consent", err)
+			return
+		}
+	} else {
+		needsConsent, err := h.service.NeedsConsent(client, user, scopes)
+		if err != nil {
+			h.serverError(w, r, "Failed to load consent", err)
+			return
+		}
+		if needsConsent && req.hasPrompt(PromptNone) {
+			redirectWithError(w, r, req, "consent_required", "the user has not granted the requested scopes", h.config.Token.Issuer)
+			return
+		}
+		if needsConsent || req.hasPrompt(PromptConsent) {
+			renderPage(w, http.StatusOK, "consent", pageData{
+				Title:      "Authorize " + client.Name,
+				CSRF:       h.csrfToken(w, r),
+				Username:   user.Username,
+				ClientName: client.Name,
+				Scopes:     scopes,
+				Request:    rawQuery,
+			})
+			return
+		}
+	}
+
+	code, err := h.service.IssueAuthorizationCode(client, user, session, req, scopes)
+	if err != nil {
+		h.serverError(w, r, "Failed to issue authorization code", err)
+		return
+	}
+
+	GetLogger().InfoWithRequestID(getRequestID(r), "Authorization code issued", map[string]interface{}{
+		"user_id":   user.ID,
+		"client_id": client.ID,
+		"scopes":    scopes,
+	})
+
+	params := url.Values{}
+	params.Set("code", code)
+	redirectToClient(w, r, req, params, h.config.Token.Issuer)
+}
+
+// Token 令牌端点
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	var (
+		tokens *TokenResponse
+		err    error
+	)
+
+	switch grantType := r.PostFormValue("grant_type"); grantType {
+	case GrantAuthorizationCode:
+		var code *AuthorizationCode
+		tokens, code, err = h.service.ExchangeAuthorizationCode(client,
+			r.PostFormValue("code"), r.PostFormValue("redirect_uri"), r.PostFormValue("code_verifier"))
+		if errors.Is(err, ErrTokenReused) {
+			GetLogger().WarnWithRequestID(getRequestID(r), "Authorization code reuse detected, tokens revoked", map[string]interface{}{
+				"client_id": client.ID,
+				"user_id":   code.UserID,
+				"remote_ip": getClientIP(r),
+			})
+			err = errInvalidAuthCode
+		}
+
+	case GrantRefreshToken:
+		if !client.allowsGrant(GrantRefreshToken) {
+			err = errUnauthorizedClient
+			break
+		}
+		var old *RefreshToken
+		tokens, old, err = h.service.Refresh(r.PostFormValue("refresh_token"), client, r.PostFormValue("scope"))
+		switch {
+		case errors.Is(err, ErrTokenReused):
+			GetLogger().WarnWithRequestID(getRequestID(r), "Refresh token reuse detected, family revoked", map[string]interface{}{
+				"client_id": client.ID,
+				"user_id":   old.UserID,
+				"family_id": old.FamilyID,
+				"remote_ip": getClientIP(r),
+			})
+			err = oauthError(http.StatusBadRequest, "invalid_grant", ErrInvalidGrant.Error())
+		case errors.Is(err, ErrInvalidGrant), errors.Is(err, ErrUserDisabled):
+			err = oauthError(http.StatusBadRequest, "invalid_grant", ErrInvalidGrant.Error())
+		case errors.Is(err, ErrInvalidScope):
+			err = oauthError(http.StatusBadRequest, "invalid_scope", err.Error())
+		}
+
+	case GrantClientCredentials:
+		tokens, err = h.service.ClientCredentials(client, r.PostFormValue("scope"))
+
+	default:
+		err = errUnsupportedGrantType
+	}
+
+	var oerr *OAuthError
+	if errors.As(err, &oerr) {
+		writeError(w, oerr.Status, oerr.Code, oerr.Description)
+		return
+	}
+	if err != nil {
+		h.serverError(w, r, "Token error", err)
+		return
+	}
+
+	writeTokens(w, tokens)
+}
+
+// Introspect 令牌自省端点（RFC 7662），仅机密客户端可调用
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	if client.Public {
+		writeError(w, http.StatusUnauthorized, errInvalidClient.Code, "public clients cannot introspect tokens")
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	result, err := h.service.Introspect(token, r.PostFormValue("token_type_hint"))
+	if err != nil {
+		h.serverError(w, r, "Introspection error", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Revoke 令牌吊销端点（RFC 7009）
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	if err := h.service.RevokeToken(client, token, r.PostFormValue("token_type_hint")); err != nil {
+		h.serverError(w, r, "Revocation error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// AuthorizationServerMetadata 授权服务器元数据（RFC 8414）
+func (h *Handler) AuthorizationServerMetadata(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.serverMetadata())
+}
+
+func (h *Handler) serverMetadata() map[string]interface{} {
+	issuer := h.config.Token.Issuer
+
+	return map[string]interface{}{
+		"issuer":                                         issuer,
+		"authorization_endpoint":                         issuer + "/oauth/authorize",
+		"token_endpoint":                                 issuer + "/oauth/token",
+		"introspection_endpoint":                         issuer + "/oauth/introspect",
+		"revocation_endpoint":                            issuer + "/oauth/revoke",
+		"jwks_uri":                                       issuer + "/.well-known/jwks.json",
+		"response_types_supported":                       []string{"code"},
+		"grant_types_supported":                          []string{GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken},
+		"code_challenge_methods_supported":               []string{"S256"},
+		"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
+		"introspection_endpoint_auth_methods_supported":  []string{"client_secret_basic", "client_secret_post"},
+		"revocation_endpoint_auth_methods_supported":     []string{"client_secret_basic", "client_secret_post", "none"},
+		"authorization_response_iss_parameter_supported": true,
+	}
+}
+
+// authenticateClient 解析表单并校验客户端凭证（client_secret_basic / client_secret_post / none）
+func (h *Handler) authenticateClient(w http.ResponseWriter, r *http.Request) (*Client, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return nil, false
+	}
+
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 第 2.3.1 节：Basic 凭证先做表单编码
+		var err1, err2 error
+		clientID, err1 = url.QueryUnescape(clientID)
+		secret, err2 = url.QueryUnescape(secret)
+		if err1 != nil || err2 != nil {
+			basic = false
+			clientID = ""
+		}
+		if r.PostForm.Get("client_secret") != "" {
+			writeError(w, http.StatusBadRequest, "invalid_request", "multiple client authentication methods")
+			return nil, false
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+		writeError(w, http.StatusUnauthorized, errInvalidClient.Code, "client authentication is required")
+		return nil, false
+	}
+
+	client, err := h.service.AuthenticateClient(clientID, secret)
+	if err != nil {
+		var oerr *OAuthError
+		if !errors.As(err, &oerr) {
+			h.serverError(w, r, "Client authentication error", err)
+			return nil, false
+		}
+
+		GetLogger().WarnWithRequestID(getRequestID(r), "Client authentication failed", map[string]interface{}{
+			"client_id": clientID,
+			"path":      r.URL.Path,
+			"remote_ip": getClientIP(r),
+		})
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+		}
+		writeError(w, oerr.Status, oerr.Code, oerr.Description)
+		return nil, false
+	}
+
+	return client, true
+}
+
+// redirectToClient 带参数重定向回客户端回调地址，附带 state 和 iss（RFC 9207）
+func redirectToClient(w http.ResponseWriter, r *http.Request, req *AuthorizeRequest, params url.Values, issuer string) {
+	target, _ := url.Parse(req.RedirectURI)
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", issuer)
+	target.RawQuery = query.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// redirectWithError 通过回调地址返回授权错误
+func redirectWithError(w http.ResponseWriter, r *http.Request, req *AuthorizeRequest, code, description, issuer string) {
+	params := url.Values{}
+	params.Set("error", code)
+	params.Set("error_description", description)
+	redirectToClient(w, r, req, params, issuer)
+}
+
+// clientResponse 对外展示的客户端信息（不含密钥哈希）
+type clientResponse struct {
+	ID           string   `json:"client_id"`
+	Secret       string   `json:"client_secret,omitempty"` // 仅在创建和轮换密钥时返回
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+	GrantTypes   []string `json:"grant_types"`
+	Public       bool     `json:"public"`
+	Trusted      bool     `json:"trusted"`
+	CreatedAt    string   `json:"created_at"`
+
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+}
+
+func newClientResponse(client *Client, secret string) clientResponse {
+	return clientResponse{
+		ID:           client.ID,
+		Secret:       secret,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		GrantTypes:   client.GrantTypes,
+		Public:       client.Public,
+		Trusted:      client.Trusted,
+		CreatedAt:    client.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+
+		PostLogoutRedirectURIs: client.PostLogoutRedirectURIs,
+	}
+}
+
+// ListClients 列出客户端
+func (h *Handler) ListClients(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, "admin"); !ok {
+		return
+	}
+
+	clients, err := h.service.store.ListClients()
+	if err != nil {
+		h.serverError(w, r, "Failed to list clients", err)
+		return
+	}
+
+	response := make([]clientResponse, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, newClientResponse(client, ""))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// CreateClient 注册客户端，响应中返回一次明文密钥
+func (h *Handler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	var req ClientConfig
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	client, secret, err := h.service.RegisterClient(req)
+	if errors.Is(err, ErrConflict) {
+		writeError(w, http.StatusConflict, "client_exists", "client_id is already registered")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+
+	GetLogger().InfoWithRequestID(getRequestID(r), "Client registered", map[string]interface{}{
+		"client_id": client.ID,
+		"by":        claims["sub"],
+	})
+
+	writeJSON(w, http.StatusCreated, newClientResponse(client, secret))
+}
+
+// GetClient 获取客户端
+func (h *Handler) GetClient(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, "admin"); !ok {
+		return
+	}
+
+	client, err := h.service.store.GetClient(r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "client not found")
+		return
+	}
+	if err != nil {
+		h.serverError(w, r, "Failed to load client", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newClientResponse(client, ""))
+}
+
+// UpdateClient 更新客户端配置，未提供 client_secret 时保留原密钥
+func (h *Handler) UpdateClient(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	var req ClientConfig
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.ID = r.PathValue("id")
+
+	client, err := h.service.UpdateClient(req)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "client not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+
+	GetLogger().InfoWithRequestID(getRequestID(r), "Client updated", map[string]interface{}{
+		"client_id": client.ID,
+		"by":        claims["sub"],
+	})
+
+	writeJSON(w, http.StatusOK, newClientResponse(client, ""))
+}
+
+// RotateClientSecret 轮换客户端密钥
+func (h *Handler) RotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	client, secret, err := h.service.RotateClientSecret(r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "client not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	GetLogger().InfoWithRequestID(getRequestID(r), "Client secret rotated", map[string]interface{}{
+		"client_id": client.ID,
+		"by":        claims["sub"],
+	})
+
+	writeJSON(w, http.StatusOK, newClientResponse(client, secret))
+}
+
+// DeleteClient 删除客户端，其刷新令牌和授权记录一并删除
+func (h *Handler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	err := h.service.store.DeleteClient(id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "client not found")
+		return
+	}
+	if err != nil {
+		h.serverError(w, r, "Failed to delete client", err)
+		return
+	}
+
+	GetLogger().InfoWithRequestID(getRequestID(r), "Client deleted", map[string]interface{}{
+		"client_id": id,
+		"by":        claims["sub"],
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireScope 校验 Bearer 访问令牌拥有指定授权范围
+func (h *Handler) requireScope(w http.ResponseWriter, r *http.Request, scope string) (map[string]interface{}, bool) {
+	claims, _, ok := h.authorizeBearer(w, r, scope)
+	return claims, ok
+}
+
+// authorizeBearer 校验 Bearer 访问令牌拥有指定授权范围，返回声明和令牌对应的用户
+func (h *Handler) authorizeBearer(w http.ResponseWriter, r *http.Request, scope string) (map[string]interface{}, *User, bool) {
+	token := bearerToken(r)
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="auth"`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", "missing bearer token")
+		return nil, nil, false
+	}
+
+	claims, user, err := h.service.VerifyAccessToken(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="auth", error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", err.Error())
+		return nil, nil, false
+	}
+
+	scopes, _ := claims["scope"].(string)
+	if !containsAll(strings.Fields(scopes), []string{scope}) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="auth", error="insufficient_scope", scope="`+scope+`"`)
+		writeError(w, http.StatusForbidden, "insufficient_scope", "the "+scope+" scope is required")
+		return nil, nil, false
+	}
+
+	return claims, user, true
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testCodeChallenge = BASE64URL(SHA256(testCodeVerifier))
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mJ92K9uEJ4EZ7Lw8ucwRLgwX6tQ-Vw"
+	testCodeChallenge = "jPIwlCPyPhbmae8uXqwOq2ynxfighpE84YGweb7y94Y"
+	testRedirectURI   = "https://app.example.com/callback"
+)
+
+func newTestClient(t *testing.T, service *AuthService, id string, public bool) *Client {
+	t.Helper()
+	client, _, err := service.RegisterClient(ClientConfig{
+		ID:           id,
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{"read"},
+		Public:       public,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// authorize 走一遍授权端点的校验并签发授权码
+func authorize(t *testing.T, service *AuthService, user *User, req *AuthorizeRequest) (string, *OAuthError) {
+	t.Helper()
+	client, oerr := service.ValidateClientRedirect(req)
+	if oerr != nil {
+		return "", oerr
+	}
+	scopes, oerr := service.ValidateAuthorizeRequest(client, req)
+	if oerr != nil {
+		return "", oerr
+	}
+	_, session, err := service.CreateSession(user, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := service.IssueAuthorizationCode(client, user, session, req, service.GrantableScopes(user, scopes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, nil
+}
+
+func pkceRequest(clientID string) *AuthorizeRequest {
+	return &AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               "read",
+		CodeChallenge:       testCodeChallenge,
+		CodeChallengeMethod: "S256",
+	}
+}
+
+func TestAuthorizationCodeWithPKCE(t *testing.T) {
+	service := newTestService(t)
+	user := newTestUser(t, service, "alice", "read")
+	client := newTestClient(t, service, "spa", true)
+
+	code, oerr := authorize(t, service, user, pkceRequest("spa"))
+	if oerr != nil {
+		t.Fatal(oerr)
+	}
+	tokens, _, err := service.ExchangeAuthorizationCode(client, code, testRedirectURI, testCodeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.Scope != "read" || tokens.RefreshToken == "" {
+		t.Errorf("tokens: scope = %q, refresh token issued = %v", tokens.Scope, tokens.RefreshToken != "")
+	}
+	if _, _, err := service.VerifyAccessToken(tokens.AccessToken); err != nil {
+		t.Errorf("access token: %v", err)
+	}
+}
+
+func TestPKCEVerifierMismatch(t *testing.T) {
+	service := newTestService(t)
+	user := newTestUser(t, service, "alice", "read")
+	client := newTestClient(t, service, "spa", true)
+
+	for name, verifier := range map[string]string{
+		"missing":   "",
+		"wrong":     "xBjftJeZ4CVP-mJ92K9uEJ4EZ7Lw8ucwRLgwX6tQ-Vw",
+		"challenge": testCodeChallenge, // 把 code_challenge 当作 verifier 提交（plain 方法）
+		"too short": "abc",
+	} {
+		code, oerr := authorize(t, service, user, pkceRequest("spa"))
+		if oerr != nil {
+			t.Fatal(oerr)
+		}
+		if _, _, err := service.ExchangeAuthorizationCode(client, code, testRedirectURI, verifier); err != errInvalidCodeVerifier {
+			t.Errorf("%s verifier: err = %v, want %v", name, err, errInvalidCodeVerifier)
+		}
+	}
+}
+
+func TestAuthorizeRequiresS256ForPublicClients(t *testing.T) {
+	service := newTestService(t)
+	user := newTestUser(t, service, "alice", "read")
+	newTestClient(t, service, "spa", true)
+	confidential := newTestClient(t, service, "web", false)
+
+	noChallenge := pkceRequest("spa")
+	noChallenge.CodeChallenge, noChallenge.CodeChallengeMethod = "", ""
+	plain := pkceRequest("spa")
+	plain.CodeChallengeMethod = "plain"
+
+	for name, req := range map[string]*AuthorizeRequest{"no challenge": noChallenge, "plain": plain} {
+		if _, oerr := authorize(t, service, user, req); oerr == nil || oerr.Code != "invalid_request" {
+			t.Errorf("%s: err = %v, want invalid_request", name, oerr)
+		}
+	}
+
+	// 机密客户端可以不使用 PKCE，但此时不能提交 verifier
+	req := pkceRequest("web")
+	req.CodeChallenge, req.CodeChallengeMethod = "", ""
+	code, oerr := authorize(t, service, user, req)
+	if oerr != nil {
+		t.Fatal(oerr)
+	}
+	if _, _, err := service.ExchangeAuthorizationCode(confidential, code, testRedirectURI, testCodeVerifier); err != errInvalidCodeVerifier {
+		t.Errorf("unexpected verifier: err = %v, want %v", err, errInvalidCodeVerifier)
+	}
+}
+
+func TestRedirectURIMismatch(t *testing.T) {
+	service := newTestService(t)
+	user := newTestUser(t, service, "alice", "read")
+	client := newTestClient(t, service, "spa", true)
+
+	// 授权端点只接受精确匹配的已注册地址
+	for _, uri := range []string{"", "https://app.example.com/callback/", "https://app.example.com/callback?x=1", "https://evil.example.com/callback"} {
+		req := pkceRequest("spa")
+		req.RedirectURI = uri
+		if _, oerr := authorize(t, service, user, req); oerr == nil || oerr.Code != "invalid_request" {
+			t.Errorf("redirect_uri %q: err = %v, want invalid_request", uri, oerr)
+		}
+	}
+
+	// 令牌端点的 redirect_uri 必须与授权请求一致
+	code, oerr := authorize(t, service, user, pkceRequest("spa"))
+	if oerr != nil {
+		t.Fatal(oerr)
+	}
+	if _, _, err := service.ExchangeAuthorizationCode(client, code, "https://app.example.com/other", testCodeVerifier); err != errInvalidAuthCode {
+		t.Errorf("exchange with another redirect_uri: err = %v, want %v", err, errInvalidAuthCode)
+	}
+}
+
+func TestAuthorizationCodeReplayRevokesFamily(t *testing.T) {
+	service := newTestService(t)
+	user := newTestUser(t, service, "alice", "read")
+	client := newTestClient(t, service, "spa", true)
+	other := newTestClient(t, service, "other", true)
+
+	code, oerr := authorize(t, service, user, pkceRequest("spa"))
+	if oerr != nil {
+		t.Fatal(oerr)
+	}
+	tokens, _, err := service.ExchangeAuthorizationCode(client, code, testRedirectURI, testCodeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他客户端提交该授权码不会吊销合法客户端的令牌
+	if _, _, err := service.ExchangeAuthorizationCode(other, code, testRedirectURI, testCodeVerifier); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("replay by another client: err = %v, want ErrTokenReused", err)
+	}
+	rotated, _, err := service.Refresh(tokens.RefreshToken, client, "")
+	if err != nil {
+		t.Fatalf("refresh after foreign replay: %v", err)
+	}
+
+	// 授权码被重放：拒绝并吊销由它签发的刷新令牌 family
+	if _, _, err := service.ExchangeAuthorizationCode(client, code, testRedirectURI, testCodeVerifier); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("replay: err = %v, want ErrTokenReused", err)
+	}
+	if _, _, err := service.Refresh(rotated.RefreshToken, client, ""); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("refresh after code replay: err = %v, want ErrInvalidGrant", err)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OIDC 授权范围
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// oidcScopes 与用户权限无关的 OIDC 范围，只决定返回哪些用户声明
+var oidcScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// prompt 参数取值（OIDC Core 第 3.1.2.1 节）
+const (
+	PromptNone          = "none"
+	PromptLogin         = "login"
+	PromptConsent       = "consent"
+	PromptSelectAccount = "select_account"
+)
+
+// validateOIDCParams 校验授权请求中的 prompt 和 max_age
+func validateOIDCParams(req *AuthorizeRequest) *OAuthError {
+	prompts := strings.Fields(req.Prompt)
+	for _, prompt := range prompts {
+		switch prompt {
+		case PromptLogin, PromptConsent, PromptSelectAccount:
+		case PromptNone:
+			if len(prompts) > 1 {
+				return oauthError(http.StatusBadRequest, "invalid_request", "prompt=none cannot be combined with other values")
+			}
+		default:
+			return oauthError(http.StatusBadRequest, "invalid_request", "unsupported prompt value "+prompt)
+		}
+	}
+
+	if req.MaxAge != "" {
+		if maxAge, err := strconv.Atoi(req.MaxAge); err != nil || maxAge < 0 {
+			return oauthError(http.StatusBadRequest, "invalid_request", "max_age must be a non-negative integer")
+		}
+	}
+	return nil
+}
+
+// hasPrompt 检查授权请求是否包含指定的 prompt 值
+func (req *AuthorizeRequest) hasPrompt(prompt string) bool {
+	for _, p := range strings.Fields(req.Prompt) {
+		if p == prompt {
+			return true
+		}
+	}
+	return false
+}
+
+// requiresLogin 检查是否必须重新输入密码：prompt=login/select_account，或登录时间超过 max_age
+func (req *AuthorizeRequest) requiresLogin(session *Session) bool {
+	if req.hasPrompt(PromptLogin) || req.hasPrompt(PromptSelectAccount) {
+		return true
+	}
+	if req.MaxAge != "" {
+		maxAge, _ := strconv.Atoi(req.MaxAge)
+		return time.Since(session.AuthTime) > time.Duration(maxAge)*time.Second
+	}
+	return false
+}
+
+// reauthenticationQuery 重新登录后回到授权端点使用的查询参数
+// 去掉 prompt=login/select_account 和 max_age，否则登录后会再次要求登录
+func reauthenticationQuery(values url.Values) url.Values {
+	query := url.Values{}
+	for key, v := range values {
+		query[key] = v
+	}
+	query.Del("max_age")
+
+	var prompts []string
+	for _, prompt := range strings.Fields(values.Get("prompt")) {
+		if prompt != PromptLogin && prompt != PromptSelectAccount {
+			prompts = append(prompts, prompt)
+		}
+	}
+	if len(prompts) > 0 {
+		query.Set("prompt", strings.Join(prompts, " "))
+	} else {
+		query.Del("prompt")
+	}
+	return query
+}
+
+// userClaims 按授权范围返回用户声明（ID 令牌和 userinfo 共用）
+func userClaims(user *User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.ID}
+
+	if containsAll(scopes, []string{ScopeProfile}) {
+		claims["preferred_username"] = user.Username
+		if user.Name != "" {
+			claims["name"] = user.Name
+		}
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if containsAll(scopes, []string{ScopeEmail}) && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	return claims
+}
+
+// issueIDToken 签发 ID 令牌（OIDC Core 第 2 节），有效期与访问令牌相同
+func (s *AuthService) issueIDToken(grant tokenGrant, accessToken string, now time.Time) (string, error) {
+	claims := userClaims(grant.User, grant.Scopes)
+	claims["iss"] = s.config.Issuer
+	claims["aud"] = grant.ClientID
+	claims["azp"] = grant.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(s.config.AccessTokenTTL).Unix()
+	claims["at_hash"] = tokenHashClaim(accessToken)
+
+	if !grant.AuthTime.IsZero() {
+		claims["auth_time"] = grant.AuthTime.Unix()
+	}
+	if grant.Nonce != "" {
+		claims["nonce"] = grant.Nonce
+	}
+
+	return s.signer.Sign(TokenTypeID, claims)
+}
+
+// tokenHashClaim 计算 at_hash：SHA-256 左半部分的 base64url（RS256 对应 SHA-256）
+func tokenHashClaim(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// EndSessionRequest RP 发起的登出请求（OpenID Connect RP-Initiated Logout 1.0）
+type EndSessionRequest struct {
+	Client                *Client // 通过 client_id 或 id_token_hint 确定，可能为空
+	Subject               string  // id_token_hint 中的用户 ID
+	PostLogoutRedirectURI string
+	State                 string
+}
+
+// ValidateEndSessionRequest 校验登出请求
+// id_token_hint 允许已过期，但签名和签发者必须有效；登出回调地址必须为该客户端注册过的地址
+func (s *AuthService) ValidateEndSessionRequest(values url.Values) (*EndSessionRequest, *OAuthError) {
+	req := &EndSessionRequest{
+		PostLogoutRedirectURI: values.Get("post_logout_redirect_uri"),
+		State:                 values.Get("state"),
+	}
+	clientID := values.Get("client_id")
+
+	if hint := values.Get("id_token_hint"); hint != "" {
+		claims, err := s.signer.VerifySignature(hint, TokenTypeID)
+		if err != nil {
+			return nil, oauthError(http.StatusBadRequest, "invalid_request", "invalid id_token_hint")
+		}
+		if iss, _ := claims["iss"].(string); iss != s.config.Issuer {
+			return nil, oauthError(http.StatusBadRequest, "invalid_request", "invalid id_token_hint")
+		}
+
+		aud, _ := claims["aud"].(string)
+		if clientID != "" && clientID != aud {
+			return nil, oauthError(http.StatusBadRequest, "invalid_request", "client_id does not match id_token_hint")
+		}
+		clientID = aud
+		req.Subject, _ = claims["sub"].(string)
+	}
+
+	if clientID != "" {
+		client, err := s.store.GetClient(clientID)
+		if err != nil {
+			return nil, oauthError(http.StatusBadRequest, "invalid_request", "unknown client_id")
+		}
+		req.Client = client
+	}
+
+	if req.PostLogoutRedirectURI != "" {
+		if req.Client == nil {
+			return nil, oauthError(http.StatusBadRequest, "invalid_request", "post_logout_redirect_uri requires client_id or id_token_hint")
+		}
+		if !req.Client.hasPostLogoutRedirectURI(req.PostLogoutRedirectURI) {
+			return nil, oauthError(http.StatusBadRequest, "invalid_request", "post_logout_redirect_uri is not registered for this client")
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OpenIDConfiguration OIDC 发现文档（OpenID Connect Discovery 1.0）
+func (h *Handler) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	issuer := h.config.Token.Issuer
+
+	metadata := h.serverMetadata()
+	metadata["userinfo_endpoint"] = issuer + "/oauth/userinfo"
+	metadata["end_session_endpoint"] = issuer + "/oauth/logout"
+	metadata["scopes_supported"] = oidcScopes
+	metadata["response_modes_supported"] = []string{"query"}
+	metadata["subject_types_supported"] = []string{"public"}
+	metadata["id_token_signing_alg_values_supported"] = []string{"RS256"}
+	metadata["prompt_values_supported"] = []string{PromptNone, PromptLogin, PromptConsent, PromptSelectAccount}
+	metadata["claims_supported"] = []string{
+		"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "azp", "at_hash",
+		"name", "preferred_username", "updated_at", "email", "email_verified",
+	}
+	metadata["claims_parameter_supported"] = false
+	metadata["request_parameter_supported"] = false
+	metadata["request_uri_parameter_supported"] = false
+
+	writeJSON(w, http.StatusOK, metadata)
+}
+
+// UserInfo 用户信息端点，返回访问令牌授权范围内的用户声明
+func (h *Handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	claims, user, ok := h.authorizeBearer(w, r, ScopeOpenID)
+	if !ok {
+		return
+	}
+	if user == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="auth", error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", "token is not bound to a user")
+		return
+	}
+
+	scopes, _ := claims["scope"].(string)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, userClaims(user, strings.Fields(scopes)))
+}
+
+// EndSession RP 发起的登出端点
+// 没有与当前会话匹配的 id_token_hint 时先请用户确认，防止第三方页面强制用户登出
+func (h *Handler) EndSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+	if err := r.ParseForm(); err != nil {
+		renderError(w, http.StatusBadRequest, "Invalid request", "Malformed logout request.")
+		return
+	}
+
+	// 确认页提交时，原始登出请求放在 request 字段中
+	values := r.Form
+	confirmed := false
+	if r.Method == http.MethodPost && r.PostForm.Has("csrf_token") {
+		if !h.checkCSRF(r) {
+			renderError(w, http.StatusBadRequest, "Invalid request", "The form has expired. Please start again.")
+			return
+		}
+		query, err := url.ParseQuery(r.PostFormValue("request"))
+		if err != nil {
+			renderError(w, http.StatusBadRequest, "Invalid request", "Malformed logout request.")
+			return
+		}
+		values = query
+		confirmed = true
+	}
+
+	req, oerr := h.service.ValidateEndSessionRequest(values)
+	if oerr != nil {
+		renderError(w, oerr.Status, "Invalid request", oerr.Description)
+		return
+	}
+
+	clientName := ""
+	if req.Client != nil {
+		clientName = req.Client.Name
+	}
+
+	_, user := h.currentSession(r)
+	if user != nil && !confirmed && req.Subject != user.ID {
+		renderPage(w, http.StatusOK, "logout", pageData{
+			Title:      "Sign out",
+			CSRF:       h.csrfToken(w, r),
+			Username:   user.Username,
+			ClientName: clientName,
+			Request:    values.Encode(),
+		})
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
+		if err := h.service.DeleteSession(cookie.Value); err != nil {
+			h.serverError(w, r, "Failed to delete session", err)
+			return
+		}
+	}
+	h.clearSessionCookie(w)
+
+	if user != nil {
+		fields := map[string]interface{}{
+			"user_id":   user.ID,
+			"remote_ip": getClientIP(r),
+		}
+		if req.Client != nil {
+			fields["client_id"] = req.Client.ID
+		}
+		GetLogger().InfoWithRequestID(getRequestID(r), "Logout succeeded", fields)
+	}
+
+	if req.PostLogoutRedirectURI == "" {
+		renderPage(w, http.StatusOK, "signed_out", pageData{Title: "Signed out", ClientName: clientName})
+		return
+	}
+
+	target, _ := url.Parse(req.PostLogoutRedirectURI)
+	if req.State != "" {
+		query := target.Query()
+		query.Set("state", req.State)
+		target.RawQuery = query.Encode()
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
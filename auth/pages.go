@@ -0,0 +1,172 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// 浏览器页面模板（登录、两步验证、授权确认、登出、错误）
+var pageTemplates = template.Must(template.New("layout").Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #f4f5f7; margin: 0; }
+main { max-width: 380px; margin: 10vh auto; background: #fff; padding: 32px; border-radius: 8px; box-shadow: 0 1px 4px rgba(0,0,0,.1); }
+h1 { font-size: 20px; margin: 0 0 24px; }
+label { display: block; margin-bottom: 16px; font-size: 14px; }
+input[type=text], input[type=password] { display: block; width: 100%; box-sizing: border-box; margin-top: 4px; padding: 8px; font-size: 14px; }
+button { padding: 8px 16px; font-size: 14px; cursor: pointer; }
+.error { color: #b00020; margin-bottom: 16px; font-size: 14px; }
+.actions { display: flex; gap: 8px; }
+.hint { font-size: 12px; color: #555; word-break: break-all; }
+ul { padding-left: 20px; }
+</style>
+</head>
+<body>
+<main>
+{{end}}
+
+{{define "footer"}}</main>
+</body>
+</html>
+{{end}}
+
+{{define "login"}}{{template "header" .}}
+<h1>Sign in</h1>
+{{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+<form method="post" action="/login">
+<input type="hidden" name="csrf_token" value="{{.CSRF}}">
+<input type="hidden" name="return_to" value="{{.ReturnTo}}">
+<label>Username<input type="text" name="username" value="{{.Username}}" autocomplete="username" autofocus required></label>
+<label>Password<input type="password" name="password" autocomplete="current-password" required></label>
+<button type="submit">Sign in</button>
+</form>
+{{template "footer"}}{{end}}
+
+{{define "mfa"}}{{template "header" .}}
+<h1>Two-factor authentication</h1>
+{{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+{{if .Secret}}<p>Your account requires two-factor authentication. Add <strong>{{.Username}}</strong> to your authenticator app with the setup key below, then enter the 6-digit code it shows.</p>
+<label>Setup key<input type="text" value="{{.Secret}}" readonly></label>
+<p class="hint">QR code content:<br><code>{{.OTPAuthURI}}</code></p>
+{{else}}<p>Enter the 6-digit code from your authenticator app, or one of your recovery codes.</p>{{end}}
+<form method="post" action="/login/mfa">
+<input type="hidden" name="csrf_token" value="{{.CSRF}}">
+<input type="hidden" name="return_to" value="{{.ReturnTo}}">
+<label>Verification code<input type="text" name="code" autocomplete="one-time-code" autofocus required></label>
+<button type="submit">Verify</button>
+</form>
+{{template "footer"}}{{end}}
+
+{{define "recovery_codes"}}{{template "header" .}}
+<h1>Save your recovery codes</h1>
+<p>Two-factor authentication is now enabled. If you lose your authenticator app, each of these codes can be used once instead of a verification code. They will not be shown again.</p>
+<ul>{{range .RecoveryCodes}}<li><code>{{.}}</code></li>{{end}}</ul>
+<p><a href="{{.ReturnTo}}">Continue</a></p>
+{{template "footer"}}{{end}}
+
+{{define "reset_password"}}{{template "header" .}}
+<h1>Reset password</h1>
+{{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+<form method="post" action="/password/reset">
+<input type="hidden" name="csrf_token" value="{{.CSRF}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<label>New password<input type="password" name="password" autocomplete="new-password" autofocus required></label>
+<label>Confirm password<input type="password" name="password_confirm" autocomplete="new-password" required></label>
+<button type="submit">Set password</button>
+</form>
+{{template "footer"}}{{end}}
+
+{{define "password_reset"}}{{template "header" .}}
+<h1>Password updated</h1>
+<p>Your password has been changed and you have been signed out everywhere.</p>
+<p><a href="/login">Sign in</a></p>
+{{template "footer"}}{{end}}
+
+{{define "consent"}}{{template "header" .}}
+<h1>Authorize {{.ClientName}}</h1>
+<p>Signed in as <strong>{{.Username}}</strong>.</p>
+{{if .Scopes}}<p><strong>{{.ClientName}}</strong> is requesting access to:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+{{else}}<p><strong>{{.ClientName}}</strong> is requesting access to your account.</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="csrf_token" value="{{.CSRF}}">
+<input type="hidden" name="request" value="{{.Request}}">
+<div class="actions">
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</div>
+</form>
+{{template "footer"}}{{end}}
+
+{{define "signed_in"}}{{template "header" .}}
+<h1>Signed in</h1>
+<p>You are signed in as <strong>{{.Username}}</strong>.</p>
+{{template "footer"}}{{end}}
+
+{{define "logout"}}{{template "header" .}}
+<h1>Sign out</h1>
+<p>Do you want to sign out <strong>{{.Username}}</strong>{{if .ClientName}} from {{.ClientName}}{{end}}?</p>
+<form method="post" action="/oauth/logout">
+<input type="hidden" name="csrf_token" value="{{.CSRF}}">
+<input type="hidden" name="request" value="{{.Request}}">
+<div class="actions">
+<button type="submit">Sign out</button>
+</div>
+</form>
+{{template "footer"}}{{end}}
+
+{{define "signed_out"}}{{template "header" .}}
+<h1>Signed out</h1>
+<p>You have been signed out{{if .ClientName}} of {{.ClientName}}{{end}}.</p>
+{{template "footer"}}{{end}}
+
+{{define "error"}}{{template "header" .}}
+<h1>{{.Title}}</h1>
+<div class="error">{{.Error}}</div>
+{{template "footer"}}{{end}}
+`))
+
+// pageData 页面数据
+type pageData struct {
+	Title      string
+	Error      string
+	CSRF       string
+	ReturnTo   string
+	Username   string
+	ClientName string
+	Scopes     []string
+	Request    string // 授权确认页、登出确认页回传的原始请求
+
+	Secret        string   // 两步验证注册密钥
+	OTPAuthURI    string   // 两步验证注册的 otpauth URI
+	RecoveryCodes []string // 刚生成的恢复码
+
+	Token string // 密码重置令牌
+}
+
+// renderPage 渲染页面，页面禁止缓存和被嵌入
+// 不设置 form-action：授权确认表单提交后会重定向到客户端回调地址
+func renderPage(w http.ResponseWriter, status int, name string, data pageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	if err := pageTemplates.ExecuteTemplate(w, name, data); err != nil {
+		GetLogger().Error("Failed to render page", map[string]interface{}{
+			"page":  name,
+			"error": err.Error(),
+		})
+	}
+}
+
+// renderError 渲染错误页
+func renderError(w http.ResponseWriter, status int, title, message string) {
+	renderPage(w, status, "error", pageData{Title: title, Error: message})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 密码哈希参数（PBKDF2-HMAC-SHA256）
+const (
+	passwordIterations = 210000
+	passwordSaltSize   = 16
+	passwordKeySize    = 32
+	passwordScheme     = "pbkdf2-sha256"
+)
+
+var ErrInvalidPasswordHash = errors.New("invalid password hash")
+
+// HashPassword 生成加盐密码哈希，格式为 "pbkdf2-sha256$<iterations>$<salt>$<hash>"
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := pbkdf2SHA256([]byte(password), salt, passwordIterations, passwordKeySize)
+
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword 校验密码是否与哈希匹配（常量时间比较）
+func VerifyPassword(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false, ErrInvalidPasswordHash
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false, ErrInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(expected) == 0 {
+		return false, ErrInvalidPasswordHash
+	}
+
+	key := pbkdf2SHA256([]byte(password), salt, iterations, len(expected))
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+// dummyPasswordHash 用户不存在时参与校验，使登录耗时与用户是否存在无关
+var dummyPasswordHash, _ = HashPassword("dummy-password")
+
+// pbkdf2SHA256 RFC 8018 PBKDF2，PRF 为 HMAC-SHA256
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	var counter [4]byte
+	derived := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	t := make([]byte, hashLen)
+
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		derived = append(derived, t...)
+	}
+
+	return derived[:keyLen]
+}
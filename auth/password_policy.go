@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrBreachedPassword = fmt.Errorf("%w: it appears in a list of breached passwords", ErrWeakPassword)
+
+// PasswordPolicy 密码策略：长度、字符类别、不能与用户名相同、不能出现在泄露密码列表中
+type PasswordPolicy struct {
+	minLength  int
+	maxLength  int
+	minClasses int
+	breached   *BreachedPasswords // 为空时不检查
+}
+
+// NewPasswordPolicy 创建密码策略，配置了泄露密码列表时打开文件
+func NewPasswordPolicy(config SecurityConfig) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		minLength:  config.PasswordMinLength,
+		maxLength:  config.PasswordMaxLength,
+		minClasses: config.PasswordMinClasses,
+	}
+
+	if config.BreachedPasswordsFile != "" {
+		breached, err := OpenBreachedPasswords(config.BreachedPasswordsFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.breached = breached
+	}
+	return policy, nil
+}
+
+// Check 校验密码，不满足策略时返回包装 ErrWeakPassword 的错误
+func (p *PasswordPolicy) Check(password, username string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, p.minLength)
+	}
+	if p.maxLength > 0 && length > p.maxLength {
+		return fmt.Errorf("%w: must be at most %d characters", ErrWeakPassword, p.maxLength)
+	}
+	if classes := passwordClasses(password); classes < p.minClasses {
+		return fmt.Errorf("%w: must contain at least %d of lowercase letters, uppercase letters, digits and symbols", ErrWeakPassword, p.minClasses)
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		return fmt.Errorf("%w: must not be the same as the username", ErrWeakPassword)
+	}
+
+	if p.breached != nil {
+		found, err := p.breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if found {
+			return ErrBreachedPassword
+		}
+	}
+	return nil
+}
+
+// passwordClasses 统计密码包含的字符类别数（小写、大写、数字、其他）
+func passwordClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	count := 0
+	for _, has := range []bool{lower, upper, digit, other} {
+		if has {
+			count++
+		}
+	}
+	return count
+}
+
+// BreachedPasswords 本地泄露密码列表：每行为密码的 SHA-1（十六进制，可带 ":次数" 后缀，即 HIBP 下载格式），
+// 文件必须按哈希排序，查询时在文件中二分查找，不加载到内存，可以直接使用完整的 HIBP 列表
+type BreachedPasswords struct {
+	file *os.File
+	size int64
+}
+
+// OpenBreachedPasswords 打开泄露密码列表
+func OpenBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &BreachedPasswords{file: file, size: info.Size()}, nil
+}
+
+// Contains 检查密码是否在列表中
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// 不变量：如果存在，目标行的起始位置在 [lo, hi) 内
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := b.lineStart(mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		line, err := b.readLine(start)
+		if err != nil {
+			return false, err
+		}
+		key := strings.ToUpper(strings.TrimSpace(string(line)))
+		if i := strings.IndexByte(key, ':'); i >= 0 {
+			key = key[:i]
+		}
+
+		switch {
+		case key == target:
+			return true, nil
+		case key < target:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = start
+		}
+	}
+	return false, nil
+}
+
+// lineStart 返回不小于 pos 的第一个行首位置，没有时返回文件大小
+func (b *BreachedPasswords) lineStart(pos int64) (int64, error) {
+	if pos == 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, 128)
+	for offset := pos - 1; offset < b.size; offset += int64(len(buf)) {
+		n, err := b.file.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return offset + int64(i) + 1, nil
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return b.size, nil
+}
+
+// readLine 读取从 start 开始的一行（不含换行符）
+func (b *BreachedPasswords) readLine(start int64) ([]byte, error) {
+	var line []byte
+	buf := make([]byte, 128)
+	for offset := start; offset < b.size; offset += int64(len(buf)) {
+		n, err := b.file.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return append(line, buf[:i]...), nil
+		}
+		line = append(line, buf[:n]...)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return line, nil
+}
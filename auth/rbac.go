@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidName      = errors.New("name must be 1-64 characters of letters, digits, '.', '_', ':' or '-'")
+	ErrInvalidRoute     = errors.New(`route must be "[METHOD ]PATH" with PATH starting with "/"`)
+	ErrEmptyBinding     = errors.New("route binding needs at least one role or permission")
+	ErrUnknownReference = errors.New("unknown role or permission")
+)
+
+// PermissionAll 授予全部权限的通配权限
+const PermissionAll = "*"
+
+var (
+	rbacNamePattern    = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+	routeMethodPattern = regexp.MustCompile(`^[A-Z]+$`)
+)
+
+// CreatePermission 创建权限
+func (s *AuthService) CreatePermission(permission *Permission) (*Permission, error) {
+	if !rbacNamePattern.MatchString(permission.Name) {
+		return nil, ErrInvalidName
+	}
+
+	now := time.Now().UTC()
+	p := *permission
+	p.CreatedAt = now
+	p.UpdatedAt = now
+
+	if err := s.store.CreatePermission(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpdatePermission 更新权限说明
+func (s *AuthService) UpdatePermission(permission *Permission) (*Permission, error) {
+	existing, err := s.store.GetPermission(permission.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	existing.Description = permission.Description
+	existing.UpdatedAt = time.Now().UTC()
+
+	if err := s.store.UpdatePermission(existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// CreateRole 创建角色，引用的权限必须已存在
+func (s *AuthService) CreateRole(role *Role) (*Role, error) {
+	if !rbacNamePattern.MatchString(role.Name) {
+		return nil, ErrInvalidName
+	}
+
+	role = role.clone()
+	if err := s.normalizePermissions(&role.Permissions, true); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	role.CreatedAt = now
+	role.UpdatedAt = now
+
+	if err := s.store.CreateRole(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// UpdateRole 更新角色的说明和权限
+func (s *AuthService) UpdateRole(role *Role) (*Role, error) {
+	existing, err := s.store.GetRole(role.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := append([]string(nil), role.Permissions...)
+	if err := s.normalizePermissions(&permissions, true); err != nil {
+		return nil, err
+	}
+
+	existing.Description = role.Description
+	existing.Permissions = permissions
+	existing.UpdatedAt = time.Now().UTC()
+
+	if err := s.store.UpdateRole(existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// CreateRouteBinding 创建路由绑定
+func (s *AuthService) CreateRouteBinding(binding *RouteBinding) (*RouteBinding, error) {
+	binding = binding.clone()
+	if err := s.validateRouteBinding(binding); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	binding.ID = randomID()
+	binding.CreatedAt = now
+	binding.UpdatedAt = now
+
+	if err := s.store.CreateRouteBinding(binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// UpdateRouteBinding 更新路由绑定
+func (s *AuthService) UpdateRouteBinding(binding *RouteBinding) (*RouteBinding, error) {
+	existing, err := s.store.GetRouteBinding(binding.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	binding = binding.clone()
+	if err := s.validateRouteBinding(binding); err != nil {
+		return nil, err
+	}
+	binding.CreatedAt = existing.CreatedAt
+	binding.UpdatedAt = time.Now().UTC()
+
+	if err := s.store.UpdateRouteBinding(binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// validateRouteBinding 校验路由格式和引用的角色、权限，并去重
+func (s *AuthService) validateRouteBinding(binding *RouteBinding) error {
+	route, err := normalizeRoute(binding.Route)
+	if err != nil {
+		return err
+	}
+	binding.Route = route
+
+	if err := s.normalizeRoles(&binding.Roles); err != nil {
+		return err
+	}
+	if err := s.normalizePermissions(&binding.Permissions, false); err != nil {
+		return err
+	}
+	if len(binding.Roles) == 0 && len(binding.Permissions) == 0 {
+		return ErrEmptyBinding
+	}
+	return nil
+}
+
+// normalizeRoute 规范化 "[METHOD ]PATH" 路由
+func normalizeRoute(route string) (string, error) {
+	method, path, found := strings.Cut(strings.TrimSpace(route), " ")
+	if !found {
+		method, path = "", method
+	}
+	path = strings.TrimSpace(path)
+
+	if method != "" && !routeMethodPattern.MatchString(method) {
+		return "", ErrInvalidRoute
+	}
+	if !strings.HasPrefix(path, "/") || strings.ContainsAny(path, " \t") {
+		return "", ErrInvalidRoute
+	}
+
+	if method == "" {
+		return path, nil
+	}
+	return method + " " + path, nil
+}
+
+// normalizeRoles 去重并校验角色存在
+func (s *AuthService) normalizeRoles(roles *[]string) error {
+	*roles = intersectScopes(nil, *roles)
+	for _, name := range *roles {
+		if _, err := s.store.GetRole(name); errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: role %q", ErrUnknownReference, name)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizePermissions 去重并校验权限存在，allowWildcard 为 true 时接受 "*"
+func (s *AuthService) normalizePermissions(permissions *[]string, allowWildcard bool) error {
+	*permissions = intersectScopes(nil, *permissions)
+	for _, name := range *permissions {
+		if name == PermissionAll && allowWildcard {
+			continue
+		}
+		if _, err := s.store.GetPermission(name); errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: permission %q", ErrUnknownReference, name)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UserUpdate 管理员可修改的用户字段
+type UserUpdate struct {
+	Username      string   `json:"username"`
+	Password      string   `json:"password,omitempty"` // 为空时保留原密码
+	Name          string   `json:"name"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Scopes        []string `json:"scopes"`
+	Roles         []string `json:"roles"`
+	Disabled      bool     `json:"disabled"`
+}
+
+// CreateUserAccount 管理员创建用户，可直接分配授权范围和角色
+func (s *AuthService) CreateUserAccount(update UserUpdate) (*User, error) {
+	if err := s.normalizeRoles(&update.Roles); err != nil {
+		return nil, err
+	}
+
+	return s.CreateUser(&User{
+		Username:      update.Username,
+		Name:          update.Name,
+		Email:         update.Email,
+		EmailVerified: update.EmailVerified,
+		Scopes:        intersectScopes(nil, update.Scopes),
+		Roles:         update.Roles,
+		Disabled:      update.Disabled,
+	}, update.Password)
+}
+
+// UpdateUserAccount 管理员更新用户；禁用或修改密码时吊销其全部刷新令牌
+func (s *AuthService) UpdateUserAccount(id string, update UserUpdate) (*User, error) {
+	user, err := s.store.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !usernamePattern.MatchString(update.Username) {
+		return nil, ErrInvalidUsername
+	}
+	if update.Email != "" && !emailPattern.MatchString(update.Email) {
+		return nil, ErrInvalidEmail
+	}
+	if err := s.normalizeRoles(&update.Roles); err != nil {
+		return nil, err
+	}
+
+	revoke := update.Disabled && !user.Disabled
+	if update.Password != "" {
+		if err := s.passwords.Check(update.Password, update.Username); err != nil {
+			return nil, err
+		}
+		if user.PasswordHash, err = HashPassword(update.Password); err != nil {
+			return nil, err
+		}
+		revoke = true
+	}
+
+	user.Username = update.Username
+	user.Name = update.Name
+	user.Email = update.Email
+	user.EmailVerified = update.EmailVerified
+	user.Scopes = intersectScopes(nil, update.Scopes)
+	user.Roles = update.Roles
+	user.Disabled = update.Disabled
+	user.UpdatedAt = time.Now().UTC()
+
+	if err := s.store.UpdateUser(user); err != nil {
+		return nil, err
+	}
+	if revoke {
+		if err := s.store.RevokeUserRefreshTokens(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// RBACPolicy 网关使用的授权策略：角色的权限和路由绑定
+type RBACPolicy struct {
+	Roles    map[string][]string `json:"roles"`
+	Bindings []PolicyBinding     `json:"bindings"`
+}
+
+// PolicyBinding 策略中的路由绑定
+type PolicyBinding struct {
+	Route       string   `json:"route"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// Policy 导出当前授权策略
+func (s *AuthService) Policy() (*RBACPolicy, error) {
+	roles, err := s.store.ListRoles()
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := s.store.ListRouteBindings()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &RBACPolicy{
+		Roles:    make(map[string][]string, len(roles)),
+		Bindings: make([]PolicyBinding, 0, len(bindings)),
+	}
+	for _, role := range roles {
+		policy.Roles[role.Name] = role.Permissions
+	}
+	for _, binding := range bindings {
+		policy.Bindings = append(policy.Bindings, PolicyBinding{
+			Route:       binding.Route,
+			Roles:       binding.Roles,
+			Permissions: binding.Permissions,
+		})
+	}
+	return policy, nil
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ScopeRBACRead 读取授权策略所需的授权范围（网关使用客户端凭证获取）
+const ScopeRBACRead = "rbac:read"
+
+// writeAdminError 将管理 API 的业务错误映射为 HTTP 响应
+func (h *Handler) writeAdminError(w http.ResponseWriter, r *http.Request, resource string, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, "not_found", resource+" not found")
+	case errors.Is(err, ErrConflict):
+		writeError(w, http.StatusConflict, "conflict", resource+" already exists")
+	case errors.Is(err, ErrInvalidName), errors.Is(err, ErrInvalidRoute), errors.Is(err, ErrEmptyBinding),
+		errors.Is(err, ErrUnknownReference), errors.Is(err, ErrInvalidUsername), errors.Is(err, ErrInvalidEmail),
+		errors.Is(err, ErrWeakPassword):
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+	default:
+		h.serverError(w, r, "Admin API error", err)
+	}
+}
+
+// auditAdmin 记录管理操作
+func auditAdmin(r *http.Request, message string, claims map[string]interface{}, fields map[string]interface{}) {
+	fields["by"] = claims["sub"]
+	GetLogger().InfoWithRequestID(getRequestID(r), message, fields)
+}
+
+// ListUsers 列出用户
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, "admin"); !ok {
+		return
+	}
+
+	users, err := h.service.store.ListUsers()
+	if err != nil {
+		h.serverError(w, r, "Failed to list users", err)
+		return
+	}
+
+	response := make([]userResponse, 0, len(users))
+	for _, user := range users {
+		response = append(response, newUserResponse(user))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// CreateUser 管理员创建用户
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	var req UserUpdate
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.service.CreateUserAccount(req)
+	if err != nil {
+		h.writeAdminError(w, r, "user", err)
+		return
+	}
+
+	auditAdmin(r, "User created", claims, map[string]interface{}{"user_id": user.ID, "roles": user.Roles})
+	writeJSON(w, http.StatusCreated, newUserResponse(user))
+}
+
+// GetUser 获取用户
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, "admin"); !ok {
+		return
+	}
+
+	user, err := h.service.store.GetUser(r.PathValue("id"))
+	if err != nil {
+		h.writeAdminError(w, r, "user", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// UpdateUser 更新用户资料、授权范围、角色和状态
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	var req UserUpdate
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.service.UpdateUserAccount(r.PathValue("id"), req)
+	if err != nil {
+		h.writeAdminError(w, r, "user", err)
+		return
+	}
+
+	auditAdmin(r, "User updated", claims, map[string]interface{}{
+		"user_id":  user.ID,
+		"roles":    user.Roles,
+		"disabled": user.Disabled,
+	})
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// DeleteUser 删除用户，不能删除自己
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	if sub, _ := claims["sub"].(string); sub == id {
+		writeError(w, http.StatusBadRequest, "invalid_request", "cannot delete the current user")
+		return
+	}
+
+	if err := h.service.store.DeleteUser(id); err != nil {
+		h.writeAdminError(w, r, "user", err)
+		return
+	}
+
+	auditAdmin(r, "User deleted", claims, map[string]interface{}{"user_id": id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListPermissions 列出权限
+func (h *Handler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, "admin"); !ok {
+		return
+	}
+
+	permissions, err := h.service.store.ListPermissions()
+	if err != nil {
+		h.serverError(w, r, "Failed to list permissions", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, permissions)
+}
+
+// CreatePermission 创建权限
+func (h *Handler) CreatePermission(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	var req Permission
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	permission, err := h.service.CreatePermission(&req)
+	if err != nil {
+		h.writeAdminError(w, r, "permission", err)
+		return
+	}
+
+	auditAdmin(r, "Permission created", claims, map[string]interface{}{"permission": permission.Name})
+	writeJSON(w, http.StatusCreated, permission)
+}
+
+// GetPermission 获取权限
+func (h *Handler) GetPermission(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, "admin"); !ok {
+		return
+	}
+
+	permission, err := h.service.store.GetPermission(r.PathValue("name"))
+	if err != nil {
+		h.writeAdminError(w, r, "permission", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, permission)
+}
+
+// UpdatePermission 更新权限说明
+func (h *Handler) UpdatePermission(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	var req Permission
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Name = r.PathValue("name")
+
+	permission, err := h.service.UpdatePermission(&req)
+	if err != nil {
+		h.writeAdminError(w, r, "permission", err)
+		return
+	}
+
+	auditAdmin(r, "Permission updated", claims, map[string]interface{}{"permission": permission.Name})
+	writeJSON(w, http.StatusOK, permission)
+}
+
+// DeletePermission 删除权限，同时从角色和路由绑定中移除
+func (h *Handler) DeletePermission(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := h.service.store.DeletePermission(name); err != nil {
+		h.writeAdminError(w, r, "permission", err)
+		return
+	}
+
+	auditAdmin(r, "Permission deleted", claims, map[string]interface{}{"permission": name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListRoles 列出角色
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, "admin"); !ok {
+		return
+	}
+
+	roles, err := h.service.store.ListRoles()
+	if err != nil {
+		h.serverError(w, r, "Failed to list roles", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, roles)
+}
+
+// CreateRole 创建角色
+func (h *Handler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	var req Role
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	role, err := h.service.CreateRole(&req)
+	if err != nil {
+		h.writeAdminError(w, r, "role", err)
+		return
+	}
+
+	auditAdmin(r, "Role created", claims, map[string]interface{}{"role": role.Name, "permissions": role.Permissions})
+	writeJSON(w, http.StatusCreated, role)
+}
+
+// GetRole 获取角色
+func (h *Handler) GetRole(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, "admin"); !ok {
+		return
+	}
+
+	role, err := h.service.store.GetRole(r.PathValue("name"))
+	if err != nil {
+		h.writeAdminError(w, r, "role", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, role)
+}
+
+// UpdateRole 更新角色的说明和权限
+func (h *Handler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	var req Role
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Name = r.PathValue("name")
+
+	role, err := h.service.UpdateRole(&req)
+	if err != nil {
+		h.writeAdminError(w, r, "role", err)
+		return
+	}
+
+	auditAdmin(r, "Role updated", claims, map[string]interface{}{"role": role.Name, "permissions": role.Permissions})
+	writeJSON(w, http.StatusOK, role)
+}
+
+// DeleteRole 删除角色，同时从用户和路由绑定中移除
+func (h *Handler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := h.service.store.DeleteRole(name); err != nil {
+		h.writeAdminError(w, r, "role", err)
+		return
+	}
+
+	auditAdmin(r, "Role deleted", claims, map[string]interface{}{"role": name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListRouteBindings 列出路由绑定
+func (h *Handler) ListRouteBindings(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, "admin"); !ok {
+		return
+	}
+
+	bindings, err := h.service.store.ListRouteBindings()
+	if err != nil {
+		h.serverError(w, r, "Failed to list route bindings", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bindings)
+}
+
+// CreateRouteBinding 创建路由绑定
+func (h *Handler) CreateRouteBinding(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	var req RouteBinding
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	binding, err := h.service.CreateRouteBinding(&req)
+	if err != nil {
+		h.writeAdminError(w, r, "route binding", err)
+		return
+	}
+
+	auditAdmin(r, "Route binding created", claims, map[string]interface{}{"binding_id": binding.ID, "route": binding.Route})
+	writeJSON(w, http.StatusCreated, binding)
+}
+
+// GetRouteBinding 获取路由绑定
+func (h *Handler) GetRouteBinding(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, "admin"); !ok {
+		return
+	}
+
+	binding, err := h.service.store.GetRouteBinding(r.PathValue("id"))
+	if err != nil {
+		h.writeAdminError(w, r, "route binding", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, binding)
+}
+
+// UpdateRouteBinding 更新路由绑定
+func (h *Handler) UpdateRouteBinding(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	var req RouteBinding
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.ID = r.PathValue("id")
+
+	binding, err := h.service.UpdateRouteBinding(&req)
+	if err != nil {
+		h.writeAdminError(w, r, "route binding", err)
+		return
+	}
+
+	auditAdmin(r, "Route binding updated", claims, map[string]interface{}{"binding_id": binding.ID, "route": binding.Route})
+	writeJSON(w, http.StatusOK, binding)
+}
+
+// DeleteRouteBinding 删除路由绑定
+func (h *Handler) DeleteRouteBinding(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := h.service.store.DeleteRouteBinding(id); err != nil {
+		h.writeAdminError(w, r, "route binding", err)
+		return
+	}
+
+	auditAdmin(r, "Route binding deleted", claims, map[string]interface{}{"binding_id": id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Policy 导出网关使用的授权策略
+func (h *Handler) Policy(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireScope(w, r, ScopeRBACRead); !ok {
+		return
+	}
+
+	policy, err := h.service.Policy()
+	if err != nil {
+		h.serverError(w, r, "Failed to export policy", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, policy)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// passwordFingerprint 密码哈希的指纹，写入重置令牌
+// 密码修改后哈希（含随机盐）变化，已签发的重置令牌全部失效，因此令牌只能使用一次
+func passwordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// FindUserForReset 按用户名或邮箱查找用户
+func (s *AuthService) FindUserForReset(login string) (*User, error) {
+	user, err := s.store.GetUserByUsername(login)
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(login, "@") {
+		return user, err
+	}
+
+	users, err := s.store.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Email != "" && strings.EqualFold(user.Email, login) {
+			return user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// IssuePasswordReset 签发密码重置令牌（RS256 JWT，头部 typ 为 reset+jwt）
+func (s *AuthService) IssuePasswordReset(user *User) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.config.PasswordResetTTL)
+
+	token, err := s.signer.Sign(TokenTypeReset, map[string]interface{}{
+		"iss": s.config.Issuer,
+		"sub": user.ID,
+		"iat": now.Unix(),
+		"exp": expiresAt.Unix(),
+		"jti": randomID(),
+		"pwd": passwordFingerprint(user.PasswordHash),
+	})
+	return token, expiresAt, err
+}
+
+// VerifyResetToken 校验重置令牌并返回用户
+func (s *AuthService) VerifyResetToken(token string) (*User, error) {
+	claims, err := s.signer.Verify(token, TokenTypeReset)
+	if err != nil {
+		return nil, ErrInvalidResetToken
+	}
+	if iss, _ := claims["iss"].(string); iss != s.config.Issuer {
+		return nil, ErrInvalidResetToken
+	}
+
+	sub, _ := claims["sub"].(string)
+	user, err := s.store.GetUser(sub)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrInvalidResetToken
+	}
+
+	fingerprint, _ := claims["pwd"].(string)
+	if subtle.ConstantTimeCompare([]byte(fingerprint), []byte(passwordFingerprint(user.PasswordHash))) != 1 {
+		return nil, ErrInvalidResetToken
+	}
+	return user, nil
+}
+
+// ResetPassword 使用重置令牌设置新密码，吊销用户的全部刷新令牌和登录会话
+func (s *AuthService) ResetPassword(token, password string) (*User, error) {
+	user, err := s.VerifyResetToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.passwords.Check(password, user.Username); err != nil {
+		return nil, err
+	}
+
+	if user.PasswordHash, err = HashPassword(password); err != nil {
+		return nil, err
+	}
+	user.UpdatedAt = time.Now().UTC()
+
+	if err := s.store.UpdateUser(user); err != nil {
+		return nil, err
+	}
+	if err := s.store.RevokeUserRefreshTokens(user.ID); err != nil {
+		return nil, err
+	}
+	if err := s.store.DeleteUserSessions(user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// 密码审计事件（日志 event 字段）
+const (
+	passwordEventResetRequested = "password.reset_requested"
+	passwordEventResetIssued    = "password.reset_issued"
+	passwordEventReset          = "password.reset"
+)
+
+type resetRequest struct {
+	Login    string `json:"login"`    // 用户名或邮箱
+	Token    string `json:"token"`    // 确认重置时使用
+	Password string `json:"password"` // 确认重置时使用
+}
+
+// resetURL 浏览器重置页面地址
+func (h *Handler) resetURL(token string) string {
+	return h.config.Token.Issuer + "/password/reset?token=" + url.QueryEscape(token)
+}
+
+// RequestPasswordReset 自助申请重置密码，重置链接发送到 AUTH_PASSWORD_RESET_WEBHOOK
+// 无论账户是否存在都返回 202，不泄露用户名或邮箱是否注册
+func (h *Handler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if h.config.Security.PasswordResetWebhook == "" {
+		writeError(w, http.StatusForbidden, "password_reset_disabled", "self-service password reset is disabled")
+		return
+	}
+
+	var req resetRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Login == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "login is required")
+		return
+	}
+
+	// 每次申请都计入同一账户和 IP 的失败次数，防止被用来轰炸邮箱
+	ip := getClientIP(r)
+	if throttle := h.guard.Check("reset:"+req.Login, ip); throttle != nil {
+		writeThrottled(w, r, req.Login, throttle)
+		return
+	}
+	h.guard.Fail("reset:"+req.Login, ip)
+
+	user, err := h.service.FindUserForReset(req.Login)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		h.serverError(w, r, "Failed to look up user", err)
+		return
+	}
+
+	if user != nil && !user.Disabled {
+		token, expiresAt, err := h.service.IssuePasswordReset(user)
+		if err != nil {
+			h.serverError(w, r, "Failed to issue password reset", err)
+			return
+		}
+
+		GetLogger().InfoWithRequestID(getRequestID(r), "Password reset requested", map[string]interface{}{
+			"event":     passwordEventResetRequested,
+			"user_id":   user.ID,
+			"remote_ip": ip,
+		})
+		// 异步投递，响应时间与账户是否存在无关
+		go h.deliverPasswordReset(getRequestID(r), user, token, expiresAt)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deliverPasswordReset 将重置链接 POST 到 AUTH_PASSWORD_RESET_WEBHOOK（例如发信服务）
+func (h *Handler) deliverPasswordReset(requestID string, user *User, token string, expiresAt time.Time) {
+	body, err := json.Marshal(map[string]interface{}{
+		"user_id":     user.ID,
+		"username":    user.Username,
+		"email":       user.Email,
+		"reset_url":   h.resetURL(token),
+		"reset_token": token,
+		"expires_at":  expiresAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(h.config.Security.PasswordResetWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		GetLogger().ErrorWithRequestID(requestID, "Failed to deliver password reset", map[string]interface{}{
+			"user_id": user.ID,
+			"error":   err.Error(),
+		})
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		GetLogger().ErrorWithRequestID(requestID, "Failed to deliver password reset", map[string]interface{}{
+			"user_id":     user.ID,
+			"status_code": resp.StatusCode,
+		})
+	}
+}
+
+// ConfirmPasswordReset 使用重置令牌设置新密码
+func (h *Handler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req resetRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.service.ResetPassword(req.Token, req.Password)
+	switch {
+	case errors.Is(err, ErrInvalidResetToken):
+		writeError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	case errors.Is(err, ErrWeakPassword):
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	case err != nil:
+		h.serverError(w, r, "Password reset error", err)
+		return
+	}
+
+	h.completePasswordReset(r, user)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completePasswordReset 重置成功后解除登录锁定并记录审计事件
+func (h *Handler) completePasswordReset(r *http.Request, user *User) {
+	h.guard.Unlock(user.Username)
+	GetLogger().InfoWithRequestID(getRequestID(r), "Password reset", map[string]interface{}{
+		"event":     passwordEventReset,
+		"user_id":   user.ID,
+		"remote_ip": getClientIP(r),
+	})
+}
+
+// IssueUserPasswordReset 管理员为用户签发重置链接，由管理员自行转交（需要 admin 授权范围）
+func (h *Handler) IssueUserPasswordReset(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.requireScope(w, r, "admin")
+	if !ok {
+		return
+	}
+
+	user, err := h.service.store.GetUser(r.PathValue("id"))
+	if err != nil {
+		h.writeAdminError(w, r, "user", err)
+		return
+	}
+
+	token, expiresAt, err := h.service.IssuePasswordReset(user)
+	if err != nil {
+		h.serverError(w, r, "Failed to issue password reset", err)
+		return
+	}
+
+	auditAdmin(r, "Password reset issued", claims, map[string]interface{}{
+		"event":   passwordEventResetIssued,
+		"user_id": user.ID,
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]string{
+		"reset_token": token,
+		"reset_url":   h.resetURL(token),
+		"expires_at":  expiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// ResetPasswordPage 浏览器重置密码页（重置链接的落地页）
+func (h *Handler) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if _, err := h.service.VerifyResetToken(token); err != nil {
+		if !errors.Is(err, ErrInvalidResetToken) {
+			h.serverError(w, r, "Failed to verify reset token", err)
+			return
+		}
+		renderError(w, http.StatusBadRequest, "Invalid link", "This password reset link is invalid or has expired.")
+		return
+	}
+
+	renderPage(w, http.StatusOK, "reset_password", pageData{
+		Title: "Reset password",
+		CSRF:  h.csrfToken(w, r),
+		Token: token,
+	})
+}
+
+// ResetPasswordSubmit 提交新密码
+func (h *Handler) ResetPasswordSubmit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := r.ParseForm(); err != nil || !h.checkCSRF(r) {
+		renderError(w, http.StatusBadRequest, "Invalid request", "The form has expired. Please start again.")
+		return
+	}
+
+	token := r.PostFormValue("token")
+	password := r.PostFormValue("password")
+	if password != r.PostFormValue("password_confirm") {
+		renderPage(w, http.StatusBadRequest, "reset_password", pageData{
+			Title: "Reset password",
+			Error: "The passwords do not match.",
+			CSRF:  h.csrfToken(w, r),
+			Token: token,
+		})
+		return
+	}
+
+	user, err := h.service.ResetPassword(token, password)
+	switch {
+	case errors.Is(err, ErrInvalidResetToken):
+		renderError(w, http.StatusBadRequest, "Invalid link", "This password reset link is invalid or has expired.")
+		return
+	case errors.Is(err, ErrWeakPassword):
+		renderPage(w, http.StatusBadRequest, "reset_password", pageData{
+			Title: "Reset password",
+			Error: err.Error(),
+			CSRF:  h.csrfToken(w, r),
+			Token: token,
+		})
+		return
+	case err != nil:
+		h.serverError(w, r, "Password reset error", err)
+		return
+	}
+
+	h.completePasswordReset(r, user)
+	renderPage(w, http.StatusOK, "password_reset", pageData{Title: "Password updated"})
+}
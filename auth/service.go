@@ -0,0 +1,401 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidGrant       = errors.New("invalid or expired refresh token")
+	ErrInvalidUsername    = errors.New("username must be 1-64 characters of letters, digits, '.', '_', '-' or '@'")
+	ErrWeakPassword       = errors.New("password does not meet the password policy")
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrUserDisabled       = errors.New("user is disabled")
+	ErrInvalidScope       = errors.New("requested scope is invalid or exceeds the granted scope")
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+	emailPattern    = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+)
+
+// TokenResponse 令牌响应（字段与 OAuth2 令牌响应一致）
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// AuthService 账户与令牌服务
+type AuthService struct {
+	config    TokenConfig
+	mfa       MFAConfig
+	passwords *PasswordPolicy
+	store     Store
+	signer    *TokenSigner
+}
+
+// NewAuthService 创建认证服务
+func NewAuthService(config TokenConfig, mfa MFAConfig, passwords *PasswordPolicy, store Store, signer *TokenSigner) *AuthService {
+	return &AuthService{
+		config:    config,
+		mfa:       mfa,
+		passwords: passwords,
+		store:     store,
+		signer:    signer,
+	}
+}
+
+// CreateUser 创建用户，user 中只需填写用户名、资料和授权范围
+func (s *AuthService) CreateUser(user *User, password string) (*User, error) {
+	if !usernamePattern.MatchString(user.Username) {
+		return nil, ErrInvalidUsername
+	}
+	if user.Email != "" && !emailPattern.MatchString(user.Email) {
+		return nil, ErrInvalidEmail
+	}
+	if err := s.passwords.Check(password, user.Username); err != nil {
+		return nil, err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	user = user.clone()
+	user.ID = randomID()
+	user.PasswordHash = hash
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	if err := s.store.CreateUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// EnsureUser 用户不存在时创建（用于初始管理员）
+func (s *AuthService) EnsureUser(username, password string, scopes []string) (*User, bool, error) {
+	user, err := s.store.GetUserByUsername(username)
+	if err == nil {
+		return user, false, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, false, err
+	}
+
+	user, err = s.CreateUser(&User{Username: username, Scopes: scopes}, password)
+	return user, err == nil, err
+}
+
+// Authenticate 校验用户名和密码
+func (s *AuthService) Authenticate(username, password string) (*User, error) {
+	user, err := s.store.GetUserByUsername(username)
+	if errors.Is(err, ErrNotFound) {
+		// 仍然计算一次哈希，避免通过响应时间枚举用户名
+		VerifyPassword(password, dummyPasswordHash)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := VerifyPassword(password, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	return user, nil
+}
+
+// Login 密码登录，签发访问令牌和新的刷新令牌 family
+// 需要第二因素时返回 *MFAChallengeError，由 CompleteMFALogin 完成登录
+func (s *AuthService) Login(username, password, scope string) (*TokenResponse, *User, error) {
+	user, err := s.Authenticate(username, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkSecondFactor(user, scope); err != nil {
+		return nil, user, err
+	}
+
+	scopes := intersectScopes(strings.Fields(scope), s.userScopes(user))
+	tokens, err := s.issueTokens(tokenGrant{User: user, Scopes: scopes, FamilyID: randomID(), AuthTime: time.Now()})
+	return tokens, user, err
+}
+
+// Refresh 轮换刷新令牌：旧令牌作废并签发新令牌，已用过的令牌被重放时吊销整个 family
+// client 为空表示 /api/v1/login 签发的令牌；scope 非空时只能缩小授权范围
+func (s *AuthService) Refresh(refreshToken string, client *Client, scope string) (*TokenResponse, *RefreshToken, error) {
+	hash := hashToken(refreshToken)
+
+	// 先校验归属再消费，避免其他客户端持有的令牌导致合法 family 被吊销
+	token, err := s.store.GetRefreshToken(hash)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil, ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	clientID := ""
+	if client != nil {
+		clientID = client.ID
+	}
+	if token.ClientID != clientID {
+		return nil, token, ErrInvalidGrant
+	}
+
+	token, err = s.store.ConsumeRefreshToken(hash)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, nil, ErrInvalidGrant
+	case errors.Is(err, ErrTokenReused):
+		if revokeErr := s.store.RevokeRefreshTokenFamily(token.FamilyID); revokeErr != nil {
+			return nil, token, revokeErr
+		}
+		return nil, token, ErrTokenReused
+	case errors.Is(err, ErrTokenRevoked):
+		return nil, token, ErrInvalidGrant
+	case err != nil:
+		return nil, nil, err
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return nil, token, ErrInvalidGrant
+	}
+
+	user, err := s.store.GetUser(token.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, token, ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, token, err
+	}
+	if user.Disabled {
+		s.store.RevokeRefreshTokenFamily(token.FamilyID)
+		return nil, token, ErrUserDisabled
+	}
+
+	// 用户或客户端的授权范围可能已被收回，与当前可用范围取交集；
+	// 原令牌没有任何范围时刷新后也没有，不能扩大为全部可用范围
+	available := s.userScopes(user)
+	if client != nil {
+		available = s.GrantableScopes(user, client.Scopes)
+	}
+	scopes := retainScopes(token.Scopes, available)
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		if !containsAll(scopes, requested) {
+			return nil, token, ErrInvalidScope
+		}
+		scopes = requested
+	}
+
+	tokens, err := s.issueTokens(tokenGrant{
+		User:     user,
+		ClientID: clientID,
+		Scopes:   scopes,
+		FamilyID: token.FamilyID,
+		AuthTime: token.AuthTime,
+	})
+	return tokens, token, err
+}
+
+// Revoke 吊销刷新令牌所在的 family；all 为 true 时吊销该用户的全部刷新令牌
+// 未知令牌不视为错误（RFC 7009 语义）
+func (s *AuthService) Revoke(refreshToken string, all bool) (*RefreshToken, error) {
+	token, err := s.store.GetRefreshToken(hashToken(refreshToken))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if all {
+		return token, s.store.RevokeUserRefreshTokens(token.UserID)
+	}
+	return token, s.store.RevokeRefreshTokenFamily(token.FamilyID)
+}
+
+// VerifyAccessToken 校验访问令牌（签名、有效期、签发者、吊销状态）并返回对应用户
+// 客户端凭证模式签发的令牌没有用户，返回的 user 为 nil
+func (s *AuthService) VerifyAccessToken(accessToken string) (map[string]interface{}, *User, error) {
+	claims, err := s.signer.Verify(accessToken, TokenTypeAccess)
+	if err != nil {
+		return nil, nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != s.config.Issuer {
+		return nil, nil, ErrInvalidToken
+	}
+
+	if jti, _ := claims["jti"].(string); jti != "" {
+		revoked, err := s.store.IsAccessTokenRevoked(jti)
+		if err != nil {
+			return nil, nil, err
+		}
+		if revoked {
+			return nil, nil, ErrInvalidToken
+		}
+	}
+
+	sub, _ := claims["sub"].(string)
+	if clientID, _ := claims["client_id"].(string); clientID != "" && clientID == sub {
+		return claims, nil, nil
+	}
+
+	user, err := s.store.GetUser(sub)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Disabled {
+		return nil, nil, ErrUserDisabled
+	}
+
+	return claims, user, nil
+}
+
+// tokenGrant 签发令牌的参数
+type tokenGrant struct {
+	User     *User // 客户端凭证模式为空，令牌的 sub 为客户端 ID
+	ClientID string
+	Scopes   []string
+	FamilyID string    // 刷新令牌 family，为空时不签发刷新令牌
+	AuthTime time.Time // 用户登录时间
+	Nonce    string    // 授权请求的 nonce，写入 ID 令牌
+}
+
+// issueTokens 签发访问令牌，并在 family 中追加一个刷新令牌
+func (s *AuthService) issueTokens(grant tokenGrant) (*TokenResponse, error) {
+	now := time.Now()
+
+	claims := map[string]interface{}{
+		"iss": s.config.Issuer,
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(s.config.AccessTokenTTL).Unix(),
+		"jti": randomID(),
+	}
+	if grant.User != nil {
+		claims["sub"] = grant.User.ID
+		claims["preferred_username"] = grant.User.Username
+		if len(grant.User.Roles) > 0 {
+			claims["roles"] = grant.User.Roles
+		}
+	} else {
+		claims["sub"] = grant.ClientID
+	}
+	if grant.ClientID != "" {
+		claims["client_id"] = grant.ClientID
+	}
+	if len(s.config.Audience) == 1 {
+		claims["aud"] = s.config.Audience[0]
+	} else if len(s.config.Audience) > 1 {
+		claims["aud"] = s.config.Audience
+	}
+	if len(grant.Scopes) > 0 {
+		claims["scope"] = strings.Join(grant.Scopes, " ")
+	}
+
+	accessToken, err := s.signer.Sign(TokenTypeAccess, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.config.AccessTokenTTL / time.Second),
+		Scope:       strings.Join(grant.Scopes, " "),
+	}
+
+	// OIDC：授权给客户端且包含 openid 范围时签发 ID 令牌
+	if grant.User != nil && grant.ClientID != "" && containsAll(grant.Scopes, []string{ScopeOpenID}) {
+		tokens.IDToken, err = s.issueIDToken(grant, accessToken, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if grant.FamilyID == "" || grant.User == nil {
+		return tokens, nil
+	}
+
+	refreshToken := randomToken(32)
+	err = s.store.CreateRefreshToken(&RefreshToken{
+		Hash:      hashToken(refreshToken),
+		FamilyID:  grant.FamilyID,
+		UserID:    grant.User.ID,
+		ClientID:  grant.ClientID,
+		Scopes:    grant.Scopes,
+		AuthTime:  grant.AuthTime.UTC(),
+		CreatedAt: now.UTC(),
+		ExpiresAt: now.Add(s.config.RefreshTokenTTL).UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tokens.RefreshToken = refreshToken
+	return tokens, nil
+}
+
+// userScopes 用户可获得的全部授权范围（AUTH_DEFAULT_SCOPES + 用户范围）
+func (s *AuthService) userScopes(user *User) []string {
+	return intersectScopes(nil, append(append([]string(nil), s.config.DefaultScopes...), user.Scopes...))
+}
+
+// intersectScopes 计算授予的范围：未请求时授予全部可用范围，否则取请求与可用范围的交集（去重、保序）
+func intersectScopes(requested, allowed []string) []string {
+	if len(requested) == 0 {
+		requested = allowed
+	}
+	return retainScopes(requested, allowed)
+}
+
+// retainScopes 取 scopes 与 allowed 的交集（去重、保序），scopes 为空时结果为空
+func retainScopes(scopes, allowed []string) []string {
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, scope := range allowed {
+		allowedSet[scope] = true
+	}
+
+	var granted []string
+	for _, scope := range scopes {
+		if scope != "" && allowedSet[scope] {
+			granted = append(granted, scope)
+			allowedSet[scope] = false // 去重
+		}
+	}
+	return granted
+}
+
+// containsAll 检查 scopes 是否包含 required 的全部元素
+func containsAll(scopes, required []string) bool {
+	set := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		set[scope] = true
+	}
+	for _, scope := range required {
+		if !set[scope] {
+			return false
+		}
+	}
+	return true
+}
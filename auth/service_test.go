@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testPassword = "Corr3ct-Horse-Battery"
+
+func newTestService(t *testing.T) *AuthService {
+	t.Helper()
+	passwords, err := NewPasswordPolicy(SecurityConfig{PasswordMinLength: 8, PasswordMaxLength: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthService(TokenConfig{
+		Issuer:               "https://auth.example.com",
+		AccessTokenTTL:       time.Minute,
+		RefreshTokenTTL:      time.Hour,
+		AuthorizationCodeTTL: time.Minute,
+	}, MFAConfig{Skew: 1, ChallengeTTL: time.Minute, MaxAttempts: 5, RecoveryCodes: 10}, passwords, NewMemoryStore(), newTestSigner(t))
+}
+
+func newTestUser(t *testing.T, service *AuthService, username string, scopes ...string) *User {
+	t.Helper()
+	user, err := service.CreateUser(&User{Username: username, Scopes: scopes}, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	service := newTestService(t)
+	newTestUser(t, service, "alice", "read", "write")
+
+	login, _, err := service.Login("alice", testPassword, "read write")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed, _, err := service.Refresh(login.RefreshToken, nil, "read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == login.RefreshToken {
+		t.Fatal("refresh must issue a new refresh token")
+	}
+	if refreshed.Scope != "read" {
+		t.Errorf("scope = %q, want read", refreshed.Scope)
+	}
+	if _, _, err := service.VerifyAccessToken(refreshed.AccessToken); err != nil {
+		t.Errorf("refreshed access token: %v", err)
+	}
+
+	// 不能扩大授权范围
+	if _, _, err := service.Refresh(refreshed.RefreshToken, nil, "read write"); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("widening scope: err = %v, want ErrInvalidScope", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	service := newTestService(t)
+	newTestUser(t, service, "alice")
+
+	login, _, err := service.Login("alice", testPassword, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := service.Login("alice", testPassword, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, _, err := service.Refresh(login.RefreshToken, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重放已轮换的令牌：拒绝并吊销整个 family，包括轮换后的新令牌
+	if _, _, err := service.Refresh(login.RefreshToken, nil, ""); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("reused token: err = %v, want ErrTokenReused", err)
+	}
+	if _, _, err := service.Refresh(rotated.RefreshToken, nil, ""); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("rotated token after reuse: err = %v, want ErrInvalidGrant", err)
+	}
+
+	// 其他登录签发的 family 不受影响
+	if _, _, err := service.Refresh(other.RefreshToken, nil, ""); err != nil {
+		t.Errorf("other family: %v", err)
+	}
+}
+
+func TestRefreshRejectsTokenOfAnotherClient(t *testing.T) {
+	service := newTestService(t)
+	newTestUser(t, service, "alice")
+
+	login, _, err := service.Login("alice", testPassword, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他客户端提交该令牌不会消费它，也不会吊销合法持有者的 family
+	if _, _, err := service.Refresh(login.RefreshToken, &Client{ID: "other"}, ""); !errors.Is(err, ErrInvalidGrant) {
+		t.Fatalf("foreign client: err = %v, want ErrInvalidGrant", err)
+	}
+	if _, _, err := service.Refresh(login.RefreshToken, nil, ""); err != nil {
+		t.Errorf("owner after foreign attempt: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 浏览器 cookie 名称
+const (
+	sessionCookieName = "auth_session"
+	csrfCookieName    = "auth_csrf"
+)
+
+// CreateSession 创建浏览器登录会话，返回写入 cookie 的会话 ID
+func (s *AuthService) CreateSession(user *User, ttl time.Duration) (string, *Session, error) {
+	id := randomToken(32)
+	now := time.Now().UTC()
+
+	session := &Session{
+		Hash:      hashToken(id),
+		UserID:    user.ID,
+		AuthTime:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.store.CreateSession(session); err != nil {
+		return "", nil, err
+	}
+	return id, session, nil
+}
+
+// GetSession 获取有效的登录会话及其用户
+func (s *AuthService) GetSession(id string) (*Session, *User, error) {
+	session, err := s.store.GetSession(hashToken(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		s.store.DeleteSession(session.Hash)
+		return nil, nil, ErrNotFound
+	}
+
+	user, err := s.store.GetUser(session.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Disabled {
+		return nil, nil, ErrUserDisabled
+	}
+	return session, user, nil
+}
+
+// DeleteSession 删除登录会话
+func (s *AuthService) DeleteSession(id string) error {
+	return s.store.DeleteSession(hashToken(id))
+}
+
+// currentSession 读取请求携带的有效会话，没有时返回 nil
+func (h *Handler) currentSession(r *http.Request) (*Session, *User) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+
+	session, user, err := h.service.GetSession(cookie.Value)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrUserDisabled) {
+			GetLogger().ErrorWithRequestID(getRequestID(r), "Failed to load session", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return nil, nil
+	}
+	return session, user
+}
+
+// setSessionCookie 写入会话 cookie
+func (h *Handler) setSessionCookie(w http.ResponseWriter, id string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   h.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearSessionCookie 删除会话 cookie
+func (h *Handler) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// csrfToken 返回表单使用的 CSRF 令牌（双重提交 cookie），没有时生成
+func (h *Handler) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookieName); err == nil && len(cookie.Value) >= 32 {
+		return cookie.Value
+	}
+
+	token := randomToken(32)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   h.secureCookies(),
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// checkCSRF 校验表单中的 CSRF 令牌与 cookie 一致
+func (h *Handler) checkCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostFormValue("csrf_token"))) == 1
+}
+
+// secureCookies 对外地址为 HTTPS 时 cookie 只通过 HTTPS 发送
+func (h *Handler) secureCookies() bool {
+	return strings.HasPrefix(h.config.Token.Issuer, "https://")
+}
+
+// safeReturnTo 只允许站内相对路径作为登录后的跳转目标，防止开放重定向
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return "/"
+	}
+	return returnTo
+}
+
+// LoginPage 浏览器登录页，prompt=login 时即使已登录也要求重新输入密码
+func (h *Handler) LoginPage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	returnTo := safeReturnTo(query.Get("return_to"))
+
+	// 已登录时直接跳转
+	if _, user := h.currentSession(r); user != nil && query.Get("prompt") != PromptLogin {
+		http.Redirect(w, r, returnTo, http.StatusFound)
+		return
+	}
+
+	renderPage(w, http.StatusOK, "login", pageData{
+		Title:    "Sign in",
+		CSRF:     h.csrfToken(w, r),
+		ReturnTo: returnTo,
+		Username: query.Get("login_hint"),
+	})
+}
+
+// LoginSubmit 提交登录表单，成功后建立会话并跳转，需要第二因素时先跳转验证页
+func (h *Handler) LoginSubmit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := r.ParseForm(); err != nil || !h.checkCSRF(r) {
+		renderError(w, http.StatusBadRequest, "Invalid request", "The form has expired. Please start again.")
+		return
+	}
+
+	username := r.PostFormValue("username")
+	returnTo := safeReturnTo(r.PostFormValue("return_to"))
+
+	ip := getClientIP(r)
+	if throttle := h.guard.Check(username, ip); throttle != nil {
+		retryAfter := logThrottled(r, username, throttle)
+		w.Header().Set("Retry-After", fmt.Sprint(retryAfter))
+		renderPage(w, http.StatusTooManyRequests, "login", pageData{
+			Title:    "Sign in",
+			Error:    fmt.Sprintf("Too many failed attempts. Please try again in %d seconds.", retryAfter),
+			CSRF:     h.csrfToken(w, r),
+			ReturnTo: returnTo,
+			Username: username,
+		})
+		return
+	}
+
+	user, err := h.service.PasswordLogin(username, r.PostFormValue("password"))
+	var challenge *MFAChallengeError
+	switch {
+	case errors.As(err, &challenge):
+		h.startMFALogin(w, r, user, challenge, returnTo)
+		return
+	case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrUserDisabled):
+		GetLogger().WarnWithRequestID(getRequestID(r), "Login failed", map[string]interface{}{
+			"username":  username,
+			"reason":    err.Error(),
+			"remote_ip": ip,
+		})
+		h.recordLoginFailure(r, username, ip)
+		renderPage(w, http.StatusUnauthorized, "login", pageData{
+			Title:    "Sign in",
+			Error:    "Invalid username or password.",
+			CSRF:     h.csrfToken(w, r),
+			ReturnTo: returnTo,
+			Username: username,
+		})
+		return
+	case err != nil:
+		h.serverError(w, r, "Login error", err)
+		return
+	}
+
+	if !h.startSession(w, r, user) {
+		return
+	}
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
+
+// startSession 登录成功后建立会话，失败时已写入错误响应
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, user *User) bool {
+	// 登录后轮换会话 ID，防止会话固定
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		h.service.DeleteSession(cookie.Value)
+	}
+
+	id, session, err := h.service.CreateSession(user, h.config.Account.SessionTTL)
+	if err != nil {
+		h.serverError(w, r, "Failed to create session", err)
+		return false
+	}
+	h.setSessionCookie(w, id, session.ExpiresAt)
+	h.guard.Succeed(user.Username)
+
+	GetLogger().InfoWithRequestID(getRequestID(r), "Login succeeded", map[string]interface{}{
+		"user_id":   user.ID,
+		"session":   true,
+		"remote_ip": getClientIP(r),
+	})
+	return true
+}
+
+// Home 登录状态页
+func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
+	_, user := h.currentSession(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	renderPage(w, http.StatusOK, "signed_in", pageData{Title: "Signed in", Username: user.Username})
+}
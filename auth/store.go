@@ -0,0 +1,1143 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("already exists")
+	ErrTokenReused  = errors.New("token reused")
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// User 用户账户
+type User struct {
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	PasswordHash  string    `json:"password_hash"`
+	Name          string    `json:"name,omitempty"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified,omitempty"`
+	Scopes        []string  `json:"scopes,omitempty"` // 用户可获得的授权范围
+	Roles         []string  `json:"roles,omitempty"`  // RBAC 角色，写入访问令牌的 roles 声明
+	Disabled      bool      `json:"disabled,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.Scopes = append([]string(nil), u.Scopes...)
+	c.Roles = append([]string(nil), u.Roles...)
+	return &c
+}
+
+// RefreshToken 刷新令牌记录，只保存令牌的 SHA-256 哈希
+// 同一次登录轮换出的令牌属于同一个 family，旧令牌被重放时整个 family 失效
+type RefreshToken struct {
+	Hash      string    `json:"hash"`
+	FamilyID  string    `json:"family_id"`
+	UserID    string    `json:"user_id"`
+	ClientID  string    `json:"client_id,omitempty"` // 为空表示 /api/v1/login 签发
+	Scopes    []string  `json:"scopes,omitempty"`
+	AuthTime  time.Time `json:"auth_time,omitempty"` // 用户最初登录时间，刷新出的 ID 令牌沿用
+	Used      bool      `json:"used,omitempty"`
+	Revoked   bool      `json:"revoked,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (t *RefreshToken) clone() *RefreshToken {
+	c := *t
+	c.Scopes = append([]string(nil), t.Scopes...)
+	return &c
+}
+
+// Client OAuth2 客户端
+type Client struct {
+	ID                     string    `json:"client_id"`
+	SecretHash             string    `json:"secret_hash,omitempty"` // 客户端密钥的 SHA-256，公共客户端为空
+	Name                   string    `json:"name"`
+	RedirectURIs           []string  `json:"redirect_uris,omitempty"`
+	PostLogoutRedirectURIs []string  `json:"post_logout_redirect_uris,omitempty"`
+	Scopes                 []string  `json:"scopes,omitempty"`      // 客户端可申请的授权范围
+	GrantTypes             []string  `json:"grant_types,omitempty"` // 允许的授权类型
+	Public                 bool      `json:"public,omitempty"`      // 公共客户端（无密钥，必须使用 PKCE）
+	Trusted                bool      `json:"trusted,omitempty"`     // 第一方客户端，跳过授权确认页
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+func (c *Client) clone() *Client {
+	d := *c
+	d.RedirectURIs = append([]string(nil), c.RedirectURIs...)
+	d.PostLogoutRedirectURIs = append([]string(nil), c.PostLogoutRedirectURIs...)
+	d.Scopes = append([]string(nil), c.Scopes...)
+	d.GrantTypes = append([]string(nil), c.GrantTypes...)
+	return &d
+}
+
+// AuthorizationCode 授权码记录，只保存授权码的 SHA-256 哈希
+type AuthorizationCode struct {
+	Hash                string    `json:"hash"`
+	ClientID            string    `json:"client_id"`
+	UserID              string    `json:"user_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	Scopes              []string  `json:"scopes,omitempty"`
+	CodeChallenge       string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string    `json:"code_challenge_method,omitempty"`
+	Nonce               string    `json:"nonce,omitempty"`
+	AuthTime            time.Time `json:"auth_time"`
+	FamilyID            string    `json:"family_id"` // 兑换出的刷新令牌 family，授权码被重放时吊销
+	Used                bool      `json:"used,omitempty"`
+	ExpiresAt           time.Time `json:"expires_at"`
+}
+
+func (c *AuthorizationCode) clone() *AuthorizationCode {
+	d := *c
+	d.Scopes = append([]string(nil), c.Scopes...)
+	return &d
+}
+
+// Consent 用户对客户端的授权记录
+type Consent struct {
+	UserID    string    `json:"user_id"`
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+func (c *Consent) clone() *Consent {
+	d := *c
+	d.Scopes = append([]string(nil), c.Scopes...)
+	return &d
+}
+
+// Session 浏览器登录会话，只保存会话 ID 的 SHA-256 哈希
+type Session struct {
+	Hash      string    `json:"hash"`
+	UserID    string    `json:"user_id"`
+	AuthTime  time.Time `json:"auth_time"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MFA 用户的两步验证（TOTP）状态
+type MFA struct {
+	UserID        string    `json:"user_id"`
+	TOTPSecret    string    `json:"totp_secret"`              // base32 编码的 TOTP 密钥
+	Enabled       bool      `json:"enabled,omitempty"`        // 首次验证通过后启用，之前为待确认的注册
+	LastStep      int64     `json:"last_step,omitempty"`      // 最近一次使用的时间步，防止验证码重放
+	RecoveryCodes []string  `json:"recovery_codes,omitempty"` // 未使用恢复码的 SHA-256
+	CreatedAt     time.Time `json:"created_at"`
+	EnabledAt     time.Time `json:"enabled_at,omitempty"`
+}
+
+func (m *MFA) clone() *MFA {
+	c := *m
+	c.RecoveryCodes = append([]string(nil), m.RecoveryCodes...)
+	return &c
+}
+
+// MFAChallenge 密码已验证、等待第二因素的登录，只保存令牌的 SHA-256 哈希
+type MFAChallenge struct {
+	Hash      string    `json:"hash"`
+	UserID    string    `json:"user_id"`
+	Scope     string    `json:"scope,omitempty"` // /api/v1/login 请求的授权范围
+	Attempts  int       `json:"attempts,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Permission RBAC 权限
+type Permission struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Role RBAC 角色，权限 "*" 表示全部权限
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Permissions []string  `json:"permissions,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (r *Role) clone() *Role {
+	d := *r
+	d.Permissions = append([]string(nil), r.Permissions...)
+	return &d
+}
+
+// RouteBinding 网关路由的访问要求：调用方拥有任一角色或任一权限即可访问
+type RouteBinding struct {
+	ID          string    `json:"id"`
+	Route       string    `json:"route"` // "[METHOD ]PATH"，与网关路由规则格式一致
+	Roles       []string  `json:"roles,omitempty"`
+	Permissions []string  `json:"permissions,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (b *RouteBinding) clone() *RouteBinding {
+	d := *b
+	d.Roles = append([]string(nil), b.Roles...)
+	d.Permissions = append([]string(nil), b.Permissions...)
+	return &d
+}
+
+// Store 认证数据存储接口，返回值均为副本
+type Store interface {
+	CreateUser(user *User) error
+	GetUser(id string) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	UpdateUser(user *User) error
+	DeleteUser(id string) error
+	ListUsers() ([]*User, error)
+
+	CreateRefreshToken(token *RefreshToken) error
+	GetRefreshToken(hash string) (*RefreshToken, error)
+	// ConsumeRefreshToken 原子地将令牌标记为已使用，已使用过的令牌返回 ErrTokenReused
+	ConsumeRefreshToken(hash string) (*RefreshToken, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID string) error
+
+	// RevokeAccessToken 记录被吊销的访问令牌 jti，保留到令牌过期
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+
+	CreateClient(client *Client) error
+	GetClient(id string) (*Client, error)
+	UpdateClient(client *Client) error
+	DeleteClient(id string) error
+	ListClients() ([]*Client, error)
+
+	CreateAuthorizationCode(code *AuthorizationCode) error
+	// ConsumeAuthorizationCode 原子地将授权码标记为已使用，已使用过的授权码返回 ErrTokenReused
+	ConsumeAuthorizationCode(hash string) (*AuthorizationCode, error)
+
+	GetConsent(userID, clientID string) (*Consent, error)
+	SaveConsent(consent *Consent) error
+
+	CreateSession(session *Session) error
+	GetSession(hash string) (*Session, error)
+	DeleteSession(hash string) error
+	// DeleteUserSessions 删除用户的全部登录会话（重置密码后使用）
+	DeleteUserSessions(userID string) error
+
+	// SaveMFA 创建或替换用户的两步验证状态
+	SaveMFA(mfa *MFA) error
+	GetMFA(userID string) (*MFA, error)
+	DeleteMFA(userID string) error
+	// UseTOTPStep 原子地记录使用过的时间步，不大于上次使用的时间步返回 ErrTokenReused
+	UseTOTPStep(userID string, step int64) error
+	// UseRecoveryCode 原子地删除一个恢复码并返回剩余数量，不存在时返回 ErrNotFound
+	UseRecoveryCode(userID, hash string) (int, error)
+
+	CreateMFAChallenge(challenge *MFAChallenge) error
+	GetMFAChallenge(hash string) (*MFAChallenge, error)
+	// AddMFAChallengeAttempt 原子地增加验证失败次数并返回增加后的次数
+	AddMFAChallengeAttempt(hash string) (int, error)
+	DeleteMFAChallenge(hash string) error
+
+	CreatePermission(permission *Permission) error
+	GetPermission(name string) (*Permission, error)
+	UpdatePermission(permission *Permission) error
+	// DeletePermission 删除权限，并从角色和路由绑定中移除
+	DeletePermission(name string) error
+	ListPermissions() ([]*Permission, error)
+
+	CreateRole(role *Role) error
+	GetRole(name string) (*Role, error)
+	UpdateRole(role *Role) error
+	// DeleteRole 删除角色，并从用户和路由绑定中移除
+	DeleteRole(name string) error
+	ListRoles() ([]*Role, error)
+
+	CreateRouteBinding(binding *RouteBinding) error
+	GetRouteBinding(id string) (*RouteBinding, error)
+	UpdateRouteBinding(binding *RouteBinding) error
+	DeleteRouteBinding(id string) error
+	ListRouteBindings() ([]*RouteBinding, error)
+
+	// DeleteExpired 清理过期的令牌、授权码、会话和两步验证登录
+	DeleteExpired(now time.Time) (int, error)
+}
+
+// storeData 存储的全部数据，file 存储将其整体序列化
+type storeData struct {
+	Users               map[string]*User              `json:"users"`
+	RefreshTokens       map[string]*RefreshToken      `json:"refresh_tokens"`
+	RevokedAccessTokens map[string]time.Time          `json:"revoked_access_tokens"`
+	Clients             map[string]*Client            `json:"clients"`
+	AuthorizationCodes  map[string]*AuthorizationCode `json:"authorization_codes"`
+	Consents            map[string]*Consent           `json:"consents"` // key: userID + " " + clientID
+	Sessions            map[string]*Session           `json:"sessions"`
+	MFA                 map[string]*MFA               `json:"mfa"` // key: userID
+	MFAChallenges       map[string]*MFAChallenge      `json:"mfa_challenges"`
+	Permissions         map[string]*Permission        `json:"permissions"`
+	Roles               map[string]*Role              `json:"roles"`
+	RouteBindings       map[string]*RouteBinding      `json:"route_bindings"`
+}
+
+func newStoreData() *storeData {
+	d := &storeData{}
+	d.ensureMaps()
+	return d
+}
+
+// ensureMaps 补全反序列化后缺失的 map
+func (d *storeData) ensureMaps() {
+	if d.Users == nil {
+		d.Users = make(map[string]*User)
+	}
+	if d.RefreshTokens == nil {
+		d.RefreshTokens = make(map[string]*RefreshToken)
+	}
+	if d.RevokedAccessTokens == nil {
+		d.RevokedAccessTokens = make(map[string]time.Time)
+	}
+	if d.Clients == nil {
+		d.Clients = make(map[string]*Client)
+	}
+	if d.AuthorizationCodes == nil {
+		d.AuthorizationCodes = make(map[string]*AuthorizationCode)
+	}
+	if d.Consents == nil {
+		d.Consents = make(map[string]*Consent)
+	}
+	if d.Sessions == nil {
+		d.Sessions = make(map[string]*Session)
+	}
+	if d.MFA == nil {
+		d.MFA = make(map[string]*MFA)
+	}
+	if d.MFAChallenges == nil {
+		d.MFAChallenges = make(map[string]*MFAChallenge)
+	}
+	if d.Permissions == nil {
+		d.Permissions = make(map[string]*Permission)
+	}
+	if d.Roles == nil {
+		d.Roles = make(map[string]*Role)
+	}
+	if d.RouteBindings == nil {
+		d.RouteBindings = make(map[string]*RouteBinding)
+	}
+}
+
+// MemoryStore 内存存储
+type MemoryStore struct {
+	data *storeData
+	mu   sync.RWMutex
+
+	// persist 在每次修改后调用（持有写锁），由 file 存储设置
+	persist func(data *storeData) error
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: newStoreData()}
+}
+
+// commit 持久化修改，调用方需持有写锁
+func (s *MemoryStore) commit() error {
+	if s.persist == nil {
+		return nil
+	}
+	return s.persist(s.data)
+}
+
+// CreateUser 创建用户，用户名不区分大小写且唯一
+func (s *MemoryStore) CreateUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Users[user.ID]; exists {
+		return ErrConflict
+	}
+	if s.findUserByUsername(user.Username) != nil {
+		return ErrConflict
+	}
+
+	s.data.Users[user.ID] = user.clone()
+	return s.commit()
+}
+
+// GetUser 按 ID 获取用户
+func (s *MemoryStore) GetUser(id string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.data.Users[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return user.clone(), nil
+}
+
+// GetUserByUsername 按用户名获取用户
+func (s *MemoryStore) GetUserByUsername(username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.findUserByUsername(username)
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	return user.clone(), nil
+}
+
+func (s *MemoryStore) findUserByUsername(username string) *User {
+	for _, user := range s.data.Users {
+		if strings.EqualFold(user.Username, username) {
+			return user
+		}
+	}
+	return nil
+}
+
+// UpdateUser 更新用户
+func (s *MemoryStore) UpdateUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Users[user.ID]; !exists {
+		return ErrNotFound
+	}
+	if other := s.findUserByUsername(user.Username); other != nil && other.ID != user.ID {
+		return ErrConflict
+	}
+
+	s.data.Users[user.ID] = user.clone()
+	return s.commit()
+}
+
+// DeleteUser 删除用户及其刷新令牌、授权记录、会话和两步验证
+func (s *MemoryStore) DeleteUser(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Users[id]; !exists {
+		return ErrNotFound
+	}
+
+	delete(s.data.Users, id)
+	for hash, token := range s.data.RefreshTokens {
+		if token.UserID == id {
+			delete(s.data.RefreshTokens, hash)
+		}
+	}
+	for key, consent := range s.data.Consents {
+		if consent.UserID == id {
+			delete(s.data.Consents, key)
+		}
+	}
+	for hash, session := range s.data.Sessions {
+		if session.UserID == id {
+			delete(s.data.Sessions, hash)
+		}
+	}
+	delete(s.data.MFA, id)
+	for hash, challenge := range s.data.MFAChallenges {
+		if challenge.UserID == id {
+			delete(s.data.MFAChallenges, hash)
+		}
+	}
+	return s.commit()
+}
+
+// ListUsers 按创建时间列出用户
+func (s *MemoryStore) ListUsers() ([]*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]*User, 0, len(s.data.Users))
+	for _, user := range s.data.Users {
+		users = append(users, user.clone())
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	return users, nil
+}
+
+// CreateRefreshToken 保存刷新令牌
+func (s *MemoryStore) CreateRefreshToken(token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.RefreshTokens[token.Hash]; exists {
+		return ErrConflict
+	}
+
+	s.data.RefreshTokens[token.Hash] = token.clone()
+	return s.commit()
+}
+
+// GetRefreshToken 获取刷新令牌
+func (s *MemoryStore) GetRefreshToken(hash string) (*RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, exists := s.data.RefreshTokens[hash]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return token.clone(), nil
+}
+
+// ConsumeRefreshToken 使用刷新令牌
+func (s *MemoryStore) ConsumeRefreshToken(hash string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.data.RefreshTokens[hash]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if token.Revoked {
+		return token.clone(), ErrTokenRevoked
+	}
+	if token.Used {
+		return token.clone(), ErrTokenReused
+	}
+
+	token.Used = true
+	return token.clone(), s.commit()
+}
+
+// RevokeRefreshTokenFamily 吊销同一 family 的全部刷新令牌
+func (s *MemoryStore) RevokeRefreshTokenFamily(familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.data.RefreshTokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+		}
+	}
+	return s.commit()
+}
+
+// RevokeUserRefreshTokens 吊销用户的全部刷新令牌
+func (s *MemoryStore) RevokeUserRefreshTokens(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.data.RefreshTokens {
+		if token.UserID == userID {
+			token.Revoked = true
+		}
+	}
+	return s.commit()
+}
+
+// RevokeAccessToken 吊销访问令牌
+func (s *MemoryStore) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.RevokedAccessTokens[jti] = expiresAt
+	return s.commit()
+}
+
+// IsAccessTokenRevoked 检查访问令牌是否已吊销
+func (s *MemoryStore) IsAccessTokenRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, revoked := s.data.RevokedAccessTokens[jti]
+	return revoked, nil
+}
+
+// CreateClient 注册客户端
+func (s *MemoryStore) CreateClient(client *Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Clients[client.ID]; exists {
+		return ErrConflict
+	}
+
+	s.data.Clients[client.ID] = client.clone()
+	return s.commit()
+}
+
+// GetClient 获取客户端
+func (s *MemoryStore) GetClient(id string) (*Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, exists := s.data.Clients[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return client.clone(), nil
+}
+
+// UpdateClient 更新客户端
+func (s *MemoryStore) UpdateClient(client *Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Clients[client.ID]; !exists {
+		return ErrNotFound
+	}
+
+	s.data.Clients[client.ID] = client.clone()
+	return s.commit()
+}
+
+// DeleteClient 删除客户端及其签发的刷新令牌和授权记录
+func (s *MemoryStore) DeleteClient(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Clients[id]; !exists {
+		return ErrNotFound
+	}
+
+	delete(s.data.Clients, id)
+	for hash, token := range s.data.RefreshTokens {
+		if token.ClientID == id {
+			delete(s.data.RefreshTokens, hash)
+		}
+	}
+	for hash, code := range s.data.AuthorizationCodes {
+		if code.ClientID == id {
+			delete(s.data.AuthorizationCodes, hash)
+		}
+	}
+	for key, consent := range s.data.Consents {
+		if consent.ClientID == id {
+			delete(s.data.Consents, key)
+		}
+	}
+	return s.commit()
+}
+
+// ListClients 按创建时间列出客户端
+func (s *MemoryStore) ListClients() ([]*Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(s.data.Clients))
+	for _, client := range s.data.Clients {
+		clients = append(clients, client.clone())
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+	})
+	return clients, nil
+}
+
+// CreateAuthorizationCode 保存授权码
+func (s *MemoryStore) CreateAuthorizationCode(code *AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.AuthorizationCodes[code.Hash]; exists {
+		return ErrConflict
+	}
+
+	s.data.AuthorizationCodes[code.Hash] = code.clone()
+	return s.commit()
+}
+
+// ConsumeAuthorizationCode 使用授权码
+func (s *MemoryStore) ConsumeAuthorizationCode(hash string) (*AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, exists := s.data.AuthorizationCodes[hash]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if code.Used {
+		return code.clone(), ErrTokenReused
+	}
+
+	code.Used = true
+	return code.clone(), s.commit()
+}
+
+// GetConsent 获取用户对客户端的授权记录
+func (s *MemoryStore) GetConsent(userID, clientID string) (*Consent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	consent, exists := s.data.Consents[userID+" "+clientID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return consent.clone(), nil
+}
+
+// SaveConsent 保存授权记录（覆盖）
+func (s *MemoryStore) SaveConsent(consent *Consent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Consents[consent.UserID+" "+consent.ClientID] = consent.clone()
+	return s.commit()
+}
+
+// CreateSession 保存登录会话
+func (s *MemoryStore) CreateSession(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Sessions[session.Hash]; exists {
+		return ErrConflict
+	}
+
+	c := *session
+	s.data.Sessions[session.Hash] = &c
+	return s.commit()
+}
+
+// GetSession 获取登录会话
+func (s *MemoryStore) GetSession(hash string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.data.Sessions[hash]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	c := *session
+	return &c, nil
+}
+
+// DeleteSession 删除登录会话
+func (s *MemoryStore) DeleteSession(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Sessions[hash]; !exists {
+		return nil
+	}
+
+	delete(s.data.Sessions, hash)
+	return s.commit()
+}
+
+// DeleteUserSessions 删除用户的全部登录会话
+func (s *MemoryStore) DeleteUserSessions(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := false
+	for hash, session := range s.data.Sessions {
+		if session.UserID == userID {
+			delete(s.data.Sessions, hash)
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+	return s.commit()
+}
+
+// SaveMFA 保存两步验证状态
+func (s *MemoryStore) SaveMFA(mfa *MFA) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.MFA[mfa.UserID] = mfa.clone()
+	return s.commit()
+}
+
+// GetMFA 获取用户的两步验证状态
+func (s *MemoryStore) GetMFA(userID string) (*MFA, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	mfa, exists := s.data.MFA[userID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return mfa.clone(), nil
+}
+
+// DeleteMFA 删除用户的两步验证状态
+func (s *MemoryStore) DeleteMFA(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.MFA[userID]; !exists {
+		return ErrNotFound
+	}
+
+	delete(s.data.MFA, userID)
+	return s.commit()
+}
+
+// UseTOTPStep 记录使用过的时间步
+func (s *MemoryStore) UseTOTPStep(userID string, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mfa, exists := s.data.MFA[userID]
+	if !exists {
+		return ErrNotFound
+	}
+	if step <= mfa.LastStep {
+		return ErrTokenReused
+	}
+
+	mfa.LastStep = step
+	return s.commit()
+}
+
+// UseRecoveryCode 删除一个恢复码
+func (s *MemoryStore) UseRecoveryCode(userID, hash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mfa, exists := s.data.MFA[userID]
+	if !exists {
+		return 0, ErrNotFound
+	}
+	for i, code := range mfa.RecoveryCodes {
+		if code == hash {
+			mfa.RecoveryCodes = append(mfa.RecoveryCodes[:i:i], mfa.RecoveryCodes[i+1:]...)
+			return len(mfa.RecoveryCodes), s.commit()
+		}
+	}
+	return len(mfa.RecoveryCodes), ErrNotFound
+}
+
+// CreateMFAChallenge 保存待完成的两步验证登录
+func (s *MemoryStore) CreateMFAChallenge(challenge *MFAChallenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.MFAChallenges[challenge.Hash]; exists {
+		return ErrConflict
+	}
+
+	c := *challenge
+	s.data.MFAChallenges[challenge.Hash] = &c
+	return s.commit()
+}
+
+// GetMFAChallenge 获取待完成的两步验证登录
+func (s *MemoryStore) GetMFAChallenge(hash string) (*MFAChallenge, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	challenge, exists := s.data.MFAChallenges[hash]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	c := *challenge
+	return &c, nil
+}
+
+// AddMFAChallengeAttempt 增加验证失败次数
+func (s *MemoryStore) AddMFAChallengeAttempt(hash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	challenge, exists := s.data.MFAChallenges[hash]
+	if !exists {
+		return 0, ErrNotFound
+	}
+
+	challenge.Attempts++
+	return challenge.Attempts, s.commit()
+}
+
+// DeleteMFAChallenge 删除待完成的两步验证登录，不存在时返回 ErrNotFound
+func (s *MemoryStore) DeleteMFAChallenge(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.MFAChallenges[hash]; !exists {
+		return ErrNotFound
+	}
+
+	delete(s.data.MFAChallenges, hash)
+	return s.commit()
+}
+
+// CreatePermission 创建权限
+func (s *MemoryStore) CreatePermission(permission *Permission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Permissions[permission.Name]; exists {
+		return ErrConflict
+	}
+
+	p := *permission
+	s.data.Permissions[p.Name] = &p
+	return s.commit()
+}
+
+// GetPermission 获取权限
+func (s *MemoryStore) GetPermission(name string) (*Permission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	permission, exists := s.data.Permissions[name]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	p := *permission
+	return &p, nil
+}
+
+// UpdatePermission 更新权限
+func (s *MemoryStore) UpdatePermission(permission *Permission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Permissions[permission.Name]; !exists {
+		return ErrNotFound
+	}
+
+	p := *permission
+	s.data.Permissions[p.Name] = &p
+	return s.commit()
+}
+
+// DeletePermission 删除权限，并从角色和路由绑定中移除
+func (s *MemoryStore) DeletePermission(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Permissions[name]; !exists {
+		return ErrNotFound
+	}
+
+	delete(s.data.Permissions, name)
+	for _, role := range s.data.Roles {
+		role.Permissions = removeString(role.Permissions, name)
+	}
+	for _, binding := range s.data.RouteBindings {
+		binding.Permissions = removeString(binding.Permissions, name)
+	}
+	return s.commit()
+}
+
+// ListPermissions 按名称列出权限
+func (s *MemoryStore) ListPermissions() ([]*Permission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	permissions := make([]*Permission, 0, len(s.data.Permissions))
+	for _, permission := range s.data.Permissions {
+		p := *permission
+		permissions = append(permissions, &p)
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		return permissions[i].Name < permissions[j].Name
+	})
+	return permissions, nil
+}
+
+// CreateRole 创建角色
+func (s *MemoryStore) CreateRole(role *Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Roles[role.Name]; exists {
+		return ErrConflict
+	}
+
+	s.data.Roles[role.Name] = role.clone()
+	return s.commit()
+}
+
+// GetRole 获取角色
+func (s *MemoryStore) GetRole(name string) (*Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	role, exists := s.data.Roles[name]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return role.clone(), nil
+}
+
+// UpdateRole 更新角色
+func (s *MemoryStore) UpdateRole(role *Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Roles[role.Name]; !exists {
+		return ErrNotFound
+	}
+
+	s.data.Roles[role.Name] = role.clone()
+	return s.commit()
+}
+
+// DeleteRole 删除角色，并从用户和路由绑定中移除
+func (s *MemoryStore) DeleteRole(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.Roles[name]; !exists {
+		return ErrNotFound
+	}
+
+	delete(s.data.Roles, name)
+	for _, user := range s.data.Users {
+		user.Roles = removeString(user.Roles, name)
+	}
+	for _, binding := range s.data.RouteBindings {
+		binding.Roles = removeString(binding.Roles, name)
+	}
+	return s.commit()
+}
+
+// ListRoles 按名称列出角色
+func (s *MemoryStore) ListRoles() ([]*Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make([]*Role, 0, len(s.data.Roles))
+	for _, role := range s.data.Roles {
+		roles = append(roles, role.clone())
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+	return roles, nil
+}
+
+// CreateRouteBinding 创建路由绑定
+func (s *MemoryStore) CreateRouteBinding(binding *RouteBinding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.RouteBindings[binding.ID]; exists {
+		return ErrConflict
+	}
+
+	s.data.RouteBindings[binding.ID] = binding.clone()
+	return s.commit()
+}
+
+// GetRouteBinding 获取路由绑定
+func (s *MemoryStore) GetRouteBinding(id string) (*RouteBinding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	binding, exists := s.data.RouteBindings[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return binding.clone(), nil
+}
+
+// UpdateRouteBinding 更新路由绑定
+func (s *MemoryStore) UpdateRouteBinding(binding *RouteBinding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.RouteBindings[binding.ID]; !exists {
+		return ErrNotFound
+	}
+
+	s.data.RouteBindings[binding.ID] = binding.clone()
+	return s.commit()
+}
+
+// DeleteRouteBinding 删除路由绑定
+func (s *MemoryStore) DeleteRouteBinding(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.data.RouteBindings[id]; !exists {
+		return ErrNotFound
+	}
+
+	delete(s.data.RouteBindings, id)
+	return s.commit()
+}
+
+// ListRouteBindings 按创建时间列出路由绑定
+func (s *MemoryStore) ListRouteBindings() ([]*RouteBinding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bindings := make([]*RouteBinding, 0, len(s.data.RouteBindings))
+	for _, binding := range s.data.RouteBindings {
+		bindings = append(bindings, binding.clone())
+	}
+	sort.Slice(bindings, func(i, j int) bool {
+		return bindings[i].CreatedAt.Before(bindings[j].CreatedAt)
+	})
+	return bindings, nil
+}
+
+// removeString 返回去掉 value 后的切片
+func removeString(values []string, value string) []string {
+	result := values[:0]
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// DeleteExpired 清理过期数据
+func (s *MemoryStore) DeleteExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for hash, token := range s.data.RefreshTokens {
+		if now.After(token.ExpiresAt) {
+			delete(s.data.RefreshTokens, hash)
+			removed++
+		}
+	}
+	for jti, expiresAt := range s.data.RevokedAccessTokens {
+		if now.After(expiresAt) {
+			delete(s.data.RevokedAccessTokens, jti)
+			removed++
+		}
+	}
+	for hash, code := range s.data.AuthorizationCodes {
+		if now.After(code.ExpiresAt) {
+			delete(s.data.AuthorizationCodes, hash)
+			removed++
+		}
+	}
+	for hash, session := range s.data.Sessions {
+		if now.After(session.ExpiresAt) {
+			delete(s.data.Sessions, hash)
+			removed++
+		}
+	}
+	for hash, challenge := range s.data.MFAChallenges {
+		if now.After(challenge.ExpiresAt) {
+			delete(s.data.MFAChallenges, hash)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.commit()
+}
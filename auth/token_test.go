@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T) *TokenSigner {
+	t.Helper()
+	signer, err := LoadOrCreateSigner(filepath.Join(t.TempDir(), "signing.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestTokenSignerRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	signer, err := LoadOrCreateSigner(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signer.Sign(TokenTypeAccess, map[string]interface{}{
+		"sub": "alice",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := signer.Verify(token, TokenTypeAccess)
+	if err != nil || claims["sub"] != "alice" {
+		t.Fatalf("Verify = %v, %v", claims, err)
+	}
+
+	// 重启后从文件加载同一私钥，已签发的令牌仍然有效
+	reloaded, err := LoadOrCreateSigner(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.kid != signer.kid {
+		t.Errorf("kid after reload = %s, want %s", reloaded.kid, signer.kid)
+	}
+	if _, err := reloaded.Verify(token, TokenTypeAccess); err != nil {
+		t.Errorf("Verify after reload: %v", err)
+	}
+
+	jwks := signer.JWKS()["keys"].([]map[string]string)
+	if len(jwks) != 1 || jwks[0]["kid"] != signer.kid || jwks[0]["alg"] != "RS256" || jwks[0]["e"] != "AQAB" {
+		t.Errorf("JWKS = %v", jwks)
+	}
+}
+
+func TestTokenSignerRejects(t *testing.T) {
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Minute).Unix()}
+
+	sign := func(s *TokenSigner, typ string, claims map[string]interface{}) string {
+		t.Helper()
+		token, err := s.Sign(typ, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	valid := sign(signer, TokenTypeAccess, claims)
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999}`)) + "." + parts[2]
+
+	for _, v := range []struct {
+		name  string
+		token string
+		typ   string
+		want  error
+	}{
+		{"ID token used as access token", sign(signer, TokenTypeID, claims), TokenTypeAccess, ErrInvalidToken},
+		{"reset token used as access token", sign(signer, TokenTypeReset, claims), TokenTypeAccess, ErrInvalidToken},
+		{"access token used as reset token", valid, TokenTypeReset, ErrInvalidToken},
+		{"unknown kid", sign(other, TokenTypeAccess, claims), TokenTypeAccess, ErrInvalidToken},
+		// kid 相同但由其他私钥签名
+		{"forged signature", sign(&TokenSigner{key: other.key, kid: signer.kid}, TokenTypeAccess, claims), TokenTypeAccess, ErrInvalidToken},
+		{"tampered payload", tampered, TokenTypeAccess, ErrInvalidToken},
+		{"missing exp", sign(signer, TokenTypeAccess, map[string]interface{}{"sub": "alice"}), TokenTypeAccess, ErrInvalidToken},
+		{"expired", sign(signer, TokenTypeAccess, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(-time.Second).Unix()}), TokenTypeAccess, ErrTokenExpired},
+		{"not a JWT", "abc.def", TokenTypeAccess, ErrInvalidToken},
+	} {
+		if _, err := signer.Verify(v.token, v.typ); !errors.Is(err, v.want) {
+			t.Errorf("%s: err = %v, want %v", v.name, err, v.want)
+		}
+	}
+
+	// VerifySignature 不检查有效期，但仍校验类型和签名
+	expired := sign(signer, TokenTypeID, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()})
+	if _, err := signer.VerifySignature(expired, TokenTypeID); err != nil {
+		t.Errorf("VerifySignature(expired) = %v", err)
+	}
+	if _, err := signer.VerifySignature(expired, TokenTypeAccess); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifySignature(wrong typ) = %v", err)
+	}
+}
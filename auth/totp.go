@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP 参数（RFC 6238 默认值，兼容常见验证器应用）
+const (
+	totpPeriod     = 30
+	totpDigits     = 6
+	totpSecretSize = 20 // 160 位，RFC 4226 推荐的 HMAC-SHA1 密钥长度
+)
+
+// 恢复码：16 个 base32 字符（80 位），显示为 xxxx-xxxx-xxxx-xxxx。
+// 存储中只保存 SHA-256，80 位随机数即使哈希泄露也无法离线穷举
+const (
+	recoveryCodeBytes        = 10
+	recoveryCodeLength       = 16
+	legacyRecoveryCodeLength = 10 // 早期生成的 50 位恢复码，重新生成前仍可使用
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret 生成 base32 编码的 TOTP 密钥
+func newTOTPSecret() string {
+	b := make([]byte, totpSecretSize)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return totpEncoding.EncodeToString(b)
+}
+
+// totpStep 时间对应的时间步
+func totpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// totpCode 计算时间步的验证码（RFC 4226 动态截断）
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// matchTOTP 在前后 skew 个时间步内查找与验证码匹配的时间步
+func matchTOTP(secret, code string, now time.Time, skew int) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := totpStep(now)
+	for offset := -skew; offset <= skew; offset++ {
+		step := current + int64(offset)
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// isTOTPCode 输入是否为 TOTP 验证码格式（否则按恢复码处理）
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// otpauthURI 验证器应用使用的 otpauth URI（即二维码内容）
+func otpauthURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// newRecoveryCodes 生成恢复码，返回明文（只展示一次）和存储用的哈希
+func newRecoveryCodes(count int) ([]string, []string) {
+	codes := make([]string, 0, count)
+	hashes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes = append(codes, code[0:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:16])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes
+}
+
+// normalizeRecoveryCode 去掉分隔符和空白并转为小写
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ':
+			return -1
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return r
+	}, code)
+}
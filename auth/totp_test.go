@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA-1 测试向量（8 位），验证码为其后 6 位
+var totpVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestTOTPKnownAnswers(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+
+	for _, v := range totpVectors {
+		now := time.Unix(v.unix, 0)
+		want := v.code[len(v.code)-totpDigits:]
+		if got := totpCode(key, totpStep(now)); got != want {
+			t.Errorf("T=%d: totpCode = %s, want %s", v.unix, got, want)
+		}
+		if step, ok := matchTOTP(secret, want, now, 0); !ok || step != totpStep(now) {
+			t.Errorf("T=%d: matchTOTP = %d, %v", v.unix, step, ok)
+		}
+	}
+}
+
+func TestMatchTOTPSkew(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+
+	for _, v := range []struct {
+		offset int64
+		skew   int
+		ok     bool
+	}{
+		{0, 0, true},
+		{-1, 0, false},
+		{-1, 1, true},
+		{1, 1, true},
+		{2, 1, false},
+		{-2, 1, false},
+	} {
+		step, ok := matchTOTP(secret, totpCode(key, current+v.offset), now, v.skew)
+		if ok != v.ok || (ok && step != current+v.offset) {
+			t.Errorf("offset %d, skew %d: matchTOTP = %d, %v; want %v", v.offset, v.skew, step, ok, v.ok)
+		}
+	}
+
+	if _, ok := matchTOTP(secret, "12345", now, 1); ok {
+		t.Error("short code must not match")
+	}
+	if _, ok := matchTOTP("not base32!", "287082", now, 1); ok {
+		t.Error("invalid secret must not match")
+	}
+}
+
+// newTestMFAUser 创建已启用两步验证的用户，返回 TOTP 密钥、恢复码和确认注册时使用的时间步
+func newTestMFAUser(t *testing.T, service *AuthService) (*User, []byte, []string, int64) {
+	t.Helper()
+	user := newTestUser(t, service, "alice")
+	mfa, err := service.BeginTOTPEnrollment(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(mfa.TOTPSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := totpStep(time.Now())
+	codes, err := service.ConfirmTOTPEnrollment(user, totpCode(key, step))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, key, codes, step
+}
+
+func TestTOTPStepReplayRejected(t *testing.T) {
+	service := newTestService(t)
+	user, key, _, step := newTestMFAUser(t, service)
+
+	// 确认注册时使用的验证码不能再用于登录
+	if _, err := service.VerifySecondFactor(user, totpCode(key, step)); !errors.Is(err, ErrMFACodeReused) {
+		t.Fatalf("code used for enrollment: err = %v, want ErrMFACodeReused", err)
+	}
+
+	// 下一时间步的验证码在偏差范围内，只能使用一次
+	next := totpCode(key, step+1)
+	if result, err := service.VerifySecondFactor(user, next); err != nil || result.Method != MFAMethodTOTP {
+		t.Fatalf("next step: result = %+v, err = %v", result, err)
+	}
+	if _, err := service.VerifySecondFactor(user, next); !errors.Is(err, ErrMFACodeReused) {
+		t.Errorf("replayed code: err = %v, want ErrMFACodeReused", err)
+	}
+	// 更早的时间步也被拒绝
+	if _, err := service.VerifySecondFactor(user, totpCode(key, step)); err == nil {
+		t.Error("earlier step accepted after a later one was used")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	service := newTestService(t)
+	user, _, codes, _ := newTestMFAUser(t, service)
+
+	if len(codes) != 10 {
+		t.Fatalf("got %d recovery codes, want 10", len(codes))
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		groups := strings.Split(code, "-")
+		if len(groups) != 4 || len(normalizeRecoveryCode(code)) != recoveryCodeLength || seen[code] {
+			t.Errorf("recovery code %q: want 4 unique groups of 4 base32 characters", code)
+		}
+		if _, err := totpEncoding.DecodeString(strings.ToUpper(normalizeRecoveryCode(code))); err != nil {
+			t.Errorf("recovery code %q is not base32: %v", code, err)
+		}
+		seen[code] = true
+	}
+
+	// 不区分大小写和分隔符，每个只能使用一次
+	entered := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	result, err := service.VerifySecondFactor(user, entered)
+	if err != nil || result.Method != MFAMethodRecoveryCode || result.Remaining != 9 {
+		t.Fatalf("recovery code: result = %+v, err = %v", result, err)
+	}
+	if _, err := service.VerifySecondFactor(user, codes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("reused recovery code: err = %v, want ErrInvalidMFACode", err)
+	}
+	if _, err := service.VerifySecondFactor(user, codes[1][:len(codes[1])-1]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("truncated recovery code: err = %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestLegacyRecoveryCodesStillAccepted(t *testing.T) {
+	service := newTestService(t)
+	user, _, _, _ := newTestMFAUser(t, service)
+
+	mfa, err := service.store.GetMFA(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfa.RecoveryCodes = []string{hashToken("abcde23456")}
+	if err := service.store.SaveMFA(mfa); err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := service.VerifySecondFactor(user, "ABCDE-23456"); err != nil || result.Remaining != 0 {
+		t.Errorf("legacy recovery code: result = %+v, err = %v", result, err)
+	}
+}
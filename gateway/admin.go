@@ -0,0 +1,339 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminServer 管理 API（独立监听器，Bearer 令牌认证）
+type AdminServer struct {
+	config  AdminConfig
+	apiKeys *APIKeyStore
+	quotas  *QuotaManager // 为 nil 时不提供配额接口
+	overlap time.Duration // 轮换时未指定 overlap 的默认值
+	server  *http.Server
+}
+
+// NewAdminServer 创建管理 API
+func NewAdminServer(config AdminConfig, apiKeys *APIKeyStore, quotas *QuotaManager, overlap time.Duration) *AdminServer {
+	a := &AdminServer{config: config, apiKeys: apiKeys, quotas: quotas, overlap: overlap}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/api-keys", a.ListAPIKeys)
+	mux.HandleFunc("POST /admin/api-keys", a.CreateAPIKey)
+	mux.HandleFunc("GET /admin/api-keys/{id}", a.GetAPIKey)
+	mux.HandleFunc("PATCH /admin/api-keys/{id}", a.UpdateAPIKey)
+	mux.HandleFunc("POST /admin/api-keys/{id}/rotate", a.RotateAPIKey)
+	mux.HandleFunc("DELETE /admin/api-keys/{id}", a.RevokeAPIKey)
+	if quotas != nil {
+		mux.HandleFunc("GET /admin/quotas/usage", a.GetQuotaUsage)
+		mux.HandleFunc("DELETE /admin/quotas/usage", a.ResetQuotaUsage)
+		mux.HandleFunc("GET /admin/quotas/report", a.GetQuotaReport)
+	}
+
+	a.server = &http.Server{
+		Addr:         config.Host + ":" + config.Port,
+		Handler:      RequestIDMiddleware(a.authorize(mux)),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+	return a
+}
+
+// Start 启动管理 API
+func (a *AdminServer) Start() {
+	go func() {
+		GetLogger().Info("Admin server started", map[string]interface{}{
+			"address": a.server.Addr,
+		})
+
+		if err := a.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			GetLogger().Error("Admin server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+}
+
+// Stop 关闭管理 API
+func (a *AdminServer) Stop() {
+	a.server.Close()
+}
+
+// authorize 校验 Authorization: Bearer <ADMIN_TOKEN>
+func (a *AdminServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.config.Token)) != 1 {
+			requestID := r.Context().Value(RequestIDKey).(string)
+			GetLogger().WarnWithRequestID(requestID, "Admin authentication failed", map[string]interface{}{
+				"path":      r.URL.Path,
+				"remote_ip": getClientIP(r),
+			})
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeAdminJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// auditAdmin 记录管理操作
+func auditAdmin(r *http.Request, message string, fields map[string]interface{}) {
+	fields["remote_ip"] = getClientIP(r)
+	requestID := r.Context().Value(RequestIDKey).(string)
+	GetLogger().InfoWithRequestID(requestID, message, fields)
+}
+
+// writeAdminJSON 写入 JSON 响应
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAdminError 将业务错误映射为 HTTP 响应
+func writeAdminError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrAPIKeyNotFound), errors.Is(err, ErrQuotaNotFound):
+		writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "not_found", "message": err.Error()})
+	case errors.Is(err, ErrAPIKeyRevoked), errors.Is(err, ErrAPIKeyExpired):
+		writeAdminJSON(w, http.StatusConflict, map[string]string{"error": "conflict", "message": err.Error()})
+	case errors.Is(err, ErrAPIKeyOwnerMissing), errors.Is(err, ErrAPIKeyUnknownTier):
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "message": err.Error()})
+	default:
+		requestID := r.Context().Value(RequestIDKey).(string)
+		GetLogger().ErrorWithRequestID(requestID, "Admin request failed", map[string]interface{}{
+			"path":  r.URL.Path,
+			"error": err.Error(),
+		})
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
+
+// decodeAdminJSON 解析请求体，失败时写入 400
+func decodeAdminJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "message": "invalid JSON body"})
+		return false
+	}
+	return true
+}
+
+// apiKeyRequest 创建 / 修改 API Key 的请求，expires_in 与 expires_at 二选一
+type apiKeyRequest struct {
+	APIKeySpec
+	ExpiresIn string `json:"expires_in"` // 如 "720h"
+}
+
+// spec 转换为 APIKeySpec
+func (req *apiKeyRequest) spec() (APIKeySpec, error) {
+	spec := req.APIKeySpec
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			return spec, errors.New("invalid expires_in")
+		}
+		expiresAt := time.Now().Add(d)
+		spec.ExpiresAt = &expiresAt
+	}
+	return spec, nil
+}
+
+// apiKeyCreated 创建 / 轮换的响应，key 只在此时返回
+type apiKeyCreated struct {
+	Key      string  `json:"key"`
+	APIKey   *APIKey `json:"api_key"`
+	Previous *APIKey `json:"previous,omitempty"` // 轮换前的 key（已设置过期时间）
+}
+
+// ListAPIKeys 列出全部托管 key（不含明文）
+func (a *AdminServer) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, a.apiKeys.List())
+}
+
+// GetAPIKey 获取托管 key
+func (a *AdminServer) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, err := a.apiKeys.Get(r.PathValue("id"))
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, key)
+}
+
+// CreateAPIKey 创建托管 key
+func (a *AdminServer) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if !decodeAdminJSON(w, r, &req) {
+		return
+	}
+	spec, err := req.spec()
+	if err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	raw, key, err := a.apiKeys.Create(spec)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	auditAdmin(r, "API key created", map[string]interface{}{
+		"api_key_id": key.ID,
+		"owner":      key.Owner,
+		"tier":       key.Tier,
+	})
+	writeAdminJSON(w, http.StatusCreated, apiKeyCreated{Key: raw, APIKey: key})
+}
+
+// UpdateAPIKey 修改托管 key 的属性，未提供的字段保持不变
+func (a *AdminServer) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if !decodeAdminJSON(w, r, &req) {
+		return
+	}
+	spec, err := req.spec()
+	if err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	key, err := a.apiKeys.Update(r.PathValue("id"), spec)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	auditAdmin(r, "API key updated", map[string]interface{}{
+		"api_key_id": key.ID,
+		"owner":      key.Owner,
+	})
+	writeAdminJSON(w, http.StatusOK, key)
+}
+
+// RotateAPIKey 轮换托管 key：生成新 key，旧 key 在重叠期内继续可用
+// 请求体可选 {"overlap": "1h"}，"0s" 表示旧 key 立即失效
+func (a *AdminServer) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Overlap string `json:"overlap"`
+	}
+	if r.ContentLength != 0 && !decodeAdminJSON(w, r, &req) {
+		return
+	}
+
+	overlap := a.overlap
+	if req.Overlap != "" {
+		d, err := time.ParseDuration(req.Overlap)
+		if err != nil || d < 0 {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "message": "invalid overlap"})
+			return
+		}
+		overlap = d
+	}
+
+	raw, key, previous, err := a.apiKeys.Rotate(r.PathValue("id"), overlap)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	auditAdmin(r, "API key rotated", map[string]interface{}{
+		"api_key_id":  key.ID,
+		"previous_id": previous.ID,
+		"owner":       key.Owner,
+		"overlap":     overlap.String(),
+	})
+	writeAdminJSON(w, http.StatusCreated, apiKeyCreated{Key: raw, APIKey: key, Previous: previous})
+}
+
+// RevokeAPIKey 立即吊销托管 key
+func (a *AdminServer) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, err := a.apiKeys.Revoke(r.PathValue("id"))
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	auditAdmin(r, "API key revoked", map[string]interface{}{
+		"api_key_id": key.ID,
+		"owner":      key.Owner,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetQuotaUsage 当前窗口的配额用量，可按 ?policy= 和 ?key= 过滤
+func (a *AdminServer) GetQuotaUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := a.quotas.Usage(r.URL.Query().Get("policy"), r.URL.Query().Get("key"))
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, usage)
+}
+
+// ResetQuotaUsage 将 ?policy= 的当前窗口用量清零，指定 ?key= 时只清零该键
+func (a *AdminServer) ResetQuotaUsage(w http.ResponseWriter, r *http.Request) {
+	policy, key := r.URL.Query().Get("policy"), r.URL.Query().Get("key")
+	if policy == "" {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "message": "policy is required"})
+		return
+	}
+
+	reset, err := a.quotas.Reset(policy, key)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	auditAdmin(r, "Quota usage reset", map[string]interface{}{
+		"quota": policy,
+		"key":   key,
+		"reset": reset,
+	})
+	writeAdminJSON(w, http.StatusOK, map[string]int{"reset": reset})
+}
+
+// GetQuotaReport 用量报表（当前窗口和保留的已结束窗口），?format=csv 时导出 CSV
+func (a *AdminServer) GetQuotaReport(w http.ResponseWriter, r *http.Request) {
+	usage, err := a.quotas.Report(r.URL.Query().Get("policy"), r.URL.Query().Get("key"))
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") != "csv" {
+		writeAdminJSON(w, http.StatusOK, usage)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="quota-usage.csv"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"policy", "key", "tier", "window_start", "window_end", "used", "limit"})
+	for _, u := range usage {
+		out.Write([]string{
+			u.Policy,
+			u.Key,
+			u.Tier,
+			u.Start.Format(time.RFC3339),
+			u.End.Format(time.RFC3339),
+			strconv.FormatInt(u.Used, 10),
+			strconv.FormatInt(u.Limit, 10),
+		})
+	}
+	out.Flush()
+}
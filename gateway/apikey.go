@@ -0,0 +1,383 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API Key 格式：gw_<id>_<secret>，id 用于查找，只保存完整 key 的 SHA-256
+const (
+	apiKeyPrefix     = "gw_"
+	apiKeyIDSize     = 6
+	apiKeySecretSize = 32
+)
+
+var (
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrAPIKeyRevoked      = errors.New("api key revoked")
+	ErrAPIKeyExpired      = errors.New("api key expired")
+	ErrAPIKeyRouteDenied  = errors.New("api key not allowed for this route")
+	ErrAPIKeyUnknownTier  = errors.New("unknown rate limit tier")
+	ErrAPIKeyOwnerMissing = errors.New("owner is required")
+)
+
+// APIKey 托管的 API Key（不含明文）
+type APIKey struct {
+	ID        string     `json:"id"`
+	Hash      string     `json:"hash"`
+	Name      string     `json:"name,omitempty"`
+	Owner     string     `json:"owner"`            // 调用方身份（Identity.Subject）
+	Scopes    []string   `json:"scopes,omitempty"` // 授权范围
+	Routes    []string   `json:"routes,omitempty"` // 允许访问的路由 "[METHOD ]PATH"，为空时不限
+	Tier      string     `json:"tier,omitempty"`   // 限流等级（RATELIMIT_TIERS）
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RotatedTo string     `json:"rotated_to,omitempty"` // 轮换后的新 key ID
+
+	static bool // 来自 SECURITY_API_KEYS，不持久化、不能管理
+}
+
+// APIKeySpec 创建或修改 API Key 的参数，修改时为 nil 的字段保持不变
+type APIKeySpec struct {
+	Name      *string    `json:"name"`
+	Owner     *string    `json:"owner"`
+	Scopes    *[]string  `json:"scopes"`
+	Routes    *[]string  `json:"routes"`
+	Tier      *string    `json:"tier"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Active 检查 key 在 now 时刻是否可用
+func (k *APIKey) Active(now time.Time) error {
+	if k.RevokedAt != nil {
+		return ErrAPIKeyRevoked
+	}
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return ErrAPIKeyExpired
+	}
+	return nil
+}
+
+// AllowsRoute 检查 key 是否允许访问请求的路由
+func (k *APIKey) AllowsRoute(r *http.Request) bool {
+	if len(k.Routes) == 0 {
+		return true
+	}
+	for _, route := range k.Routes {
+		if matchRoute(route, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *APIKey) clone() *APIKey {
+	c := *k
+	c.Scopes = append([]string(nil), k.Scopes...)
+	c.Routes = append([]string(nil), k.Routes...)
+	return &c
+}
+
+// APIKeyStore API Key 存储，托管的 key 持久化到 JSON 文件，每次修改后整体写回
+type APIKeyStore struct {
+	path   string
+	tiers  map[string]bool // 为空时不校验限流等级
+	keys   map[string]*APIKey
+	static map[string]*APIKey // 哈希 -> 静态 key
+	mu     sync.RWMutex
+}
+
+// NewAPIKeyStore 创建 API Key 存储，文件不存在时从空开始
+func NewAPIKeyStore(path string, staticKeys []string, tiers []RateLimitTier) (*APIKeyStore, error) {
+	s := &APIKeyStore{
+		path:   path,
+		tiers:  make(map[string]bool),
+		keys:   make(map[string]*APIKey),
+		static: make(map[string]*APIKey),
+	}
+	for _, tier := range tiers {
+		s.tiers[tier.Name] = true
+	}
+
+	// 兼容 SECURITY_API_KEYS：只在内存中保存哈希
+	for _, raw := range staticKeys {
+		if raw == "" {
+			continue
+		}
+		hash := hashAPIKey(raw)
+		s.static[hash] = &APIKey{ID: "static-" + hash[:8], Hash: hash, Owner: "api-key", static: true}
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(data) > 0 {
+			var keys []*APIKey
+			if err := json.Unmarshal(data, &keys); err != nil {
+				return nil, fmt.Errorf("invalid API key file %s: %w", path, err)
+			}
+			for _, key := range keys {
+				s.keys[key.ID] = key
+			}
+		}
+	}
+	return s, nil
+}
+
+// hashAPIKey key 的 SHA-256（十六进制）；key 本身是高熵随机值，不需要慢哈希
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKeySecret 生成新的 key ID 和完整 key
+func newAPIKeySecret() (string, string, error) {
+	id := make([]byte, apiKeyIDSize)
+	secret := make([]byte, apiKeySecretSize)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	keyID := hex.EncodeToString(id)
+	return keyID, apiKeyPrefix + keyID + "_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// parseAPIKeyID 从完整 key 中取出 ID，不是托管 key 格式时返回空
+func parseAPIKeyID(raw string) string {
+	rest, ok := strings.CutPrefix(raw, apiKeyPrefix)
+	if !ok {
+		return ""
+	}
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok || len(id) != apiKeyIDSize*2 {
+		return ""
+	}
+	return id
+}
+
+// Lookup 校验完整 key，返回其副本
+func (s *APIKeyStore) Lookup(raw string, now time.Time) (*APIKey, error) {
+	hash := hashAPIKey(raw)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := s.keys[parseAPIKeyID(raw)]
+	if key == nil {
+		key = s.static[hash]
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	if err := key.Active(now); err != nil {
+		return nil, err
+	}
+	return key.clone(), nil
+}
+
+// List 返回全部托管 key，按创建时间排序
+func (s *APIKeyStore) List() []*APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key.clone())
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// Get 获取托管 key
+func (s *APIKeyStore) Get(id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := s.keys[id]
+	if key == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key.clone(), nil
+}
+
+// apply 将参数写入 key 并校验（调用方持有锁）
+func (s *APIKeyStore) apply(key *APIKey, spec APIKeySpec) error {
+	if spec.Name != nil {
+		key.Name = *spec.Name
+	}
+	if spec.Owner != nil {
+		key.Owner = *spec.Owner
+	}
+	if spec.Scopes != nil {
+		key.Scopes = *spec.Scopes
+	}
+	if spec.Routes != nil {
+		key.Routes = *spec.Routes
+	}
+	if spec.Tier != nil {
+		key.Tier = *spec.Tier
+	}
+	if spec.ExpiresAt != nil {
+		expiresAt := spec.ExpiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+
+	if key.Owner == "" {
+		return ErrAPIKeyOwnerMissing
+	}
+	if key.Tier != "" && len(s.tiers) > 0 && !s.tiers[key.Tier] {
+		return fmt.Errorf("%w: %s", ErrAPIKeyUnknownTier, key.Tier)
+	}
+	return nil
+}
+
+// Create 创建 key，返回完整 key（只在此时可见）
+func (s *APIKeyStore) Create(spec APIKeySpec) (string, *APIKey, error) {
+	id, raw, err := newAPIKeySecret()
+	if err != nil {
+		return "", nil, err
+	}
+	key := &APIKey{ID: id, Hash: hashAPIKey(raw), CreatedAt: time.Now().UTC()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.apply(key, spec); err != nil {
+		return "", nil, err
+	}
+	s.keys[id] = key
+	if err := s.save(); err != nil {
+		delete(s.keys, id)
+		return "", nil, err
+	}
+	return raw, key.clone(), nil
+}
+
+// Update 修改 key 的属性
+func (s *APIKeyStore) Update(id string, spec APIKeySpec) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := s.keys[id]
+	if existing == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	key := existing.clone()
+	if err := s.apply(key, spec); err != nil {
+		return nil, err
+	}
+	s.keys[id] = key
+	if err := s.save(); err != nil {
+		s.keys[id] = existing
+		return nil, err
+	}
+	return key.clone(), nil
+}
+
+// Rotate 生成属性相同的新 key，旧 key 在 overlap 之后过期（原过期时间更早时保持不变）
+func (s *APIKeyStore) Rotate(id string, overlap time.Duration) (string, *APIKey, *APIKey, error) {
+	newID, raw, err := newAPIKeySecret()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := s.keys[id]
+	if existing == nil {
+		return "", nil, nil, ErrAPIKeyNotFound
+	}
+	if err := existing.Active(now); err != nil {
+		return "", nil, nil, err
+	}
+
+	key := existing.clone()
+	key.ID = newID
+	key.Hash = hashAPIKey(raw)
+	key.CreatedAt = now
+	key.RotatedTo = ""
+
+	old := existing.clone()
+	old.RotatedTo = newID
+	if overlapEnd := now.Add(overlap); old.ExpiresAt == nil || overlapEnd.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &overlapEnd
+	}
+
+	s.keys[newID] = key
+	s.keys[id] = old
+	if err := s.save(); err != nil {
+		delete(s.keys, newID)
+		s.keys[id] = existing
+		return "", nil, nil, err
+	}
+	return raw, key.clone(), old.clone(), nil
+}
+
+// Revoke 立即吊销 key，记录保留用于审计
+func (s *APIKeyStore) Revoke(id string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := s.keys[id]
+	if existing == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	if existing.RevokedAt != nil {
+		return existing.clone(), nil
+	}
+
+	key := existing.clone()
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	s.keys[id] = key
+	if err := s.save(); err != nil {
+		s.keys[id] = existing
+		return nil, err
+	}
+	return key.clone(), nil
+}
+
+// save 将托管 key 写回文件（调用方持有锁）
+func (s *APIKeyStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, data, 0600)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// IdentityKey 认证身份的 context key
+const IdentityKey contextKey = "identity"
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Identity 认证后的调用方身份
+type Identity struct {
+	Subject string                 // 调用方标识
+	Method  string                 // 认证方式，如 "api-key"、"client-cert"、"jwt"
+	Scopes  []string               // 授权范围
+	Roles   []string               // RBAC 角色（JWT 的角色声明）
+	Claims  map[string]interface{} // 令牌声明（JWT）
+	Headers map[string]string      // 需要转发给上游的身份头
+	KeyID   string                 // API Key ID（api-key）
+	Tier    string                 // 限流等级（api-key）
+}
+
+// HasScopes 检查身份是否拥有全部授权范围
+func (identity *Identity) HasScopes(scopes []string) bool {
+	for _, required := range scopes {
+		found := false
+		for _, scope := range identity.Scopes {
+			if scope == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Authenticator 认证器接口
+// 请求未携带该类型凭证时返回 (nil, nil)，凭证无效时返回错误
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// ChallengeError 由需要质询客户端的认证错误实现，认证中间件据此返回 401 和 WWW-Authenticate
+type ChallengeError interface {
+	error
+	Challenge() string
+}
+
+// Challenger 由需要在认证失败或未携带凭证时质询客户端的认证器实现（如 Basic 认证让浏览器弹出登录框），
+// 返回 WWW-Authenticate 质询，对该请求不适用时返回空字符串
+type Challenger interface {
+	Challenge(r *http.Request) string
+}
+
+// LoginRedirecter 由可以引导浏览器登录的认证器实现（如会话 Cookie），
+// 认证失败时认证中间件先询问它，返回 true 表示已写入响应（通常是跳转到登录页）
+type LoginRedirecter interface {
+	RedirectToLogin(w http.ResponseWriter, r *http.Request) bool
+}
+
+// IdentityHeaderProvider 由会向上游转发身份头的认证器实现，
+// 认证中间件会先删除客户端自带的同名头，防止伪造
+type IdentityHeaderProvider interface {
+	IdentityHeaders() []string
+}
+
+// GetIdentity 获取请求的认证身份
+func GetIdentity(r *http.Request) *Identity {
+	identity, _ := r.Context().Value(IdentityKey).(*Identity)
+	return identity
+}
+
+// withIdentity 将认证身份写入请求，并告知外层的 identityRecorder
+func withIdentity(r *http.Request, identity *Identity) *http.Request {
+	for key, value := range identity.Headers {
+		r.Header.Set(key, value)
+	}
+
+	if recorder, ok := r.Context().Value(identityRecorderKey).(*identityRecorder); ok {
+		recorder.identity.Store(identity)
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), IdentityKey, identity))
+}
+
+// identityRecorderKey 外层中间件（日志）读取认证结果的 context key
+// 认证发生在虚拟主机链内部，写入的 context 外层看不到，因此由外层预先放入记录器
+const identityRecorderKey contextKey = "identity_recorder"
+
+type identityRecorder struct {
+	identity atomic.Pointer[Identity]
+}
+
+// withIdentityRecorder 为请求放入身份记录器
+func withIdentityRecorder(r *http.Request) (*http.Request, *identityRecorder) {
+	recorder := &identityRecorder{}
+	return r.WithContext(context.WithValue(r.Context(), identityRecorderKey, recorder)), recorder
+}
+
+// API Key 认证转发给上游的身份头
+const (
+	APIKeyIDHeader    = "X-API-Key-ID"
+	APIKeyOwnerHeader = "X-API-Key-Owner"
+)
+
+// APIKeyAuthenticator API Key 认证器（X-API-Key），key 来自 APIKeyStore
+type APIKeyAuthenticator struct {
+	store *APIKeyStore
+}
+
+// NewAPIKeyAuthenticator 创建 API Key 认证器
+func NewAPIKeyAuthenticator(store *APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{store: store}
+}
+
+// Authenticate 验证 X-API-Key，检查吊销、过期和允许的路由
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		return nil, nil
+	}
+
+	key, err := a.store.Lookup(apiKey, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !key.AllowsRoute(r) {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyRouteDenied, key.ID)
+	}
+
+	return &Identity{
+		Subject: key.Owner,
+		Method:  "api-key",
+		Scopes:  key.Scopes,
+		KeyID:   key.ID,
+		Tier:    key.Tier,
+		Headers: map[string]string{
+			APIKeyIDHeader:    key.ID,
+			APIKeyOwnerHeader: key.Owner,
+		},
+	}, nil
+}
+
+// IdentityHeaders 实现 IdentityHeaderProvider
+func (a *APIKeyAuthenticator) IdentityHeaders() []string {
+	return []string{APIKeyIDHeader, APIKeyOwnerHeader}
+}
+
+// ScopeRule 路由级授权范围规则
+type ScopeRule struct {
+	Route  string   `json:"route"` // "[METHOD ]PATH"
+	Scopes []string `json:"scopes"`
+}
+
+// ScopeMiddleware 路由级授权范围中间件，匹配规则的路由要求调用方身份拥有全部授权范围
+func ScopeMiddleware(rules []ScopeRule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := GetIdentity(r)
+
+			for _, rule := range rules {
+				if !matchRoute(rule.Route, r) {
+					continue
+				}
+
+				if identity == nil || !identity.HasScopes(rule.Scopes) {
+					requestID := r.Context().Value(RequestIDKey).(string)
+					GetLogger().WarnWithRequestID(requestID, "Insufficient scope", map[string]interface{}{
+						"path":     r.URL.Path,
+						"route":    rule.Route,
+						"required": rule.Scopes,
+					})
+
+					if identity != nil && identity.Method == "jwt" {
+						w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(rule.Scopes, " ")+`"`)
+					}
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BasicAuthUserHeader Basic / Digest 认证转发给上游的用户名头
+const BasicAuthUserHeader = "X-Auth-User"
+
+var (
+	ErrInvalidPassword = errors.New("invalid username or password")
+	ErrStaleNonce      = errors.New("digest nonce expired")
+	ErrInvalidDigest   = errors.New("invalid digest credentials")
+)
+
+// basicAuthCacheTTL 校验成功的密码缓存时间，避免每个请求都计算 bcrypt
+const basicAuthCacheTTL = 5 * time.Minute
+
+// basicAuthRoutesMatch 判断请求是否在启用 Basic / Digest 认证的路由上，未配置路由时对全部路由生效
+func basicAuthRoutesMatch(routes []string, r *http.Request) bool {
+	if len(routes) == 0 {
+		return true
+	}
+	for _, route := range routes {
+		if matchRoute(route, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteAuthParam 将值格式化为 WWW-Authenticate 的 quoted-string
+func quoteAuthParam(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// BasicAuthenticator HTTP Basic 认证器，密码来自 htpasswd 文件
+type BasicAuthenticator struct {
+	file     *HtpasswdFile
+	realm    string
+	routes   []string
+	cache    *LRUCache // 校验成功的 (用户名, 密码, 哈希) 摘要
+	cacheKey []byte
+}
+
+// NewBasicAuthenticator 创建 Basic 认证器
+func NewBasicAuthenticator(file *HtpasswdFile, config BasicAuthConfig) *BasicAuthenticator {
+	cacheKey := make([]byte, 32)
+	rand.Read(cacheKey)
+
+	return &BasicAuthenticator{
+		file:   file,
+		realm:  config.Realm,
+		routes: config.Routes,
+		cache: NewCache(CacheConfig{
+			Enabled:         true,
+			MaxSize:         10000,
+			TTL:             basicAuthCacheTTL,
+			CleanupInterval: time.Minute,
+		}),
+		cacheKey: cacheKey,
+	}
+}
+
+// Stop 停止缓存清理
+func (a *BasicAuthenticator) Stop() {
+	a.cache.Stop()
+}
+
+// Authenticate 校验 Authorization: Basic
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if !basicAuthRoutesMatch(a.routes, r) {
+		return nil, nil
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+
+	hash, found := a.file.Lookup(user)
+	if !found {
+		verifyHtpasswd(password, htpasswdDummyHash)
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPassword, user)
+	}
+
+	// 缓存键包含哈希，文件中的密码变更后旧缓存自然失效
+	mac := hmac.New(sha256.New, a.cacheKey)
+	mac.Write([]byte(user + "\x00" + password + "\x00" + hash))
+	key := hex.EncodeToString(mac.Sum(nil))
+
+	if _, cached := a.cache.Get(key); !cached {
+		valid, err := verifyHtpasswd(password, hash)
+		if err != nil {
+			return nil, err
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPassword, user)
+		}
+		a.cache.Set(key, []byte{1})
+	}
+
+	return &Identity{
+		Subject: user,
+		Method:  "basic",
+		Headers: map[string]string{BasicAuthUserHeader: user},
+	}, nil
+}
+
+// Challenge 实现 Challenger
+func (a *BasicAuthenticator) Challenge(r *http.Request) string {
+	if !basicAuthRoutesMatch(a.routes, r) {
+		return ""
+	}
+	return "Basic realm=" + quoteAuthParam(a.realm) + `, charset="UTF-8"`
+}
+
+// IdentityHeaders 实现 IdentityHeaderProvider
+func (a *BasicAuthenticator) IdentityHeaders() []string {
+	return []string{BasicAuthUserHeader}
+}
+
+// DigestAuthenticator HTTP Digest 认证器（RFC 7616，MD5，qop=auth），HA1 来自 htdigest 文件
+// nonce 为带时间戳的 HMAC，无需服务端保存；同一 nonce 的 nc 必须递增，防止重放
+type DigestAuthenticator struct {
+	file     *HtpasswdFile
+	realm    string
+	routes   []string
+	nonceTTL time.Duration
+	key      []byte
+
+	mu        sync.Mutex
+	counters  map[string]uint64 // nonce -> 最后使用的 nc
+	lastPrune time.Time
+}
+
+// NewDigestAuthenticator 创建 Digest 认证器
+func NewDigestAuthenticator(file *HtpasswdFile, config BasicAuthConfig) *DigestAuthenticator {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	return &DigestAuthenticator{
+		file:      file,
+		realm:     config.Realm,
+		routes:    config.Routes,
+		nonceTTL:  config.NonceTTL,
+		key:       key,
+		counters:  make(map[string]uint64),
+		lastPrune: time.Now(),
+	}
+}
+
+// newNonce 生成 nonce：base64url(时间戳 8 字节 + 随机 8 字节 + HMAC 16 字节)
+func (a *DigestAuthenticator) newNonce() string {
+	payload := make([]byte, 16, 32)
+	binary.BigEndian.PutUint64(payload, uint64(time.Now().Unix()))
+	rand.Read(payload[8:])
+
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(append(payload, mac.Sum(nil)[:16]...))
+}
+
+// checkNonce 校验 nonce 的签名和有效期
+func (a *DigestAuthenticator) checkNonce(nonce string) error {
+	data, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(data) != 32 {
+		return ErrInvalidDigest
+	}
+
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(data[:16])
+	if !hmac.Equal(mac.Sum(nil)[:16], data[16:]) {
+		return ErrInvalidDigest
+	}
+
+	issued := time.Unix(int64(binary.BigEndian.Uint64(data)), 0)
+	if time.Since(issued) > a.nonceTTL {
+		return ErrStaleNonce
+	}
+	return nil
+}
+
+// useNonceCount 记录 nonce 的 nc，nc 未递增时返回 false
+func (a *DigestAuthenticator) useNonceCount(nonce string, nc uint64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// 定期清理过期 nonce 的计数
+	if time.Since(a.lastPrune) > a.nonceTTL {
+		for n := range a.counters {
+			if a.checkNonce(n) != nil {
+				delete(a.counters, n)
+			}
+		}
+		a.lastPrune = time.Now()
+	}
+
+	if nc <= a.counters[nonce] {
+		return false
+	}
+	a.counters[nonce] = nc
+	return true
+}
+
+// Authenticate 校验 Authorization: Digest
+func (a *DigestAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if !basicAuthRoutesMatch(a.routes, r) {
+		return nil, nil
+	}
+	params, ok := digestParams(r)
+	if !ok {
+		return nil, nil
+	}
+
+	user := params["username"]
+	if params["realm"] != a.realm || params["qop"] != "auth" || params["cnonce"] == "" || params["uri"] != r.URL.RequestURI() {
+		return nil, ErrInvalidDigest
+	}
+	if algorithm := params["algorithm"]; algorithm != "" && !strings.EqualFold(algorithm, "MD5") {
+		return nil, ErrInvalidDigest
+	}
+	nc, err := strconv.ParseUint(params["nc"], 16, 64)
+	if err != nil || nc == 0 {
+		return nil, ErrInvalidDigest
+	}
+	if err := a.checkNonce(params["nonce"]); err != nil {
+		return nil, err
+	}
+
+	ha1, found := a.file.Lookup(user)
+	if !found {
+		ha1 = strings.Repeat("0", 32)
+	}
+	ha2 := md5Hex(r.Method + ":" + params["uri"])
+	expected := md5Hex(ha1 + ":" + params["nonce"] + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(params["response"]))) != 1 || !found {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPassword, user)
+	}
+
+	if !a.useNonceCount(params["nonce"], nc) {
+		return nil, fmt.Errorf("%w: nonce count reused", ErrInvalidDigest)
+	}
+
+	return &Identity{
+		Subject: user,
+		Method:  "digest",
+		Headers: map[string]string{BasicAuthUserHeader: user},
+	}, nil
+}
+
+// Challenge 实现 Challenger，请求使用过期 nonce 时带上 stale=true，客户端无需重新输入密码
+func (a *DigestAuthenticator) Challenge(r *http.Request) string {
+	if !basicAuthRoutesMatch(a.routes, r) {
+		return ""
+	}
+
+	challenge := "Digest realm=" + quoteAuthParam(a.realm) + `, qop="auth", algorithm=MD5, nonce="` + a.newNonce() + `"`
+	if params, ok := digestParams(r); ok && a.checkNonce(params["nonce"]) == ErrStaleNonce {
+		challenge += ", stale=true"
+	}
+	return challenge
+}
+
+// IdentityHeaders 实现 IdentityHeaderProvider
+func (a *DigestAuthenticator) IdentityHeaders() []string {
+	return []string{BasicAuthUserHeader}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// digestParams 解析 Authorization: Digest 的参数
+func digestParams(r *http.Request) (map[string]string, bool) {
+	scheme, rest, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Digest") {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		name, value, found := strings.Cut(rest, "=")
+		if !found {
+			return nil, false
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimLeft(value, " ")
+
+		if strings.HasPrefix(value, `"`) {
+			var sb strings.Builder
+			i := 1
+			for ; i < len(value) && value[i] != '"'; i++ {
+				if value[i] == '\\' && i+1 < len(value) {
+					i++
+				}
+				sb.WriteByte(value[i])
+			}
+			if i >= len(value) {
+				return nil, false
+			}
+			params[name] = sb.String()
+			rest = value[i+1:]
+		} else {
+			token, remaining, _ := strings.Cut(value, ",")
+			params[name] = strings.TrimSpace(token)
+			rest = "," + remaining
+		}
+
+		rest = strings.TrimLeft(rest, " ")
+		if rest != "" && rest[0] != ',' {
+			return nil, false
+		}
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return params, true
+}
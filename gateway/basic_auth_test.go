@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDigestResponseKnownAnswer(t *testing.T) {
+	// RFC 2617 3.5 节示例（勘误后的 response）
+	ha1 := md5Hex("Mufasa:testrealm@host.com:Circle Of Life")
+	ha2 := md5Hex("GET:/dir/index.html")
+	response := md5Hex(ha1 + ":dcd98b7102dd2f0e8b11d0f600bfb0c093:00000001:0a4f113b:auth:" + ha2)
+	if response != "6629fae49393a05397450978507c4ef1" {
+		t.Fatalf("response = %s", response)
+	}
+}
+
+func newTestDigestAuthenticator(t *testing.T) *DigestAuthenticator {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "htdigest")
+	line := "Mufasa:testrealm@host.com:" + md5Hex("Mufasa:testrealm@host.com:Circle Of Life") + "\n"
+	if err := os.WriteFile(path, []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := NewHtdigestFile(path, "testrealm@host.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDigestAuthenticator(file, BasicAuthConfig{Realm: "testrealm@host.com", NonceTTL: time.Minute})
+}
+
+func digestAuthorization(user, password, nonce, nc string) string {
+	ha1 := md5Hex(user + ":testrealm@host.com:" + password)
+	ha2 := md5Hex("GET:/dir/index.html")
+	response := md5Hex(ha1 + ":" + nonce + ":" + nc + ":0a4f113b:auth:" + ha2)
+	return `Digest username="` + user + `", realm="testrealm@host.com", nonce="` + nonce +
+		`", uri="/dir/index.html", qop=auth, nc=` + nc + `, cnonce="0a4f113b", response="` + response + `"`
+}
+
+func TestDigestAuthenticate(t *testing.T) {
+	a := newTestDigestAuthenticator(t)
+	nonce := a.newNonce()
+
+	authenticate := func(password, nonce, nc string) error {
+		r := httptest.NewRequest("GET", "/dir/index.html", nil)
+		r.Header.Set("Authorization", digestAuthorization("Mufasa", password, nonce, nc))
+		identity, err := a.Authenticate(r)
+		if err == nil && (identity == nil || identity.Subject != "Mufasa") {
+			t.Fatalf("identity = %+v", identity)
+		}
+		return err
+	}
+
+	if err := authenticate("Circle Of Life", nonce, "00000001"); err != nil {
+		t.Fatalf("valid credentials: %v", err)
+	}
+	if err := authenticate("Circle Of Life", nonce, "00000001"); !errors.Is(err, ErrInvalidDigest) {
+		t.Errorf("reused nc: err = %v, want ErrInvalidDigest", err)
+	}
+	if err := authenticate("Circle Of Life", nonce, "00000002"); err != nil {
+		t.Errorf("next nc: %v", err)
+	}
+	if err := authenticate("circle of life", nonce, "00000003"); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("wrong password: err = %v, want ErrInvalidPassword", err)
+	}
+	if err := authenticate("Circle Of Life", "dcd98b7102dd2f0e8b11d0f600bfb0c093", "00000001"); !errors.Is(err, ErrInvalidDigest) {
+		t.Errorf("foreign nonce: err = %v, want ErrInvalidDigest", err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strconv"
+)
+
+// bcrypt（OpenBSD eksblowfish），仅用于校验 htpasswd 中的 $2a$ / $2b$ / $2y$ 哈希
+// 格式："$2b$<cost>$<22 字符盐><31 字符哈希>"
+
+var ErrInvalidBcryptHash = errors.New("invalid bcrypt hash")
+
+const (
+	bcryptMinCost  = 4
+	bcryptMaxCost  = 31
+	bcryptSaltLen  = 16
+	bcryptHashLen  = 23
+	bcryptMaxKey   = 72
+	bcryptEncodedN = 7 + 22 + 31 // "$2b$10$" + 盐 + 哈希
+)
+
+// bcryptEncoding bcrypt 使用的 base64 字母表（无填充）
+var bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+// bcryptMagic 加密 64 次的初始明文 "OrpheanBeholderScryDoubt"
+var bcryptMagic = []byte("OrpheanBeholderScryDoubt")
+
+// bcryptVerify 校验密码是否与 bcrypt 哈希匹配（常量时间比较）
+func bcryptVerify(password, encoded string) (bool, error) {
+	cost, salt, expected, err := bcryptParse(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	hash := bcryptHash([]byte(password), salt, cost)
+	return subtle.ConstantTimeCompare(hash, expected) == 1, nil
+}
+
+// bcryptParse 解析 bcrypt 哈希，返回代价、盐和哈希值
+func bcryptParse(encoded string) (int, []byte, []byte, error) {
+	if len(encoded) != bcryptEncodedN || encoded[0] != '$' || encoded[1] != '2' || encoded[3] != '$' || encoded[6] != '$' {
+		return 0, nil, nil, ErrInvalidBcryptHash
+	}
+	switch encoded[2] {
+	case 'a', 'b', 'y':
+	default:
+		return 0, nil, nil, ErrInvalidBcryptHash
+	}
+
+	cost, err := strconv.Atoi(encoded[4:6])
+	if err != nil || cost < bcryptMinCost || cost > bcryptMaxCost {
+		return 0, nil, nil, ErrInvalidBcryptHash
+	}
+
+	salt, err := bcryptEncoding.DecodeString(encoded[7:29])
+	if err != nil || len(salt) != bcryptSaltLen {
+		return 0, nil, nil, ErrInvalidBcryptHash
+	}
+	expected, err := bcryptEncoding.DecodeString(encoded[29:])
+	if err != nil || len(expected) != bcryptHashLen {
+		return 0, nil, nil, ErrInvalidBcryptHash
+	}
+	return cost, salt, expected, nil
+}
+
+// bcryptHash 计算原始哈希（23 字节）
+func bcryptHash(password, salt []byte, cost int) []byte {
+	// 密码末尾带 NUL，最多使用 72 字节
+	key := make([]byte, 0, len(password)+1)
+	key = append(key, password...)
+	key = append(key, 0)
+	if len(key) > bcryptMaxKey {
+		key = key[:bcryptMaxKey]
+	}
+
+	b := newBlowfishState()
+	b.expandKey(key, salt)
+	for i := uint64(0); i < 1<<uint(cost); i++ {
+		b.expandKey(key, nil)
+		b.expandKey(salt, nil)
+	}
+
+	ctext := make([]uint32, len(bcryptMagic)/4)
+	pos := 0
+	for i := range ctext {
+		ctext[i] = blowfishWord(bcryptMagic, &pos)
+	}
+
+	for i := 0; i < 64; i++ {
+		for j := 0; j < len(ctext); j += 2 {
+			ctext[j], ctext[j+1] = b.encrypt(ctext[j], ctext[j+1])
+		}
+	}
+
+	out := make([]byte, 0, len(ctext)*4)
+	for _, word := range ctext {
+		out = append(out, byte(word>>24), byte(word>>16), byte(word>>8), byte(word))
+	}
+	return out[:bcryptHashLen]
+}
+
+// blowfishState Blowfish 子密钥
+type blowfishState struct {
+	p [18]uint32
+	s [4][256]uint32
+}
+
+func newBlowfishState() *blowfishState {
+	return &blowfishState{p: blowfishP, s: blowfishS}
+}
+
+// blowfishWord 从 data 的 *pos 处循环读取一个大端字
+func blowfishWord(data []byte, pos *int) uint32 {
+	var word uint32
+	for i := 0; i < 4; i++ {
+		if *pos >= len(data) {
+			*pos = 0
+		}
+		word = word<<8 | uint32(data[*pos])
+		*pos++
+	}
+	return word
+}
+
+// expandKey eksblowfish 的密钥扩展，salt 为 nil 时即标准 Blowfish 密钥扩展
+func (b *blowfishState) expandKey(key, salt []byte) {
+	pos := 0
+	for i := range b.p {
+		b.p[i] ^= blowfishWord(key, &pos)
+	}
+
+	var l, r uint32
+	saltPos := 0
+	next := func() {
+		if salt != nil {
+			l ^= blowfishWord(salt, &saltPos)
+			r ^= blowfishWord(salt, &saltPos)
+		}
+		l, r = b.encrypt(l, r)
+	}
+
+	for i := 0; i < len(b.p); i += 2 {
+		next()
+		b.p[i], b.p[i+1] = l, r
+	}
+	for i := range b.s {
+		for j := 0; j < len(b.s[i]); j += 2 {
+			next()
+			b.s[i][j], b.s[i][j+1] = l, r
+		}
+	}
+}
+
+// encrypt 加密一个 64 位分组
+func (b *blowfishState) encrypt(l, r uint32) (uint32, uint32) {
+	f := func(x uint32) uint32 {
+		return ((b.s[0][x>>24] + b.s[1][x>>16&0xff]) ^ b.s[2][x>>8&0xff]) + b.s[3][x&0xff]
+	}
+
+	l ^= b.p[0]
+	for i := 1; i <= 16; i += 2 {
+		r ^= f(l) ^ b.p[i]
+		l ^= f(r) ^ b.p[i+1]
+	}
+	r ^= b.p[17]
+	return r, l
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// OpenBSD / Openwall crypt_blowfish 的已知答案
+var bcryptVectors = []struct {
+	password string
+	hash     string
+}{
+	{"U*U", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"},
+	{"U*U*", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.VGOzA784oUp/Z0DY336zx7pLYAy0lwK"},
+	{"", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.7uG0VCzI2bS7j6ymqJi9CdcdxiRTWNy"},
+	{"0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789chars after 72 are ignored",
+		"$2a$05$abcdefghijklmnopqrstuu5s2v8.iXieOjg/.AySBTTZIIVFJeBui"},
+	{"password", "$2b$04$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm"},
+	{"password", "$2y$10$abcdefghijklmnopqrstuu5Lo0g67CiD3M4RpN1BmBb4Crp5w7dbK"},
+}
+
+func TestBcryptVerifyKnownAnswers(t *testing.T) {
+	for _, v := range bcryptVectors {
+		ok, err := bcryptVerify(v.password, v.hash)
+		if err != nil || !ok {
+			t.Errorf("bcryptVerify(%q, %q) = %v, %v; want true", v.password, v.hash, ok, err)
+		}
+
+		ok, err = bcryptVerify(v.password+"x", v.hash)
+		if err != nil || (ok && len(v.password) < bcryptMaxKey) {
+			t.Errorf("bcryptVerify(%q, %q) = %v, %v; want false", v.password+"x", v.hash, ok, err)
+		}
+	}
+}
+
+func TestBcryptTruncatesAt72Bytes(t *testing.T) {
+	const hash = "$2a$05$abcdefghijklmnopqrstuu5s2v8.iXieOjg/.AySBTTZIIVFJeBui"
+	prefix := "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	if len(prefix) != bcryptMaxKey {
+		t.Fatalf("prefix length = %d, want %d", len(prefix), bcryptMaxKey)
+	}
+
+	for _, password := range []string{prefix, prefix + "anything else"} {
+		if ok, err := bcryptVerify(password, hash); err != nil || !ok {
+			t.Errorf("bcryptVerify(%q) = %v, %v; want true", password, ok, err)
+		}
+	}
+	if ok, _ := bcryptVerify(prefix[:bcryptMaxKey-1], hash); ok {
+		t.Error("71-byte prefix must not match")
+	}
+}
+
+func TestBcryptEmptyPassword(t *testing.T) {
+	const hash = "$2a$05$CCCCCCCCCCCCCCCCCCCCC.7uG0VCzI2bS7j6ymqJi9CdcdxiRTWNy"
+	if ok, err := bcryptVerify("", hash); err != nil || !ok {
+		t.Fatalf("empty password = %v, %v; want true", ok, err)
+	}
+	if ok, _ := bcryptVerify(" ", hash); ok {
+		t.Error("non-empty password must not match the empty password")
+	}
+}
+
+func TestBcryptParseRejectsMalformedHashes(t *testing.T) {
+	valid := "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"
+	for name, hash := range map[string]string{
+		"empty":        "",
+		"truncated":    valid[:len(valid)-1],
+		"too long":     valid + "A",
+		"variant":      strings.Replace(valid, "$2a$", "$2x$", 1),
+		"cost too low": strings.Replace(valid, "$05$", "$03$", 1),
+		"cost too big": strings.Replace(valid, "$05$", "$32$", 1),
+		"cost not int": strings.Replace(valid, "$05$", "$0a$", 1),
+		"bad alphabet": valid[:10] + "!" + valid[11:],
+	} {
+		if _, err := bcryptVerify("U*U", hash); !errors.Is(err, ErrInvalidBcryptHash) {
+			t.Errorf("%s: err = %v, want ErrInvalidBcryptHash", name, err)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrCertificateRevoked = errors.New("client certificate revoked")
+
+// 转发给上游的客户端证书身份头
+const (
+	HeaderClientCertSubject     = "X-Client-Cert-Subject"
+	HeaderClientCertIssuer      = "X-Client-Cert-Issuer"
+	HeaderClientCertSerial      = "X-Client-Cert-Serial"
+	HeaderClientCertSAN         = "X-Client-Cert-SAN"
+	HeaderClientCertFingerprint = "X-Client-Cert-Fingerprint"
+	HeaderClientCert            = "X-Client-Cert" // URL 编码的 PEM
+)
+
+// ClientCertVerifier 客户端证书校验器（CA 证书包 + CRL）
+type ClientCertVerifier struct {
+	pool       *x509.CertPool
+	caCerts    []*x509.Certificate
+	crlFile    string
+	crlModTime time.Time
+	revoked    map[string]bool // 吊销的证书，键为 revocationKey(签发者, 序列号)
+	mu         sync.RWMutex
+	stopReload chan struct{}
+}
+
+// NewClientCertVerifier 加载 CA 证书包和 CRL 文件（可选）
+func NewClientCertVerifier(caFile, crlFile string) (*ClientCertVerifier, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &ClientCertVerifier{
+		pool:       x509.NewCertPool(),
+		crlFile:    crlFile,
+		revoked:    make(map[string]bool),
+		stopReload: make(chan struct{}),
+	}
+
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		v.pool.AddCert(cert)
+		v.caCerts = append(v.caCerts, cert)
+	}
+
+	if len(v.caCerts) == 0 {
+		return nil, fmt.Errorf("no CA certificates found in %s", caFile)
+	}
+
+	if crlFile != "" {
+		if err := v.loadCRL(); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// loadCRL 加载并校验 CRL（支持 PEM 和 DER）
+func (v *ClientCertVerifier) loadCRL() error {
+	info, err := os.Stat(v.crlFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(v.crlFile)
+	if err != nil {
+		return err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return err
+	}
+
+	// CRL 必须由配置的 CA 签发，且签发者名称与该 CA 一致
+	signed := false
+	for _, ca := range v.caCerts {
+		if bytes.Equal(ca.RawSubject, crl.RawIssuer) && crl.CheckSignatureFrom(ca) == nil {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return fmt.Errorf("CRL %s is not signed by a configured CA", v.crlFile)
+	}
+
+	// 序列号只在同一签发者内唯一，按签发者 + 序列号记录，避免误伤其他 CA 签发的同序列号证书
+	revoked := make(map[string]bool, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[revocationKey(crl.RawIssuer, entry.SerialNumber)] = true
+	}
+
+	v.mu.Lock()
+	v.revoked = revoked
+	v.crlModTime = info.ModTime()
+	v.mu.Unlock()
+
+	GetLogger().Info("Client certificate CRL loaded", map[string]interface{}{
+		"crl_file":    v.crlFile,
+		"revoked":     len(revoked),
+		"next_update": crl.NextUpdate.UTC().Format(time.RFC3339),
+	})
+
+	return nil
+}
+
+// StartReload 定期检查 CRL 文件变化并重新加载
+func (v *ClientCertVerifier) StartReload(interval time.Duration) {
+	if v.crlFile == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(v.crlFile)
+			if err != nil {
+				continue
+			}
+
+			v.mu.RLock()
+			changed := !info.ModTime().Equal(v.crlModTime)
+			v.mu.RUnlock()
+
+			if changed {
+				if err := v.loadCRL(); err != nil {
+					GetLogger().Error("CRL reload failed", map[string]interface{}{
+						"crl_file": v.crlFile,
+						"error":    err.Error(),
+					})
+				}
+			}
+		case <-v.stopReload:
+			return
+		}
+	}
+}
+
+// Stop 停止 CRL 热加载
+func (v *ClientCertVerifier) Stop() {
+	close(v.stopReload)
+}
+
+// revocationKey 吊销记录的键：签发者 DER 编码的名称 + 十六进制序列号
+func revocationKey(rawIssuer []byte, serial *big.Int) string {
+	return string(rawIssuer) + "/" + serial.Text(16)
+}
+
+// VerifyConnection 在标准链校验之后检查证书是否已被吊销。
+// 与 VerifyPeerCertificate 不同，恢复的会话（会话票据）也会调用，CRL 重新加载后已吊销的证书无法通过会话恢复继续接入
+func (v *ClientCertVerifier) VerifyConnection(cs tls.ConnectionState) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			if v.revoked[revocationKey(cert.RawIssuer, cert.SerialNumber)] {
+				return ErrCertificateRevoked
+			}
+		}
+	}
+
+	return nil
+}
+
+// ApplyClientAuth 为 TLS 配置启用客户端证书校验，mode 为 "optional" 或 "required"
+func (v *ClientCertVerifier) ApplyClientAuth(tlsConfig *tls.Config, mode string) error {
+	switch mode {
+	case "optional":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "required":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("unsupported client auth mode: %s", mode)
+	}
+
+	tlsConfig.ClientCAs = v.pool
+	tlsConfig.VerifyConnection = v.VerifyConnection
+
+	return nil
+}
+
+// ClientCertAuthenticator 客户端证书认证器
+type ClientCertAuthenticator struct {
+	forwardPEM bool
+}
+
+// NewClientCertAuthenticator 创建客户端证书认证器
+func NewClientCertAuthenticator(forwardPEM bool) *ClientCertAuthenticator {
+	return &ClientCertAuthenticator{forwardPEM: forwardPEM}
+}
+
+// Authenticate 使用 TLS 握手中已校验的客户端证书认证
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	cert := verifiedClientCert(r)
+	if cert == nil {
+		return nil, nil
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	headers := map[string]string{
+		HeaderClientCertSubject:     cert.Subject.String(),
+		HeaderClientCertIssuer:      cert.Issuer.String(),
+		HeaderClientCertSerial:      cert.SerialNumber.Text(16),
+		HeaderClientCertSAN:         strings.Join(certSANs(cert), ","),
+		HeaderClientCertFingerprint: hex.EncodeToString(fingerprint[:]),
+	}
+	if a.forwardPEM {
+		headers[HeaderClientCert] = url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		})))
+	}
+
+	return &Identity{
+		Subject: cert.Subject.String(),
+		Method:  "client-cert",
+		Headers: headers,
+	}, nil
+}
+
+// IdentityHeaders 返回客户端证书身份头
+func (a *ClientCertAuthenticator) IdentityHeaders() []string {
+	return []string{
+		HeaderClientCertSubject,
+		HeaderClientCertIssuer,
+		HeaderClientCertSerial,
+		HeaderClientCertSAN,
+		HeaderClientCertFingerprint,
+		HeaderClientCert,
+	}
+}
+
+// verifiedClientCert 返回经过链校验的客户端叶子证书
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// certSANs 返回证书中的 DNS、邮箱、URI 和 IP 备用名称
+func certSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+// ClientCertRule 路由级客户端证书规则
+// Subjects 匹配完整 DN 或 CN，SANs 匹配任一备用名称，均支持 path.Match 通配符；
+// 两者都配置时须同时满足
+type ClientCertRule struct {
+	Route    string   `json:"route"` // "[METHOD ]PATH"
+	Subjects []string `json:"subjects"`
+	SANs     []string `json:"sans"`
+}
+
+// ClientCertRuleMiddleware 路由级客户端证书规则中间件，
+// 匹配规则的路由必须携带满足条件的客户端证书（无论使用何种凭证认证）
+func ClientCertRuleMiddleware(rules []ClientCertRule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, rule := range rules {
+				if !matchRoute(rule.Route, r) {
+					continue
+				}
+
+				if cert := verifiedClientCert(r); cert == nil || !rule.allows(cert) {
+					requestID := r.Context().Value(RequestIDKey).(string)
+					fields := map[string]interface{}{
+						"path":      r.URL.Path,
+						"route":     rule.Route,
+						"remote_ip": getClientIP(r),
+					}
+					if cert != nil {
+						fields["subject"] = cert.Subject.String()
+					}
+					GetLogger().WarnWithRequestID(requestID, "Client certificate rule rejected", fields)
+
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allows 检查证书是否满足规则
+func (rule ClientCertRule) allows(cert *x509.Certificate) bool {
+	if len(rule.Subjects) > 0 && !matchAnyPattern(rule.Subjects, cert.Subject.String(), cert.Subject.CommonName) {
+		return false
+	}
+
+	if len(rule.SANs) > 0 && !matchAnyPattern(rule.SANs, certSANs(cert)...) {
+		return false
+	}
+
+	return true
+}
+
+// matchAnyPattern 任一值匹配任一通配符模式
+func matchAnyPattern(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
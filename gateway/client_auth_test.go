@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue 签发客户端证书
+func (ca *testCA) issue(t *testing.T, serial int64, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeCRL 写入 ca 签发的 CRL（PEM）
+func (ca *testCA) writeCRL(t *testing.T, path string, number int64, serials ...int64) {
+	t.Helper()
+	template := &x509.RevocationList{
+		Number:     big.NewInt(number),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serial := range serials {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeCABundle(t *testing.T, path string, cas ...*testCA) {
+	t.Helper()
+	var bundle []byte
+	for _, ca := range cas {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...)
+	}
+	if err := os.WriteFile(path, bundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientCertRevocationIsPerIssuer(t *testing.T) {
+	dir := t.TempDir()
+	caA, caB := newTestCA(t, "CA A"), newTestCA(t, "CA B")
+	writeCABundle(t, filepath.Join(dir, "ca.pem"), caA, caB)
+	caA.writeCRL(t, filepath.Join(dir, "crl.pem"), 1, 5)
+
+	verifier, err := NewClientCertVerifier(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "crl.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个 CA 签发了相同序列号的证书，只有 CA A 的被吊销
+	revokedCert := caA.issue(t, 5, "revoked").Leaf
+	otherCert := caB.issue(t, 5, "same serial").Leaf
+	for _, v := range []struct {
+		name  string
+		chain []*x509.Certificate
+		want  error
+	}{
+		{"revoked", []*x509.Certificate{revokedCert, caA.cert}, ErrCertificateRevoked},
+		{"same serial, other issuer", []*x509.Certificate{otherCert, caB.cert}, nil},
+		{"other serial", []*x509.Certificate{caA.issue(t, 6, "ok").Leaf, caA.cert}, nil},
+	} {
+		err := verifier.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{v.chain}})
+		if !errors.Is(err, v.want) {
+			t.Errorf("%s: err = %v, want %v", v.name, err, v.want)
+		}
+	}
+}
+
+func TestClientCertCRLRejectsForeignIssuer(t *testing.T) {
+	dir := t.TempDir()
+	caA, other := newTestCA(t, "CA A"), newTestCA(t, "Other CA")
+	writeCABundle(t, filepath.Join(dir, "ca.pem"), caA)
+	other.writeCRL(t, filepath.Join(dir, "crl.pem"), 1, 5)
+
+	if _, err := NewClientCertVerifier(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "crl.pem")); err == nil {
+		t.Fatal("CRL signed by an unknown CA must be rejected")
+	}
+}
+
+func TestClientCertRevocationAppliesToResumedSessions(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "CA")
+	writeCABundle(t, filepath.Join(dir, "ca.pem"), ca)
+	crlFile := filepath.Join(dir, "crl.pem")
+	ca.writeCRL(t, crlFile, 1)
+
+	verifier, err := NewClientCertVerifier(filepath.Join(dir, "ca.pem"), crlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.DidResume)
+	}))
+	server.TLS = &tls.Config{}
+	if err := verifier.ApplyClientAuth(server.TLS, "required"); err != nil {
+		t.Fatal(err)
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true // 每个请求新建连接，第二次起通过会话票据恢复
+	transport.TLSClientConfig.Certificates = []tls.Certificate{ca.issue(t, 7, "client")}
+	transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(8)
+	client := &http.Client{Transport: transport}
+
+	get := func() (string, error) {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		var body [8]byte
+		n, _ := resp.Body.Read(body[:])
+		return string(body[:n]), nil
+	}
+
+	if _, err := get(); err != nil {
+		t.Fatalf("first handshake: %v", err)
+	}
+	if resumed, err := get(); err != nil || resumed != "true" {
+		t.Fatalf("second request: resumed = %q, err = %v; want a resumed session", resumed, err)
+	}
+
+	ca.writeCRL(t, crlFile, 2, 7)
+	if err := verifier.loadCRL(); err != nil {
+		t.Fatal(err)
+	}
+	if resumed, err := get(); err == nil {
+		t.Fatalf("revoked certificate accepted (resumed = %s)", resumed)
+	}
+}
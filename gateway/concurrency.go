@@ -0,0 +1,304 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// 并发限制：限制发往一个后端池的在途请求数，达到上限后在有界队列中等待，队列已满或等待超时时拒绝（503）。
+// 按每秒请求数限流无法保护变慢的后端（同样的速率下在途请求随延迟增长），并发上限直接限制后端承受的负载；
+// 自适应模式根据 proxyRequest 观测到的延迟调整上限（参考 Netflix concurrency-limits 的 AIMD / Gradient2）。
+// 配置了请求优先级时每个类别有自己的队列，空闲名额按类别权重分配（加权公平排队），过载时先拒绝低优先级类别
+
+var (
+	ErrConcurrencyLimited = errors.New("concurrency limit reached")
+	ErrQueueTimeout       = errors.New("timed out waiting for a concurrency slot")
+	ErrPriorityShed       = errors.New("shed to protect higher priority requests")
+	ErrQueueEvicted       = errors.New("evicted from queue by a higher priority request")
+)
+
+// 自适应算法
+const (
+	ConcurrencyFixed    = ""         // 固定上限
+	ConcurrencyAIMD     = "aimd"     // 加性增、乘性减：延迟超过阈值或出错时按比例降低上限，否则逐步增加
+	ConcurrencyGradient = "gradient" // 梯度：按长期延迟与短期延迟之比调整上限，延迟上升时提前收缩
+)
+
+// 自适应参数
+const (
+	aimdBackoffRatio       = 0.9   // 过载时上限乘以该比例
+	gradientTolerance      = 1.5   // 短期延迟超过长期延迟的该倍数时才收缩
+	gradientSmoothing      = 0.2   // 新上限的权重
+	gradientShortAlpha     = 0.1   // 短期延迟的指数平均系数
+	gradientLongAlpha      = 0.002 // 长期延迟的指数平均系数（约 500 个样本）
+	gradientMinGradient    = 0.5   // 每次最多收缩一半
+	gradientLongDriftRatio = 2.0   // 长期延迟超过短期延迟的该倍数时向短期延迟衰减（负载下降后尽快恢复）
+)
+
+// ConcurrencyLimiter 在途请求数限制器
+type ConcurrencyLimiter struct {
+	name         string
+	adaptive     string
+	minLimit     float64
+	maxLimit     float64
+	queueSize    int
+	queueTimeout time.Duration
+	latency      time.Duration // aimd：超过该延迟视为过载
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	queued   int
+	queues   map[int]*admissionQueue // 优先级类别 -> 等待队列
+	vtime    float64                 // 最近一次分配名额的虚拟时间
+
+	// gradient 的延迟统计（纳秒）
+	shortRTT float64
+	longRTT  float64
+}
+
+// admissionQueue 一个优先级类别的等待队列
+type admissionQueue struct {
+	weight  float64
+	pass    float64    // 虚拟时间：每分配一个名额前进 1/weight，权重越大前进越慢、越常被选中
+	waiters *list.List // 等待的请求（chan error，nil 表示取得名额），先到先得
+}
+
+// NewConcurrencyLimiter 创建并发限制器，limit 为 0 时返回 nil（不限制）
+func NewConcurrencyLimiter(name string, config ConcurrencyConfig) (*ConcurrencyLimiter, error) {
+	if config.Limit <= 0 {
+		return nil, nil
+	}
+
+	l := &ConcurrencyLimiter{
+		name:      name,
+		adaptive:  config.Adaptive,
+		minLimit:  float64(max(1, config.MinLimit)),
+		maxLimit:  float64(config.Limit),
+		queueSize: max(0, config.QueueSize),
+		limit:     float64(config.Limit),
+		queues:    make(map[int]*admissionQueue),
+	}
+
+	switch config.Adaptive {
+	case ConcurrencyFixed:
+	case ConcurrencyAIMD, ConcurrencyGradient:
+		l.maxLimit = float64(max(config.Limit, config.MaxLimit))
+		if l.minLimit > l.limit {
+			return nil, fmt.Errorf("min_limit %d exceeds limit %d", config.MinLimit, config.Limit)
+		}
+	default:
+		return nil, fmt.Errorf("unknown adaptive concurrency algorithm %q", config.Adaptive)
+	}
+
+	var err error
+	if config.QueueTimeout != "" {
+		if l.queueTimeout, err = time.ParseDuration(config.QueueTimeout); err != nil || l.queueTimeout < 0 {
+			return nil, fmt.Errorf("invalid queue_timeout %q", config.QueueTimeout)
+		}
+	}
+	if config.LatencyThreshold != "" {
+		if l.latency, err = time.ParseDuration(config.LatencyThreshold); err != nil || l.latency <= 0 {
+			return nil, fmt.Errorf("invalid latency_threshold %q", config.LatencyThreshold)
+		}
+	}
+
+	GetMetrics().UpdateConcurrencyLimit(name, int(l.limit))
+	return l, nil
+}
+
+// Acquire 取得一个并发名额，达到上限时在 class 的队列中排队等待；成功后必须调用 Release。
+// 后端池负载达到类别的 shed_concurrency 时直接拒绝；队列已满时挤出优先级最低的排队请求，没有更低优先级的请求时拒绝
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, class *priorityClass) error {
+	rank, weight, shedAt := class.admission()
+
+	l.mu.Lock()
+	if shedAt > 0 && float64(l.inflight+l.queued) >= shedAt*l.limit {
+		l.mu.Unlock()
+		return ErrPriorityShed
+	}
+	if l.inflight < int(l.limit) && l.queued == 0 {
+		l.inflight++
+		l.mu.Unlock()
+		return nil
+	}
+	if l.queued >= l.queueSize && !l.evict(rank) {
+		l.mu.Unlock()
+		return ErrConcurrencyLimited
+	}
+
+	queue := l.queues[rank]
+	if queue == nil {
+		queue = &admissionQueue{weight: weight, waiters: list.New()}
+		l.queues[rank] = queue
+	}
+	if queue.waiters.Len() == 0 {
+		// 空闲过的类别从当前虚拟时间开始，不能积攒份额
+		queue.pass = math.Max(queue.pass, l.vtime)
+	}
+	ready := make(chan error, 1)
+	element := queue.waiters.PushBack(ready)
+	l.queued++
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case err = <-ready:
+		return err
+	case <-timeout:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case granted := <-ready:
+		if granted != nil {
+			return granted
+		}
+		// 超时的同时已分配到名额，交还给下一个等待者
+		l.inflight--
+		l.dispatch()
+	default:
+		queue.waiters.Remove(element)
+		l.queued--
+	}
+	return err
+}
+
+// evict 挤出比 rank 优先级低的类别中最后到达的排队请求（调用方持有锁）
+func (l *ConcurrencyLimiter) evict(rank int) bool {
+	victim := -1
+	for r, queue := range l.queues {
+		if r > rank && r > victim && queue.waiters.Len() > 0 {
+			victim = r
+		}
+	}
+	if victim < 0 {
+		return false
+	}
+
+	waiters := l.queues[victim].waiters
+	waiters.Remove(waiters.Back()).(chan error) <- ErrQueueEvicted
+	l.queued--
+	return true
+}
+
+// Release 归还名额
+func (l *ConcurrencyLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	l.dispatch()
+}
+
+// dispatch 按上限唤醒等待者，每次选择虚拟时间最小的类别（相同时优先级高的先）（调用方持有锁）
+func (l *ConcurrencyLimiter) dispatch() {
+	for l.inflight < int(l.limit) && l.queued > 0 {
+		var next *admissionQueue
+		nextRank := 0
+		for rank, queue := range l.queues {
+			if queue.waiters.Len() == 0 {
+				continue
+			}
+			if next == nil || queue.pass < next.pass || queue.pass == next.pass && rank < nextRank {
+				next, nextRank = queue, rank
+			}
+		}
+
+		ready := next.waiters.Remove(next.waiters.Front()).(chan error)
+		l.vtime = next.pass
+		next.pass += 1 / next.weight
+		l.queued--
+		l.inflight++
+		ready <- nil
+	}
+}
+
+// shedReason 把 Acquire 的错误转换为指标中的拒绝原因
+func shedReason(err error) string {
+	switch err {
+	case ErrPriorityShed:
+		return ShedReasonConcurrency
+	case ErrConcurrencyLimited:
+		return ShedReasonQueueFull
+	case ErrQueueTimeout:
+		return ShedReasonQueueTimeout
+	case ErrQueueEvicted:
+		return ShedReasonEvicted
+	}
+	return ShedReasonCanceled
+}
+
+// Observe 记录一次后端请求的延迟（到收到响应头为止），dropped 表示出错、超时或 5xx；固定上限时不做任何事
+func (l *ConcurrencyLimiter) Observe(rtt time.Duration, dropped bool) {
+	if l == nil || l.adaptive == ConcurrencyFixed {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous := int(l.limit)
+	switch l.adaptive {
+	case ConcurrencyAIMD:
+		l.observeAIMD(rtt, dropped)
+	case ConcurrencyGradient:
+		l.observeGradient(rtt)
+	}
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, l.limit))
+
+	if current := int(l.limit); current != previous {
+		GetMetrics().UpdateConcurrencyLimit(l.name, current)
+		l.dispatch()
+	}
+}
+
+// observeAIMD 过载时乘性减少，在途请求接近上限（说明上限确实在约束流量）时加性增加
+func (l *ConcurrencyLimiter) observeAIMD(rtt time.Duration, dropped bool) {
+	if dropped || (l.latency > 0 && rtt > l.latency) {
+		l.limit *= aimdBackoffRatio
+		return
+	}
+	if float64(l.inflight)*2 >= l.limit {
+		l.limit++
+	}
+}
+
+// observeGradient 上限 × min(1, 容忍倍数 × 长期延迟 / 短期延迟) + √上限（允许少量排队），再做平滑
+func (l *ConcurrencyLimiter) observeGradient(rtt time.Duration) {
+	sample := float64(rtt)
+	if l.longRTT == 0 {
+		l.shortRTT, l.longRTT = sample, sample
+		return
+	}
+	l.shortRTT += (sample - l.shortRTT) * gradientShortAlpha
+	l.longRTT += (sample - l.longRTT) * gradientLongAlpha
+	if l.longRTT > l.shortRTT*gradientLongDriftRatio {
+		l.longRTT *= 0.95
+	}
+
+	// 在途请求远低于上限时延迟不反映上限是否合适
+	if float64(l.inflight) < l.limit/2 {
+		return
+	}
+
+	gradient := math.Max(gradientMinGradient, math.Min(1, gradientTolerance*l.longRTT/l.shortRTT))
+	next := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.limit*(1-gradientSmoothing) + next*gradientSmoothing
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -13,10 +16,19 @@ type Config struct {
 	Server ServerConfig
 
 	// 安全配置
-	Security SecurityConfig
+	Security    SecurityConfig
+	JWT         JWTConfig
+	BasicAuth   BasicAuthConfig
+	Signing     SigningConfig
+	Session     SessionConfig
+	RBAC        RBACConfig
+	ForwardAuth ForwardAuthConfig
+	Policy      PolicyConfig
 
 	// 中间件配置
 	RateLimit   RateLimitConfig
+	Quota       QuotaConfig
+	Priority    PriorityConfig
 	Cache       CacheConfig
 	CircuitBreaker CircuitBreakerConfig
 
@@ -26,6 +38,12 @@ type Config struct {
 	// 可观测性配置
 	Logging LoggingConfig
 	Metrics MetricsConfig
+
+	// 管理 API
+	Admin AdminConfig
+
+	// 虚拟主机配置
+	VirtualHosts []VirtualHostConfig
 }
 
 // ServerConfig 服务器配置
@@ -40,11 +58,41 @@ type ServerConfig struct {
 	EnableTLS       bool
 	CertFile        string
 	KeyFile         string
+
+	// 证书存储
+	CertDir            string        // 目录下的 name.crt / name.key 对
+	CertReloadInterval time.Duration // 证书文件变化检查间隔
+	CertExpiryWarning  time.Duration // 证书剩余有效期低于该值时告警
+	TLS                TLSListenerConfig
+
+	// HTTP → HTTPS 重定向监听器（启用 TLS 时）
+	HTTPRedirectPort    string   // 为空时不启动
+	HTTPRedirectExempts []string // 不重定向的路由，如 ACME 验证路径
+	HSTS                HSTSConfig
+}
+
+// HSTSConfig Strict-Transport-Security 配置（仅在 TLS 连接上发送）
+type HSTSConfig struct {
+	MaxAge            time.Duration // 为 0 时不发送
+	IncludeSubDomains bool
+	Preload           bool
+}
+
+// TLSListenerConfig 监听器 TLS 配置
+type TLSListenerConfig struct {
+	MinVersion   string   // "1.2", "1.3"
+	CipherSuites []string // Go 标准库中的密码套件名称，仅影响 TLS 1.2
+	ALPN         []string
+
+	// 客户端证书（mTLS）
+	ClientAuth    string // "none", "optional", "required"
+	ClientCAFile  string // CA 证书包（PEM）
+	ClientCRLFile string // 证书吊销列表（PEM 或 DER，可选）
 }
 
 // SecurityConfig 安全配置
 type SecurityConfig struct {
-	APIKeys         []string
+	APIKeys         []string // 静态 API Key（兼容旧配置，建议改用托管 key）
 	EnableCORS      bool
 	AllowedOrigins  []string
 	AllowedMethods  []string
@@ -52,6 +100,114 @@ type SecurityConfig struct {
 	IPWhitelist     []string
 	IPBlacklist     []string
 	MaxRequestSize  int64
+
+	// 客户端证书身份
+	ClientCertForwardPEM bool             // 是否向上游转发 URL 编码的客户端证书 PEM
+	ClientCertRules      []ClientCertRule // 路由级客户端证书规则（从 JSON 文件加载）
+
+	// 路由级授权范围规则（从 JSON 文件加载）
+	ScopeRules []ScopeRule
+
+	// 托管 API Key
+	APIKeysFile           string        // 存储文件（只保存哈希）
+	APIKeyRotationOverlap time.Duration // 轮换后旧 key 的默认保留时间
+}
+
+// JWTConfig JWT Bearer 令牌认证配置
+type JWTConfig struct {
+	Enabled             bool
+	Algorithms          []string      // 允许的算法：HS256, RS256, ES256, EdDSA
+	HMACSecret          string        // HS256 密钥
+	KeyFile             string        // 本地公钥文件（PEM 公钥 / 证书，或 JWKS JSON）
+	JWKSURL             string        // 远程 JWKS 地址
+	JWKSRefreshInterval time.Duration // JWKS 刷新间隔
+	Issuer              string        // 期望的 iss，为空时不校验
+	Audience            []string      // 期望的 aud（任一匹配），必须配置
+	TokenTypes          []string      // 接受的 JOSE 头部 typ（如 at+jwt），包含 "*" 时不校验
+	ClockSkew           time.Duration // exp / nbf 允许的时钟偏差
+	RequireExp          bool          // 是否要求令牌包含 exp
+	ForwardClaims       []string      // 转发给上游的声明，格式 "claim:Header"
+	RolesClaim          string        // RBAC 角色声明（字符串数组或空格分隔字符串）
+}
+
+// BasicAuthConfig HTTP Basic / Digest 认证配置
+type BasicAuthConfig struct {
+	Enabled        bool
+	HtpasswdFile   string        // Basic 认证的 htpasswd 文件（bcrypt / {SHA} / $apr1$）
+	HtdigestFile   string        // Digest 认证的 htdigest 文件，为空时不启用 Digest
+	Realm          string
+	Routes         []string      // 接受 Basic / Digest 凭证的路由，为空时对全部路由生效
+	ReloadInterval time.Duration // 检查文件变化的间隔
+	NonceTTL       time.Duration // Digest nonce 有效期
+}
+
+// SigningConfig HMAC 请求签名配置
+type SigningConfig struct {
+	Enabled        bool
+	PartnersFile   string        // 合作方 JSON 文件
+	MaxSkew        time.Duration // 签名时间戳允许的偏差
+	NonceTTL       time.Duration // nonce 保留时间（不短于 2 倍 MaxSkew），决定无时间戳方案的防重放窗口
+	NonceCacheSize int           // 最多保留的 nonce 数
+}
+
+// SessionConfig 网关管理的浏览器会话配置（OIDC 登录 + 加密会话 Cookie + CSRF 校验）
+type SessionConfig struct {
+	Enabled         bool
+	Issuer          string // auth 服务地址（iss），浏览器跳转到 {Issuer}/oauth/authorize 登录
+	TokenURL        string // 换取令牌的地址，为空时为 {Issuer}/oauth/token
+	ClientID        string // 网关在 auth 服务注册的客户端
+	ClientSecret    string
+	RedirectURL     string   // 登录回调地址（需在 auth 服务注册），其路径由网关处理
+	Scopes          []string // 登录请求的授权范围
+	LoginPath       string   // 开始登录流程的路径，?return_to= 指定登录后返回的页面
+	LogoutPath      string   // 退出登录的路径
+	PostLogoutURL   string   // 退出后返回的地址（需在 auth 服务注册），为空时不跳转到 auth 服务退出
+	Secrets         []string // 会话 Cookie 加密密钥，第一个用于加密，其余用于轮换期间解密
+	CookieName      string
+	CookieDomain    string
+	CookieSecure    bool
+	CookieSameSite  string        // lax / strict / none
+	IdleTimeout     time.Duration // 空闲超时
+	AbsoluteTimeout time.Duration // 绝对超时，从登录时算起
+	Routes          []string      // 接受会话 Cookie 的路由，为空时对全部路由生效
+	CSRFHeader      string        // 非安全方法携带 CSRF 令牌的请求头（表单可用 _csrf 字段）
+	ForwardClaims   []string      // 转发给上游的声明，格式 "claim:Header"
+	RolesClaim      string        // RBAC 角色声明
+}
+
+// RBACConfig 基于角色的路由授权配置
+type RBACConfig struct {
+	Enabled         bool
+	PolicyURL       string        // auth 服务的策略地址，优先于 PolicyFile
+	PolicyFile      string        // 本地策略文件（JSON）
+	TokenURL        string        // 拉取策略前通过客户端凭证获取令牌，为空时不带令牌
+	ClientID        string
+	ClientSecret    string
+	RefreshInterval time.Duration // 策略刷新间隔
+	DefaultDeny     bool          // 没有匹配路由绑定的请求也拒绝
+}
+
+// ForwardAuthConfig 外部授权（forward-auth）配置
+type ForwardAuthConfig struct {
+	Enabled         bool
+	URL             string            // 授权服务地址，2xx 允许，其他 4xx 拒绝
+	Timeout         time.Duration     // 子请求超时
+	ResponseHeaders []string          // 允许时从授权服务响应复制到上游请求的头
+	FailureMode     string            // 授权服务不可用时：open 放行 / closed 拒绝
+	CacheTTL        time.Duration     // 决定缓存时间，0 不缓存
+	CacheSize       int               // 最多缓存的决定数
+	CacheKeyHeaders []string          // 缓存键使用的凭证头，请求不带其中任一头时不缓存
+	Rules           []ForwardAuthRule // 路由级规则（从 JSON 文件加载）
+}
+
+// PolicyConfig 属性授权策略配置
+type PolicyConfig struct {
+	Enabled  bool
+	File     string // 策略文件（JSON），启动时编译，表达式有误时拒绝启动
+	DryRun   bool   // 只记录会被拒绝的请求，不拦截
+	Timezone string // time.* 变量使用的时区，为空时使用本地时区
+
+	TrustProxyHeaders bool // ip 变量信任 X-Forwarded-For / X-Real-IP（部署在会覆盖这些头的代理之后时开启）
 }
 
 // RateLimitConfig 限流配置
@@ -61,6 +217,52 @@ type RateLimitConfig struct {
 	BurstSize     int
 	PerIP         bool
 	CleanupInterval time.Duration
+	MaxKeys       int // 每个限流器最多保存的键数，超出时淘汰最久未使用的键
+
+	// API Key 限流等级，每个 key 在等级内独立计数
+	Tiers []RateLimitTier
+
+	// 限流策略文件（JSON），按用户、API Key、路由、请求头、声明等组合键限流
+	PoliciesFile string
+
+	// 共享存储（Redis 协议），多个网关实例共同计数；为空时每个实例单独计数
+	RedisURL     string
+	RedisPrefix  string
+	RedisTimeout time.Duration
+	SyncInterval time.Duration // 本地计数同步到共享存储的间隔
+	SyncBatch    int           // 一个键本地累计的请求数达到该值时提前同步
+}
+
+// RateLimitTier API Key 限流等级
+type RateLimitTier struct {
+	Name              string
+	RequestsPerSecond int
+	BurstSize         int
+}
+
+// QuotaConfig 配额配置
+type QuotaConfig struct {
+	PoliciesFile   string        // 配额策略文件（JSON），为空时不启用配额
+	UsageFile      string        // 用量持久化文件，为空时只保存在内存中
+	FlushInterval  time.Duration // 用量写回文件的间隔
+	Timezone       string        // 日历窗口使用的时区（IANA 名称），默认服务器时区
+	HistoryWindows int           // 每个键保留的已结束窗口数，用于用量报表
+	MaxKeys        int           // 最多保存的键数（全部策略合计），超出时淘汰最久未使用的键，0 为不限
+}
+
+// PriorityConfig 请求优先级配置
+type PriorityConfig struct {
+	ClassesFile  string        // 优先级类别文件（JSON，按优先级从高到低排列），为空时不区分优先级
+	DefaultClass string        // 未匹配任何类别的请求所属的类别，默认最后一个类别
+	CPUInterval  time.Duration // CPU 使用率的采样间隔
+}
+
+// AdminConfig 管理 API 配置（独立监听器）
+type AdminConfig struct {
+	Enabled bool
+	Host    string
+	Port    string
+	Token   string // Bearer 令牌，启用时必须设置
 }
 
 // CacheConfig 缓存配置
@@ -91,6 +293,57 @@ type BackendConfig struct {
 	IdleConnTimeout     time.Duration
 	RetryAttempts       int
 	RetryDelay          time.Duration
+	TLS                 UpstreamTLSConfig // 发往后端的 TLS 配置
+	Concurrency         ConcurrencyConfig // 在途请求数限制
+}
+
+// ConcurrencyConfig 后端池的在途请求数限制，limit 为 0 时不限制
+type ConcurrencyConfig struct {
+	Limit            int    `json:"limit"`             // 上限，自适应模式下为初始值
+	MinLimit         int    `json:"min_limit"`         // 自适应模式的下限
+	MaxLimit         int    `json:"max_limit"`         // 自适应模式的上限
+	QueueSize        int    `json:"queue_size"`        // 达到上限后排队等待的请求数
+	QueueTimeout     string `json:"queue_timeout"`     // 排队等待的最长时间，如 "100ms"
+	Adaptive         string `json:"adaptive"`          // 为空时固定上限，"aimd" / "gradient" 时按延迟自动调整
+	LatencyThreshold string `json:"latency_threshold"` // aimd：超过该延迟视为过载
+}
+
+// UpstreamTLSConfig 上游（后端）TLS 配置
+type UpstreamTLSConfig struct {
+	CAFile             string `json:"ca_file"`              // 校验后端证书的 CA 证书包
+	CertFile           string `json:"cert_file"`            // 客户端证书（mTLS）
+	KeyFile            string `json:"key_file"`
+	ServerName         string `json:"server_name"`          // 覆盖 SNI 和证书校验使用的主机名
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // 仅用于开发环境
+}
+
+// VirtualHostConfig 虚拟主机配置（从 JSON 文件加载）
+type VirtualHostConfig struct {
+	Name            string               `json:"name"`
+	Hosts           []string             `json:"hosts"`   // 精确域名或通配符（*.example.com）
+	Default         bool                 `json:"default"` // 未匹配主机时使用
+	Routes          []VirtualRouteConfig `json:"routes"`
+	CertFile        string               `json:"cert_file"`
+	KeyFile         string               `json:"key_file"`
+	CORS            *CORSConfig          `json:"cors"`             // 为空时沿用全局 CORS 配置
+	SecurityHeaders map[string]string    `json:"security_headers"` // 覆盖默认安全头，值为空表示移除
+}
+
+// VirtualRouteConfig 虚拟主机路由配置
+type VirtualRouteConfig struct {
+	Path                string             `json:"path"` // ServeMux 路径模式，如 "/api/"
+	Backends            []string           `json:"backends"`
+	LoadBalanceStrategy string             `json:"load_balance_strategy"`
+	TLS                 *UpstreamTLSConfig `json:"tls"`         // 为空时沿用全局后端 TLS 配置
+	Concurrency         *ConcurrencyConfig `json:"concurrency"` // 为空时沿用全局并发限制配置
+}
+
+// CORSConfig 虚拟主机 CORS 配置
+type CORSConfig struct {
+	Enabled        bool     `json:"enabled"`
+	AllowedOrigins []string `json:"allowed_origins"`
+	AllowedMethods []string `json:"allowed_methods"`
+	AllowedHeaders []string `json:"allowed_headers"`
 }
 
 // LoggingConfig 日志配置
@@ -111,9 +364,9 @@ type MetricsConfig struct {
 	Path    string
 }
 
-// LoadConfig 加载配置
-func LoadConfig() *Config {
-	return &Config{
+// LoadConfig 加载配置，引用的配置文件不存在或格式有误时返回错误
+func LoadConfig() (*Config, error) {
+	config := &Config{
 		Server: ServerConfig{
 			Port:            getEnv("SERVER_PORT", "8081"),
 			Host:            getEnv("SERVER_HOST", "0.0.0.0"),
@@ -125,9 +378,30 @@ func LoadConfig() *Config {
 			EnableTLS:       getBoolEnv("SERVER_ENABLE_TLS", false),
 			CertFile:        getEnv("SERVER_CERT_FILE", "server.crt"),
 			KeyFile:         getEnv("SERVER_KEY_FILE", "server.key"),
+
+			CertDir:            getEnv("SERVER_CERT_DIR", ""),
+			CertReloadInterval: getDurationEnv("SERVER_CERT_RELOAD_INTERVAL", 30*time.Second),
+			CertExpiryWarning:  getDurationEnv("SERVER_CERT_EXPIRY_WARNING", 30*24*time.Hour),
+			TLS: TLSListenerConfig{
+				MinVersion:   getEnv("SERVER_TLS_MIN_VERSION", "1.2"),
+				CipherSuites: getSliceEnv("SERVER_TLS_CIPHER_SUITES", []string{}),
+				ALPN:         getSliceEnv("SERVER_TLS_ALPN", []string{"h2", "http/1.1"}),
+
+				ClientAuth:    getEnv("SERVER_TLS_CLIENT_AUTH", "none"),
+				ClientCAFile:  getEnv("SERVER_TLS_CLIENT_CA_FILE", ""),
+				ClientCRLFile: getEnv("SERVER_TLS_CLIENT_CRL_FILE", ""),
+			},
+
+			HTTPRedirectPort:    getEnv("SERVER_HTTP_REDIRECT_PORT", "8080"),
+			HTTPRedirectExempts: getSliceEnv("SERVER_HTTP_REDIRECT_EXEMPTS", []string{"/.well-known/", "/health"}),
+			HSTS: HSTSConfig{
+				MaxAge:            getDurationEnv("SERVER_HSTS_MAX_AGE", 365*24*time.Hour),
+				IncludeSubDomains: getBoolEnv("SERVER_HSTS_INCLUDE_SUBDOMAINS", true),
+				Preload:           getBoolEnv("SERVER_HSTS_PRELOAD", false),
+			},
 		},
 		Security: SecurityConfig{
-			APIKeys:        getSliceEnv("SECURITY_API_KEYS", []string{"default-api-key"}),
+			APIKeys:        getSliceEnv("SECURITY_API_KEYS", []string{}),
 			EnableCORS:     getBoolEnv("SECURITY_ENABLE_CORS", true),
 			AllowedOrigins: getSliceEnv("SECURITY_ALLOWED_ORIGINS", []string{"*"}),
 			AllowedMethods: getSliceEnv("SECURITY_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
@@ -135,6 +409,93 @@ func LoadConfig() *Config {
 			IPWhitelist:    getSliceEnv("SECURITY_IP_WHITELIST", []string{}),
 			IPBlacklist:    getSliceEnv("SECURITY_IP_BLACKLIST", []string{}),
 			MaxRequestSize: getInt64Env("SECURITY_MAX_REQUEST_SIZE", 10<<20), // 10MB
+
+			ClientCertForwardPEM: getBoolEnv("SECURITY_CLIENT_CERT_FORWARD_PEM", true),
+
+			APIKeysFile:           getEnv("SECURITY_API_KEYS_FILE", "api-keys.json"),
+			APIKeyRotationOverlap: getDurationEnv("SECURITY_API_KEY_ROTATION_OVERLAP", 24*time.Hour),
+		},
+		JWT: JWTConfig{
+			Enabled:             getBoolEnv("JWT_ENABLED", false),
+			Algorithms:          getSliceEnv("JWT_ALGORITHMS", []string{"RS256", "ES256", "EdDSA"}),
+			HMACSecret:          getEnv("JWT_HMAC_SECRET", ""),
+			KeyFile:             getEnv("JWT_KEY_FILE", ""),
+			JWKSURL:             getEnv("JWT_JWKS_URL", ""),
+			JWKSRefreshInterval: getDurationEnv("JWT_JWKS_REFRESH_INTERVAL", 10*time.Minute),
+			Issuer:              getEnv("JWT_ISSUER", ""),
+			Audience:            getSliceEnv("JWT_AUDIENCE", []string{}),
+			TokenTypes:          getSliceEnv("JWT_TOKEN_TYPES", []string{"at+jwt"}),
+			ClockSkew:           getDurationEnv("JWT_CLOCK_SKEW", 30*time.Second),
+			RequireExp:          getBoolEnv("JWT_REQUIRE_EXP", true),
+			ForwardClaims:       getSliceEnv("JWT_FORWARD_CLAIMS", []string{"sub:X-User-ID"}),
+			RolesClaim:          getEnv("JWT_ROLES_CLAIM", "roles"),
+		},
+		BasicAuth: BasicAuthConfig{
+			Enabled:        getBoolEnv("BASIC_AUTH_ENABLED", false),
+			HtpasswdFile:   getEnv("BASIC_AUTH_HTPASSWD_FILE", ""),
+			HtdigestFile:   getEnv("BASIC_AUTH_HTDIGEST_FILE", ""),
+			Realm:          getEnv("BASIC_AUTH_REALM", "gateway"),
+			Routes:         getSliceEnv("BASIC_AUTH_ROUTES", []string{}),
+			ReloadInterval: getDurationEnv("BASIC_AUTH_RELOAD_INTERVAL", 10*time.Second),
+			NonceTTL:       getDurationEnv("BASIC_AUTH_DIGEST_NONCE_TTL", 5*time.Minute),
+		},
+		Signing: SigningConfig{
+			Enabled:        getBoolEnv("SIGNING_ENABLED", false),
+			PartnersFile:   getEnv("SIGNING_PARTNERS_FILE", ""),
+			MaxSkew:        getDurationEnv("SIGNING_MAX_SKEW", 5*time.Minute),
+			NonceTTL:       getDurationEnv("SIGNING_NONCE_TTL", 24*time.Hour),
+			NonceCacheSize: getIntEnv("SIGNING_NONCE_CACHE_SIZE", 100000),
+		},
+		Session: SessionConfig{
+			Enabled:         getBoolEnv("SESSION_ENABLED", false),
+			Issuer:          strings.TrimSuffix(getEnv("SESSION_ISSUER", ""), "/"),
+			TokenURL:        getEnv("SESSION_TOKEN_URL", ""),
+			ClientID:        getEnv("SESSION_CLIENT_ID", ""),
+			ClientSecret:    getEnv("SESSION_CLIENT_SECRET", ""),
+			RedirectURL:     getEnv("SESSION_REDIRECT_URL", ""),
+			Scopes:          getSliceEnv("SESSION_SCOPES", []string{"openid", "profile", "email"}),
+			LoginPath:       getEnv("SESSION_LOGIN_PATH", "/_gateway/login"),
+			LogoutPath:      getEnv("SESSION_LOGOUT_PATH", "/_gateway/logout"),
+			PostLogoutURL:   getEnv("SESSION_POST_LOGOUT_URL", ""),
+			Secrets:         getSliceEnv("SESSION_SECRET", []string{}),
+			CookieName:      getEnv("SESSION_COOKIE_NAME", "gw_session"),
+			CookieDomain:    getEnv("SESSION_COOKIE_DOMAIN", ""),
+			CookieSecure:    getBoolEnv("SESSION_COOKIE_SECURE", true),
+			CookieSameSite:  getEnv("SESSION_COOKIE_SAMESITE", "lax"),
+			IdleTimeout:     getDurationEnv("SESSION_IDLE_TIMEOUT", 30*time.Minute),
+			AbsoluteTimeout: getDurationEnv("SESSION_ABSOLUTE_TIMEOUT", 12*time.Hour),
+			Routes:          getSliceEnv("SESSION_ROUTES", []string{}),
+			CSRFHeader:      getEnv("SESSION_CSRF_HEADER", "X-CSRF-Token"),
+			ForwardClaims:   getSliceEnv("SESSION_FORWARD_CLAIMS", []string{"sub:X-User-ID"}),
+			RolesClaim:      getEnv("SESSION_ROLES_CLAIM", "roles"),
+		},
+		RBAC: RBACConfig{
+			Enabled:         getBoolEnv("RBAC_ENABLED", false),
+			PolicyURL:       getEnv("RBAC_POLICY_URL", ""),
+			PolicyFile:      getEnv("RBAC_POLICY_FILE", ""),
+			TokenURL:        getEnv("RBAC_TOKEN_URL", ""),
+			ClientID:        getEnv("RBAC_CLIENT_ID", ""),
+			ClientSecret:    getEnv("RBAC_CLIENT_SECRET", ""),
+			RefreshInterval: getDurationEnv("RBAC_POLICY_REFRESH_INTERVAL", time.Minute),
+			DefaultDeny:     getBoolEnv("RBAC_DEFAULT_DENY", false),
+		},
+		ForwardAuth: ForwardAuthConfig{
+			Enabled:         getBoolEnv("FORWARD_AUTH_ENABLED", false),
+			URL:             getEnv("FORWARD_AUTH_URL", ""),
+			Timeout:         getDurationEnv("FORWARD_AUTH_TIMEOUT", 2*time.Second),
+			ResponseHeaders: getSliceEnv("FORWARD_AUTH_RESPONSE_HEADERS", []string{}),
+			FailureMode:     getEnv("FORWARD_AUTH_FAILURE_MODE", ForwardAuthFailClosed),
+			CacheTTL:        getDurationEnv("FORWARD_AUTH_CACHE_TTL", 5*time.Second),
+			CacheSize:       getIntEnv("FORWARD_AUTH_CACHE_SIZE", 10000),
+			CacheKeyHeaders: getSliceEnv("FORWARD_AUTH_CACHE_KEY_HEADERS", []string{"Authorization", "X-API-Key", "Cookie"}),
+		},
+		Policy: PolicyConfig{
+			Enabled:  getBoolEnv("POLICY_ENABLED", false),
+			File:     getEnv("POLICY_FILE", ""),
+			DryRun:   getBoolEnv("POLICY_DRY_RUN", false),
+			Timezone: getEnv("POLICY_TIMEZONE", ""),
+
+			TrustProxyHeaders: getBoolEnv("POLICY_TRUST_PROXY_HEADERS", false),
 		},
 		RateLimit: RateLimitConfig{
 			Enabled:         getBoolEnv("RATELIMIT_ENABLED", true),
@@ -142,6 +503,26 @@ func LoadConfig() *Config {
 			BurstSize:       getIntEnv("RATELIMIT_BURST_SIZE", 50),
 			PerIP:           getBoolEnv("RATELIMIT_PER_IP", true),
 			CleanupInterval: getDurationEnv("RATELIMIT_CLEANUP_INTERVAL", 1*time.Minute),
+			MaxKeys:         getIntEnv("RATELIMIT_MAX_KEYS", 100000),
+			PoliciesFile:    getEnv("RATELIMIT_POLICIES_FILE", ""),
+			RedisURL:        getEnv("RATELIMIT_REDIS_URL", ""),
+			RedisPrefix:     getEnv("RATELIMIT_REDIS_PREFIX", "gateway:ratelimit:"),
+			RedisTimeout:    getDurationEnv("RATELIMIT_REDIS_TIMEOUT", 200*time.Millisecond),
+			SyncInterval:    getDurationEnv("RATELIMIT_SYNC_INTERVAL", 100*time.Millisecond),
+			SyncBatch:       getIntEnv("RATELIMIT_SYNC_BATCH", 20),
+		},
+		Quota: QuotaConfig{
+			PoliciesFile:   getEnv("QUOTA_POLICIES_FILE", ""),
+			UsageFile:      getEnv("QUOTA_USAGE_FILE", ""),
+			FlushInterval:  getDurationEnv("QUOTA_FLUSH_INTERVAL", 10*time.Second),
+			Timezone:       getEnv("QUOTA_TIMEZONE", ""),
+			HistoryWindows: getIntEnv("QUOTA_HISTORY_WINDOWS", 12),
+			MaxKeys:        getIntEnv("QUOTA_MAX_KEYS", 100000),
+		},
+		Priority: PriorityConfig{
+			ClassesFile:  getEnv("PRIORITY_CLASSES_FILE", ""),
+			DefaultClass: getEnv("PRIORITY_DEFAULT_CLASS", ""),
+			CPUInterval:  getDurationEnv("PRIORITY_CPU_INTERVAL", time.Second),
 		},
 		Cache: CacheConfig{
 			Enabled:         getBoolEnv("CACHE_ENABLED", true),
@@ -166,6 +547,22 @@ func LoadConfig() *Config {
 			IdleConnTimeout:     getDurationEnv("BACKEND_IDLE_CONN_TIMEOUT", 90*time.Second),
 			RetryAttempts:       getIntEnv("BACKEND_RETRY_ATTEMPTS", 3),
 			RetryDelay:          getDurationEnv("BACKEND_RETRY_DELAY", 100*time.Millisecond),
+			TLS: UpstreamTLSConfig{
+				CAFile:             getEnv("BACKEND_TLS_CA_FILE", ""),
+				CertFile:           getEnv("BACKEND_TLS_CERT_FILE", ""),
+				KeyFile:            getEnv("BACKEND_TLS_KEY_FILE", ""),
+				ServerName:         getEnv("BACKEND_TLS_SERVER_NAME", ""),
+				InsecureSkipVerify: getBoolEnv("BACKEND_TLS_INSECURE_SKIP_VERIFY", false),
+			},
+			Concurrency: ConcurrencyConfig{
+				Limit:            getIntEnv("BACKEND_CONCURRENCY_LIMIT", 0),
+				MinLimit:         getIntEnv("BACKEND_CONCURRENCY_MIN_LIMIT", 1),
+				MaxLimit:         getIntEnv("BACKEND_CONCURRENCY_MAX_LIMIT", 1000),
+				QueueSize:        getIntEnv("BACKEND_CONCURRENCY_QUEUE_SIZE", 0),
+				QueueTimeout:     getEnv("BACKEND_CONCURRENCY_QUEUE_TIMEOUT", "100ms"),
+				Adaptive:         getEnv("BACKEND_CONCURRENCY_ADAPTIVE", ""),
+				LatencyThreshold: getEnv("BACKEND_CONCURRENCY_LATENCY_THRESHOLD", "1s"),
+			},
 		},
 		Logging: LoggingConfig{
 			Level:      getEnv("LOG_LEVEL", "info"),
@@ -181,7 +578,41 @@ func LoadConfig() *Config {
 			Port:    getEnv("METRICS_PORT", "9090"),
 			Path:    getEnv("METRICS_PATH", "/metrics"),
 		},
+		Admin: AdminConfig{
+			Enabled: getBoolEnv("ADMIN_ENABLED", false),
+			Host:    getEnv("ADMIN_HOST", "127.0.0.1"),
+			Port:    getEnv("ADMIN_PORT", "9091"),
+			Token:   getEnv("ADMIN_TOKEN", ""),
+		},
+	}
+
+	var err error
+	if config.RateLimit.Tiers, err = parseRateLimitTiers(getSliceEnv("RATELIMIT_TIERS", []string{})); err != nil {
+		return nil, fmt.Errorf("invalid RATELIMIT_TIERS: %w", err)
+	}
+	if config.VirtualHosts, err = loadVirtualHosts(getEnv("VHOSTS_FILE", "")); err != nil {
+		return nil, fmt.Errorf("failed to load virtual hosts: %w", err)
+	}
+	if config.Security.ClientCertRules, err = loadClientCertRules(getEnv("SECURITY_CLIENT_CERT_RULES_FILE", "")); err != nil {
+		return nil, fmt.Errorf("failed to load client certificate rules: %w", err)
+	}
+	if config.Security.ScopeRules, err = loadScopeRules(getEnv("SECURITY_SCOPE_RULES_FILE", "")); err != nil {
+		return nil, fmt.Errorf("failed to load scope rules: %w", err)
 	}
+	if config.ForwardAuth.Rules, err = loadForwardAuthRules(getEnv("FORWARD_AUTH_RULES_FILE", "")); err != nil {
+		return nil, fmt.Errorf("failed to load forward auth rules: %w", err)
+	}
+
+	return config, nil
+}
+
+// loadVirtualHosts 从 JSON 文件加载虚拟主机配置
+func loadVirtualHosts(path string) ([]VirtualHostConfig, error) {
+	var vhosts []VirtualHostConfig
+	if err := loadJSONFile(path, &vhosts); err != nil {
+		return nil, err
+	}
+	return vhosts, nil
 }
 
 // 辅助函数
@@ -235,3 +666,83 @@ func getSliceEnv(key string, fallback []string) []string {
 	}
 	return fallback
 }
+
+// loadClientCertRules 从 JSON 文件加载路由级客户端证书规则
+func loadClientCertRules(path string) ([]ClientCertRule, error) {
+	var rules []ClientCertRule
+	if err := loadJSONFile(path, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// loadScopeRules 从 JSON 文件加载路由级授权范围规则
+func loadScopeRules(path string) ([]ScopeRule, error) {
+	var rules []ScopeRule
+	if err := loadJSONFile(path, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// loadForwardAuthRules 从 JSON 文件加载外部授权规则
+func loadForwardAuthRules(path string) ([]ForwardAuthRule, error) {
+	var rules []ForwardAuthRule
+	if err := loadJSONFile(path, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// parseRateLimitTiers 解析限流等级，格式 "name:rps:burst"
+func parseRateLimitTiers(values []string) ([]RateLimitTier, error) {
+	var tiers []RateLimitTier
+	for _, value := range values {
+		parts := strings.Split(strings.TrimSpace(value), ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("tier %q: want name:requests_per_second:burst", value)
+		}
+		rps, err1 := strconv.Atoi(parts[1])
+		burst, err2 := strconv.Atoi(parts[2])
+		if parts[0] == "" || err1 != nil || err2 != nil || rps <= 0 || burst <= 0 {
+			return nil, fmt.Errorf("tier %q: name is required and requests_per_second and burst must be positive integers", value)
+		}
+		tiers = append(tiers, RateLimitTier{Name: parts[0], RequestsPerSecond: rps, BurstSize: burst})
+	}
+	return tiers, nil
+}
+
+// loadJSONFile 读取 JSON 配置文件，路径为空时不做任何事
+func loadJSONFile(path string, v interface{}) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// writeFileAtomic 先写同目录的临时文件再重命名，避免进程中途退出留下不完整的文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
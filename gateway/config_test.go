@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestParseRateLimitTiers(t *testing.T) {
+	tiers, err := parseRateLimitTiers([]string{"free:5:10", " pro:100:200 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RateLimitTier{{Name: "free", RequestsPerSecond: 5, BurstSize: 10}, {Name: "pro", RequestsPerSecond: 100, BurstSize: 200}}
+	if len(tiers) != len(want) || tiers[0] != want[0] || tiers[1] != want[1] {
+		t.Errorf("tiers = %+v, want %+v", tiers, want)
+	}
+
+	for _, value := range []string{"free", "free:5", "free:5:10:1", ":5:10", "free:x:10", "free:5:0", "free:-1:10", "free:5.5:10"} {
+		if _, err := parseRateLimitTiers([]string{"pro:100:200", value}); err == nil {
+			t.Errorf("parseRateLimitTiers(%q) should fail", value)
+		}
+	}
+}
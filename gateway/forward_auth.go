@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// 外部授权失败（超时、网络错误、5xx）时的处理方式
+const (
+	ForwardAuthFailOpen   = "open"   // 放行
+	ForwardAuthFailClosed = "closed" // 返回 503
+)
+
+const forwardAuthMaxBody = 64 << 10
+
+// forwardAuthDenyHeaders 拒绝时从授权服务响应复制给客户端的头
+var forwardAuthDenyHeaders = []string{"Content-Type", "WWW-Authenticate", "Location", "Set-Cookie", "Retry-After"}
+
+// forwardAuthSkipHeaders 不转发给授权服务的请求头（逐跳头和请求体相关头）
+var forwardAuthSkipHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+}
+
+// ForwardAuthRule 路由级外部授权规则，第一条匹配的规则生效
+type ForwardAuthRule struct {
+	Route       string `json:"route"`        // "[METHOD ]PATH"
+	FailureMode string `json:"failure_mode"` // open / closed，为空时使用默认值
+	Disabled    bool   `json:"disabled"`     // 该路由不做外部授权
+}
+
+// forwardAuthDecision 授权服务的决定（可缓存）
+type forwardAuthDecision struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"` // 通过时复制到上游请求，拒绝时返回给客户端
+	Body    []byte      `json:"body,omitempty"`    // 拒绝时的响应体
+}
+
+// Allowed 授权服务返回 2xx 表示允许
+func (d *forwardAuthDecision) Allowed() bool {
+	return d.Status >= 200 && d.Status < 300
+}
+
+// cacheable 带 Set-Cookie 的拒绝决定不缓存：cookie（如跳转登录时的 state）属于这一次请求，不能发给其他请求
+func (d *forwardAuthDecision) cacheable() bool {
+	return d.Allowed() || len(d.Headers.Values("Set-Cookie")) == 0
+}
+
+// ForwardAuthorizer 外部授权（forward-auth）：代理前将请求信息发送到授权服务，按响应状态放行或拒绝
+type ForwardAuthorizer struct {
+	config ForwardAuthConfig
+	client *http.Client
+	cache  *LRUCache // 为 nil 时不缓存
+}
+
+// NewForwardAuthorizer 创建外部授权
+func NewForwardAuthorizer(config ForwardAuthConfig) (*ForwardAuthorizer, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("forward auth requires FORWARD_AUTH_URL")
+	}
+	modes := []string{config.FailureMode}
+	for _, rule := range config.Rules {
+		if rule.FailureMode != "" {
+			modes = append(modes, rule.FailureMode)
+		}
+	}
+	for _, mode := range modes {
+		if mode != ForwardAuthFailOpen && mode != ForwardAuthFailClosed {
+			return nil, fmt.Errorf("invalid forward auth failure mode %q", mode)
+		}
+	}
+
+	a := &ForwardAuthorizer{
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			// 授权服务的重定向（如跳转登录页）原样返回给客户端
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	if config.CacheTTL > 0 {
+		a.cache = NewCache(CacheConfig{
+			Enabled:         true,
+			MaxSize:         config.CacheSize,
+			TTL:             config.CacheTTL,
+			CleanupInterval: time.Minute,
+		})
+	}
+	return a, nil
+}
+
+// Stop 停止缓存清理
+func (a *ForwardAuthorizer) Stop() {
+	if a.cache != nil {
+		a.cache.Stop()
+	}
+}
+
+// rule 返回请求匹配的规则，没有匹配时返回默认规则
+func (a *ForwardAuthorizer) rule(r *http.Request) ForwardAuthRule {
+	for _, rule := range a.config.Rules {
+		if matchRoute(rule.Route, r) {
+			if rule.FailureMode == "" {
+				rule.FailureMode = a.config.FailureMode
+			}
+			return rule
+		}
+	}
+	return ForwardAuthRule{FailureMode: a.config.FailureMode}
+}
+
+// cacheKey 按凭证、方法、主机和请求 URI（与 X-Forwarded-Uri 相同，含查询参数）生成缓存键，请求不带凭证时返回空（不缓存）
+func (a *ForwardAuthorizer) cacheKey(r *http.Request) string {
+	if a.cache == nil {
+		return ""
+	}
+
+	h := sha256.New()
+	found := false
+	for _, header := range a.config.CacheKeyHeaders {
+		value := r.Header.Get(header)
+		if value != "" {
+			found = true
+		}
+		io.WriteString(h, header+"="+value+"\n")
+	}
+	if !found {
+		return ""
+	}
+	io.WriteString(h, r.Method+" "+r.Host+r.URL.RequestURI())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Authorize 获取授权决定，授权服务不可用时返回错误
+func (a *ForwardAuthorizer) Authorize(r *http.Request) (*forwardAuthDecision, bool, error) {
+	key := a.cacheKey(r)
+	if key != "" {
+		if data, found := a.cache.Get(key); found {
+			var decision forwardAuthDecision
+			if json.Unmarshal(data, &decision) == nil {
+				return &decision, true, nil
+			}
+		}
+	}
+
+	decision, err := a.check(r)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if key != "" && decision.cacheable() {
+		if data, err := json.Marshal(decision); err == nil {
+			a.cache.Set(key, data)
+		}
+	}
+	return decision, false, nil
+}
+
+// check 向授权服务发送子请求（不带请求体）
+func (a *ForwardAuthorizer) check(r *http.Request) (*forwardAuthDecision, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), a.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range r.Header {
+		if forwardAuthSkipHeaders[key] {
+			continue
+		}
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	req.Header.Set("X-Forwarded-Method", r.Method)
+	req.Header.Set("X-Forwarded-Uri", r.URL.RequestURI())
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-For", getClientIP(r))
+	if requestID, ok := r.Context().Value(RequestIDKey).(string); ok {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("authorization service returned %d", resp.StatusCode)
+	}
+
+	decision := &forwardAuthDecision{Status: resp.StatusCode, Headers: make(http.Header)}
+	if decision.Allowed() {
+		for _, header := range a.config.ResponseHeaders {
+			if values := resp.Header.Values(header); len(values) > 0 {
+				decision.Headers[http.CanonicalHeaderKey(header)] = values
+			}
+		}
+		return decision, nil
+	}
+
+	for _, header := range forwardAuthDenyHeaders {
+		if values := resp.Header.Values(header); len(values) > 0 {
+			decision.Headers[header] = values
+		}
+	}
+	decision.Body, err = io.ReadAll(io.LimitReader(resp.Body, forwardAuthMaxBody))
+	if err != nil {
+		return nil, err
+	}
+	return decision, nil
+}
+
+// ForwardAuthMiddleware 外部授权中间件，在认证和 RBAC 之后、代理之前执行
+func ForwardAuthMiddleware(authorizer *ForwardAuthorizer, whitelist map[string]bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if authorizer == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 删除客户端伪造的授权结果头
+			for _, header := range authorizer.config.ResponseHeaders {
+				r.Header.Del(header)
+			}
+
+			if whitelist[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rule := authorizer.rule(r)
+			if rule.Disabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requestID := r.Context().Value(RequestIDKey).(string)
+			decision, cached, err := authorizer.Authorize(r)
+			if err != nil {
+				GetLogger().WarnWithRequestID(requestID, "Forward auth unavailable", map[string]interface{}{
+					"path":         r.URL.Path,
+					"error":        err.Error(),
+					"failure_mode": rule.FailureMode,
+				})
+
+				if rule.FailureMode == ForwardAuthFailOpen {
+					next.ServeHTTP(w, r)
+					return
+				}
+				http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+				return
+			}
+
+			if decision.Allowed() {
+				for key, values := range decision.Headers {
+					r.Header[key] = values
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			GetLogger().WarnWithRequestID(requestID, "Access denied by forward auth", map[string]interface{}{
+				"path":        r.URL.Path,
+				"method":      r.Method,
+				"status_code": decision.Status,
+				"cached":      cached,
+			})
+
+			for key, values := range decision.Headers {
+				w.Header()[key] = values
+			}
+			if w.Header().Get("Content-Type") == "" {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			}
+			w.WriteHeader(decision.Status)
+			w.Write(decision.Body)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestForwardAuthorizer(t *testing.T, handler http.HandlerFunc) *ForwardAuthorizer {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	authorizer, err := NewForwardAuthorizer(ForwardAuthConfig{
+		URL:             server.URL,
+		Timeout:         time.Second,
+		FailureMode:     ForwardAuthFailClosed,
+		CacheTTL:        time.Minute,
+		CacheSize:       100,
+		CacheKeyHeaders: []string{"Authorization"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(authorizer.Stop)
+	return authorizer
+}
+
+func TestForwardAuthCacheKeyIncludesQuery(t *testing.T) {
+	var calls atomic.Int32
+	authorizer := newTestForwardAuthorizer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// 授权服务按完整 URI 决定：只允许读取自己的文档
+		if r.Header.Get("X-Forwarded-Uri") == "/docs?owner=alice" {
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	authorize := func(target string) (int, bool) {
+		t.Helper()
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("Authorization", "Bearer alice")
+		decision, cached, err := authorizer.Authorize(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decision.Status, cached
+	}
+
+	for i, v := range []struct {
+		target string
+		status int
+		cached bool
+	}{
+		{"/docs?owner=alice", http.StatusOK, false},
+		{"/docs?owner=alice", http.StatusOK, true},
+		{"/docs?owner=bob", http.StatusForbidden, false}, // 不能复用 owner=alice 的允许决定
+		{"/docs?owner=bob", http.StatusForbidden, true},
+		{"/docs", http.StatusForbidden, false},
+	} {
+		if status, cached := authorize(v.target); status != v.status || cached != v.cached {
+			t.Errorf("request %d %s: status = %d, cached = %v; want %d, %v", i, v.target, status, cached, v.status, v.cached)
+		}
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("authorization service calls = %d, want 3", n)
+	}
+}
+
+func TestForwardAuthDoesNotCacheDenyWithSetCookie(t *testing.T) {
+	var calls atomic.Int32
+	authorizer := newTestForwardAuthorizer(t, func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if r.Header.Get("X-Forwarded-Uri") == "/app" {
+			// 跳转登录，每次生成新的 state cookie
+			http.SetCookie(w, &http.Cookie{Name: "state", Value: string(rune('a' + n))})
+			w.Header().Set("Location", "https://login.example.com/")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	var cookies []string
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/app", nil)
+		r.Header.Set("Authorization", "Bearer alice")
+		decision, cached, err := authorizer.Authorize(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cached || decision.Status != http.StatusFound {
+			t.Fatalf("request %d: status = %d, cached = %v", i, decision.Status, cached)
+		}
+		cookies = append(cookies, decision.Headers.Get("Set-Cookie"))
+	}
+	if cookies[0] == cookies[1] {
+		t.Errorf("Set-Cookie %q was reused for another request", cookies[0])
+	}
+
+	// 不带 Set-Cookie 的拒绝仍然缓存
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/admin", nil)
+		r.Header.Set("Authorization", "Bearer alice")
+		if _, cached, err := authorizer.Authorize(r); err != nil || cached != (i == 1) {
+			t.Errorf("plain deny %d: cached = %v, err = %v", i, cached, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnsupportedPasswordHash = errors.New("unsupported htpasswd hash")
+
+// htpasswdDummyHash 用户不存在时参与校验，使耗时与用户是否存在无关
+const htpasswdDummyHash = "$2b$10$4nLiS8Z6HLKSAlE7EiCnoOXRo/muni9eQLCL6tBRLmcVV7eBahYZC"
+
+// verifyHtpasswd 校验密码是否与 htpasswd 条目匹配
+// 支持 bcrypt（$2y$ / $2b$ / $2a$）、{SHA} 和 Apache MD5（$apr1$）
+func verifyHtpasswd(password, hash string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcryptVerify(password, hash)
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(hash[len("{SHA}"):])) == 1, nil
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, found := strings.Cut(hash[len("$apr1$"):], "$")
+		if !found {
+			return false, ErrUnsupportedPasswordHash
+		}
+		return subtle.ConstantTimeCompare([]byte(apr1Crypt(password, salt)), []byte(hash)) == 1, nil
+	}
+	return false, ErrUnsupportedPasswordHash
+}
+
+// htpasswdSupported 检查条目的哈希格式是否受支持
+func htpasswdSupported(hash string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		_, _, _, err := bcryptParse(hash)
+		return err == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		return len(hash) == len("{SHA}")+28
+	case strings.HasPrefix(hash, "$apr1$"):
+		return strings.Contains(hash[len("$apr1$"):], "$")
+	}
+	return false
+}
+
+// apr1Crypt Apache 的 MD5 crypt（htpasswd -m，默认格式）
+func apr1Crypt(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	final := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(magic + salt))
+	for n := len(pw); n > 0; n -= 16 {
+		ctx.Write(final[:min(n, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	final = ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 == 1 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 == 1 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var sb strings.Builder
+	sb.WriteString(magic + salt + "$")
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			sb.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(final[group[0]])<<16|uint32(final[group[1]])<<8|uint32(final[group[2]]), 4)
+	}
+	encode(uint32(final[11]), 2)
+	return sb.String()
+}
+
+// HtpasswdFile htpasswd（"user:hash"）或 htdigest（"user:realm:HA1"）文件，文件变化时自动重新加载
+type HtpasswdFile struct {
+	path    string
+	digest  bool // htdigest 格式
+	realm   string
+	modTime time.Time
+	entries map[string]string // 用户名 -> 哈希（htdigest 为本 realm 的 HA1）
+	mu      sync.RWMutex
+	stop    chan struct{}
+}
+
+// NewHtpasswdFile 加载 htpasswd 文件
+func NewHtpasswdFile(path string) (*HtpasswdFile, error) {
+	f := &HtpasswdFile{path: path, stop: make(chan struct{})}
+	return f, f.load()
+}
+
+// NewHtdigestFile 加载 htdigest 文件，只保留 realm 匹配的条目
+func NewHtdigestFile(path, realm string) (*HtpasswdFile, error) {
+	f := &HtpasswdFile{path: path, digest: true, realm: realm, stop: make(chan struct{})}
+	return f, f.load()
+}
+
+// load 解析文件，无法识别的行记录警告后忽略
+func (f *HtpasswdFile) load() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		user, hash, found := strings.Cut(text, ":")
+		valid := found && user != ""
+		if f.digest && valid {
+			var realm string
+			realm, hash, valid = strings.Cut(hash, ":")
+			if valid && realm != f.realm {
+				continue
+			}
+			valid = valid && len(hash) == 32
+		} else if valid {
+			valid = htpasswdSupported(hash)
+		}
+
+		if !valid {
+			GetLogger().Warn("Ignoring invalid password file entry", map[string]interface{}{
+				"file": f.path,
+				"line": line,
+			})
+			continue
+		}
+		entries[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.entries = entries
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+
+	GetLogger().Info("Password file loaded", map[string]interface{}{
+		"file":  f.path,
+		"users": len(entries),
+	})
+	return nil
+}
+
+// Lookup 返回用户的哈希
+func (f *HtpasswdFile) Lookup(user string) (string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	hash, ok := f.entries[user]
+	return hash, ok
+}
+
+// StartReload 定期检查文件变化并重新加载，加载失败时沿用上次的内容
+func (f *HtpasswdFile) StartReload(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(f.path)
+			if err != nil {
+				continue
+			}
+
+			f.mu.RLock()
+			changed := !info.ModTime().Equal(f.modTime)
+			f.mu.RUnlock()
+
+			if changed {
+				if err := f.load(); err != nil {
+					GetLogger().Error("Password file reload failed", map[string]interface{}{
+						"file":  f.path,
+						"error": err.Error(),
+					})
+				}
+			}
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// Stop 停止热加载
+func (f *HtpasswdFile) Stop() {
+	close(f.stop)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApr1CryptMatchesOpenSSL(t *testing.T) {
+	// openssl passwd -apr1 -salt <salt> <password>
+	for _, v := range []struct {
+		password, salt, want string
+	}{
+		{"password", "saltsalt", "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/"},
+		{"", "ab", "$apr1$ab$S8K6Sgp3W8c9Jb6LxgywZ."},
+		{"Circle Of Life", "12345678", "$apr1$12345678$F0Twpu4iZ7XPwc4pcnBnF."},
+		{"pw", "toolongsalt", "$apr1$toolongs$.b7SOdLzLdPcSCHmuvJfm1"}, // 盐最多 8 个字符
+	} {
+		if got := apr1Crypt(v.password, v.salt); got != v.want {
+			t.Errorf("apr1Crypt(%q, %q) = %q, want %q", v.password, v.salt, got, v.want)
+		}
+	}
+}
+
+func TestVerifyHtpasswd(t *testing.T) {
+	for _, v := range []struct {
+		password, hash string
+		want           bool
+	}{
+		{"password", "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/", true},
+		{"Password", "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/", false},
+		{"password", "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", true},
+		{"passwort", "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", false},
+		{"U*U", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", true},
+		{"U*U*", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", false},
+		{"password", htpasswdDummyHash, false},
+	} {
+		got, err := verifyHtpasswd(v.password, v.hash)
+		if err != nil || got != v.want {
+			t.Errorf("verifyHtpasswd(%q, %q) = %v, %v; want %v", v.password, v.hash, got, err, v.want)
+		}
+	}
+
+	for _, hash := range []string{"password", "$1$saltsalt$abc", "$apr1$nosalt"} {
+		if _, err := verifyHtpasswd("password", hash); !errors.Is(err, ErrUnsupportedPasswordHash) {
+			t.Errorf("verifyHtpasswd(%q) err = %v, want ErrUnsupportedPasswordHash", hash, err)
+		}
+	}
+}
+
+func TestHtpasswdFileSkipsUnsupportedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	content := "# comment\n" +
+		"alice:$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/\n" +
+		"bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n" +
+		"carol:$2y$10$abcdefghijklmnopqrstuu5Lo0g67CiD3M4RpN1BmBb4Crp5w7dbK\n" +
+		"dave:plaintext\n" +
+		"erin:$2a$05$short\n" +
+		":$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := NewHtpasswdFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"alice", "bob", "carol"} {
+		hash, ok := file.Lookup(user)
+		if !ok {
+			t.Errorf("%s: entry missing", user)
+			continue
+		}
+		if valid, err := verifyHtpasswd("password", hash); err != nil || !valid {
+			t.Errorf("%s: verify = %v, %v", user, valid, err)
+		}
+	}
+	for _, user := range []string{"dave", "erin", ""} {
+		if _, ok := file.Lookup(user); ok {
+			t.Errorf("%q: invalid entry was loaded", user)
+		}
+	}
+}
+
+func TestHtdigestFileKeepsMatchingRealm(t *testing.T) {
+	// HA1 = MD5("Mufasa:testrealm@host.com:Circle Of Life")（RFC 2617 3.5 节示例）
+	const ha1 = "939e7578ed9e3c518a452acee763bce9"
+	if got := md5Hex("Mufasa:testrealm@host.com:Circle Of Life"); got != ha1 {
+		t.Fatalf("HA1 = %s, want %s", got, ha1)
+	}
+
+	path := filepath.Join(t.TempDir(), "htdigest")
+	content := "Mufasa:testrealm@host.com:" + ha1 + "\n" +
+		"Mufasa:other realm:00000000000000000000000000000000\n" +
+		"short:testrealm@host.com:abc\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := NewHtdigestFile(path, "testrealm@host.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := file.Lookup("Mufasa"); !ok || got != ha1 {
+		t.Errorf("Lookup(Mufasa) = %q, %v; want %s", got, ok, ha1)
+	}
+	if _, ok := file.Lookup("short"); ok {
+		t.Error("entry with malformed HA1 was loaded")
+	}
+}
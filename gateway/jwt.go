@@ -0,0 +1,672 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTokenMalformed   = errors.New("token is malformed")
+	ErrTokenAlgorithm   = errors.New("token algorithm not allowed")
+	ErrTokenKeyNotFound = errors.New("token signing key not found")
+	ErrTokenSignature   = errors.New("token signature is invalid")
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrTokenIssuer      = errors.New("token issuer is invalid")
+	ErrTokenAudience    = errors.New("token audience is invalid")
+	ErrTokenType        = errors.New("token type is not accepted")
+)
+
+// bearerError Bearer 令牌认证失败（RFC 6750），认证中间件据此返回 401 和 WWW-Authenticate
+type bearerError struct {
+	err error
+}
+
+func (e *bearerError) Error() string { return e.err.Error() }
+
+func (e *bearerError) Unwrap() error { return e.err }
+
+// Challenge 返回 WWW-Authenticate 头
+func (e *bearerError) Challenge() string {
+	return `Bearer error="invalid_token", error_description="` + e.err.Error() + `"`
+}
+
+// jwtHeader JWT 头部
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// JWK JSON Web Key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	K   string `json:"k,omitempty"`
+}
+
+// JWKSet JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwksMinRefreshInterval 遇到未知 kid 时按需刷新 JWKS 的最小间隔（不论上次是否成功）
+const jwksMinRefreshInterval = 30 * time.Second
+
+// jwksRefresh 一次进行中的 JWKS 拉取，并发的按需刷新等待同一次拉取的结果
+type jwksRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// JWTVerifier JWT 校验器，密钥来自本地文件、HMAC 密钥或 JWKS URL
+type JWTVerifier struct {
+	config      JWTConfig
+	algorithms  map[string]bool
+	tokenTypes  map[string]bool             // 为 nil 时不校验 typ
+	localKeys   map[string]crypto.PublicKey // HMAC 密钥和本地密钥文件中的密钥
+	keys        map[string]crypto.PublicKey // kid -> 公钥（HMAC 为 []byte），无 kid 的密钥使用 ""
+	lastAttempt time.Time                   // 最近一次拉取 JWKS 的开始时间
+	refreshing  *jwksRefresh                // 进行中的按需刷新
+	client      *http.Client
+	mu          sync.RWMutex
+	refreshMu   sync.Mutex
+	stopRefresh chan struct{}
+}
+
+// NewJWTVerifier 创建 JWT 校验器
+func NewJWTVerifier(config JWTConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		config:      config,
+		algorithms:  make(map[string]bool),
+		localKeys:   make(map[string]crypto.PublicKey),
+		keys:        make(map[string]crypto.PublicKey),
+		client:      &http.Client{Timeout: 10 * time.Second},
+		stopRefresh: make(chan struct{}),
+	}
+
+	for _, alg := range config.Algorithms {
+		v.algorithms[strings.TrimSpace(alg)] = true
+	}
+
+	// 同一密钥签发的 ID 令牌（typ JWT，aud 为 client_id）和密码重置令牌（reset+jwt）不能当作访问令牌使用
+	if len(config.Audience) == 0 {
+		return nil, fmt.Errorf("JWT_AUDIENCE is required")
+	}
+	v.tokenTypes = make(map[string]bool)
+	for _, typ := range config.TokenTypes {
+		typ = strings.ToLower(strings.TrimSpace(typ))
+		if typ == "*" {
+			v.tokenTypes = nil
+			break
+		}
+		v.tokenTypes[strings.TrimPrefix(typ, "application/")] = true
+	}
+
+	if config.HMACSecret != "" {
+		v.localKeys[""] = []byte(config.HMACSecret)
+	}
+
+	if config.KeyFile != "" {
+		if err := v.loadKeyFile(config.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for kid, key := range v.localKeys {
+		v.keys[kid] = key
+	}
+
+	if config.JWKSURL != "" {
+		if err := v.refreshJWKS(); err != nil {
+			// JWKS 服务暂不可用时不阻止启动，后续刷新会重试
+			GetLogger().Error("Failed to fetch JWKS", map[string]interface{}{
+				"url":   config.JWKSURL,
+				"error": err.Error(),
+			})
+		}
+		go v.refreshRoutine(config.JWKSRefreshInterval)
+	}
+
+	if len(v.keys) == 0 && config.JWKSURL == "" {
+		return nil, fmt.Errorf("no JWT verification keys configured")
+	}
+
+	return v, nil
+}
+
+// loadKeyFile 加载本地密钥文件（PEM 公钥 / 证书，或 JWKS JSON）
+func (v *JWTVerifier) loadKeyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var set JWKSet
+	if json.Unmarshal(data, &set) == nil && len(set.Keys) > 0 {
+		keys, err := parseJWKSet(set)
+		if err != nil {
+			return err
+		}
+		for kid, key := range keys {
+			v.localKeys[kid] = key
+		}
+		return nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("no PEM or JWKS data found in %s", path)
+	}
+
+	var key crypto.PublicKey
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		key = cert.PublicKey
+	} else {
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	v.localKeys[""] = key
+	return nil
+}
+
+// refreshJWKS 从 JWKS URL 拉取密钥，替换之前从 JWKS 获取的密钥
+func (v *JWTVerifier) refreshJWKS() error {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	v.mu.Lock()
+	v.lastAttempt = time.Now()
+	v.mu.Unlock()
+
+	resp, err := v.client.Get(v.config.JWKSURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected JWKS status code: %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys, err := parseJWKSet(set)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	// 保留本地配置的密钥
+	for kid, key := range v.localKeys {
+		keys[kid] = key
+	}
+	v.keys = keys
+	v.mu.Unlock()
+
+	GetLogger().Debug("JWKS refreshed", map[string]interface{}{
+		"url":  v.config.JWKSURL,
+		"keys": len(keys),
+	})
+
+	return nil
+}
+
+// refreshRoutine 定期刷新 JWKS
+func (v *JWTVerifier) refreshRoutine(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := v.refreshJWKS(); err != nil {
+				GetLogger().Warn("JWKS refresh failed, keeping cached keys", map[string]interface{}{
+					"url":   v.config.JWKSURL,
+					"error": err.Error(),
+				})
+			}
+		case <-v.stopRefresh:
+			return
+		}
+	}
+}
+
+// Stop 停止 JWKS 刷新
+func (v *JWTVerifier) Stop() {
+	close(v.stopRefresh)
+}
+
+// refreshOnDemand 按需刷新 JWKS：距上次拉取（不论成败）不足 jwksMinRefreshInterval 时不拉取，
+// 并发调用共用同一次拉取，避免携带随机 kid 的请求（尤其在 JWKS 服务不可用时）放大为大量外部请求
+func (v *JWTVerifier) refreshOnDemand() error {
+	v.mu.Lock()
+	if call := v.refreshing; call != nil {
+		v.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+	if time.Since(v.lastAttempt) < jwksMinRefreshInterval {
+		v.mu.Unlock()
+		return ErrTokenKeyNotFound
+	}
+	call := &jwksRefresh{done: make(chan struct{})}
+	v.refreshing = call
+	v.lastAttempt = time.Now()
+	v.mu.Unlock()
+
+	call.err = v.refreshJWKS()
+
+	v.mu.Lock()
+	v.refreshing = nil
+	v.mu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// key 查找签名密钥；kid 未知时（密钥轮换）按需刷新 JWKS，最多每 30 秒一次，
+// 仍未找到时使用未标注 kid 的本地密钥
+func (v *JWTVerifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	if !ok && kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			key, ok = k, true
+		}
+	}
+	v.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if v.config.JWKSURL != "" {
+		if err := v.refreshOnDemand(); err == nil {
+			v.mu.RLock()
+			key, ok = v.keys[kid]
+			v.mu.RUnlock()
+			if ok {
+				return key, nil
+			}
+		}
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if key, ok := v.keys[""]; ok {
+		return key, nil
+	}
+
+	return nil, ErrTokenKeyNotFound
+}
+
+// Verify 校验令牌类型、签名和标准声明，返回全部声明
+func (v *JWTVerifier) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	if !v.algorithms[header.Alg] {
+		return nil, ErrTokenAlgorithm
+	}
+
+	// typ 不区分大小写，可以省略 "application/" 前缀（RFC 7515 4.1.9）
+	if v.tokenTypes != nil && !v.tokenTypes[strings.TrimPrefix(strings.ToLower(header.Typ), "application/")] {
+		return nil, ErrTokenType
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// validateClaims 校验 exp / nbf / iss / aud，时间校验允许 ClockSkew 的时钟偏差
+func (v *JWTVerifier) validateClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	skew := v.config.ClockSkew
+
+	if exp, ok := claims["exp"].(float64); ok {
+		if now.After(time.Unix(int64(exp), 0).Add(skew)) {
+			return ErrTokenExpired
+		}
+	} else if v.config.RequireExp {
+		return ErrTokenExpired
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Add(skew).Before(time.Unix(int64(nbf), 0)) {
+			return ErrTokenNotYetValid
+		}
+	}
+
+	if v.config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.config.Issuer {
+			return ErrTokenIssuer
+		}
+	}
+
+	if len(v.config.Audience) > 0 {
+		matched := false
+		for _, aud := range claimStrings(claims["aud"]) {
+			for _, expected := range v.config.Audience {
+				if aud == expected {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return ErrTokenAudience
+		}
+	}
+
+	return nil
+}
+
+// verifyJWTSignature 按算法校验签名
+func verifyJWTSignature(alg string, key crypto.PublicKey, signingInput, signature []byte) error {
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrTokenAlgorithm
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrTokenSignature
+		}
+
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrTokenAlgorithm
+		}
+		digest := sha256.Sum256(signingInput)
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+			return ErrTokenSignature
+		}
+
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return ErrTokenSignature
+		}
+		digest := sha256.Sum256(signingInput)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrTokenSignature
+		}
+
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return ErrTokenAlgorithm
+		}
+		if !ed25519.Verify(pub, signingInput, signature) {
+			return ErrTokenSignature
+		}
+
+	default:
+		return ErrTokenAlgorithm
+	}
+
+	return nil
+}
+
+// parseJWKSet 解析 JWKS 中的公钥
+func parseJWKSet(set JWKSet) (map[string]crypto.PublicKey, error) {
+	keys := make(map[string]crypto.PublicKey)
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWK %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// PublicKey 将 JWK 转换为公钥（oct 类型返回 HMAC 密钥）
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(jwk.K)
+
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+}
+
+// decodeJWTSegment 解码 base64url JSON 段
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// claimStrings 将字符串或字符串数组声明转换为切片
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// claimString 将声明格式化为请求头的值
+func claimString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%f", v), "0"), ".")
+	case bool:
+		return fmt.Sprint(v)
+	case []interface{}:
+		return strings.Join(claimStrings(v), ",")
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// tokenScopes 读取 scope（空格分隔）或 scp（数组）声明
+func tokenScopes(claims map[string]interface{}) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	return claimStrings(claims["scp"])
+}
+
+// parseForwardClaims 解析 "claim:Header" 格式的声明转发配置
+func parseForwardClaims(mappings []string) map[string]string {
+	forwardClaims := make(map[string]string)
+	for _, mapping := range mappings {
+		claim, header, found := strings.Cut(strings.TrimSpace(mapping), ":")
+		if found && claim != "" && header != "" {
+			forwardClaims[claim] = header
+		}
+	}
+	return forwardClaims
+}
+
+// JWTAuthenticator Authorization: Bearer 令牌认证器
+type JWTAuthenticator struct {
+	verifier      *JWTVerifier
+	forwardClaims map[string]string // 声明名 -> 转发给上游的请求头
+	rolesClaim    string
+}
+
+// NewJWTAuthenticator 创建 JWT 认证器
+func NewJWTAuthenticator(verifier *JWTVerifier, config JWTConfig) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		verifier:      verifier,
+		forwardClaims: parseForwardClaims(config.ForwardClaims),
+		rolesClaim:    config.RolesClaim,
+	}
+}
+
+// Authenticate 校验 Bearer 令牌
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	authorization := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+
+	claims, err := a.verifier.Verify(strings.TrimSpace(token))
+	if err != nil {
+		return nil, &bearerError{err: err}
+	}
+
+	headers := make(map[string]string)
+	for claim, header := range a.forwardClaims {
+		if value, ok := claims[claim]; ok {
+			headers[header] = claimString(value)
+		}
+	}
+
+	subject, _ := claims["sub"].(string)
+
+	return &Identity{
+		Subject: subject,
+		Method:  "jwt",
+		Scopes:  tokenScopes(claims),
+		Roles:   claimStrings(claims[a.rolesClaim]),
+		Claims:  claims,
+		Headers: headers,
+	}, nil
+}
+
+// IdentityHeaders 返回转发声明使用的请求头
+func (a *JWTAuthenticator) IdentityHeaders() []string {
+	headers := make([]string, 0, len(a.forwardClaims))
+	for _, header := range a.forwardClaims {
+		headers = append(headers, header)
+	}
+	return headers
+}
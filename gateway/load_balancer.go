@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -23,7 +24,8 @@ type Backend struct {
 	Alive        bool
 	mu           sync.RWMutex
 	ReverseProxy *httputil.ReverseProxy
-	Connections  int64 // 当前连接数（用于最小连接数策略）
+	Client       *http.Client // 后端池共用的客户端（连接池 + 上游 TLS）
+	Connections  int64        // 当前连接数（用于最小连接数策略）
 }
 
 // IsAlive 检查后端是否存活
@@ -62,10 +64,16 @@ type RoundRobinBalancer struct {
 	mu       sync.RWMutex
 }
 
-// NewLoadBalancer 创建负载均衡器
-func NewLoadBalancer(config BackendConfig, strategy string) (LoadBalancer, []*Backend) {
+// NewLoadBalancer 创建负载均衡器，无法创建后端客户端（如 CA 或客户端证书不可读）时返回错误
+func NewLoadBalancer(config BackendConfig, strategy string) (LoadBalancer, []*Backend, error) {
 	var backends []*Backend
 
+	// 后端池共用的 HTTP 客户端
+	client, err := NewBackendClient(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("backend client for %v: %w", config.URLs, err)
+	}
+
 	for _, backendURL := range config.URLs {
 		parsedURL, err := url.Parse(backendURL)
 		if err != nil {
@@ -77,6 +85,7 @@ func NewLoadBalancer(config BackendConfig, strategy string) (LoadBalancer, []*Ba
 		}
 
 		proxy := httputil.NewSingleHostReverseProxy(parsedURL)
+		proxy.Transport = client.Transport
 
 		// 自定义错误处理
 		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
@@ -92,6 +101,7 @@ func NewLoadBalancer(config BackendConfig, strategy string) (LoadBalancer, []*Ba
 			URL:          parsedURL,
 			Alive:        true,
 			ReverseProxy: proxy,
+			Client:       client,
 		}
 
 		backends = append(backends, backend)
@@ -118,7 +128,7 @@ func NewLoadBalancer(config BackendConfig, strategy string) (LoadBalancer, []*Ba
 		}
 	}
 
-	return lb, backends
+	return lb, backends, nil
 }
 
 // NextBackend 获取下一个后端（轮询）
@@ -303,7 +313,7 @@ func (hc *HealthChecker) checkBackend(backend *Backend) {
 		return
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := backend.Client.Do(req)
 	if err != nil {
 		wasAlive := backend.IsAlive()
 		hc.lb.MarkBackendDown(backend)
@@ -318,6 +328,8 @@ func (hc *HealthChecker) checkBackend(backend *Backend) {
 	}
 	defer resp.Body.Close()
 
+	recordBackendCertExpiry(backend, resp.TLS)
+
 	if resp.StatusCode == http.StatusOK {
 		wasDown := !backend.IsAlive()
 		hc.lb.MarkBackendUp(backend)
@@ -18,8 +18,12 @@ var (
 )
 
 func init() {
-	// 加载配置
-	cfg = LoadConfig()
+	// 加载配置（日志尚未初始化，错误直接输出到标准错误）
+	var err error
+	if cfg, err = LoadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
 
 	// 初始化日志
 	logger = InitLogger(cfg.Logging)
@@ -48,10 +52,27 @@ func main() {
 		"/metrics":         true,
 	}
 
+	// 创建限流共享存储（多个网关实例共同计数）
+	rateLimitBackend, err := NewRateLimitBackend(cfg.RateLimit)
+	if err != nil {
+		logger.Error("Invalid rate limit store configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	if rateLimitBackend != nil {
+		defer rateLimitBackend.Stop()
+	}
+
 	// 创建限流器
 	rateLimiter := NewRateLimiter(cfg.RateLimit)
 	if rateLimiter != nil {
 		defer rateLimiter.Stop()
+		if rateLimiter.perIP {
+			rateLimitBackend.Share(rateLimiter, "ip")
+		} else {
+			rateLimitBackend.Share(rateLimiter, "global")
+		}
 	}
 
 	// 创建缓存
@@ -63,23 +84,281 @@ func main() {
 	// 创建熔断器
 	circuitBreaker := NewCircuitBreaker(cfg.CircuitBreaker)
 
+	// 创建默认后端池的并发限制器
+	concurrencyLimiter, err := NewConcurrencyLimiter("default", cfg.Backend.Concurrency)
+	if err != nil {
+		logger.Error("Invalid concurrency configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	// 加载请求优先级类别
+	priorities, err := NewPriorityClasses(cfg.Priority)
+	if err != nil {
+		logger.Error("Invalid priority configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	if priorities != nil {
+		defer priorities.Stop()
+	}
+
+	// 创建 API Key 存储和按等级限流的限流器
+	apiKeys, err := NewAPIKeyStore(cfg.Security.APIKeysFile, cfg.Security.APIKeys, cfg.RateLimit.Tiers)
+	if err != nil {
+		logger.Error("Failed to load API keys", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	if len(cfg.Security.APIKeys) > 0 {
+		logger.Warn("SECURITY_API_KEYS is deprecated, use managed API keys instead", map[string]interface{}{
+			"count": len(cfg.Security.APIKeys),
+		})
+	}
+
+	tierLimiters := make(map[string]*TokenBucketLimiter)
+	for _, tier := range cfg.RateLimit.Tiers {
+		limiter := NewRateLimiter(RateLimitConfig{
+			Enabled:           true,
+			RequestsPerSecond: tier.RequestsPerSecond,
+			BurstSize:         tier.BurstSize,
+			PerIP:             true,
+			CleanupInterval:   cfg.RateLimit.CleanupInterval,
+			MaxKeys:           cfg.RateLimit.MaxKeys,
+		})
+		defer limiter.Stop()
+		rateLimitBackend.Share(limiter, "tier-"+tier.Name)
+		tierLimiters[tier.Name] = limiter
+	}
+
+	// 创建限流策略
+	rateLimitPolicies, err := NewRateLimitPolicies(cfg.RateLimit, rateLimitBackend)
+	if err != nil {
+		logger.Error("Invalid rate limit policies", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	if rateLimitPolicies != nil {
+		defer rateLimitPolicies.Stop()
+	}
+
+	// 创建配额
+	quotas, err := NewQuotaManager(cfg.Quota)
+	if err != nil {
+		logger.Error("Invalid quota configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	if quotas != nil {
+		defer quotas.Stop()
+	}
+
+	// 启动管理 API
+	if cfg.Admin.Enabled {
+		if cfg.Admin.Token == "" {
+			logger.Error("ADMIN_TOKEN is required when the admin API is enabled", nil)
+			os.Exit(1)
+		}
+		adminServer := NewAdminServer(cfg.Admin, apiKeys, quotas, cfg.Security.APIKeyRotationOverlap)
+		adminServer.Start()
+		defer adminServer.Stop()
+	}
+
+	// 创建认证器（任一认证成功即可）
+	authenticators := []Authenticator{NewAPIKeyAuthenticator(apiKeys)}
+	if cfg.Server.EnableTLS && cfg.Server.TLS.ClientAuth != "none" {
+		authenticators = append(authenticators, NewClientCertAuthenticator(cfg.Security.ClientCertForwardPEM))
+	}
+	if cfg.JWT.Enabled {
+		jwtVerifier, err := NewJWTVerifier(cfg.JWT)
+		if err != nil {
+			logger.Error("Invalid JWT configuration", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		defer jwtVerifier.Stop()
+		authenticators = append(authenticators, NewJWTAuthenticator(jwtVerifier, cfg.JWT))
+	}
+
+	if cfg.BasicAuth.Enabled {
+		if cfg.BasicAuth.HtpasswdFile == "" && cfg.BasicAuth.HtdigestFile == "" {
+			logger.Error("BASIC_AUTH_HTPASSWD_FILE or BASIC_AUTH_HTDIGEST_FILE is required when basic auth is enabled", nil)
+			os.Exit(1)
+		}
+		if cfg.BasicAuth.HtpasswdFile != "" {
+			htpasswd, err := NewHtpasswdFile(cfg.BasicAuth.HtpasswdFile)
+			if err != nil {
+				logger.Error("Failed to load htpasswd file", map[string]interface{}{
+					"error": err.Error(),
+				})
+				os.Exit(1)
+			}
+			go htpasswd.StartReload(cfg.BasicAuth.ReloadInterval)
+			defer htpasswd.Stop()
+
+			basicAuthenticator := NewBasicAuthenticator(htpasswd, cfg.BasicAuth)
+			defer basicAuthenticator.Stop()
+			authenticators = append(authenticators, basicAuthenticator)
+		}
+		if cfg.BasicAuth.HtdigestFile != "" {
+			htdigest, err := NewHtdigestFile(cfg.BasicAuth.HtdigestFile, cfg.BasicAuth.Realm)
+			if err != nil {
+				logger.Error("Failed to load htdigest file", map[string]interface{}{
+					"error": err.Error(),
+				})
+				os.Exit(1)
+			}
+			go htdigest.StartReload(cfg.BasicAuth.ReloadInterval)
+			defer htdigest.Stop()
+			authenticators = append(authenticators, NewDigestAuthenticator(htdigest, cfg.BasicAuth))
+		}
+	}
+
+	if cfg.Signing.Enabled {
+		signer, err := NewRequestSigner(cfg.Signing, cfg.Security.MaxRequestSize)
+		if err != nil {
+			logger.Error("Invalid request signing configuration", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		authenticators = append(authenticators, signer)
+	}
+
+	var sessionManager *SessionManager
+	if cfg.Session.Enabled {
+		sessionManager, err = NewSessionManager(cfg.Session, cfg.Security.MaxRequestSize)
+		if err != nil {
+			logger.Error("Invalid session configuration", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		if !cfg.Session.CookieSecure {
+			logger.Warn("Session cookies are sent without the Secure attribute", nil)
+		}
+		authenticators = append(authenticators, sessionManager)
+	}
+
+	// 创建 RBAC 授权器
+	var rbacAuthorizer *RBACAuthorizer
+	if cfg.RBAC.Enabled {
+		var err error
+		rbacAuthorizer, err = NewRBACAuthorizer(cfg.RBAC)
+		if err != nil {
+			logger.Error("Invalid RBAC configuration", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		defer rbacAuthorizer.Stop()
+	}
+
+	// 创建外部授权
+	var forwardAuth *ForwardAuthorizer
+	if cfg.ForwardAuth.Enabled {
+		forwardAuth, err = NewForwardAuthorizer(cfg.ForwardAuth)
+		if err != nil {
+			logger.Error("Invalid forward auth configuration", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		defer forwardAuth.Stop()
+	}
+
+	// 创建属性授权策略引擎
+	var policyEngine *PolicyEngine
+	if cfg.Policy.Enabled {
+		policyEngine, err = NewPolicyEngine(cfg.Policy)
+		if err != nil {
+			logger.Error("Invalid policy configuration", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		if cfg.Policy.DryRun {
+			logger.Warn("Policy engine running in dry-run mode, denials are only logged", nil)
+		}
+	}
+
 	// 创建负载均衡器和后端列表
-	loadBalancer, backends := NewLoadBalancer(cfg.Backend, cfg.Backend.LoadBalanceStrategy)
+	loadBalancer, backends, err := NewLoadBalancer(cfg.Backend, cfg.Backend.LoadBalanceStrategy)
+	if err != nil {
+		logger.Error("Failed to create backend pool", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
 
 	// 启动健康检查
 	healthChecker := NewHealthChecker(backends, loadBalancer, cfg.Backend)
 	go healthChecker.Start()
 	defer healthChecker.Stop()
 
+	// 默认虚拟主机（未匹配任何虚拟主机的请求）
+	defaultHost := &VirtualHost{
+		Name: "default",
+		Handler: buildHostChain(mux, chainDeps{
+			rateLimiter:       rateLimiter,
+			tierLimiters:      tierLimiters,
+			rateLimitPolicies: rateLimitPolicies,
+			quotas:            quotas,
+			priorities:        priorities,
+			cache:             cache,
+			circuitBreaker:    circuitBreaker,
+			concurrency:       concurrencyLimiter,
+			loadBalancer:      loadBalancer,
+			pathWhitelist:     pathWhitelist,
+			authenticators:    authenticators,
+			sessions:          sessionManager,
+			rbac:              rbacAuthorizer,
+			policy:            policyEngine,
+			forwardAuth:       forwardAuth,
+			security:          cfg.Security,
+			securityHeaders:   DefaultSecurityHeaders(cfg.Server.HSTS),
+		}),
+	}
+
+	// 创建证书存储（默认证书 + 证书目录 + 虚拟主机证书）
+	var certStore *CertStore
+	if cfg.Server.EnableTLS {
+		certStore = NewCertStore(cfg.Server.CertDir, cfg.Server.CertExpiryWarning)
+		certStore.AddPair(cfg.Server.CertFile, cfg.Server.KeyFile)
+	}
+
+	// 创建虚拟主机路由器
+	vhostRouter, err := NewVirtualHostRouter(cfg.VirtualHosts, defaultHost, certStore, chainDeps{
+		rateLimiter:       rateLimiter,
+		tierLimiters:      tierLimiters,
+		rateLimitPolicies: rateLimitPolicies,
+		quotas:            quotas,
+		priorities:        priorities,
+		cache:             cache,
+		authenticators:    authenticators,
+		sessions:          sessionManager,
+		rbac:              rbacAuthorizer,
+		policy:            policyEngine,
+		forwardAuth:       forwardAuth,
+		security:          cfg.Security,
+		securityHeaders:   DefaultSecurityHeaders(cfg.Server.HSTS),
+	})
+	if err != nil {
+		logger.Error("Failed to create virtual hosts", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	defer vhostRouter.Stop()
+
 	// 构建中间件链（注意顺序很重要！）
-	handler := buildMiddlewareChain(
-		mux,
-		rateLimiter,
-		cache,
-		circuitBreaker,
-		loadBalancer,
-		pathWhitelist,
-	)
+	handler := buildMiddlewareChain(vhostRouter)
 
 	// 创建 HTTP 服务器
 	srv := &http.Server{
@@ -91,6 +370,44 @@ func main() {
 		MaxHeaderBytes: cfg.Server.MaxHeaderBytes,
 	}
 
+	// 按 SNI 选择证书，证书文件变化时热加载
+	if cfg.Server.EnableTLS {
+		if err := certStore.Load(); err != nil {
+			logger.Error("Failed to load certificates", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		go certStore.StartReload(cfg.Server.CertReloadInterval)
+		defer certStore.Stop()
+
+		tlsConfig, err := NewServerTLSConfig(cfg.Server.TLS, vhostRouter.GetCertificate)
+		if err != nil {
+			logger.Error("Invalid TLS configuration", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+
+		// 客户端证书校验（mTLS）
+		if cfg.Server.TLS.ClientAuth != "none" {
+			verifier, err := NewClientCertVerifier(cfg.Server.TLS.ClientCAFile, cfg.Server.TLS.ClientCRLFile)
+			if err == nil {
+				err = verifier.ApplyClientAuth(tlsConfig, cfg.Server.TLS.ClientAuth)
+			}
+			if err != nil {
+				logger.Error("Invalid client certificate configuration", map[string]interface{}{
+					"error": err.Error(),
+				})
+				os.Exit(1)
+			}
+			go verifier.StartReload(cfg.Server.CertReloadInterval)
+			defer verifier.Stop()
+		}
+
+		srv.TLSConfig = tlsConfig
+	}
+
 	// 启动指标服务器
 	StartMetricsServer(cfg.Metrics)
 
@@ -104,7 +421,7 @@ func main() {
 
 		var err error
 		if cfg.Server.EnableTLS {
-			err = srv.ListenAndServeTLS(cfg.Server.CertFile, cfg.Server.KeyFile)
+			err = srv.ListenAndServeTLS("", "")
 		} else {
 			err = srv.ListenAndServe()
 		}
@@ -117,6 +434,31 @@ func main() {
 		}
 	}()
 
+	// 启动 HTTP → HTTPS 重定向服务器
+	var redirectSrv *http.Server
+	if cfg.Server.EnableTLS && cfg.Server.HTTPRedirectPort != "" {
+		redirectSrv = &http.Server{
+			Handler:        HTTPSRedirectHandler(cfg.Server.Port, cfg.Server.HTTPRedirectExempts, handler),
+			Addr:           cfg.Server.Host + ":" + cfg.Server.HTTPRedirectPort,
+			ReadTimeout:    cfg.Server.ReadTimeout,
+			WriteTimeout:   cfg.Server.WriteTimeout,
+			IdleTimeout:    cfg.Server.IdleTimeout,
+			MaxHeaderBytes: cfg.Server.MaxHeaderBytes,
+		}
+
+		go func() {
+			logger.Info("HTTP redirect server started", map[string]interface{}{
+				"address": redirectSrv.Addr,
+			})
+
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Redirect server error", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}()
+	}
+
 	// 等待中断信号
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -139,23 +481,68 @@ func main() {
 		})
 	}
 
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(ctx); err != nil {
+			logger.Error("Redirect server forced to shutdown", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
 	logger.Info("Server stopped", nil)
 }
 
+// chainDeps 虚拟主机中间件链的依赖
+type chainDeps struct {
+	rateLimiter       *TokenBucketLimiter
+	tierLimiters      map[string]*TokenBucketLimiter // API Key 限流等级
+	rateLimitPolicies *RateLimitPolicies             // 为 nil 时不按策略限流
+	quotas            *QuotaManager                  // 为 nil 时不检查配额
+	priorities        *PriorityClasses               // 为 nil 时不区分请求优先级
+	cache             *LRUCache
+	circuitBreaker    *CircuitBreaker
+	concurrency       *ConcurrencyLimiter // 为 nil 时不限制发往默认后端池的并发
+	loadBalancer      LoadBalancer        // 为 nil 时不挂载代理中间件
+	pathWhitelist     map[string]bool
+	authenticators    []Authenticator
+	sessions          *SessionManager    // 为 nil 时不处理浏览器会话
+	rbac              *RBACAuthorizer    // 为 nil 时不做 RBAC 授权
+	policy            *PolicyEngine      // 为 nil 时不做属性授权
+	forwardAuth       *ForwardAuthorizer // 为 nil 时不做外部授权
+	security          SecurityConfig
+	securityHeaders   map[string]string
+}
+
 // buildMiddlewareChain 构建中间件链
-func buildMiddlewareChain(
-	handler http.Handler,
-	rateLimiter *TokenBucketLimiter,
-	cache *LRUCache,
-	circuitBreaker *CircuitBreaker,
-	loadBalancer LoadBalancer,
-	pathWhitelist map[string]bool,
-) http.Handler {
+func buildMiddlewareChain(router http.Handler) http.Handler {
 	// 中间件执行顺序（从外到内）：
 	// 1. Recovery - 捕获 panic
 	// 2. RequestID - 生成请求 ID
 	// 3. Logging - 记录日志
 	// 4. Metrics - 收集指标
+	// 5-15. 按 Host 分发到虚拟主机的中间件链（见 buildHostChain）
+
+	// 从内到外包装中间件
+	h := router
+
+	// 4. 指标中间件
+	h = MetricsMiddleware(h)
+
+	// 3. 日志中间件
+	h = LoggingMiddlewareNew(logger)(h)
+
+	// 2. 请求 ID 中间件
+	h = RequestIDMiddleware(h)
+
+	// 1. 恢复中间件（最外层）
+	h = RecoveryMiddleware(h)
+
+	return h
+}
+
+// buildHostChain 构建单个虚拟主机的中间件链
+func buildHostChain(handler http.Handler, deps chainDeps) http.Handler {
+	// 中间件执行顺序（从外到内）：
 	// 5. SecurityHeaders - 设置安全头
 	// 6. CORS - 处理跨域
 	// 7. IPFilter - IP 过滤
@@ -163,25 +550,40 @@ func buildMiddlewareChain(
 	// 9. Timeout - 超时控制
 	// 10. Compression - 压缩
 	// 11. RateLimit - 限流
-	// 12. Authentication - 认证
+	// 12. Authentication - 认证（API Key / 客户端证书 / JWT / Basic / Digest / HMAC 签名 / 会话 Cookie，任一通过即可）+ 会话 CSRF 校验 + API Key 等级限流 + 限流策略 + 路由级证书与授权范围规则 + RBAC + 属性授权策略 + 外部授权 + 配额
 	// 13. Cache - 缓存
-	// 14. Proxy - 代理（负载均衡 + 熔断 + 重试）
+	// 14. Priority + Proxy - 请求优先级 + 代理（并发限制 + 负载均衡 + 熔断 + 重试）
 	// 15. Handler - 最终处理器
 
 	// 从内到外包装中间件
 	h := handler
 
 	// 14. 代理中间件（只对非白名单路径生效）
-	h = ProxyMiddleware(loadBalancer, circuitBreaker, cfg.Backend, pathWhitelist)(h)
+	if deps.loadBalancer != nil {
+		h = ProxyMiddleware(deps.loadBalancer, deps.circuitBreaker, deps.concurrency, cfg.Backend, deps.pathWhitelist)(h)
+	}
 
-	// 13. 缓存中间件
-	h = CacheMiddlewareNew(cache, pathWhitelist)(h)
+	// 14. 请求优先级中间件（缓存命中的请求不排队也不被拒绝）
+	h = PriorityMiddleware(deps.priorities, deps.pathWhitelist)(h)
 
-	// 12. 认证中间件
-	h = AuthenticationMiddlewareNew(cfg.Security, pathWhitelist)(h)
+	// 13. 缓存中间件
+	h = CacheMiddlewareNew(deps.cache, deps.pathWhitelist)(h)
+
+	// 12. 认证中间件（配额在全部授权检查之后计数，被拒绝的请求不消耗配额）
+	h = QuotaMiddleware(deps.quotas, deps.pathWhitelist)(h)
+	h = ForwardAuthMiddleware(deps.forwardAuth, deps.pathWhitelist)(h)
+	h = PolicyMiddleware(deps.policy, deps.pathWhitelist)(h)
+	h = RBACMiddleware(deps.rbac, deps.pathWhitelist)(h)
+	h = ScopeMiddleware(deps.security.ScopeRules)(h)
+	h = ClientCertRuleMiddleware(deps.security.ClientCertRules)(h)
+	h = RateLimitPolicyMiddleware(deps.rateLimitPolicies, deps.pathWhitelist)(h)
+	h = TierRateLimitMiddleware(deps.tierLimiters)(h)
+	h = SessionMiddleware(deps.sessions)(h)
+	h = AuthenticationMiddlewareNew(deps.authenticators, deps.pathWhitelist)(h)
+	h = SessionEndpointMiddleware(deps.sessions)(h)
 
 	// 11. 限流中间件
-	h = RateLimitMiddlewareNew(rateLimiter, pathWhitelist)(h)
+	h = RateLimitMiddlewareNew(deps.rateLimiter, deps.pathWhitelist)(h)
 
 	// 10. 压缩中间件
 	h = CompressionMiddleware(h)
@@ -190,28 +592,16 @@ func buildMiddlewareChain(
 	h = TimeoutMiddleware(30 * time.Second)(h)
 
 	// 8. 请求大小限制中间件
-	h = RequestSizeLimitMiddleware(cfg.Security.MaxRequestSize)(h)
+	h = RequestSizeLimitMiddleware(deps.security.MaxRequestSize)(h)
 
 	// 7. IP 过滤中间件
-	h = IPFilterMiddleware(cfg.Security)(h)
+	h = IPFilterMiddleware(deps.security)(h)
 
 	// 6. CORS 中间件
-	h = CORSMiddleware(cfg.Security)(h)
+	h = CORSMiddleware(deps.security)(h)
 
 	// 5. 安全头中间件
-	h = SecurityHeadersMiddleware(h)
-
-	// 4. 指标中间件
-	h = MetricsMiddleware(h)
-
-	// 3. 日志中间件
-	h = LoggingMiddlewareNew(logger)(h)
-
-	// 2. 请求 ID 中间件
-	h = RequestIDMiddleware(h)
-
-	// 1. 恢复中间件（最外层）
-	h = RecoveryMiddleware(h)
+	h = SecurityHeadersMiddleware(deps.securityHeaders)(h)
 
 	return h
 }
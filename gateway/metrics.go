@@ -31,9 +31,22 @@ type Metrics struct {
 	// 限流统计
 	RateLimitedRequests uint64
 
+	// 并发限制：被拒绝的请求数和各后端池当前的上限
+	ShedRequests      uint64
+	ConcurrencyLimits map[string]int
+	concurrencyMu     sync.RWMutex
+
+	// 各优先级类别的请求数与按原因统计的被拒绝请求数
+	PriorityClasses map[string]*PriorityClassStats
+	priorityMu      sync.Mutex
+
 	// 缓存统计
 	CacheHits   uint64
 	CacheMisses uint64
+
+	// 证书过期时间
+	CertificateExpiry map[string]time.Time
+	certMu            sync.RWMutex
 }
 
 var globalMetrics *Metrics
@@ -41,9 +54,12 @@ var globalMetrics *Metrics
 // InitMetrics 初始化指标收集器
 func InitMetrics() *Metrics {
 	globalMetrics = &Metrics{
-		StatusCodes:    make(map[int]uint64),
-		BackendStatus:  make(map[string]bool),
-		RequestLatency: make([]time.Duration, 0, 1000),
+		StatusCodes:       make(map[int]uint64),
+		BackendStatus:     make(map[string]bool),
+		CertificateExpiry: make(map[string]time.Time),
+		ConcurrencyLimits: make(map[string]int),
+		PriorityClasses:   make(map[string]*PriorityClassStats),
+		RequestLatency:    make([]time.Duration, 0, 1000),
 	}
 	return globalMetrics
 }
@@ -97,6 +113,48 @@ func (m *Metrics) RecordRateLimited() {
 	atomic.AddUint64(&m.RateLimitedRequests, 1)
 }
 
+// PriorityClassStats 优先级类别的统计
+type PriorityClassStats struct {
+	Requests uint64            `json:"requests"`
+	Shed     map[string]uint64 `json:"shed"` // 拒绝原因 -> 请求数
+}
+
+// RecordShed 记录因过载被拒绝的请求，class 为空表示未配置请求优先级
+func (m *Metrics) RecordShed(class, reason string) {
+	atomic.AddUint64(&m.ShedRequests, 1)
+	if class == "" {
+		return
+	}
+
+	m.priorityMu.Lock()
+	defer m.priorityMu.Unlock()
+	m.priorityClass(class).Shed[reason]++
+}
+
+// RecordPriorityRequest 记录分到优先级类别的请求
+func (m *Metrics) RecordPriorityRequest(class string) {
+	m.priorityMu.Lock()
+	defer m.priorityMu.Unlock()
+	m.priorityClass(class).Requests++
+}
+
+// priorityClass 返回类别的统计，不存在时创建（调用方持有锁）
+func (m *Metrics) priorityClass(class string) *PriorityClassStats {
+	stats, ok := m.PriorityClasses[class]
+	if !ok {
+		stats = &PriorityClassStats{Shed: make(map[string]uint64)}
+		m.PriorityClasses[class] = stats
+	}
+	return stats
+}
+
+// UpdateConcurrencyLimit 更新后端池的并发上限
+func (m *Metrics) UpdateConcurrencyLimit(pool string, limit int) {
+	m.concurrencyMu.Lock()
+	defer m.concurrencyMu.Unlock()
+	m.ConcurrencyLimits[pool] = limit
+}
+
 // RecordCacheHit 记录缓存命中
 func (m *Metrics) RecordCacheHit() {
 	atomic.AddUint64(&m.CacheHits, 1)
@@ -114,6 +172,13 @@ func (m *Metrics) UpdateBackendStatus(backend string, alive bool) {
 	m.BackendStatus[backend] = alive
 }
 
+// UpdateCertificateExpiry 更新证书过期时间
+func (m *Metrics) UpdateCertificateExpiry(name string, notAfter time.Time) {
+	m.certMu.Lock()
+	defer m.certMu.Unlock()
+	m.CertificateExpiry[name] = notAfter
+}
+
 // GetStats 获取统计数据
 func (m *Metrics) GetStats() map[string]interface{} {
 	m.mu.RLock()
@@ -165,19 +230,49 @@ func (m *Metrics) GetStats() map[string]interface{} {
 		backendStatus[k] = v
 	}
 
+	// 证书剩余有效天数
+	m.certMu.RLock()
+	certificateExpiry := make(map[string]float64)
+	for k, v := range m.CertificateExpiry {
+		certificateExpiry[k] = time.Until(v).Hours() / 24
+	}
+	m.certMu.RUnlock()
+
+	m.concurrencyMu.RLock()
+	concurrencyLimits := make(map[string]int)
+	for k, v := range m.ConcurrencyLimits {
+		concurrencyLimits[k] = v
+	}
+	m.concurrencyMu.RUnlock()
+
+	m.priorityMu.Lock()
+	priorityClasses := make(map[string]PriorityClassStats)
+	for k, v := range m.PriorityClasses {
+		shed := make(map[string]uint64)
+		for reason, count := range v.Shed {
+			shed[reason] = count
+		}
+		priorityClasses[k] = PriorityClassStats{Requests: v.Requests, Shed: shed}
+	}
+	m.priorityMu.Unlock()
+
 	return map[string]interface{}{
-		"total_requests":        totalRequests,
-		"success_requests":      atomic.LoadUint64(&m.SuccessRequests),
-		"error_requests":        atomic.LoadUint64(&m.ErrorRequests),
-		"error_rate":            errorRate,
-		"rate_limited_requests": atomic.LoadUint64(&m.RateLimitedRequests),
-		"avg_latency_ms":        avgLatency,
-		"p95_latency_ms":        p95Latency,
-		"status_codes":          statusCodes,
-		"cache_hits":            cacheHits,
-		"cache_misses":          cacheMisses,
-		"cache_hit_rate":        cacheHitRate,
-		"backend_status":        backendStatus,
+		"total_requests":          totalRequests,
+		"success_requests":        atomic.LoadUint64(&m.SuccessRequests),
+		"error_requests":          atomic.LoadUint64(&m.ErrorRequests),
+		"error_rate":              errorRate,
+		"rate_limited_requests":   atomic.LoadUint64(&m.RateLimitedRequests),
+		"shed_requests":           atomic.LoadUint64(&m.ShedRequests),
+		"concurrency_limits":      concurrencyLimits,
+		"priority_classes":        priorityClasses,
+		"avg_latency_ms":          avgLatency,
+		"p95_latency_ms":          p95Latency,
+		"status_codes":            statusCodes,
+		"cache_hits":              cacheHits,
+		"cache_misses":            cacheMisses,
+		"cache_hit_rate":          cacheHitRate,
+		"backend_status":          backendStatus,
+		"certificate_expiry_days": certificateExpiry,
 	}
 }
 
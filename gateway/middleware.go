@@ -6,9 +6,11 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -91,6 +93,9 @@ func LoggingMiddlewareNew(logger *Logger) func(http.Handler) http.Handler {
 			// 包装 ResponseWriter 以捕获状态码
 			rw := NewResponseWriter(w)
 
+			// 记录内层认证得到的身份
+			r, recorder := withIdentityRecorder(r)
+
 			// 记录请求开始
 			logger.InfoWithRequestID(requestID, "Request started", map[string]interface{}{
 				"method":     r.Method,
@@ -107,13 +112,21 @@ func LoggingMiddlewareNew(logger *Logger) func(http.Handler) http.Handler {
 			GetMetrics().RecordLatency(duration)
 			GetMetrics().RecordStatusCode(rw.StatusCode())
 
-			logger.InfoWithRequestID(requestID, "Request completed", map[string]interface{}{
+			fields := map[string]interface{}{
 				"method":      r.Method,
 				"path":        r.URL.Path,
 				"status_code": rw.StatusCode(),
 				"duration_ms": duration.Milliseconds(),
 				"remote_ip":   getClientIP(r),
-			})
+			}
+			if identity := recorder.identity.Load(); identity != nil {
+				fields["subject"] = identity.Subject
+				fields["auth_method"] = identity.Method
+				if identity.KeyID != "" {
+					fields["api_key_id"] = identity.KeyID
+				}
+			}
+			logger.InfoWithRequestID(requestID, "Request completed", fields)
 		})
 	}
 }
@@ -135,37 +148,81 @@ func MetricsMiddleware(next http.Handler) http.Handler {
 }
 
 // AuthenticationMiddlewareNew 改进的认证中间件
-func AuthenticationMiddlewareNew(config SecurityConfig, whitelist map[string]bool) func(http.Handler) http.Handler {
-	// 将 API keys 转换为 map 以加速查找
-	apiKeyMap := make(map[string]bool)
-	for _, key := range config.APIKeys {
-		apiKeyMap[key] = true
+// 依次尝试各认证器，任一认证器认证成功即放行
+func AuthenticationMiddlewareNew(authenticators []Authenticator, whitelist map[string]bool) func(http.Handler) http.Handler {
+	// 认证器会转发给上游的身份头
+	var identityHeaders []string
+	for _, authenticator := range authenticators {
+		if provider, ok := authenticator.(IdentityHeaderProvider); ok {
+			identityHeaders = append(identityHeaders, provider.IdentityHeaders()...)
+		}
 	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 删除客户端伪造的身份头
+			for _, header := range identityHeaders {
+				r.Header.Del(header)
+			}
+
 			// 检查是否在白名单中
 			if whitelist[r.URL.Path] {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			// 获取 API Key
-			apiKey := r.Header.Get("X-API-Key")
+			// 验证凭证
+			var authErr error
+			for _, authenticator := range authenticators {
+				identity, err := authenticator.Authenticate(r)
+				if err != nil {
+					authErr = err
+					continue
+				}
+				if identity != nil {
+					next.ServeHTTP(w, withIdentity(r, identity))
+					return
+				}
+			}
 
-			// 验证 API Key
-			if apiKey == "" || !apiKeyMap[apiKey] {
-				requestID := r.Context().Value(RequestIDKey).(string)
-				GetLogger().WarnWithRequestID(requestID, "Authentication failed", map[string]interface{}{
-					"path":      r.URL.Path,
-					"remote_ip": getClientIP(r),
-				})
+			fields := map[string]interface{}{
+				"path":      r.URL.Path,
+				"remote_ip": getClientIP(r),
+			}
+			if authErr != nil {
+				fields["error"] = authErr.Error()
+			}
+
+			requestID := r.Context().Value(RequestIDKey).(string)
+			GetLogger().WarnWithRequestID(requestID, "Authentication failed", fields)
+
+			for _, authenticator := range authenticators {
+				if redirecter, ok := authenticator.(LoginRedirecter); ok && redirecter.RedirectToLogin(w, r) {
+					return
+				}
+			}
 
-				http.Error(w, "Forbidden", http.StatusForbidden)
+			var challenges []string
+			var challengeErr ChallengeError
+			if errors.As(authErr, &challengeErr) {
+				challenges = append(challenges, challengeErr.Challenge())
+			}
+			for _, authenticator := range authenticators {
+				if challenger, ok := authenticator.(Challenger); ok {
+					if challenge := challenger.Challenge(r); challenge != "" {
+						challenges = append(challenges, challenge)
+					}
+				}
+			}
+			if len(challenges) > 0 {
+				for _, challenge := range challenges {
+					w.Header().Add("WWW-Authenticate", challenge)
+				}
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			http.Error(w, "Forbidden", http.StatusForbidden)
 		})
 	}
 }
@@ -175,7 +232,7 @@ func RateLimitMiddlewareNew(limiter *TokenBucketLimiter, whitelist map[string]bo
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// 检查是否在白名单中
-			if whitelist[r.URL.Path] {
+			if whitelist[r.URL.Path] || limiter == nil {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -184,7 +241,14 @@ func RateLimitMiddlewareNew(limiter *TokenBucketLimiter, whitelist map[string]bo
 			clientIP := getClientIP(r)
 
 			// 检查限流
-			if limiter != nil && !limiter.Allow(clientIP) {
+			policy := "global"
+			if limiter.perIP {
+				policy = "ip"
+			}
+			result := limiter.Take(clientIP)
+			setRateLimitHeaders(w.Header(), policy, result)
+
+			if !result.Allowed {
 				GetMetrics().RecordRateLimited()
 
 				requestID := r.Context().Value(RequestIDKey).(string)
@@ -192,10 +256,79 @@ func RateLimitMiddlewareNew(limiter *TokenBucketLimiter, whitelist map[string]bo
 					"remote_ip": clientIP,
 				})
 
-				w.Header().Set("X-RateLimit-Limit", "100")
-				w.Header().Set("X-RateLimit-Remaining", "0")
-				w.Header().Set("Retry-After", "1")
-				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				writeRateLimited(w, result)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders 写入限流响应头：每个生效的限流器在 RateLimit-Policy / RateLimit
+// （draft-ietf-httpapi-ratelimit-headers）中各占一项，旧式 X-RateLimit-* 只反映剩余令牌最少的限流器
+// 令牌桶的配额 q 为桶容量，窗口 w 和重置时间 t 为补满所需的秒数
+func setRateLimitHeaders(header http.Header, policy string, result RateLimitResult) {
+	name := quoteAuthParam(policy)
+	reset := strconv.Itoa(ceilSeconds(result.Reset))
+	header.Add("RateLimit-Policy", name+";q="+strconv.Itoa(result.Limit)+";w="+strconv.Itoa(ceilSeconds(result.Window)))
+	header.Add("RateLimit", name+";r="+strconv.Itoa(result.Remaining)+";t="+reset)
+
+	if current, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil && current <= result.Remaining {
+		return
+	}
+	header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("X-RateLimit-Reset", reset)
+}
+
+// writeRateLimited 返回 429，Retry-After 为距下一个可用令牌的秒数
+func writeRateLimited(w http.ResponseWriter, result RateLimitResult) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+}
+
+// ceilSeconds 将时长向上取整为秒
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// TierRateLimitMiddleware 按 API Key 的限流等级限流，每个 key 独立计数
+// 在认证之后执行；没有等级或等级未配置的调用方不受影响
+func TierRateLimitMiddleware(limiters map[string]*TokenBucketLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(limiters) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := GetIdentity(r)
+			if identity == nil || identity.Tier == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limiter := limiters[identity.Tier]
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result := limiter.Take(identity.KeyID)
+			setRateLimitHeaders(w.Header(), "tier-"+identity.Tier, result)
+
+			if !result.Allowed {
+				GetMetrics().RecordRateLimited()
+
+				requestID := r.Context().Value(RequestIDKey).(string)
+				GetLogger().WarnWithRequestID(requestID, "Rate limit exceeded", map[string]interface{}{
+					"remote_ip":  getClientIP(r),
+					"subject":    identity.Subject,
+					"api_key_id": identity.KeyID,
+					"tier":       identity.Tier,
+				})
+
+				writeRateLimited(w, result)
 				return
 			}
 
@@ -296,20 +429,39 @@ func CORSMiddleware(config SecurityConfig) func(http.Handler) http.Handler {
 	}
 }
 
+// DefaultSecurityHeaders 默认安全头
+func DefaultSecurityHeaders(hsts HSTSConfig) map[string]string {
+	headers := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"X-XSS-Protection":        "1; mode=block",
+		"Content-Security-Policy": "default-src 'self'",
+		"Referrer-Policy":         "strict-origin-when-cross-origin",
+		"Permissions-Policy":      "geolocation=(), microphone=(), camera=()",
+	}
+
+	if value := HSTSHeader(hsts); value != "" {
+		headers["Strict-Transport-Security"] = value
+	}
+
+	return headers
+}
+
 // SecurityHeadersMiddleware 安全头中间件
-func SecurityHeadersMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// 设置安全头
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "DENY")
-		w.Header().Set("X-XSS-Protection", "1; mode=block")
-		w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
-		w.Header().Set("Content-Security-Policy", "default-src 'self'")
-		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
+func SecurityHeadersMiddleware(headers map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 设置安全头（HSTS 只能通过 TLS 连接发送）
+			for key, value := range headers {
+				if key == "Strict-Transport-Security" && r.TLS == nil {
+					continue
+				}
+				w.Header().Set(key, value)
+			}
 
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 // IPFilterMiddleware IP 过滤中间件
@@ -463,6 +615,11 @@ func getClientIP(r *http.Request) string {
 	}
 
 	// 从 RemoteAddr 获取
+	return getRemoteIP(r)
+}
+
+// getRemoteIP 获取 TCP 连接的对端 IP，不读取客户端可伪造的转发头
+func getRemoteIP(r *http.Request) string {
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		return r.RemoteAddr
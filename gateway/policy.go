@@ -0,0 +1,884 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PolicyRule 路由级属性授权策略，匹配路由的请求要求 condition 为 true
+type PolicyRule struct {
+	Name      string `json:"name"`
+	Route     string `json:"route"`     // "[METHOD ]PATH"，PATH 可以包含 {name} 参数段
+	Condition string `json:"condition"` // 条件表达式，见 README
+	DryRun    bool   `json:"dry_run"`   // 只记录会被拒绝的请求，不拦截
+}
+
+// compiledPolicy 编译后的策略
+type compiledPolicy struct {
+	PolicyRule
+	expr policyNode
+}
+
+// PolicyDenial 策略拒绝的原因
+type PolicyDenial struct {
+	Policy string `json:"policy"`
+	Route  string `json:"route"`
+	DryRun bool   `json:"-"`
+	Err    error  `json:"-"` // 表达式求值失败（按拒绝处理）
+}
+
+// PolicyEngine 属性授权策略引擎：请求匹配的全部策略都必须通过
+type PolicyEngine struct {
+	policies []*compiledPolicy
+	dryRun   bool
+	location *time.Location
+
+	trustProxyHeaders bool
+}
+
+// NewPolicyEngine 加载并编译策略文件
+func NewPolicyEngine(config PolicyConfig) (*PolicyEngine, error) {
+	if config.File == "" {
+		return nil, fmt.Errorf("policy engine requires POLICY_FILE")
+	}
+
+	location := time.Local
+	if config.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid POLICY_TIMEZONE: %w", err)
+		}
+	}
+
+	var rules []PolicyRule
+	if err := loadJSONFile(config.File, &rules); err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+
+	engine := &PolicyEngine{dryRun: config.DryRun, location: location, trustProxyHeaders: config.TrustProxyHeaders}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = "policy-" + strconv.Itoa(i+1)
+		}
+		if rule.Route == "" || rule.Condition == "" {
+			return nil, fmt.Errorf("policy %s: route and condition are required", rule.Name)
+		}
+
+		expr, err := compilePolicy(rule.Condition, routeParams(rule.Route))
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", rule.Name, err)
+		}
+		engine.policies = append(engine.policies, &compiledPolicy{PolicyRule: rule, expr: expr})
+	}
+	return engine, nil
+}
+
+// Evaluate 按顺序对请求匹配的策略求值，返回会拒绝请求的策略（包括 dry-run 策略）
+func (e *PolicyEngine) Evaluate(r *http.Request) []*PolicyDenial {
+	var env *policyEnv
+	var denials []*PolicyDenial
+
+	for _, policy := range e.policies {
+		params, ok := matchRouteParams(policy.Route, r)
+		if !ok {
+			continue
+		}
+
+		if env == nil {
+			env = &policyEnv{r: r, identity: GetIdentity(r), now: time.Now().In(e.location), clientIP: getRemoteIP(r)}
+			if e.trustProxyHeaders {
+				env.clientIP = getClientIP(r)
+			}
+		}
+		env.params = params
+
+		allowed, err := policyBool(policy.expr.eval(env))
+		if err == nil && allowed {
+			continue
+		}
+		denials = append(denials, &PolicyDenial{
+			Policy: policy.Name,
+			Route:  policy.Route,
+			DryRun: e.dryRun || policy.DryRun,
+			Err:    err,
+		})
+	}
+	return denials
+}
+
+// PolicyMiddleware 属性授权中间件，在认证和 RBAC 之后执行
+// dry-run（全局或策略级）时只记录会被拒绝的请求
+func PolicyMiddleware(engine *PolicyEngine, whitelist map[string]bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if engine == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if whitelist[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			subject := ""
+			if identity := GetIdentity(r); identity != nil {
+				subject = identity.Subject
+			}
+			requestID := r.Context().Value(RequestIDKey).(string)
+
+			for _, denial := range engine.Evaluate(r) {
+				fields := map[string]interface{}{
+					"path":      r.URL.Path,
+					"method":    r.Method,
+					"subject":   subject,
+					"remote_ip": getClientIP(r),
+					"policy":    denial.Policy,
+					"route":     denial.Route,
+				}
+				if denial.Err != nil {
+					fields["error"] = denial.Err.Error()
+				}
+
+				if denial.DryRun {
+					GetLogger().WarnWithRequestID(requestID, "Policy would deny request (dry run)", fields)
+					continue
+				}
+
+				GetLogger().WarnWithRequestID(requestID, "Access denied by policy", fields)
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Cache-Control", "no-store")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(struct {
+					Error  string `json:"error"`
+					Reason string `json:"reason"`
+					*PolicyDenial
+				}{Error: "forbidden", Reason: "policy_denied", PolicyDenial: denial})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ---- 求值环境 ----
+
+// policyEnv 单个请求的求值环境
+type policyEnv struct {
+	r        *http.Request
+	identity *Identity
+	params   map[string]string
+	now      time.Time
+	clientIP string
+}
+
+// policyVariables 表达式可用的变量，值为访问路径的段数（-1 表示至少两段）
+var policyVariables = map[string]int{
+	"method":      1,
+	"path":        1,
+	"host":        1,
+	"ip":          1,
+	"subject":     1,
+	"auth_method": 1,
+	"scopes":      1,
+	"roles":       1,
+	"params":      2,
+	"headers":     2,
+	"query":       2,
+	"time":        2,
+	"claims":      -1,
+}
+
+// resolve 读取变量值，不存在时返回 nil
+func (env *policyEnv) resolve(path []string) interface{} {
+	identity := env.identity
+	switch path[0] {
+	case "method":
+		return env.r.Method
+	case "path":
+		return env.r.URL.Path
+	case "host":
+		return normalizeHost(env.r.Host)
+	case "ip":
+		return env.clientIP
+	case "subject":
+		if identity == nil {
+			return nil
+		}
+		return identity.Subject
+	case "auth_method":
+		if identity == nil {
+			return nil
+		}
+		return identity.Method
+	case "scopes":
+		if identity == nil {
+			return nil
+		}
+		return policyList(identity.Scopes)
+	case "roles":
+		if identity == nil {
+			return nil
+		}
+		return policyList(identity.Roles)
+	case "params":
+		return env.params[path[1]]
+	case "headers":
+		if values := env.r.Header.Values(path[1]); len(values) > 0 {
+			return values[0]
+		}
+		return nil
+	case "query":
+		if values, ok := env.r.URL.Query()[path[1]]; ok && len(values) > 0 {
+			return values[0]
+		}
+		return nil
+	case "time":
+		switch path[1] {
+		case "hour":
+			return float64(env.now.Hour())
+		case "minute":
+			return float64(env.now.Minute())
+		case "weekday":
+			return float64(env.now.Weekday())
+		}
+		return nil
+	case "claims":
+		if identity == nil {
+			return nil
+		}
+		var value interface{} = identity.Claims
+		for _, key := range path[1:] {
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = m[key]
+		}
+		return value
+	}
+	return nil
+}
+
+func policyList(values []string) []interface{} {
+	list := make([]interface{}, len(values))
+	for i, value := range values {
+		list[i] = value
+	}
+	return list
+}
+
+// ---- 表达式 ----
+
+// policyNode 表达式节点
+type policyNode interface {
+	eval(env *policyEnv) (interface{}, error)
+}
+
+type policyLiteral struct{ value interface{} }
+
+func (n *policyLiteral) eval(*policyEnv) (interface{}, error) { return n.value, nil }
+
+type policyVariable struct{ path []string }
+
+func (n *policyVariable) eval(env *policyEnv) (interface{}, error) { return env.resolve(n.path), nil }
+
+type policyListNode struct{ items []policyNode }
+
+func (n *policyListNode) eval(env *policyEnv) (interface{}, error) {
+	list := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = value
+	}
+	return list, nil
+}
+
+type policyNot struct{ x policyNode }
+
+func (n *policyNot) eval(env *policyEnv) (interface{}, error) {
+	value, err := policyBool(n.x.eval(env))
+	return !value, err
+}
+
+type policyLogic struct {
+	op          string
+	left, right policyNode
+}
+
+func (n *policyLogic) eval(env *policyEnv) (interface{}, error) {
+	left, err := policyBool(n.left.eval(env))
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" && !left || n.op == "||" && left {
+		return left, nil
+	}
+	return policyBool(n.right.eval(env))
+}
+
+type policyCompare struct {
+	op          string
+	left, right policyNode
+}
+
+func (n *policyCompare) eval(env *policyEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return policyEqual(left, right), nil
+	case "!=":
+		return !policyEqual(left, right), nil
+	case "in":
+		return policyIn(left, right)
+	}
+
+	// 缺失的值（如未携带的声明）与任何值比较都为 false
+	if left == nil || right == nil {
+		return false, nil
+	}
+	var c int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare number with %T", right)
+		}
+		c = compareOrdered(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare string with %T", right)
+		}
+		c = strings.Compare(l, r)
+	default:
+		return nil, fmt.Errorf("cannot compare %T", left)
+	}
+
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func compareOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// policyCIDRs cidr() 的结果，用于 ip in cidr(...)
+type policyCIDRs []*net.IPNet
+
+type policyCall struct {
+	name string
+	fn   func(args []interface{}) (interface{}, error)
+	args []policyNode
+}
+
+func (n *policyCall) eval(env *policyEnv) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return n.fn(args)
+}
+
+// policyBool 将求值结果转换为布尔值，缺失的值视为 false
+func policyBool(value interface{}, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("expected boolean, got %T", value)
+}
+
+// policyEqual 比较两个值，类型不同时不相等
+func policyEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case float64:
+		y, ok := b.(float64)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	case nil:
+		return b == nil
+	}
+	return false
+}
+
+// policyIn 判断值是否在列表中，或 IP 是否在 cidr() 网段内
+func policyIn(value, collection interface{}) (interface{}, error) {
+	switch c := collection.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, item := range c {
+			if policyEqual(value, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case policyCIDRs:
+		s, _ := value.(string)
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return false, nil
+		}
+		for _, network := range c {
+			if network.Contains(ip) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return nil, fmt.Errorf("right side of 'in' must be a list or cidr(), got %T", collection)
+}
+
+// ---- 编译 ----
+
+type policyTokenKind int
+
+const (
+	policyTokenEOF policyTokenKind = iota
+	policyTokenIdent
+	policyTokenString
+	policyTokenNumber
+	policyTokenPunct
+)
+
+type policyToken struct {
+	kind  policyTokenKind
+	text  string
+	value interface{} // 字符串和数字字面量的值
+	pos   int
+}
+
+// tokenizePolicy 将表达式切分为记号
+func tokenizePolicy(src string) ([]policyToken, error) {
+	var tokens []policyToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+					switch src[j] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(src[j])
+					}
+					continue
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, policyToken{kind: policyTokenString, text: src[i : j+1], value: sb.String(), pos: i})
+			i = j + 1
+
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i + 1
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", src[i:j], i)
+			}
+			tokens = append(tokens, policyToken{kind: policyTokenNumber, text: src[i:j], value: n, pos: i})
+			i = j
+
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			tokens = append(tokens, policyToken{kind: policyTokenIdent, text: src[i:j], pos: i})
+			i = j
+
+		default:
+			if i+1 < len(src) {
+				switch op := src[i : i+2]; op {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					tokens = append(tokens, policyToken{kind: policyTokenPunct, text: op, pos: i})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("()[],.<>!", rune(c)) {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, policyToken{kind: policyTokenPunct, text: string(c), pos: i})
+			i++
+		}
+	}
+	return append(tokens, policyToken{kind: policyTokenEOF, pos: len(src)}), nil
+}
+
+// policyParser 递归下降解析器
+//
+//	expr    = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | compare
+//	compare = primary [ ("==" | "!=" | "<" | "<=" | ">" | ">=" | "in") primary ]
+//	primary = string | number | true | false | null | list | call | variable | "(" expr ")"
+type policyParser struct {
+	tokens []policyToken
+	pos    int
+	params map[string]bool // 路由声明的参数
+}
+
+// compilePolicy 编译条件表达式，params 为路由中声明的参数名
+func compilePolicy(src string, params []string) (policyNode, error) {
+	tokens, err := tokenizePolicy(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &policyParser{tokens: tokens, params: make(map[string]bool)}
+	for _, name := range params {
+		p.params[name] = true
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != policyTokenEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+	}
+	return node, nil
+}
+
+func (p *policyParser) peek() policyToken { return p.tokens[p.pos] }
+
+func (p *policyParser) next() policyToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != policyTokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept 下一个记号为指定符号或关键字时消费它
+func (p *policyParser) accept(text string) bool {
+	tok := p.peek()
+	if (tok.kind == policyTokenPunct || tok.kind == policyTokenIdent) && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *policyParser) expect(text string) error {
+	if !p.accept(text) {
+		tok := p.peek()
+		if tok.kind == policyTokenEOF {
+			return fmt.Errorf("expected %q at end of expression", text)
+		}
+		return fmt.Errorf("expected %q at %d, got %q", text, tok.pos, tok.text)
+	}
+	return nil
+}
+
+func (p *policyParser) parseOr() (policyNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &policyLogic{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *policyParser) parseAnd() (policyNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &policyLogic{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *policyParser) parseUnary() (policyNode, error) {
+	if p.accept("!") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &policyNot{x: x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *policyParser) parseCompare() (policyNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			right, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			return &policyCompare{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *policyParser) parsePrimary() (policyNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case policyTokenString, policyTokenNumber:
+		return &policyLiteral{value: tok.value}, nil
+
+	case policyTokenIdent:
+		switch tok.text {
+		case "true":
+			return &policyLiteral{value: true}, nil
+		case "false":
+			return &policyLiteral{value: false}, nil
+		case "null":
+			return &policyLiteral{value: nil}, nil
+		}
+		if p.peek().text == "(" && p.peek().kind == policyTokenPunct {
+			return p.parseCall(tok)
+		}
+		return p.parseVariable(tok)
+
+	case policyTokenPunct:
+		switch tok.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			list := &policyListNode{}
+			for !p.accept("]") {
+				if len(list.items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.parsePrimary()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+			}
+			return list, nil
+		}
+
+	case policyTokenEOF:
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+}
+
+// parseVariable 解析变量访问：name{.key | ["key"]}
+func (p *policyParser) parseVariable(tok policyToken) (policyNode, error) {
+	segments, ok := policyVariables[tok.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %q at %d", tok.text, tok.pos)
+	}
+
+	path := []string{tok.text}
+	for {
+		if p.accept(".") {
+			key := p.next()
+			if key.kind != policyTokenIdent {
+				return nil, fmt.Errorf("expected field name at %d", key.pos)
+			}
+			path = append(path, key.text)
+		} else if p.accept("[") {
+			key := p.next()
+			if key.kind != policyTokenString {
+				return nil, fmt.Errorf("expected string key at %d", key.pos)
+			}
+			path = append(path, key.value.(string))
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		} else {
+			break
+		}
+	}
+
+	name := strings.Join(path, ".")
+	switch {
+	case segments == -1 && len(path) < 2, segments > 0 && len(path) != segments:
+		return nil, fmt.Errorf("invalid variable %q at %d", name, tok.pos)
+	case path[0] == "params" && !p.params[path[1]]:
+		return nil, fmt.Errorf("route has no parameter {%s}", path[1])
+	case path[0] == "time" && path[1] != "hour" && path[1] != "minute" && path[1] != "weekday":
+		return nil, fmt.Errorf("invalid variable %q at %d", name, tok.pos)
+	}
+	return &policyVariable{path: path}, nil
+}
+
+// parseCall 解析函数调用，cidr() 和 matches() 的参数必须是字符串字面量，在编译时解析
+func (p *policyParser) parseCall(tok policyToken) (policyNode, error) {
+	p.next() // "("
+	var args []policyNode
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	literal := func(i int) (string, bool) {
+		lit, ok := args[i].(*policyLiteral)
+		if !ok {
+			return "", false
+		}
+		s, ok := lit.value.(string)
+		return s, ok
+	}
+
+	switch tok.text {
+	case "cidr":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("cidr() requires at least one network")
+		}
+		var networks policyCIDRs
+		for i := range args {
+			s, ok := literal(i)
+			if !ok {
+				return nil, fmt.Errorf("cidr() arguments must be string literals")
+			}
+			if !strings.Contains(s, "/") {
+				if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+					s += "/32"
+				} else {
+					s += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, fmt.Errorf("cidr(): %w", err)
+			}
+			networks = append(networks, network)
+		}
+		return &policyLiteral{value: networks}, nil
+
+	case "matches":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("matches() requires 2 arguments")
+		}
+		pattern, ok := literal(1)
+		if !ok {
+			return nil, fmt.Errorf("matches() pattern must be a string literal")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("matches(): %w", err)
+		}
+		return &policyCall{name: tok.text, args: args[:1], fn: func(values []interface{}) (interface{}, error) {
+			s, ok := values[0].(string)
+			return ok && re.MatchString(s), nil
+		}}, nil
+
+	case "lower":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("lower() requires 1 argument")
+		}
+		return &policyCall{name: tok.text, args: args, fn: func(values []interface{}) (interface{}, error) {
+			if s, ok := values[0].(string); ok {
+				return strings.ToLower(s), nil
+			}
+			return values[0], nil
+		}}, nil
+
+	case "startsWith", "endsWith":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%s() requires 2 arguments", tok.text)
+		}
+		match := strings.HasPrefix
+		if tok.text == "endsWith" {
+			match = strings.HasSuffix
+		}
+		return &policyCall{name: tok.text, args: args, fn: func(values []interface{}) (interface{}, error) {
+			s, ok1 := values[0].(string)
+			affix, ok2 := values[1].(string)
+			return ok1 && ok2 && match(s, affix), nil
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown function %q at %d", tok.text, tok.pos)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 请求优先级：按路由、请求头或调用方身份把请求分到优先级类别。并发限制的等待队列按类别权重分配空闲名额，
+// 过载（后端池在途请求或 CPU 使用率超过类别的阈值）时先拒绝低优先级类别，事故期间保证下单等关键流量仍能通过
+
+// PriorityClassKey 请求所属优先级类别的 context key
+const PriorityClassKey contextKey = "priority_class"
+
+// 请求被拒绝的原因（指标中 priority_classes 的 shed 字段）
+const (
+	ShedReasonCPU          = "cpu"           // CPU 使用率达到类别阈值
+	ShedReasonConcurrency  = "concurrency"   // 后端池负载达到类别阈值
+	ShedReasonQueueFull    = "queue_full"    // 等待队列已满
+	ShedReasonQueueTimeout = "queue_timeout" // 排队超时
+	ShedReasonEvicted      = "evicted"       // 队列已满时被更高优先级的请求挤出队列
+	ShedReasonCanceled     = "canceled"      // 排队期间客户端断开
+)
+
+// PriorityClass 优先级类别，请求满足 routes / headers / principals 中任一条件即属于该类别
+type PriorityClass struct {
+	Name            string            `json:"name"`
+	Weight          int               `json:"weight"`           // 排队时分配空闲名额的相对份额，默认 1
+	Routes          []string          `json:"routes"`           // "[METHOD ]PATH"
+	Headers         map[string]string `json:"headers"`          // 请求头 -> 值（客户端可以伪造，只应用于降级或受信任的内部调用方）
+	Principals      []string          `json:"principals"`       // "user:ID" / "api_key:ID" / "tier:NAME" / "role:NAME"
+	ShedConcurrency float64           `json:"shed_concurrency"` // 后端池（在途 + 排队）/ 并发上限达到该值时拒绝，0 为不按并发拒绝
+	ShedCPU         float64           `json:"shed_cpu"`         // CPU 使用率（0-1）达到该值时拒绝，0 为不按 CPU 拒绝
+}
+
+// priorityPrincipal 调用方身份条件
+type priorityPrincipal struct {
+	kind  string // user / api_key / tier / role
+	value string
+}
+
+// priorityClass 加载后的优先级类别
+type priorityClass struct {
+	PriorityClass
+	rank       int // 在文件中的位置，越小优先级越高
+	principals []priorityPrincipal
+}
+
+// PriorityClasses 优先级类别集合
+type PriorityClasses struct {
+	classes      []*priorityClass
+	defaultClass *priorityClass
+	cpu          *cpuSampler // 没有类别按 CPU 拒绝或无法读取 CPU 使用率时为 nil
+}
+
+// NewPriorityClasses 从 PRIORITY_CLASSES_FILE 加载优先级类别，未配置时返回 nil
+func NewPriorityClasses(config PriorityConfig) (*PriorityClasses, error) {
+	if config.ClassesFile == "" {
+		return nil, nil
+	}
+
+	var classes []PriorityClass
+	if err := loadJSONFile(config.ClassesFile, &classes); err != nil {
+		return nil, err
+	}
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("no priority classes defined")
+	}
+
+	set := &PriorityClasses{}
+	names := make(map[string]bool)
+	needCPU := false
+	for i, class := range classes {
+		if class.Name == "" {
+			return nil, fmt.Errorf("priority class %d has no name", i+1)
+		}
+		if names[class.Name] {
+			return nil, fmt.Errorf("duplicate priority class %q", class.Name)
+		}
+		names[class.Name] = true
+
+		compiled, err := compilePriorityClass(class, i)
+		if err != nil {
+			return nil, fmt.Errorf("priority class %q: %w", class.Name, err)
+		}
+		set.classes = append(set.classes, compiled)
+		needCPU = needCPU || class.ShedCPU > 0
+	}
+
+	set.defaultClass = set.classes[len(set.classes)-1]
+	if config.DefaultClass != "" {
+		set.defaultClass = nil
+		for _, class := range set.classes {
+			if class.Name == config.DefaultClass {
+				set.defaultClass = class
+			}
+		}
+		if set.defaultClass == nil {
+			return nil, fmt.Errorf("default priority class %q is not defined", config.DefaultClass)
+		}
+	}
+
+	if needCPU {
+		cpu, err := newCPUSampler(config.CPUInterval)
+		if err != nil {
+			GetLogger().Warn("CPU usage unavailable, CPU-based shedding disabled", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		set.cpu = cpu
+	}
+
+	GetLogger().Info("Priority classes loaded", map[string]interface{}{
+		"file":    config.ClassesFile,
+		"classes": len(set.classes),
+		"default": set.defaultClass.Name,
+	})
+	return set, nil
+}
+
+// compilePriorityClass 校验类别并解析身份条件
+func compilePriorityClass(class PriorityClass, rank int) (*priorityClass, error) {
+	if class.Weight < 0 {
+		return nil, fmt.Errorf("weight must not be negative")
+	}
+	if class.Weight == 0 {
+		class.Weight = 1
+	}
+	if class.ShedConcurrency < 0 {
+		return nil, fmt.Errorf("shed_concurrency must not be negative")
+	}
+	if class.ShedCPU < 0 || class.ShedCPU > 1 {
+		return nil, fmt.Errorf("shed_cpu must be between 0 and 1")
+	}
+	for _, route := range class.Routes {
+		if strings.TrimSpace(route) == "" {
+			return nil, fmt.Errorf("empty route")
+		}
+	}
+	for name, value := range class.Headers {
+		if name == "" || value == "" {
+			return nil, fmt.Errorf("header condition %q requires a name and a value", name+": "+value)
+		}
+	}
+
+	compiled := &priorityClass{PriorityClass: class, rank: rank}
+	for _, principal := range class.Principals {
+		kind, value, _ := strings.Cut(strings.TrimSpace(principal), ":")
+		switch kind {
+		case "user", "api_key", "tier", "role":
+		default:
+			return nil, fmt.Errorf("unknown principal %q", principal)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("principal %q requires a value", principal)
+		}
+		compiled.principals = append(compiled.principals, priorityPrincipal{kind: kind, value: value})
+	}
+	return compiled, nil
+}
+
+// Stop 停止 CPU 采样
+func (s *PriorityClasses) Stop() {
+	if s == nil {
+		return
+	}
+	s.cpu.Stop()
+}
+
+// Classify 返回请求所属的第一个匹配的类别，都不匹配时返回默认类别
+func (s *PriorityClasses) Classify(r *http.Request) *priorityClass {
+	identity := GetIdentity(r)
+	for _, class := range s.classes {
+		if class.matches(r, identity) {
+			return class
+		}
+	}
+	return s.defaultClass
+}
+
+// matches 判断请求是否满足类别的任一条件
+func (c *priorityClass) matches(r *http.Request, identity *Identity) bool {
+	for _, route := range c.Routes {
+		if _, ok := matchRouteParams(route, r); ok {
+			return true
+		}
+	}
+	for name, value := range c.Headers {
+		if r.Header.Get(name) == value {
+			return true
+		}
+	}
+	if identity == nil {
+		return false
+	}
+	for _, principal := range c.principals {
+		switch principal.kind {
+		case "user":
+			if identity.Subject == principal.value {
+				return true
+			}
+		case "api_key":
+			if identity.KeyID == principal.value {
+				return true
+			}
+		case "tier":
+			if identity.Tier == principal.value {
+				return true
+			}
+		case "role":
+			for _, role := range identity.Roles {
+				if role == principal.value {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// admission 并发限制排队使用的参数；未分类的请求（未配置优先级）排在最后、权重为 1、不按负载拒绝
+func (c *priorityClass) admission() (rank int, weight float64, shedAt float64) {
+	if c == nil {
+		return math.MaxInt, 1, 0
+	}
+	return c.rank, float64(c.Weight), c.ShedConcurrency
+}
+
+// className 指标与日志中使用的类别名，未分类时为空
+func (c *priorityClass) className() string {
+	if c == nil {
+		return ""
+	}
+	return c.Name
+}
+
+// GetPriorityClass 获取请求所属的优先级类别，未配置优先级时为 nil
+func GetPriorityClass(r *http.Request) *priorityClass {
+	class, _ := r.Context().Value(PriorityClassKey).(*priorityClass)
+	return class
+}
+
+// PriorityMiddleware 为请求分配优先级类别，CPU 使用率达到类别阈值时直接拒绝（503）；
+// 放在代理中间件之前，由并发限制按类别排队和拒绝
+func PriorityMiddleware(priorities *PriorityClasses, whitelist map[string]bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if priorities == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if whitelist[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			class := priorities.Classify(r)
+			GetMetrics().RecordPriorityRequest(class.Name)
+
+			if class.ShedCPU > 0 && priorities.cpu != nil {
+				if usage := priorities.cpu.Usage(); usage >= class.ShedCPU {
+					requestID, _ := r.Context().Value(RequestIDKey).(string)
+					GetMetrics().RecordShed(class.Name, ShedReasonCPU)
+					GetLogger().WarnWithRequestID(requestID, "Request shed", map[string]interface{}{
+						"path":      r.URL.Path,
+						"class":     class.Name,
+						"reason":    ShedReasonCPU,
+						"cpu_usage": math.Round(usage*1000) / 1000,
+					})
+					w.Header().Set("Retry-After", "1")
+					http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), PriorityClassKey, class)))
+		})
+	}
+}
+
+// cpuSampler 定期从 /proc/stat 计算整机 CPU 使用率（仅 Linux）
+type cpuSampler struct {
+	usage atomic.Uint64 // math.Float64bits(使用率)
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// newCPUSampler 读取一次 /proc/stat 确认可用后开始采样
+func newCPUSampler(interval time.Duration) (*cpuSampler, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid CPU sampling interval %s", interval)
+	}
+	idle, total, err := readCPUStat()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &cpuSampler{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.run(interval, idle, total)
+	return s, nil
+}
+
+// run 每个间隔按 /proc/stat 的差值计算使用率
+func (s *cpuSampler) run(interval time.Duration, idle, total uint64) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+
+		nextIdle, nextTotal, err := readCPUStat()
+		if err != nil || nextTotal <= total {
+			continue
+		}
+		usage := 1 - float64(nextIdle-idle)/float64(nextTotal-total)
+		s.usage.Store(math.Float64bits(math.Max(0, usage)))
+		idle, total = nextIdle, nextTotal
+	}
+}
+
+// Usage 最近一个采样间隔的 CPU 使用率（0-1）
+func (s *cpuSampler) Usage() float64 {
+	return math.Float64frombits(s.usage.Load())
+}
+
+// Stop 停止采样
+func (s *cpuSampler) Stop() {
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+}
+
+// readCPUStat 读取 /proc/stat 第一行的累计 CPU 时间，返回空闲（idle + iowait）与总时间
+func readCPUStat() (idle, total uint64, err error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return 0, 0, fmt.Errorf("empty /proc/stat")
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected /proc/stat format")
+	}
+
+	// user nice system idle iowait irq softirq steal（guest 已计入 user，不重复累加）
+	for i, field := range fields[1:min(len(fields), 9)] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unexpected /proc/stat format")
+		}
+		total += value
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+	return idle, total, nil
+}
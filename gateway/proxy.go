@@ -7,8 +7,8 @@ import (
 	"time"
 )
 
-// ProxyMiddleware 代理中间件（整合负载均衡、熔断器、重试）
-func ProxyMiddleware(lb LoadBalancer, breaker *CircuitBreaker, config BackendConfig, whitelist map[string]bool) func(http.Handler) http.Handler {
+// ProxyMiddleware 代理中间件（整合并发限制、负载均衡、熔断器、重试），limiter 为 nil 时不限制并发
+func ProxyMiddleware(lb LoadBalancer, breaker *CircuitBreaker, limiter *ConcurrencyLimiter, config BackendConfig, whitelist map[string]bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// 检查是否在白名单中（白名单路径直接转发到 next）
@@ -20,6 +20,24 @@ func ProxyMiddleware(lb LoadBalancer, breaker *CircuitBreaker, config BackendCon
 			// 获取请求 ID
 			requestID, _ := r.Context().Value(RequestIDKey).(string)
 
+			// 并发限制：达到上限时按优先级类别排队，过载、队列已满或等待超时时拒绝
+			if limiter != nil {
+				class := GetPriorityClass(r)
+				if err := limiter.Acquire(r.Context(), class); err != nil {
+					GetMetrics().RecordShed(class.className(), shedReason(err))
+					GetLogger().WarnWithRequestID(requestID, "Concurrency limit exceeded", map[string]interface{}{
+						"path":  r.URL.Path,
+						"pool":  limiter.name,
+						"class": class.className(),
+						"error": err.Error(),
+					})
+					w.Header().Set("Retry-After", "1")
+					http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				defer limiter.Release()
+			}
+
 			// 获取后端服务器
 			backend := lb.NextBackend()
 			if backend == nil {
@@ -32,7 +50,7 @@ func ProxyMiddleware(lb LoadBalancer, breaker *CircuitBreaker, config BackendCon
 
 			// 使用熔断器执行请求
 			err := breaker.Call(func() error {
-				return proxyRequestWithRetry(w, r, backend, config, requestID)
+				return proxyRequestWithRetry(w, r, backend, config, limiter, requestID)
 			})
 
 			if err != nil {
@@ -54,7 +72,7 @@ func ProxyMiddleware(lb LoadBalancer, breaker *CircuitBreaker, config BackendCon
 }
 
 // proxyRequestWithRetry 带重试的代理请求
-func proxyRequestWithRetry(w http.ResponseWriter, r *http.Request, backend *Backend, config BackendConfig, requestID string) error {
+func proxyRequestWithRetry(w http.ResponseWriter, r *http.Request, backend *Backend, config BackendConfig, limiter *ConcurrencyLimiter, requestID string) error {
 	var lastErr error
 
 	// 增加连接数
@@ -74,7 +92,7 @@ func proxyRequestWithRetry(w http.ResponseWriter, r *http.Request, backend *Back
 		}
 
 		// 执行代理请求
-		err := proxyRequest(w, r, backend, requestID)
+		err := proxyRequest(w, r, backend, limiter, requestID)
 		if err == nil {
 			return nil
 		}
@@ -90,8 +108,8 @@ func proxyRequestWithRetry(w http.ResponseWriter, r *http.Request, backend *Back
 	return lastErr
 }
 
-// proxyRequest 执行代理请求
-func proxyRequest(w http.ResponseWriter, r *http.Request, backend *Backend, requestID string) error {
+// proxyRequest 执行代理请求，并把后端延迟提供给自适应并发限制
+func proxyRequest(w http.ResponseWriter, r *http.Request, backend *Backend, limiter *ConcurrencyLimiter, requestID string) error {
 	// 创建超时上下文
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
@@ -126,8 +144,12 @@ func proxyRequest(w http.ResponseWriter, r *http.Request, backend *Backend, requ
 	proxyReq.Header.Set("X-Forwarded-Host", r.Host)
 	proxyReq.Header.Set("X-Request-ID", requestID)
 
-	// 发送请求
-	resp, err := http.DefaultClient.Do(proxyReq)
+	// 发送请求（延迟计到收到响应头为止，不受客户端读取响应体的速度影响；客户端断开时不计）
+	start := time.Now()
+	resp, err := backend.Client.Do(proxyReq)
+	if r.Context().Err() == nil {
+		limiter.Observe(time.Since(start), err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	}
 	if err != nil {
 		GetLogger().ErrorWithRequestID(requestID, "Proxy request failed", map[string]interface{}{
 			"error":   err.Error(),
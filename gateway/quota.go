@@ -0,0 +1,592 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 配额：按日历窗口（小时 / 天 / 周 / 月）限制调用方的请求总数，如每个客户每月 10 万次。
+// 令牌桶只能表达速率，配额在窗口开始时清零；用量定期写回文件，重启后继续计数，并保留已结束窗口的用量用于计费报表
+
+var ErrQuotaNotFound = errors.New("quota policy not found")
+
+// 配额周期
+const (
+	QuotaHour  = "hour"
+	QuotaDay   = "day"
+	QuotaWeek  = "week" // 从周一开始
+	QuotaMonth = "month"
+)
+
+// QuotaPolicy 配额策略
+type QuotaPolicy struct {
+	Name    string                `json:"name"`
+	Route   string                `json:"route"`   // "[METHOD ]PATH"，为空时对全部路由生效
+	Key     []string              `json:"key"`     // 组合键，与限流策略相同，如 ["api_key"]、["claim:org_id"]
+	Period  string                `json:"period"`  // hour / day / week / month
+	Limit   int64                 `json:"limit"`   // 每个窗口的请求数
+	Tiers   map[string]QuotaLimit `json:"tiers"`   // 按调用方限流等级覆盖限额
+	Message string                `json:"message"` // 超出配额时返回给调用方的说明
+}
+
+// QuotaLimit 配额限额
+type QuotaLimit struct {
+	Limit int64 `json:"limit"`
+}
+
+// quotaPolicy 加载后的配额策略
+type quotaPolicy struct {
+	QuotaPolicy
+	key []rateLimitKeyPart
+}
+
+// QuotaUsage 一个键在一个窗口内的用量
+type QuotaUsage struct {
+	Policy string    `json:"policy"`
+	Key    string    `json:"key"` // 组合键各部分以 "|" 连接
+	Tier   string    `json:"tier,omitempty"`
+	Start  time.Time `json:"window_start"`
+	End    time.Time `json:"window_end"`
+	Used   int64     `json:"used"`
+	Limit  int64     `json:"limit"`
+}
+
+// quotaCounter 一个键的当前窗口和已结束窗口的用量
+type quotaCounter struct {
+	current QuotaUsage
+	history []QuotaUsage  // 按时间顺序
+	element *list.Element // 在 QuotaManager.order 中的位置
+}
+
+// QuotaResult 一个配额策略的检查结果
+type QuotaResult struct {
+	Allowed bool
+	Period  string
+	Message string
+	QuotaUsage
+}
+
+// quotaFile 用量文件
+type quotaFile struct {
+	SavedAt time.Time    `json:"saved_at"`
+	Usage   []QuotaUsage `json:"usage"` // 当前窗口和已结束窗口
+}
+
+// QuotaManager 配额策略和用量
+type QuotaManager struct {
+	policies       []*quotaPolicy
+	byName         map[string]*quotaPolicy
+	location       *time.Location
+	path           string
+	historyWindows int
+	maxKeys        int // 全部策略合计，0 表示不限
+
+	mu       sync.Mutex
+	counters map[string]map[string]*quotaCounter // 策略 -> 键 -> 用量
+	order    *list.List                          // 最近使用的计数器在前
+	dirty    bool
+
+	stopFlush chan struct{}
+	flushDone chan struct{}
+}
+
+// NewQuotaManager 加载配额策略和已保存的用量，未配置 QUOTA_POLICIES_FILE 时返回 nil
+func NewQuotaManager(config QuotaConfig) (*QuotaManager, error) {
+	if config.PoliciesFile == "" {
+		return nil, nil
+	}
+
+	location := time.Local
+	if config.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUOTA_TIMEZONE: %w", err)
+		}
+	}
+
+	if config.FlushInterval <= 0 {
+		return nil, fmt.Errorf("QUOTA_FLUSH_INTERVAL must be positive")
+	}
+
+	var policies []QuotaPolicy
+	if err := loadJSONFile(config.PoliciesFile, &policies); err != nil {
+		return nil, err
+	}
+
+	m := &QuotaManager{
+		byName:         make(map[string]*quotaPolicy),
+		location:       location,
+		path:           config.UsageFile,
+		historyWindows: max(0, config.HistoryWindows),
+		maxKeys:        max(0, config.MaxKeys),
+		counters:       make(map[string]map[string]*quotaCounter),
+		order:          list.New(),
+		stopFlush:      make(chan struct{}),
+		flushDone:      make(chan struct{}),
+	}
+	for i, policy := range policies {
+		if policy.Name == "" {
+			policy.Name = "quota-" + strconv.Itoa(i+1)
+		}
+		if m.byName[policy.Name] != nil {
+			return nil, fmt.Errorf("duplicate quota policy %q", policy.Name)
+		}
+
+		compiled, err := compileQuotaPolicy(policy)
+		if err != nil {
+			return nil, fmt.Errorf("quota policy %q: %w", policy.Name, err)
+		}
+		m.policies = append(m.policies, compiled)
+		m.byName[policy.Name] = compiled
+		m.counters[policy.Name] = make(map[string]*quotaCounter)
+	}
+
+	if err := m.load(time.Now()); err != nil {
+		return nil, fmt.Errorf("invalid quota usage file %s: %w", m.path, err)
+	}
+
+	go m.flushRoutine(config.FlushInterval)
+
+	GetLogger().Info("Quota policies loaded", map[string]interface{}{
+		"file":     config.PoliciesFile,
+		"policies": len(m.policies),
+		"timezone": location.String(),
+	})
+	return m, nil
+}
+
+// compileQuotaPolicy 校验配额策略
+func compileQuotaPolicy(policy QuotaPolicy) (*quotaPolicy, error) {
+	switch policy.Period {
+	case QuotaHour, QuotaDay, QuotaWeek, QuotaMonth:
+	default:
+		return nil, fmt.Errorf("invalid period %q", policy.Period)
+	}
+	if policy.Limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+	for tier, limit := range policy.Tiers {
+		if limit.Limit <= 0 {
+			return nil, fmt.Errorf("tier %q: limit must be positive", tier)
+		}
+	}
+
+	key, err := parseRateLimitKey(policy.Key, policy.Route)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaPolicy{QuotaPolicy: policy, key: key}, nil
+}
+
+// window 返回 now 所在窗口的开始和结束时间（按配置的时区划分日历窗口）
+func (m *QuotaManager) window(period string, now time.Time) (time.Time, time.Time) {
+	t := now.In(m.location)
+	year, month, day := t.Date()
+
+	switch period {
+	case QuotaHour:
+		start := time.Date(year, month, day, t.Hour(), 0, 0, 0, m.location)
+		return start, start.Add(time.Hour)
+	case QuotaDay:
+		start := time.Date(year, month, day, 0, 0, 0, 0, m.location)
+		return start, start.AddDate(0, 0, 1)
+	case QuotaWeek:
+		start := time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, m.location)
+		return start, start.AddDate(0, 0, 7)
+	default:
+		start := time.Date(year, month, 1, 0, 0, 0, 0, m.location)
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+// roll 窗口结束后将用量移入历史并开始新窗口（调用方持有锁）
+func (m *QuotaManager) roll(policy *quotaPolicy, counter *quotaCounter, now time.Time) {
+	if now.Before(counter.current.End) {
+		return
+	}
+
+	if counter.current.Used > 0 {
+		counter.history = append(counter.history, counter.current)
+		if len(counter.history) > m.historyWindows {
+			counter.history = counter.history[len(counter.history)-m.historyWindows:]
+		}
+	}
+	counter.current.Start, counter.current.End = m.window(policy.Period, now)
+	counter.current.Used = 0
+	m.dirty = true
+}
+
+// counter 取得键的计数器，不存在时创建；键数超过上限时淘汰最久未使用的计数器（调用方持有锁）
+func (m *QuotaManager) counter(policy *quotaPolicy, key string, now time.Time) *quotaCounter {
+	if counter := m.counters[policy.Name][key]; counter != nil {
+		m.order.MoveToFront(counter.element)
+		return counter
+	}
+
+	counter := &quotaCounter{current: QuotaUsage{Policy: policy.Name, Key: key}}
+	counter.current.Start, counter.current.End = m.window(policy.Period, now)
+	counter.element = m.order.PushFront(counter)
+	m.counters[policy.Name][key] = counter
+
+	if m.maxKeys > 0 && m.order.Len() > m.maxKeys {
+		oldest := m.order.Back().Value.(*quotaCounter)
+		m.remove(oldest)
+		m.dirty = m.dirty || oldest.current.Used > 0 || len(oldest.history) > 0
+	}
+	return counter
+}
+
+// remove 删除计数器（调用方持有锁）
+func (m *QuotaManager) remove(counter *quotaCounter) {
+	m.order.Remove(counter.element)
+	delete(m.counters[counter.current.Policy], counter.current.Key)
+}
+
+// sweep 结束的窗口移入历史，删除当前窗口没有用量且没有历史的计数器（调用方持有锁）
+func (m *QuotaManager) sweep(now time.Time) {
+	for _, policy := range m.policies {
+		for _, counter := range m.counters[policy.Name] {
+			m.roll(policy, counter, now)
+			if counter.current.Used == 0 && len(counter.history) == 0 {
+				m.remove(counter)
+			}
+		}
+	}
+}
+
+// limit 调用方限流等级对应的限额
+func (p *quotaPolicy) limit(identity *Identity) (int64, string) {
+	if identity != nil && identity.Tier != "" {
+		if limit, ok := p.Tiers[identity.Tier]; ok {
+			return limit.Limit, identity.Tier
+		}
+	}
+	return p.Limit, ""
+}
+
+// Check 检查全部匹配的配额策略，全部未超出时各计一次；任一超出时都不计数，
+// 超出的策略 Allowed 为 false。键缺少任一部分时该策略不适用
+func (m *QuotaManager) Check(r *http.Request) []QuotaResult {
+	identity := GetIdentity(r)
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var results []QuotaResult
+	var counters []*quotaCounter
+	allowed := true
+	for _, policy := range m.policies {
+		var params map[string]string
+		if policy.Route != "" {
+			var matched bool
+			if params, matched = matchRouteParams(policy.Route, r); !matched {
+				continue
+			}
+		}
+
+		values, ok := rateLimitKeyValues(policy.key, policy.Route, r, identity, params)
+		if !ok {
+			continue
+		}
+		key := strings.Join(values, "|")
+
+		counter := m.counter(policy, key, now)
+		m.roll(policy, counter, now)
+		counter.current.Limit, counter.current.Tier = policy.limit(identity)
+
+		result := QuotaResult{
+			Allowed:    counter.current.Used < counter.current.Limit,
+			Period:     policy.Period,
+			Message:    policy.Message,
+			QuotaUsage: counter.current,
+		}
+		allowed = allowed && result.Allowed
+		results = append(results, result)
+		counters = append(counters, counter)
+	}
+
+	if allowed {
+		for i, counter := range counters {
+			counter.current.Used++
+			results[i].Used++
+		}
+		m.dirty = m.dirty || len(counters) > 0
+	}
+	return results
+}
+
+// Usage 当前窗口的用量，policy / key 为空时不过滤
+func (m *QuotaManager) Usage(policyName, key string) ([]QuotaUsage, error) {
+	return m.collect(policyName, key, false)
+}
+
+// Report 当前窗口和已结束窗口的用量（用于计费），按策略、键、窗口开始时间排序
+func (m *QuotaManager) Report(policyName, key string) ([]QuotaUsage, error) {
+	return m.collect(policyName, key, true)
+}
+
+func (m *QuotaManager) collect(policyName, key string, history bool) ([]QuotaUsage, error) {
+	if policyName != "" && m.byName[policyName] == nil {
+		return nil, ErrQuotaNotFound
+	}
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := []QuotaUsage{}
+	for _, policy := range m.policies {
+		if policyName != "" && policy.Name != policyName {
+			continue
+		}
+		for counterKey, counter := range m.counters[policy.Name] {
+			if key != "" && counterKey != key {
+				continue
+			}
+			m.roll(policy, counter, now)
+			if history {
+				usage = append(usage, counter.history...)
+			}
+			if counter.current.Used > 0 || key != "" {
+				usage = append(usage, counter.current)
+			}
+		}
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Policy != usage[j].Policy {
+			return usage[i].Policy < usage[j].Policy
+		}
+		if usage[i].Key != usage[j].Key {
+			return usage[i].Key < usage[j].Key
+		}
+		return usage[i].Start.Before(usage[j].Start)
+	})
+	return usage, nil
+}
+
+// Reset 将当前窗口的用量清零，key 为空时清零该策略的全部键；返回清零的键数
+func (m *QuotaManager) Reset(policyName, key string) (int, error) {
+	if m.byName[policyName] == nil {
+		return 0, ErrQuotaNotFound
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reset := 0
+	for counterKey, counter := range m.counters[policyName] {
+		if key != "" && counterKey != key {
+			continue
+		}
+		if counter.current.Used > 0 {
+			counter.current.Used = 0
+			reset++
+		}
+	}
+	m.dirty = m.dirty || reset > 0
+	return reset, nil
+}
+
+// load 读取用量文件：当前窗口的用量继续计数，其余作为已结束窗口保留；已删除策略的用量被丢弃
+func (m *QuotaManager) load(now time.Time) error {
+	if m.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file quotaFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	sort.Slice(file.Usage, func(i, j int) bool {
+		return file.Usage[i].Start.Before(file.Usage[j].Start)
+	})
+	for _, usage := range file.Usage {
+		policy := m.byName[usage.Policy]
+		if policy == nil {
+			continue
+		}
+
+		counter := m.counter(policy, usage.Key, now)
+
+		if usage.Start.Equal(counter.current.Start) && usage.End.Equal(counter.current.End) {
+			counter.current = usage
+		} else if !usage.End.After(now) {
+			counter.history = append(counter.history, usage)
+		}
+	}
+
+	for _, policy := range m.policies {
+		for _, counter := range m.counters[policy.Name] {
+			if len(counter.history) > m.historyWindows {
+				counter.history = counter.history[len(counter.history)-m.historyWindows:]
+			}
+		}
+	}
+	return nil
+}
+
+// save 清理空计数器并将用量写回文件
+func (m *QuotaManager) save() error {
+	m.mu.Lock()
+	m.sweep(time.Now())
+	if !m.dirty || m.path == "" {
+		m.mu.Unlock()
+		return nil
+	}
+
+	file := quotaFile{SavedAt: time.Now()}
+	for _, policy := range m.policies {
+		for _, counter := range m.counters[policy.Name] {
+			file.Usage = append(file.Usage, counter.history...)
+			if counter.current.Used > 0 {
+				file.Usage = append(file.Usage, counter.current)
+			}
+		}
+	}
+	m.dirty = false
+	m.mu.Unlock()
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(m.path, data, 0600)
+	}
+	if err != nil {
+		// 下次重试
+		m.mu.Lock()
+		m.dirty = true
+		m.mu.Unlock()
+	}
+	return err
+}
+
+// flushRoutine 定期清理空计数器并写回用量，停止时最后写回一次
+func (m *QuotaManager) flushRoutine(interval time.Duration) {
+	defer close(m.flushDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.stopFlush:
+			m.flush()
+			return
+		}
+		m.flush()
+	}
+}
+
+func (m *QuotaManager) flush() {
+	if err := m.save(); err != nil {
+		GetLogger().Error("Failed to save quota usage", map[string]interface{}{
+			"file":  m.path,
+			"error": err.Error(),
+		})
+	}
+}
+
+// Stop 停止定期写回并保存最终用量
+func (m *QuotaManager) Stop() {
+	close(m.stopFlush)
+	<-m.flushDone
+}
+
+// quotaPeriodNames 超出配额时默认说明中的周期名称
+var quotaPeriodNames = map[string]string{
+	QuotaHour:  "Hourly",
+	QuotaDay:   "Daily",
+	QuotaWeek:  "Weekly",
+	QuotaMonth: "Monthly",
+}
+
+// QuotaMiddleware 按配额策略计数（在认证、限流和授权之后执行，被限流或拒绝的请求不消耗配额）
+func QuotaMiddleware(quotas *QuotaManager, whitelist map[string]bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if quotas == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if whitelist[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := time.Now()
+			results := quotas.Check(r)
+			var denial *QuotaResult
+			for i, result := range results {
+				setRateLimitHeaders(w.Header(), result.Policy, RateLimitResult{
+					Limit:     int(result.Limit),
+					Remaining: int(max(0, result.Limit-result.Used)),
+					Window:    result.End.Sub(result.Start),
+					Reset:     result.End.Sub(now),
+				})
+				if !result.Allowed && denial == nil {
+					denial = &results[i]
+				}
+			}
+			if denial == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			GetMetrics().RecordRateLimited()
+
+			fields := map[string]interface{}{
+				"remote_ip": getClientIP(r),
+				"path":      r.URL.Path,
+				"quota":     denial.Policy,
+				"key":       denial.Key,
+				"used":      denial.Used,
+				"limit":     denial.Limit,
+			}
+			if denial.Tier != "" {
+				fields["tier"] = denial.Tier
+			}
+			requestID := r.Context().Value(RequestIDKey).(string)
+			GetLogger().WarnWithRequestID(requestID, "Quota exceeded", fields)
+
+			message := denial.Message
+			if message == "" {
+				message = fmt.Sprintf("%s quota of %d requests exceeded", quotaPeriodNames[denial.Period], denial.Limit)
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(denial.End.Sub(now)))))
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":     "quota_exceeded",
+				"message":   message,
+				"quota":     denial.Policy,
+				"period":    denial.Period,
+				"limit":     denial.Limit,
+				"used":      denial.Used,
+				"resets_at": denial.End.Format(time.RFC3339),
+			})
+		})
+	}
+}
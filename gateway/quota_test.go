@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestQuotaManager(t *testing.T, config QuotaConfig, policies ...QuotaPolicy) *QuotaManager {
+	t.Helper()
+	data, err := json.Marshal(policies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.PoliciesFile = filepath.Join(t.TempDir(), "quotas.json")
+	if err := os.WriteFile(config.PoliciesFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if config.FlushInterval == 0 {
+		config.FlushInterval = time.Hour
+	}
+
+	manager, err := NewQuotaManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(manager.Stop)
+	return manager
+}
+
+func checkQuota(m *QuotaManager, client string) []QuotaResult {
+	r := httptest.NewRequest("GET", "/api/items", nil)
+	r.Header.Set("X-Client", client)
+	return m.Check(r)
+}
+
+func quotaKeys(m *QuotaManager, policy string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.counters[policy] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var testQuotaPolicy = QuotaPolicy{Name: "hourly", Key: []string{"header:X-Client"}, Period: QuotaHour, Limit: 2}
+
+func TestQuotaEvictsLeastRecentlyUsedKey(t *testing.T) {
+	m := newTestQuotaManager(t, QuotaConfig{MaxKeys: 3, HistoryWindows: 12}, testQuotaPolicy)
+
+	for _, client := range []string{"a", "b", "c", "a", "d"} {
+		checkQuota(m, client)
+	}
+	if keys := quotaKeys(m, "hourly"); len(keys) != 3 || keys[0] != "a" || keys[1] != "c" || keys[2] != "d" {
+		t.Errorf("keys = %v, want [a c d] (b least recently used)", keys)
+	}
+
+	// a 仍然保留用量，b 被淘汰后从 0 开始计数
+	if results := checkQuota(m, "a"); results[0].Allowed {
+		t.Errorf("a: used = %d, want the quota to be exhausted", results[0].Used)
+	}
+	if results := checkQuota(m, "b"); !results[0].Allowed || results[0].Used != 1 {
+		t.Errorf("b: allowed = %v, used = %d", results[0].Allowed, results[0].Used)
+	}
+}
+
+func TestQuotaSweepDropsEmptyCounters(t *testing.T) {
+	for _, v := range []struct {
+		historyWindows int
+		want           []string // 窗口结束后保留的键
+	}{
+		{0, nil},            // 用量不进入历史，窗口结束后计数器为空
+		{12, []string{"a"}}, // 保留已结束窗口的用量
+	} {
+		m := newTestQuotaManager(t, QuotaConfig{HistoryWindows: v.historyWindows},
+			testQuotaPolicy,
+			QuotaPolicy{Name: "global", Key: []string{"method"}, Period: QuotaHour, Limit: 1})
+
+		checkQuota(m, "a")
+		// global 已用完，b 的请求不计数，只留下用量为 0 的计数器
+		if results := checkQuota(m, "b"); results[1].Allowed || results[0].Used != 0 {
+			t.Fatalf("request from b: %+v", results)
+		}
+
+		m.mu.Lock()
+		m.sweep(time.Now())
+		m.mu.Unlock()
+		if keys := quotaKeys(m, "hourly"); len(keys) != 1 || keys[0] != "a" {
+			t.Fatalf("history %d: keys = %v, want [a]", v.historyWindows, keys)
+		}
+
+		m.mu.Lock()
+		m.sweep(time.Now().Add(2 * time.Hour))
+		m.mu.Unlock()
+		if keys := quotaKeys(m, "hourly"); len(keys) != len(v.want) {
+			t.Errorf("history %d: keys after the window ended = %v, want %v", v.historyWindows, keys, v.want)
+		}
+		if got, want := m.order.Len(), 2*len(v.want); got != want {
+			t.Errorf("history %d: LRU list has %d entries, want %d", v.historyWindows, got, want)
+		}
+	}
+}
+
+func TestQuotaSaveSkipsEmptyCounters(t *testing.T) {
+	usageFile := filepath.Join(t.TempDir(), "usage.json")
+	m := newTestQuotaManager(t, QuotaConfig{UsageFile: usageFile, HistoryWindows: 12}, testQuotaPolicy)
+
+	checkQuota(m, "a")
+	m.mu.Lock()
+	m.counter(m.byName["hourly"], "idle", time.Now())
+	m.mu.Unlock()
+
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+	if keys := quotaKeys(m, "hourly"); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("keys after save = %v, want [a]", keys)
+	}
+
+	data, err := os.ReadFile(usageFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file quotaFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Usage) != 1 || file.Usage[0].Key != "a" || file.Usage[0].Used != 1 {
+		t.Errorf("saved usage = %+v", file.Usage)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// 限流算法
+const (
+	RateLimitTokenBucket   = "token_bucket"   // 令牌桶（默认）
+	RateLimitSlidingLog    = "sliding_log"    // 滑动窗口日志：精确，每个键保存窗口内每个请求的时间
+	RateLimitSlidingWindow = "sliding_window" // 滑动窗口计数：按上一窗口计数加权估算，每个键只保存两个计数
+	RateLimitGCRA          = "gcra"           // 通用信元速率算法：与令牌桶等价，每个键只保存一个时间
+)
+
+// rateLimitSpec 限流参数：令牌桶 / GCRA 使用 rate + burst，滑动窗口使用 limit + window，两种写法可以互相换算
+type rateLimitSpec struct {
+	rate   float64       // 每秒请求数
+	burst  int           // 突发上限
+	limit  int           // 窗口内的请求数
+	window time.Duration // 窗口长度
+}
+
+// newRateLimitSpec 由每秒请求数 + 突发上限或窗口请求数 + 窗口长度得到限流参数
+func newRateLimitSpec(requestsPerSecond, burst, limit int, window string) (rateLimitSpec, error) {
+	if window != "" {
+		duration, err := time.ParseDuration(window)
+		if err != nil || duration <= 0 {
+			return rateLimitSpec{}, fmt.Errorf("invalid window %q", window)
+		}
+		if limit <= 0 {
+			return rateLimitSpec{}, fmt.Errorf("limit must be positive")
+		}
+		return rateLimitSpec{
+			rate:   float64(limit) / duration.Seconds(),
+			burst:  limit,
+			limit:  limit,
+			window: duration,
+		}, nil
+	}
+
+	if requestsPerSecond <= 0 || burst <= 0 {
+		return rateLimitSpec{}, fmt.Errorf("requests_per_second and burst must be positive")
+	}
+	return rateLimitSpec{
+		rate:   float64(requestsPerSecond),
+		burst:  burst,
+		limit:  burst,
+		window: time.Duration(float64(burst) / float64(requestsPerSecond) * float64(time.Second)),
+	}, nil
+}
+
+// checkRateLimitAlgorithm 校验算法名称
+func checkRateLimitAlgorithm(algorithm string) error {
+	switch algorithm {
+	case "", RateLimitTokenBucket, RateLimitSlidingLog, RateLimitSlidingWindow, RateLimitGCRA:
+		return nil
+	}
+	return fmt.Errorf("unknown rate limit algorithm %q", algorithm)
+}
+
+// newRateLimiterAlgorithm 按算法创建按键限流的限流器
+func newRateLimiterAlgorithm(algorithm string, spec rateLimitSpec, maxKeys int, cleanupInterval time.Duration) (RateLimiter, error) {
+	if err := checkRateLimitAlgorithm(algorithm); err != nil {
+		return nil, err
+	}
+
+	switch algorithm {
+	case RateLimitSlidingLog:
+		return NewSlidingLogLimiter(spec.limit, spec.window, maxKeys, cleanupInterval), nil
+	case RateLimitSlidingWindow:
+		return NewSlidingWindowLimiter(spec.limit, spec.window, maxKeys, cleanupInterval), nil
+	case RateLimitGCRA:
+		return NewGCRALimiter(spec.rate, spec.burst, maxKeys, cleanupInterval), nil
+	}
+	return newTokenBucketLimiter(spec.rate, spec.burst, true, maxKeys, cleanupInterval), nil
+}
+
+// rateLimitCleanupRoutine 定期清理与新键状态相同的键
+func rateLimitCleanupRoutine(interval time.Duration, stop <-chan struct{}, cleanup func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cleanup()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// SlidingLogLimiter 滑动窗口日志限流器：任意长度为 window 的时间段内最多 limit 个请求
+type SlidingLogLimiter struct {
+	limit       int
+	window      time.Duration
+	logs        *rateLimitStore[requestLog]
+	now         func() time.Time // 当前时间，测试中替换
+	stopCleanup chan struct{}
+}
+
+// requestLog 窗口内已允许请求的时间（环形缓冲区）：按需增长，容量最多为 limit，
+// 只偶尔出现的键不会占用 limit 个时间戳
+type requestLog struct {
+	times []int64
+	head  int // 最早的请求
+	count int
+}
+
+// at 第 i 个（从最早开始）请求的时间
+func (log *requestLog) at(i int) int64 {
+	return log.times[(log.head+i)%len(log.times)]
+}
+
+// push 追加一个请求时间，缓冲区已满时按时间顺序复制到容量加倍（不超过 limit）的新缓冲区
+func (log *requestLog) push(t int64, limit int) {
+	if log.count == len(log.times) {
+		grown := make([]int64, min(limit, max(4, 2*log.count)))
+		for i := 0; i < log.count; i++ {
+			grown[i] = log.at(i)
+		}
+		log.times, log.head = grown, 0
+	}
+	log.times[(log.head+log.count)%len(log.times)] = t
+	log.count++
+}
+
+// expire 移出 cutoff 之前的请求，全部移出时释放缓冲区
+func (log *requestLog) expire(cutoff int64) {
+	for log.count > 0 && log.times[log.head] <= cutoff {
+		log.head = (log.head + 1) % len(log.times)
+		log.count--
+	}
+	if log.count == 0 {
+		log.times, log.head = nil, 0
+	}
+}
+
+// NewSlidingLogLimiter 创建滑动窗口日志限流器
+func NewSlidingLogLimiter(limit int, window time.Duration, maxKeys int, cleanupInterval time.Duration) *SlidingLogLimiter {
+	limiter := &SlidingLogLimiter{
+		limit:       limit,
+		window:      window,
+		logs:        newRateLimitStore[requestLog](maxKeys),
+		now:         time.Now,
+		stopCleanup: make(chan struct{}),
+	}
+	go rateLimitCleanupRoutine(cleanupInterval, limiter.stopCleanup, limiter.Cleanup)
+	return limiter
+}
+
+// Allow 检查是否允许请求
+func (l *SlidingLogLimiter) Allow(key string) bool {
+	return l.Take(key).Allowed
+}
+
+// Take 记录一次请求，窗口内已有 limit 个请求时拒绝
+func (l *SlidingLogLimiter) Take(key string) RateLimitResult {
+	return l.take(key, true)
+}
+
+// Peek 检查是否允许请求但不记录
+func (l *SlidingLogLimiter) Peek(key string) RateLimitResult {
+	return l.take(key, false)
+}
+
+func (l *SlidingLogLimiter) take(key string, consume bool) RateLimitResult {
+	return l.logs.update(key, func(log *requestLog, created bool) RateLimitResult {
+		now := l.now().UnixNano()
+
+		// 移出窗口之外的请求
+		log.expire(now - int64(l.window))
+
+		result := RateLimitResult{Limit: l.limit, Window: l.window}
+		if log.count < l.limit {
+			if consume {
+				log.push(now, l.limit)
+			}
+			result.Allowed = true
+		} else {
+			result.RetryAfter = time.Duration(log.at(0) + int64(l.window) - now)
+		}
+
+		result.Remaining = l.limit - log.count
+		if log.count > 0 {
+			result.Reset = time.Duration(log.at(log.count-1) + int64(l.window) - now)
+		}
+		return result
+	})
+}
+
+// Cleanup 删除窗口内没有请求的键
+func (l *SlidingLogLimiter) Cleanup() {
+	now := l.now().UnixNano()
+	l.logs.sweep(func(log *requestLog) bool {
+		return log.count == 0 || now-log.at(log.count-1) >= int64(l.window)
+	})
+}
+
+// Stop 停止清理协程
+func (l *SlidingLogLimiter) Stop() {
+	close(l.stopCleanup)
+}
+
+// SlidingWindowLimiter 滑动窗口计数限流器：当前窗口计数 + 上一窗口计数 × 上一窗口与滑动窗口重叠的比例，不超过 limit
+type SlidingWindowLimiter struct {
+	limit       int
+	window      time.Duration
+	counters    *rateLimitStore[windowCounter]
+	now         func() time.Time // 当前时间，测试中替换
+	stopCleanup chan struct{}
+}
+
+type windowCounter struct {
+	start    int64 // 当前窗口的开始时间
+	previous int
+	current  int
+}
+
+// NewSlidingWindowLimiter 创建滑动窗口计数限流器
+func NewSlidingWindowLimiter(limit int, window time.Duration, maxKeys int, cleanupInterval time.Duration) *SlidingWindowLimiter {
+	limiter := &SlidingWindowLimiter{
+		limit:       limit,
+		window:      window,
+		counters:    newRateLimitStore[windowCounter](maxKeys),
+		now:         time.Now,
+		stopCleanup: make(chan struct{}),
+	}
+	go rateLimitCleanupRoutine(cleanupInterval, limiter.stopCleanup, limiter.Cleanup)
+	return limiter
+}
+
+// Allow 检查是否允许请求
+func (l *SlidingWindowLimiter) Allow(key string) bool {
+	return l.Take(key).Allowed
+}
+
+// Take 按加权计数判断是否允许请求
+func (l *SlidingWindowLimiter) Take(key string) RateLimitResult {
+	return l.take(key, true)
+}
+
+// Peek 检查是否允许请求但不计数
+func (l *SlidingWindowLimiter) Peek(key string) RateLimitResult {
+	return l.take(key, false)
+}
+
+func (l *SlidingWindowLimiter) take(key string, consume bool) RateLimitResult {
+	return l.counters.update(key, func(c *windowCounter, created bool) RateLimitResult {
+		now := l.now().UnixNano()
+		window := int64(l.window)
+		start := now - now%window
+
+		// 进入新窗口
+		if start != c.start {
+			if start-c.start == window && !created {
+				c.previous = c.current
+			} else {
+				c.previous = 0
+			}
+			c.current = 0
+			c.start = start
+		}
+
+		elapsed := float64(now-start) / float64(window)
+		estimate := float64(c.previous)*(1-elapsed) + float64(c.current)
+
+		result := RateLimitResult{Limit: l.limit, Window: l.window}
+		if estimate+1 <= float64(l.limit) {
+			if consume {
+				c.current++
+				estimate++
+			}
+			result.Allowed = true
+		} else {
+			result.RetryAfter = l.retryAfter(c, now, elapsed)
+		}
+
+		result.Remaining = max(0, int(float64(l.limit)-estimate))
+		// 当前窗口有请求时估算值在下一窗口结束时归零，否则在当前窗口结束时归零
+		switch {
+		case c.current > 0:
+			result.Reset = time.Duration(start + 2*window - now)
+		case c.previous > 0:
+			result.Reset = time.Duration(start + window - now)
+		}
+		return result
+	})
+}
+
+// retryAfter 估算值降到 limit - 1 以下所需的时间
+func (l *SlidingWindowLimiter) retryAfter(c *windowCounter, now int64, elapsed float64) time.Duration {
+	window := float64(l.window)
+	allowed := float64(l.limit - 1)
+
+	// 在当前窗口内，随上一窗口的权重下降即可放行
+	if float64(c.current) <= allowed && c.previous > 0 {
+		at := window * (1 - (allowed-float64(c.current))/float64(c.previous))
+		return time.Duration(math.Max(0, at-elapsed*window))
+	}
+
+	// 需要等到下一窗口，当前窗口的计数变为上一窗口计数
+	next := window * (1 - elapsed)
+	if c.current > 0 {
+		next += window * math.Max(0, 1-allowed/float64(c.current))
+	}
+	return time.Duration(next)
+}
+
+// Cleanup 删除两个窗口内没有请求的键
+func (l *SlidingWindowLimiter) Cleanup() {
+	now := l.now().UnixNano()
+	l.counters.sweep(func(c *windowCounter) bool {
+		return now-c.start >= 2*int64(l.window)
+	})
+}
+
+// Stop 停止清理协程
+func (l *SlidingWindowLimiter) Stop() {
+	close(l.stopCleanup)
+}
+
+// GCRALimiter 通用信元速率算法（GCRA）限流器：每个键只保存理论到达时间（TAT），
+// 请求间隔 interval = 1 / rate，允许提前 (burst - 1) × interval 到达，效果与同参数的令牌桶相同
+type GCRALimiter struct {
+	burst       int
+	interval    int64 // 纳秒
+	tolerance   int64 // 纳秒
+	tats        *rateLimitStore[int64]
+	now         func() time.Time // 当前时间，测试中替换
+	stopCleanup chan struct{}
+}
+
+// NewGCRALimiter 创建 GCRA 限流器
+func NewGCRALimiter(rate float64, burst int, maxKeys int, cleanupInterval time.Duration) *GCRALimiter {
+	interval := int64(float64(time.Second) / rate)
+	limiter := &GCRALimiter{
+		burst:       burst,
+		interval:    interval,
+		tolerance:   interval * int64(burst-1),
+		tats:        newRateLimitStore[int64](maxKeys),
+		now:         time.Now,
+		stopCleanup: make(chan struct{}),
+	}
+	go rateLimitCleanupRoutine(cleanupInterval, limiter.stopCleanup, limiter.Cleanup)
+	return limiter
+}
+
+// Allow 检查是否允许请求
+func (l *GCRALimiter) Allow(key string) bool {
+	return l.Take(key).Allowed
+}
+
+// Take 请求到达时间不早于 TAT - tolerance 时允许，并将 TAT 推后一个间隔
+func (l *GCRALimiter) Take(key string) RateLimitResult {
+	return l.take(key, true)
+}
+
+// Peek 检查是否允许请求但不推后 TAT
+func (l *GCRALimiter) Peek(key string) RateLimitResult {
+	return l.take(key, false)
+}
+
+func (l *GCRALimiter) take(key string, consume bool) RateLimitResult {
+	return l.tats.update(key, func(tat *int64, created bool) RateLimitResult {
+		now := l.now().UnixNano()
+		if created || *tat < now {
+			*tat = now
+		}
+
+		result := RateLimitResult{Limit: l.burst, Window: time.Duration(l.interval * int64(l.burst))}
+		if *tat-now <= l.tolerance {
+			if consume {
+				*tat += l.interval
+			}
+			result.Allowed = true
+		} else {
+			result.RetryAfter = time.Duration(*tat - l.tolerance - now)
+		}
+
+		result.Remaining = max(0, int((l.tolerance+l.interval-(*tat-now))/l.interval))
+		result.Reset = time.Duration(*tat - now)
+		return result
+	})
+}
+
+// Cleanup 删除 TAT 已过去的键
+func (l *GCRALimiter) Cleanup() {
+	now := l.now().UnixNano()
+	l.tats.sweep(func(tat *int64) bool {
+		return *tat <= now
+	})
+}
+
+// Stop 停止清理协程
+func (l *GCRALimiter) Stop() {
+	close(l.stopCleanup)
+}
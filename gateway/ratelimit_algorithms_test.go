@@ -0,0 +1,237 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	benchmarkMaxKeys  = 10000  // 与 RATELIMIT_MAX_KEYS 的量级相当
+	benchmarkKeySpace = 100000 // 远超 benchmarkMaxKeys，几乎每次调用都会淘汰最久未使用的键
+)
+
+var benchmarkKeys = func() []string {
+	keys := make([]string, benchmarkKeySpace)
+	for i := range keys {
+		keys[i] = "client-" + strconv.Itoa(i)
+	}
+	return keys
+}()
+
+// testClock 手动推进的时钟
+type testClock struct {
+	t time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{t: time.Unix(1700000000, 0)} // 2s 窗口的边界
+}
+
+func (c *testClock) now() time.Time { return c.t }
+
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// 每个限流器都是 2s 内 4 个请求（GCRA 为每秒 2 个、突发 4 个）
+var testRateLimiters = []struct {
+	algorithm string
+	create    func(t *testing.T, clock *testClock, maxKeys int) RateLimiter
+}{
+	{RateLimitSlidingLog, func(t *testing.T, clock *testClock, maxKeys int) RateLimiter {
+		limiter := NewSlidingLogLimiter(4, 2*time.Second, maxKeys, time.Hour)
+		limiter.now = clock.now
+		t.Cleanup(limiter.Stop)
+		return limiter
+	}},
+	{RateLimitSlidingWindow, func(t *testing.T, clock *testClock, maxKeys int) RateLimiter {
+		limiter := NewSlidingWindowLimiter(4, 2*time.Second, maxKeys, time.Hour)
+		limiter.now = clock.now
+		t.Cleanup(limiter.Stop)
+		return limiter
+	}},
+	{RateLimitGCRA, func(t *testing.T, clock *testClock, maxKeys int) RateLimiter {
+		limiter := NewGCRALimiter(2, 4, maxKeys, time.Hour)
+		limiter.now = clock.now
+		t.Cleanup(limiter.Stop)
+		return limiter
+	}},
+}
+
+type rateLimitStep struct {
+	advance    time.Duration // 请求前推进时钟
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+func TestRateLimiterAlgorithms(t *testing.T) {
+	const ms = time.Millisecond
+	steps := map[string][]rateLimitStep{
+		RateLimitSlidingLog: {
+			{0, true, 3, 2000 * ms, 0},
+			{500 * ms, true, 2, 2000 * ms, 0},
+			{500 * ms, true, 1, 2000 * ms, 0},
+			{500 * ms, true, 0, 2000 * ms, 0},
+			{0, false, 0, 2000 * ms, 500 * ms}, // 第一个请求 0.5s 后移出窗口
+			{500 * ms, true, 0, 2000 * ms, 0},
+			{0, false, 0, 2000 * ms, 500 * ms},
+			{4000 * ms, true, 3, 2000 * ms, 0}, // 整个窗口过去后恢复
+		},
+		RateLimitSlidingWindow: {
+			{0, true, 3, 4000 * ms, 0},
+			{500 * ms, true, 2, 3500 * ms, 0},
+			{500 * ms, true, 1, 3000 * ms, 0},
+			{500 * ms, true, 0, 2500 * ms, 0},
+			{0, false, 0, 2500 * ms, 1000 * ms}, // 下一窗口过去 1/4 时估算值降到 3
+			{500 * ms, false, 0, 2000 * ms, 500 * ms},
+			{500 * ms, true, 0, 3500 * ms, 0},
+			{4000 * ms, true, 3, 3500 * ms, 0}, // 两个窗口过去后恢复
+		},
+		RateLimitGCRA: {
+			{0, true, 3, 500 * ms, 0},
+			{0, true, 2, 1000 * ms, 0},
+			{0, true, 1, 1500 * ms, 0},
+			{0, true, 0, 2000 * ms, 0},
+			{0, false, 0, 2000 * ms, 500 * ms}, // 每 0.5s 恢复一个
+			{500 * ms, true, 0, 2000 * ms, 0},
+			{0, false, 0, 2000 * ms, 500 * ms},
+			{2500 * ms, true, 3, 500 * ms, 0}, // TAT 过去后恢复
+		},
+	}
+
+	for _, v := range testRateLimiters {
+		t.Run(v.algorithm, func(t *testing.T) {
+			clock := newTestClock()
+			limiter := v.create(t, clock, 0)
+			for i, step := range steps[v.algorithm] {
+				clock.advance(step.advance)
+				got := limiter.Take("k")
+				if got.Allowed != step.allowed || got.Remaining != step.remaining || got.Reset != step.reset || got.RetryAfter != step.retryAfter {
+					t.Errorf("step %d: allowed = %v, remaining = %d, reset = %v, retry after = %v; want %v, %d, %v, %v",
+						i, got.Allowed, got.Remaining, got.Reset, got.RetryAfter, step.allowed, step.remaining, step.reset, step.retryAfter)
+				}
+				if got.Limit != 4 || got.Window != 2*time.Second {
+					t.Errorf("step %d: limit = %d, window = %v", i, got.Limit, got.Window)
+				}
+			}
+
+			// 另一个键不受影响
+			if got := limiter.Take("other"); !got.Allowed || got.Remaining != 3 {
+				t.Errorf("other key: allowed = %v, remaining = %d", got.Allowed, got.Remaining)
+			}
+		})
+	}
+}
+
+// sameShardKeys 返回落在同一分片的 n 个键
+func sameShardKeys(n int) []string {
+	probe := newRateLimitStore[struct{}](0)
+	keys := []string{"key-0"}
+	for i := 1; len(keys) < n; i++ {
+		key := "key-" + strconv.Itoa(i)
+		if probe.shard(key) == probe.shard(keys[0]) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestRateLimiterEvictsIdleKey(t *testing.T) {
+	keys := sameShardKeys(3)
+	active, idle, fresh := keys[0], keys[1], keys[2]
+
+	for _, v := range testRateLimiters {
+		t.Run(v.algorithm, func(t *testing.T) {
+			limiter := v.create(t, newTestClock(), 2*rateLimitStoreShards) // 每个分片 2 个键
+			for i := 0; i < 4; i++ {
+				limiter.Take(active)
+				limiter.Take(idle)
+			}
+			limiter.Take(active) // active 最近使用过，新键到来时淘汰 idle
+			limiter.Take(fresh)
+
+			if got := limiter.Take(active); got.Allowed {
+				t.Error("recently used key was evicted")
+			}
+			if got := limiter.Take(idle); !got.Allowed || got.Remaining != 3 {
+				t.Errorf("idle key: allowed = %v, remaining = %d; want a fresh key after eviction", got.Allowed, got.Remaining)
+			}
+		})
+	}
+}
+
+func newBenchmarkLimiter(b *testing.B, algorithm string) RateLimiter {
+	b.Helper()
+	spec, err := newRateLimitSpec(0, 0, 1000, "1s")
+	if err != nil {
+		b.Fatal(err)
+	}
+	limiter, err := newRateLimiterAlgorithm(algorithm, spec, benchmarkMaxKeys, time.Hour)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(limiter.Stop)
+	return limiter
+}
+
+// benchmarkRateLimiter 热点键（单个键，考察每次调用的开销和分片锁竞争）与大量键（超过 maxKeys，考察 LRU 淘汰）
+func benchmarkRateLimiter(b *testing.B, algorithm string) {
+	b.Run("hot_key", func(b *testing.B) {
+		limiter := newBenchmarkLimiter(b, algorithm)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			limiter.Take("hot")
+		}
+	})
+
+	b.Run("hot_key_parallel", func(b *testing.B) {
+		limiter := newBenchmarkLimiter(b, algorithm)
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				limiter.Take("hot")
+			}
+		})
+	})
+
+	b.Run("many_keys_lru", func(b *testing.B) {
+		limiter := newBenchmarkLimiter(b, algorithm)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			limiter.Take(benchmarkKeys[i%benchmarkKeySpace])
+		}
+	})
+
+	b.Run("many_keys_lru_parallel", func(b *testing.B) {
+		limiter := newBenchmarkLimiter(b, algorithm)
+		var next atomic.Int64
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				limiter.Take(benchmarkKeys[next.Add(1)%benchmarkKeySpace])
+			}
+		})
+	})
+}
+
+func BenchmarkTokenBucket(b *testing.B) {
+	benchmarkRateLimiter(b, RateLimitTokenBucket)
+}
+
+func BenchmarkSlidingLog(b *testing.B) {
+	benchmarkRateLimiter(b, RateLimitSlidingLog)
+}
+
+func BenchmarkSlidingWindow(b *testing.B) {
+	benchmarkRateLimiter(b, RateLimitSlidingWindow)
+}
+
+func BenchmarkGCRA(b *testing.B) {
+	benchmarkRateLimiter(b, RateLimitGCRA)
+}
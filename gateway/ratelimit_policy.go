@@ -0,0 +1,392 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 限流策略：按认证身份、API Key、路由、请求头、声明等组合键限流，
+// 每个请求要通过全部匹配的策略（如每用户 10 r/s 且每路由 1000 r/s），策略可按调用方的限流等级使用不同的限额
+
+// rateLimitKeyMaxLen 键的单个部分超过该长度时用摘要代替，限制客户端可控的值占用的内存
+const rateLimitKeyMaxLen = 64
+
+// RateLimitPolicy 限流策略
+type RateLimitPolicy struct {
+	Name      string                          `json:"name"`
+	Route     string                          `json:"route"`     // "[METHOD ]PATH"，为空时对全部路由生效
+	Key       []string                        `json:"key"`       // 组合键，如 ["user"]、["route"]、["header:X-Tenant-ID", "ip"]
+	Algorithm string                          `json:"algorithm"` // token_bucket（默认）/ sliding_log / sliding_window / gcra
+	MaxKeys   int                             `json:"max_keys"`  // 最多保存的键数，为 0 时使用 RATELIMIT_MAX_KEYS
+	Tiers     map[string]RateLimitPolicyLimit `json:"tiers"`     // 按调用方限流等级覆盖限额
+	RateLimitPolicyLimit
+}
+
+// RateLimitPolicyLimit 限额：requests_per_second + burst，或 limit + window（如 1000 次 / "1h"）
+type RateLimitPolicyLimit struct {
+	RequestsPerSecond int    `json:"requests_per_second"`
+	Burst             int    `json:"burst"`
+	Limit             int    `json:"limit"`
+	Window            string `json:"window"`
+}
+
+// rateLimitKeyPart 组合键的一部分
+type rateLimitKeyPart struct {
+	kind string // ip / user / api_key / tier / route / path / method / header / claim / param
+	name string // header / claim / param 的名称
+}
+
+// rateLimitPolicy 加载后的限流策略
+type rateLimitPolicy struct {
+	RateLimitPolicy
+	key      []rateLimitKeyPart
+	limiter  RateLimiter
+	limiters map[string]RateLimiter // 限流等级 -> 限流器
+}
+
+// RateLimitPolicyResult 一个策略的检查结果
+type RateLimitPolicyResult struct {
+	Policy string
+	Key    string
+	Tier   string
+	RateLimitResult
+}
+
+// RateLimitPolicies 限流策略集合
+type RateLimitPolicies struct {
+	policies []*rateLimitPolicy
+}
+
+// parseRateLimitKey 解析组合键
+func parseRateLimitKey(parts []string, route string) ([]rateLimitKeyPart, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("key is required")
+	}
+
+	declared := routeParams(route)
+	key := make([]rateLimitKeyPart, 0, len(parts))
+	for _, part := range parts {
+		kind, name, _ := strings.Cut(strings.TrimSpace(part), ":")
+		switch kind {
+		case "ip", "user", "api_key", "tier", "route", "path", "method":
+			if name != "" {
+				return nil, fmt.Errorf("key part %q takes no name", part)
+			}
+		case "header", "claim":
+			if name == "" {
+				return nil, fmt.Errorf("key part %q requires a name", part)
+			}
+			if kind == "header" {
+				name = http.CanonicalHeaderKey(name)
+			}
+		case "param":
+			found := false
+			for _, param := range declared {
+				found = found || param == name
+			}
+			if !found {
+				return nil, fmt.Errorf("key part %q: route %q has no parameter {%s}", part, route, name)
+			}
+		default:
+			return nil, fmt.Errorf("unknown key part %q", part)
+		}
+		key = append(key, rateLimitKeyPart{kind: kind, name: name})
+	}
+	return key, nil
+}
+
+// NewRateLimitPolicies 从 RATELIMIT_POLICIES_FILE 加载限流策略，未配置时返回 nil；
+// 配置了共享存储时令牌桶（和 GCRA）策略由各网关实例共同计数
+func NewRateLimitPolicies(config RateLimitConfig, backend *RateLimitBackend) (*RateLimitPolicies, error) {
+	if config.PoliciesFile == "" {
+		return nil, nil
+	}
+
+	var policies []RateLimitPolicy
+	if err := loadJSONFile(config.PoliciesFile, &policies); err != nil {
+		return nil, err
+	}
+
+	set := &RateLimitPolicies{}
+	names := make(map[string]bool)
+	for i, policy := range policies {
+		if policy.Name == "" {
+			policy.Name = "policy-" + strconv.Itoa(i+1)
+		}
+		if names[policy.Name] {
+			set.Stop()
+			return nil, fmt.Errorf("duplicate rate limit policy %q", policy.Name)
+		}
+		names[policy.Name] = true
+
+		compiled, err := compileRateLimitPolicy(policy, config, backend)
+		if err != nil {
+			set.Stop()
+			return nil, fmt.Errorf("rate limit policy %q: %w", policy.Name, err)
+		}
+		set.policies = append(set.policies, compiled)
+	}
+
+	GetLogger().Info("Rate limit policies loaded", map[string]interface{}{
+		"file":     config.PoliciesFile,
+		"policies": len(set.policies),
+	})
+	return set, nil
+}
+
+// compileRateLimitPolicy 校验策略并创建各限流等级的限流器
+func compileRateLimitPolicy(policy RateLimitPolicy, config RateLimitConfig, backend *RateLimitBackend) (*rateLimitPolicy, error) {
+	key, err := parseRateLimitKey(policy.Key, policy.Route)
+	if err != nil {
+		return nil, err
+	}
+
+	maxKeys := policy.MaxKeys
+	if maxKeys == 0 {
+		maxKeys = config.MaxKeys
+	}
+
+	// 先校验全部限额，避免创建后又丢弃限流器
+	limits := map[string]RateLimitPolicyLimit{"": policy.RateLimitPolicyLimit}
+	for tier, limit := range policy.Tiers {
+		limits[tier] = limit
+	}
+	specs := make(map[string]rateLimitSpec, len(limits))
+	for tier, limit := range limits {
+		spec, err := newRateLimitSpec(limit.RequestsPerSecond, limit.Burst, limit.Limit, limit.Window)
+		if err != nil {
+			if tier != "" {
+				err = fmt.Errorf("tier %q: %w", tier, err)
+			}
+			return nil, err
+		}
+		specs[tier] = spec
+	}
+	if err := checkRateLimitAlgorithm(policy.Algorithm); err != nil {
+		return nil, err
+	}
+
+	// 共享存储只实现了令牌桶，GCRA 与同参数的令牌桶等价；滑动窗口无法共享，仍在本地计数
+	algorithm := policy.Algorithm
+	if backend != nil {
+		switch algorithm {
+		case RateLimitGCRA:
+			algorithm = RateLimitTokenBucket
+			GetLogger().Info("Rate limit policy shared as token_bucket", map[string]interface{}{
+				"policy":    policy.Name,
+				"algorithm": policy.Algorithm,
+			})
+		case RateLimitSlidingLog, RateLimitSlidingWindow:
+			GetLogger().Warn("Rate limit policy is counted per instance", map[string]interface{}{
+				"policy":    policy.Name,
+				"algorithm": policy.Algorithm,
+				"reason":    "the shared store only supports token_bucket and gcra",
+			})
+		}
+	}
+
+	compiled := &rateLimitPolicy{
+		RateLimitPolicy: policy,
+		key:             key,
+		limiters:        make(map[string]RateLimiter),
+	}
+	for tier, spec := range specs {
+		limiter, _ := newRateLimiterAlgorithm(algorithm, spec, maxKeys, config.CleanupInterval)
+		if bucket, ok := limiter.(*TokenBucketLimiter); ok {
+			name := "policy:" + policy.Name
+			if tier != "" {
+				name += ":tier-" + tier
+			}
+			backend.Share(bucket, name)
+		}
+		if tier == "" {
+			compiled.limiter = limiter
+		} else {
+			compiled.limiters[tier] = limiter
+		}
+	}
+	return compiled, nil
+}
+
+// Stop 停止全部限流器的清理协程
+func (s *RateLimitPolicies) Stop() {
+	for _, policy := range s.policies {
+		policy.limiter.Stop()
+		for _, limiter := range policy.limiters {
+			limiter.Stop()
+		}
+	}
+}
+
+// rateLimitKeyValues 计算组合键各部分的值，请求缺少任一部分时返回 false
+func rateLimitKeyValues(key []rateLimitKeyPart, route string, r *http.Request, identity *Identity, params map[string]string) ([]string, bool) {
+	values := make([]string, 0, len(key))
+	for _, part := range key {
+		value, ok := rateLimitKeyValue(part, route, r, identity, params)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
+// rateLimitKeyValue 计算键的一部分，请求缺少该值时返回 false
+func rateLimitKeyValue(part rateLimitKeyPart, route string, r *http.Request, identity *Identity, params map[string]string) (string, bool) {
+	var value string
+	switch part.kind {
+	case "ip":
+		value = getClientIP(r)
+	case "user":
+		if identity != nil {
+			value = identity.Subject
+		}
+	case "api_key":
+		if identity != nil {
+			value = identity.KeyID
+		}
+	case "tier":
+		if identity != nil {
+			value = identity.Tier
+		}
+	case "route":
+		// 匹配该策略的全部请求共用一个计数
+		value = route
+		if value == "" {
+			value = "*"
+		}
+	case "path":
+		value = r.URL.Path
+	case "method":
+		value = r.Method
+	case "header":
+		value = r.Header.Get(part.name)
+	case "claim":
+		if identity == nil {
+			return "", false
+		}
+		var claim interface{} = identity.Claims
+		for _, name := range strings.Split(part.name, ".") {
+			m, ok := claim.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			claim = m[name]
+		}
+		if claim == nil {
+			return "", false
+		}
+		value = claimString(claim)
+	case "param":
+		value = params[part.name]
+	}
+
+	if value == "" {
+		return "", false
+	}
+	if len(value) > rateLimitKeyMaxLen {
+		sum := sha256.Sum256([]byte(value))
+		value = "sha256:" + hex.EncodeToString(sum[:16])
+	}
+	return value, true
+}
+
+// Check 先检查全部匹配的策略（不计数），全部允许时各计一次；任一超出限额时都不计数，
+// 返回到该策略为止的结果（该策略为最后一项）。键缺少任一部分（如匿名请求的 user）时该策略不适用
+func (s *RateLimitPolicies) Check(r *http.Request) []RateLimitPolicyResult {
+	identity := GetIdentity(r)
+	var results []RateLimitPolicyResult
+	var limiters []RateLimiter
+	var keys []string
+
+	for _, policy := range s.policies {
+		var params map[string]string
+		if policy.Route != "" {
+			var matched bool
+			if params, matched = matchRouteParams(policy.Route, r); !matched {
+				continue
+			}
+		}
+
+		values, ok := rateLimitKeyValues(policy.key, policy.Route, r, identity, params)
+		if !ok {
+			continue
+		}
+
+		limiter, tier := policy.limiter, ""
+		if identity != nil && identity.Tier != "" {
+			if tierLimiter, ok := policy.limiters[identity.Tier]; ok {
+				limiter, tier = tierLimiter, identity.Tier
+			}
+		}
+
+		key := strings.Join(values, "\x00")
+		result := RateLimitPolicyResult{
+			Policy:          policy.Name,
+			Key:             strings.Join(values, "|"),
+			Tier:            tier,
+			RateLimitResult: limiter.Peek(key),
+		}
+		results = append(results, result)
+		if !result.Allowed {
+			return results
+		}
+		limiters = append(limiters, limiter)
+		keys = append(keys, key)
+	}
+
+	// 检查与计数之间其他请求可能用掉了剩余的限额，此时之前的策略已经计数
+	for i, limiter := range limiters {
+		results[i].RateLimitResult = limiter.Take(keys[i])
+		if !results[i].Allowed {
+			return results[:i+1]
+		}
+	}
+	return results
+}
+
+// RateLimitPolicyMiddleware 按限流策略限流（在认证之后执行，键可以引用认证身份）
+func RateLimitPolicyMiddleware(policies *RateLimitPolicies, whitelist map[string]bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if policies == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if whitelist[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			results := policies.Check(r)
+			for _, result := range results {
+				setRateLimitHeaders(w.Header(), result.Policy, result.RateLimitResult)
+			}
+			if len(results) == 0 || results[len(results)-1].Allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+			denial := results[len(results)-1]
+
+			GetMetrics().RecordRateLimited()
+
+			fields := map[string]interface{}{
+				"remote_ip": getClientIP(r),
+				"path":      r.URL.Path,
+				"policy":    denial.Policy,
+				"key":       denial.Key,
+			}
+			if denial.Tier != "" {
+				fields["tier"] = denial.Tier
+			}
+			requestID := r.Context().Value(RequestIDKey).(string)
+			GetLogger().WarnWithRequestID(requestID, "Rate limit exceeded", fields)
+
+			writeRateLimited(w, denial.RateLimitResult)
+		})
+	}
+}
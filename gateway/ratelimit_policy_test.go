@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestRateLimitPolicies(t *testing.T, policies ...RateLimitPolicy) *RateLimitPolicies {
+	t.Helper()
+	data, err := json.Marshal(policies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "policies.json")
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := NewRateLimitPolicies(RateLimitConfig{PoliciesFile: file, MaxKeys: 1000, CleanupInterval: time.Hour}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(set.Stop)
+	return set
+}
+
+func TestRateLimitPoliciesDeniedRequestConsumesNothing(t *testing.T) {
+	for _, algorithm := range []string{RateLimitTokenBucket, RateLimitSlidingLog, RateLimitSlidingWindow, RateLimitGCRA} {
+		t.Run(algorithm, func(t *testing.T) {
+			// 全局策略在前，按客户端的策略在后
+			set := newTestRateLimitPolicies(t,
+				RateLimitPolicy{Name: "global", Key: []string{"route"}, Algorithm: algorithm,
+					RateLimitPolicyLimit: RateLimitPolicyLimit{Limit: 10, Window: "1h"}},
+				RateLimitPolicy{Name: "client", Key: []string{"header:X-Client"}, Algorithm: algorithm,
+					RateLimitPolicyLimit: RateLimitPolicyLimit{Limit: 1, Window: "1h"}})
+
+			check := func(client string) []RateLimitPolicyResult {
+				r := httptest.NewRequest("GET", "/api/items", nil)
+				r.Header.Set("X-Client", client)
+				return set.Check(r)
+			}
+
+			if results := check("a"); len(results) != 2 || !results[1].Allowed || results[0].Remaining != 9 {
+				t.Fatalf("first request: %+v", results)
+			}
+
+			// 被 client 策略拒绝的请求不消耗 global 策略的限额
+			for i := 0; i < 5; i++ {
+				results := check("a")
+				if len(results) != 2 || results[1].Allowed || results[1].Policy != "client" {
+					t.Fatalf("request %d: %+v", i, results)
+				}
+				if results[0].Remaining != 9 {
+					t.Errorf("request %d: global remaining = %d, want 9", i, results[0].Remaining)
+				}
+			}
+
+			if results := check("b"); len(results) != 2 || !results[1].Allowed || results[0].Remaining != 8 {
+				t.Errorf("request from another client: %+v", results)
+			}
+		})
+	}
+}
+
+func TestRateLimitPoliciesStopAtFirstDenial(t *testing.T) {
+	set := newTestRateLimitPolicies(t,
+		RateLimitPolicy{Name: "client", Key: []string{"header:X-Client"}, RateLimitPolicyLimit: RateLimitPolicyLimit{Limit: 1, Window: "1h"}},
+		RateLimitPolicy{Name: "global", Key: []string{"route"}, RateLimitPolicyLimit: RateLimitPolicyLimit{Limit: 10, Window: "1h"}})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Client", "a")
+	set.Check(r)
+	results := set.Check(r)
+	if len(results) != 1 || results[0].Allowed || results[0].Policy != "client" {
+		t.Fatalf("results = %+v, want only the denying policy", results)
+	}
+
+	// 未匹配键的策略不适用
+	if results := set.Check(httptest.NewRequest("GET", "/", nil)); len(results) != 1 || results[0].Policy != "global" || results[0].Remaining != 8 {
+		t.Errorf("anonymous request: %+v", results)
+	}
+}
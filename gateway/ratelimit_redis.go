@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 分布式限流：多个网关实例通过 Redis 协议的共享存储共同计数。
+// 请求路径上不访问共享存储：每个实例按本地估算的全局令牌数放行，后台每 RATELIMIT_SYNC_INTERVAL
+// （或某个键本地累计 RATELIMIT_SYNC_BATCH 个请求时提前）把各键本地放行的请求数用一次流水线提交给共享存储，
+// 由原子脚本扣减全局令牌并返回剩余令牌数，再据此校正本地估算。共享存储不可用时各实例按本地限额继续限流（fail-open）。
+
+// rateLimitSyncChunk 一次流水线最多提交的键数
+const rateLimitSyncChunk = 500
+
+// rateLimitScript 令牌桶扣减脚本：按服务器时间补充令牌后扣减本地已放行的请求数，返回剩余令牌数。
+// 多个实例合计超出限额时令牌数可以为负（最多欠一个桶容量），之后的请求需要等待补回。
+// 使用 TIME 后写入依赖脚本效果复制，需要 Redis 5 及以上
+const rateLimitScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local taken = tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+  tokens = math.min(burst, tokens + (now - ts) * rate)
+end
+tokens = math.max(-burst, tokens - taken)
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return tostring(tokens)
+`
+
+// RateLimitBackend 限流共享存储
+type RateLimitBackend struct {
+	client       *RedisClient
+	prefix       string
+	syncInterval time.Duration
+	syncBatch    int
+	scriptSHA    string
+
+	mu       sync.Mutex
+	limiters []*TokenBucketLimiter
+
+	healthy  atomic.Bool
+	syncNow  chan struct{}
+	stopSync chan struct{}
+	syncDone chan struct{}
+}
+
+// rateLimitSync 一个键待提交的请求数
+type rateLimitSync struct {
+	limiter *TokenBucketLimiter
+	key     string
+	taken   int
+}
+
+// NewRateLimitBackend 连接 RATELIMIT_REDIS_URL，未配置时返回 nil；
+// 启动时共享存储不可用不会报错，先按本地限额限流，恢复后自动开始同步
+func NewRateLimitBackend(config RateLimitConfig) (*RateLimitBackend, error) {
+	if config.RedisURL == "" {
+		return nil, nil
+	}
+
+	client, err := NewRedisClient(config.RedisURL, config.RedisTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(rateLimitScript))
+	backend := &RateLimitBackend{
+		client:       client,
+		prefix:       config.RedisPrefix,
+		syncInterval: config.SyncInterval,
+		syncBatch:    max(1, config.SyncBatch),
+		scriptSHA:    hex.EncodeToString(sum[:]),
+		syncNow:      make(chan struct{}, 1),
+		stopSync:     make(chan struct{}),
+		syncDone:     make(chan struct{}),
+	}
+
+	if err := backend.loadScript(); err != nil {
+		GetLogger().Warn("Rate limit store unreachable, falling back to local limits", map[string]interface{}{
+			"addr":  client.Addr(),
+			"error": err.Error(),
+		})
+	} else {
+		backend.healthy.Store(true)
+		GetLogger().Info("Rate limit store connected", map[string]interface{}{
+			"addr":          client.Addr(),
+			"sync_interval": config.SyncInterval.String(),
+		})
+	}
+
+	go backend.syncRoutine()
+	return backend, nil
+}
+
+// Share 让限流器通过共享存储计数，name 区分不同限流器的键；backend 为 nil 时不做任何事
+func (b *RateLimitBackend) Share(limiter *TokenBucketLimiter, name string) {
+	if b == nil || limiter == nil {
+		return
+	}
+
+	limiter.shared = b
+	limiter.sharedName = name
+
+	b.mu.Lock()
+	b.limiters = append(b.limiters, limiter)
+	b.mu.Unlock()
+}
+
+// Healthy 共享存储是否可用
+func (b *RateLimitBackend) Healthy() bool {
+	return b.healthy.Load()
+}
+
+// kick 请求尽快同步（不阻塞）
+func (b *RateLimitBackend) kick() {
+	select {
+	case b.syncNow <- struct{}{}:
+	default:
+	}
+}
+
+// loadScript 加载扣减脚本（Redis 重启后脚本缓存会丢失）
+func (b *RateLimitBackend) loadScript() error {
+	_, err := b.client.Do("SCRIPT", "LOAD", rateLimitScript)
+	return err
+}
+
+// syncRoutine 定期同步，停止时提交剩余的计数
+func (b *RateLimitBackend) syncRoutine() {
+	defer close(b.syncDone)
+
+	ticker := time.NewTicker(b.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.syncNow:
+		case <-b.stopSync:
+			b.sync()
+			return
+		}
+		b.sync()
+	}
+}
+
+// sync 提交各限流器待同步的键
+func (b *RateLimitBackend) sync() {
+	if !b.Healthy() {
+		if err := b.loadScript(); err != nil {
+			return
+		}
+		b.healthy.Store(true)
+		GetLogger().Info("Rate limit store recovered", map[string]interface{}{
+			"addr": b.client.Addr(),
+		})
+	}
+
+	b.mu.Lock()
+	limiters := b.limiters
+	b.mu.Unlock()
+
+	var batch []rateLimitSync
+	for _, limiter := range limiters {
+		for _, key := range limiter.takeDirty() {
+			item := rateLimitSync{limiter: limiter, key: key}
+			if limiter.buckets.peek(key, func(bk *bucket) {
+				item.taken = bk.pending
+				bk.dirty = false
+			}) {
+				batch = append(batch, item)
+			}
+		}
+	}
+
+	for start := 0; start < len(batch); start += rateLimitSyncChunk {
+		chunk := batch[start:min(start+rateLimitSyncChunk, len(batch))]
+		if err := b.syncChunk(chunk); err != nil {
+			b.healthy.Store(false)
+			GetLogger().Warn("Rate limit store unreachable, falling back to local limits", map[string]interface{}{
+				"addr":  b.client.Addr(),
+				"error": err.Error(),
+			})
+
+			// 未能提交的请求只在本地计数
+			for _, item := range batch[start:] {
+				item.limiter.buckets.peek(item.key, func(bk *bucket) {
+					bk.pending = max(0, bk.pending-item.taken)
+				})
+			}
+			return
+		}
+	}
+}
+
+// syncChunk 用一次流水线提交一批键并校正本地令牌数；脚本缓存丢失时重新加载后重试一次
+func (b *RateLimitBackend) syncChunk(chunk []rateLimitSync) error {
+	commands := make([][]string, len(chunk))
+	for i, item := range chunk {
+		commands[i] = []string{
+			"EVALSHA", b.scriptSHA, "1",
+			b.prefix + item.limiter.sharedName + ":" + item.key,
+			strconv.FormatFloat(item.limiter.rate, 'g', -1, 64),
+			strconv.Itoa(item.limiter.burst),
+			strconv.Itoa(item.taken),
+		}
+	}
+
+	replies, err := b.client.Pipeline(commands)
+	if err != nil {
+		return err
+	}
+	if replyErr, ok := replies[0].(RedisError); ok && strings.HasPrefix(string(replyErr), "NOSCRIPT") {
+		if err := b.loadScript(); err != nil {
+			return err
+		}
+		if replies, err = b.client.Pipeline(commands); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for i, item := range chunk {
+		reply, _ := replies[i].(string)
+		tokens, err := strconv.ParseFloat(reply, 64)
+		if err != nil {
+			GetLogger().Warn("Rate limit store rejected update", map[string]interface{}{
+				"limiter": item.limiter.sharedName,
+				"error":   replies[i],
+			})
+			item.limiter.buckets.peek(item.key, func(bk *bucket) {
+				bk.pending = max(0, bk.pending-item.taken)
+			})
+			continue
+		}
+
+		item.limiter.buckets.peek(item.key, func(bk *bucket) {
+			// 提交之后本地又放行的请求尚未计入共享存储
+			bk.pending -= item.taken
+			bk.tokens = min(float64(item.limiter.burst), tokens-float64(bk.pending))
+			bk.lastCheck = now
+		})
+	}
+	return nil
+}
+
+// Stop 停止同步（先提交剩余的计数）并关闭连接
+func (b *RateLimitBackend) Stop() {
+	if b == nil {
+		return
+	}
+	close(b.stopSync)
+	<-b.syncDone
+	b.client.Close()
+}
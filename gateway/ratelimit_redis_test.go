@@ -0,0 +1,217 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// newTestRateLimitBackend 创建不会自动同步的共享存储（测试中直接调用 sync）
+func newTestRateLimitBackend(t *testing.T, url string) *RateLimitBackend {
+	t.Helper()
+	backend, err := NewRateLimitBackend(RateLimitConfig{
+		RedisURL:     url,
+		RedisPrefix:  "test:",
+		RedisTimeout: time.Second,
+		SyncInterval: time.Hour,
+		SyncBatch:    1 << 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(backend.Stop)
+	return backend
+}
+
+// newTestSharedLimiter 补充速率可忽略的令牌桶，便于精确断言令牌数
+func newTestSharedLimiter(t *testing.T, backend *RateLimitBackend) *TokenBucketLimiter {
+	t.Helper()
+	limiter := newTokenBucketLimiter(0.001, 100, true, 0, time.Hour)
+	t.Cleanup(limiter.Stop)
+	backend.Share(limiter, "api")
+	return limiter
+}
+
+func takeN(limiter *TokenBucketLimiter, key string, n int) (allowed int) {
+	for i := 0; i < n; i++ {
+		if limiter.Allow(key) {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func bucketState(t *testing.T, limiter *TokenBucketLimiter, key string) bucket {
+	t.Helper()
+	var state bucket
+	if !limiter.buckets.peek(key, func(b *bucket) { state = *b }) {
+		t.Fatalf("bucket %q not found", key)
+	}
+	return state
+}
+
+func assertTokens(t *testing.T, what string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 0.1 {
+		t.Errorf("%s = %.3f, want %.0f", what, got, want)
+	}
+}
+
+func TestRateLimitBackendSyncsAcrossInstances(t *testing.T) {
+	server := newFakeRedis(t, "s3cret")
+	backendA := newTestRateLimitBackend(t, server.url())
+	backendB := newTestRateLimitBackend(t, server.url())
+	if !backendA.Healthy() || !backendB.Healthy() {
+		t.Fatal("backends should be healthy")
+	}
+	limiterA := newTestSharedLimiter(t, backendA)
+	limiterB := newTestSharedLimiter(t, backendB)
+
+	takeN(limiterA, "k", 30)
+	takeN(limiterB, "k", 50)
+	if pending := bucketState(t, limiterA, "k").pending; pending != 30 {
+		t.Fatalf("pending before sync = %d, want 30", pending)
+	}
+
+	backendA.sync()
+	backendB.sync()
+
+	tokens, ok := server.tokens("test:api:k")
+	if !ok {
+		t.Fatal("key was not written to the store")
+	}
+	assertTokens(t, "store tokens", tokens, 20)
+
+	stateA := bucketState(t, limiterA, "k")
+	if stateA.pending != 0 || stateA.dirty {
+		t.Errorf("after sync: pending = %d, dirty = %v", stateA.pending, stateA.dirty)
+	}
+	assertTokens(t, "instance A tokens", stateA.tokens, 70) // 同步时还不知道 B 的请求
+	assertTokens(t, "instance B tokens", bucketState(t, limiterB, "k").tokens, 20)
+}
+
+func TestRateLimitBackendCorrectsLocalEstimate(t *testing.T) {
+	server := newFakeRedis(t, "")
+	backendA := newTestRateLimitBackend(t, server.url())
+	backendB := newTestRateLimitBackend(t, server.url())
+	limiterA := newTestSharedLimiter(t, backendA)
+	limiterB := newTestSharedLimiter(t, backendB)
+
+	// B 用掉 80 个令牌并同步；A 下一次同步后校正为全局剩余的 20 个
+	takeN(limiterB, "k", 80)
+	backendB.sync()
+	takeN(limiterA, "k", 1)
+	backendA.sync()
+	assertTokens(t, "instance A tokens", bucketState(t, limiterA, "k").tokens, 19)
+
+	if allowed := takeN(limiterA, "k", 50); allowed != 19 {
+		t.Errorf("instance A allowed %d more requests, want 19", allowed)
+	}
+
+	// 同步期间本地又放行的请求不会被校正覆盖
+	takeN(limiterB, "k", 5) // 本地估算仍有 20 个令牌，全部放行
+	backendA.sync()
+	backendB.sync()
+	tokens, _ := server.tokens("test:api:k")
+	assertTokens(t, "store tokens", tokens, -5)
+	assertTokens(t, "instance B tokens", bucketState(t, limiterB, "k").tokens, -5)
+	if limiterB.Allow("k") {
+		t.Error("instance B should be limited once the shared budget is exhausted")
+	}
+}
+
+func TestRateLimitBackendReloadsScriptAfterNOSCRIPT(t *testing.T) {
+	server := newFakeRedis(t, "")
+	backend := newTestRateLimitBackend(t, server.url())
+	limiter := newTestSharedLimiter(t, backend)
+
+	takeN(limiter, "k", 10)
+	backend.sync()
+	if loads := server.callCount("SCRIPT LOAD"); loads != 1 {
+		t.Fatalf("SCRIPT LOAD calls = %d, want 1", loads)
+	}
+
+	server.flushScripts()
+	takeN(limiter, "k", 5)
+	backend.sync()
+
+	if loads := server.callCount("SCRIPT LOAD"); loads != 2 {
+		t.Errorf("SCRIPT LOAD calls = %d, want 2", loads)
+	}
+	if evals := server.callCount("EVALSHA"); evals != 3 {
+		t.Errorf("EVALSHA calls = %d, want 3 (one retried after NOSCRIPT)", evals)
+	}
+	if !backend.Healthy() {
+		t.Error("NOSCRIPT must not mark the store unhealthy")
+	}
+	tokens, _ := server.tokens("test:api:k")
+	assertTokens(t, "store tokens", tokens, 85)
+	if pending := bucketState(t, limiter, "k").pending; pending != 0 {
+		t.Errorf("pending = %d, want 0", pending)
+	}
+}
+
+func TestRateLimitBackendFallsBackWhenStoreDown(t *testing.T) {
+	server := newFakeRedis(t, "")
+	backend := newTestRateLimitBackend(t, server.url())
+	limiter := newTestSharedLimiter(t, backend)
+
+	takeN(limiter, "k", 10)
+	backend.sync()
+
+	server.stop()
+	takeN(limiter, "k", 5)
+	backend.sync()
+	if backend.Healthy() {
+		t.Fatal("store should be marked unhealthy after a failed sync")
+	}
+	state := bucketState(t, limiter, "k")
+	if state.pending != 0 {
+		t.Errorf("unsent requests should only be counted locally: pending = %d", state.pending)
+	}
+
+	// 不可用期间按本地限额限流，不再累计待同步的请求
+	if allowed := takeN(limiter, "k", 100); allowed != 85 {
+		t.Errorf("allowed %d requests while the store is down, want 85", allowed)
+	}
+	if state := bucketState(t, limiter, "k"); state.pending != 0 {
+		t.Errorf("pending while the store is down = %d, want 0", state.pending)
+	}
+
+	// 恢复后（脚本缓存已丢失）重新加载脚本并继续同步
+	server.restart()
+	backend.sync()
+	if !backend.Healthy() {
+		t.Fatal("store should be healthy after it comes back")
+	}
+	takeN(limiter, "k", 1)
+	if state := bucketState(t, limiter, "k"); !state.dirty {
+		t.Error("requests should be queued for sync again after recovery")
+	}
+	evals := server.callCount("EVALSHA")
+	backend.sync()
+	if server.callCount("EVALSHA") != evals+1 {
+		t.Error("recovered key was not synced")
+	}
+	// 不可用期间只在本地计数的请求不计入共享存储，本地估算以共享存储为准
+	assertTokens(t, "local tokens after recovery", bucketState(t, limiter, "k").tokens, 90)
+}
+
+func TestRateLimitBackendStartsWithStoreDown(t *testing.T) {
+	server := newFakeRedis(t, "")
+	url := server.url()
+	server.stop()
+
+	backend := newTestRateLimitBackend(t, url)
+	if backend.Healthy() {
+		t.Fatal("unreachable store should start unhealthy")
+	}
+	limiter := newTestSharedLimiter(t, backend)
+
+	if allowed := takeN(limiter, "k", 150); allowed != 100 {
+		t.Errorf("allowed %d requests, want the local burst of 100", allowed)
+	}
+	if state := bucketState(t, limiter, "k"); state.pending != 0 || state.dirty {
+		t.Errorf("pending = %d, dirty = %v; want nothing queued while the store is down", state.pending, state.dirty)
+	}
+}
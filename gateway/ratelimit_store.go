@@ -0,0 +1,107 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// rateLimitStoreShards 键状态的分片数，减少并发请求的锁竞争
+const rateLimitStoreShards = 16
+
+// rateLimitStore 限流器的键状态存储：按键分片，每个分片是容量有限的 LRU，
+// 键数超过上限时淘汰最久未使用的键（被淘汰的键下次按新键计数）
+type rateLimitStore[T any] struct {
+	shards [rateLimitStoreShards]rateLimitShard[T]
+}
+
+type rateLimitShard[T any] struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // 最近使用的在前
+	maxKeys int        // 0 表示不限
+}
+
+type rateLimitEntry[T any] struct {
+	key   string
+	state T
+}
+
+// newRateLimitStore 创建键状态存储，maxKeys <= 0 时不限制键数
+func newRateLimitStore[T any](maxKeys int) *rateLimitStore[T] {
+	perShard := 0
+	if maxKeys > 0 {
+		perShard = max(1, (maxKeys+rateLimitStoreShards-1)/rateLimitStoreShards)
+	}
+
+	s := &rateLimitStore[T]{}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]*list.Element)
+		s.shards[i].order = list.New()
+		s.shards[i].maxKeys = perShard
+	}
+	return s
+}
+
+// shard 按键的 FNV-1a 哈希选择分片
+func (s *rateLimitStore[T]) shard(key string) *rateLimitShard[T] {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return &s.shards[hash%rateLimitStoreShards]
+}
+
+// update 在分片锁内取得键的状态（不存在时创建，created 为 true）并交给 fn 修改
+func (s *rateLimitStore[T]) update(key string, fn func(state *T, created bool) RateLimitResult) RateLimitResult {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if element, ok := shard.entries[key]; ok {
+		shard.order.MoveToFront(element)
+		return fn(&element.Value.(*rateLimitEntry[T]).state, false)
+	}
+
+	if shard.maxKeys > 0 && shard.order.Len() >= shard.maxKeys {
+		oldest := shard.order.Back()
+		shard.order.Remove(oldest)
+		delete(shard.entries, oldest.Value.(*rateLimitEntry[T]).key)
+	}
+
+	entry := &rateLimitEntry[T]{key: key}
+	shard.entries[key] = shard.order.PushFront(entry)
+	return fn(&entry.state, true)
+}
+
+// peek 在分片锁内修改已有键的状态，不改变 LRU 顺序；键不存在（已被淘汰或清理）时返回 false
+func (s *rateLimitStore[T]) peek(key string, fn func(state *T)) bool {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	element, ok := shard.entries[key]
+	if !ok {
+		return false
+	}
+	fn(&element.Value.(*rateLimitEntry[T]).state)
+	return true
+}
+
+// sweep 删除 idle 返回 true 的键（状态与新键相同，保留没有意义）
+func (s *rateLimitStore[T]) sweep(idle func(state *T) bool) {
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for element := shard.order.Back(); element != nil; {
+			prev := element.Prev()
+			entry := element.Value.(*rateLimitEntry[T])
+			if idle(&entry.state) {
+				shard.order.Remove(element)
+				delete(shard.entries, entry.key)
+			}
+			element = prev
+		}
+		shard.mu.Unlock()
+	}
+}
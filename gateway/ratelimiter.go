@@ -8,7 +8,10 @@ import (
 // RateLimiter 限流器接口
 type RateLimiter interface {
 	Allow(key string) bool
+	Take(key string) RateLimitResult
+	Peek(key string) RateLimitResult
 	Cleanup()
+	Stop()
 }
 
 // TokenBucketLimiter 令牌桶限流器
@@ -16,15 +19,21 @@ type TokenBucketLimiter struct {
 	rate       float64           // 每秒生成的令牌数
 	burst      int               // 桶容量
 	perIP      bool              // 是否按 IP 限流
-	buckets    map[string]*bucket
-	mu         sync.RWMutex
+	buckets    *rateLimitStore[bucket]
 	stopCleanup chan struct{}
+
+	// 共享存储：本地按估算的全局令牌数放行，定期把本地放行的请求数同步到共享存储
+	shared     *RateLimitBackend
+	sharedName string
+	dirtyMu    sync.Mutex
+	dirty      []string // 待同步的键
 }
 
 type bucket struct {
 	tokens    float64
 	lastCheck time.Time
-	mu        sync.Mutex
+	pending   int  // 本地已放行、尚未同步到共享存储的请求数
+	dirty     bool // 已加入待同步列表
 }
 
 // NewRateLimiter 创建限流器
@@ -33,71 +42,137 @@ func NewRateLimiter(config RateLimitConfig) *TokenBucketLimiter {
 		return nil
 	}
 
+	return newTokenBucketLimiter(float64(config.RequestsPerSecond), config.BurstSize, config.PerIP, config.MaxKeys, config.CleanupInterval)
+}
+
+// newTokenBucketLimiter 创建令牌桶限流器，最多保存 maxKeys 个键的桶
+func newTokenBucketLimiter(rate float64, burst int, perIP bool, maxKeys int, cleanupInterval time.Duration) *TokenBucketLimiter {
 	limiter := &TokenBucketLimiter{
-		rate:        float64(config.RequestsPerSecond),
-		burst:       config.BurstSize,
-		perIP:       config.PerIP,
-		buckets:     make(map[string]*bucket),
+		rate:        rate,
+		burst:       burst,
+		perIP:       perIP,
+		buckets:     newRateLimitStore[bucket](maxKeys),
 		stopCleanup: make(chan struct{}),
 	}
 
 	// 启动清理协程
-	go limiter.cleanupRoutine(config.CleanupInterval)
+	go limiter.cleanupRoutine(cleanupInterval)
 
 	return limiter
 }
 
+// RateLimitResult 一次限流检查的结果
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int           // 桶容量（突发上限）
+	Remaining  int           // 本次检查后剩余的令牌数
+	Window     time.Duration // 空桶补满所需的时间
+	Reset      time.Duration // 桶补满还需的时间
+	RetryAfter time.Duration // 被拒绝时，距下一个令牌的时间
+}
+
 // Allow 检查是否允许请求
 func (rl *TokenBucketLimiter) Allow(key string) bool {
 	if rl == nil {
 		return true
 	}
+	return rl.Take(key).Allowed
+}
+
+// Take 消耗一个令牌，并返回限额、剩余令牌和重置时间
+func (rl *TokenBucketLimiter) Take(key string) RateLimitResult {
+	return rl.take(key, true)
+}
+
+// Peek 检查是否有可用令牌但不消耗，Remaining 为当前剩余的令牌数
+func (rl *TokenBucketLimiter) Peek(key string) RateLimitResult {
+	return rl.take(key, false)
+}
+
+func (rl *TokenBucketLimiter) take(key string, consume bool) RateLimitResult {
+	if rl == nil {
+		return RateLimitResult{Allowed: true}
+	}
 
 	// 如果不是按 IP 限流，使用全局限流
 	if !rl.perIP {
 		key = "global"
 	}
 
-	// 获取或创建桶
-	rl.mu.RLock()
-	b, exists := rl.buckets[key]
-	rl.mu.RUnlock()
-
-	if !exists {
-		rl.mu.Lock()
-		// 双重检查
-		b, exists = rl.buckets[key]
-		if !exists {
-			b = &bucket{
-				tokens:    float64(rl.burst),
-				lastCheck: time.Now(),
+	return rl.buckets.update(key, func(b *bucket, created bool) RateLimitResult {
+		now := time.Now()
+		if created {
+			b.tokens = float64(rl.burst)
+			b.lastCheck = now
+		}
+
+		// 令牌桶算法：添加新令牌
+		b.tokens += now.Sub(b.lastCheck).Seconds() * rl.rate
+		if b.tokens > float64(rl.burst) {
+			b.tokens = float64(rl.burst)
+		}
+		b.lastCheck = now
+
+		result := RateLimitResult{
+			Limit:  rl.burst,
+			Window: rl.refillTime(float64(rl.burst)),
+		}
+
+		// 检查是否有可用令牌
+		if b.tokens >= 1.0 {
+			if consume {
+				b.tokens -= 1.0
 			}
-			rl.buckets[key] = b
+			result.Allowed = true
+		} else {
+			result.RetryAfter = rl.refillTime(1.0 - b.tokens)
 		}
-		rl.mu.Unlock()
-	}
 
-	// 令牌桶算法
-	b.mu.Lock()
-	defer b.mu.Unlock()
+		// 同步后令牌数可能为负（多个实例合计超出限额）
+		result.Remaining = max(0, int(b.tokens))
+		result.Reset = rl.refillTime(float64(rl.burst) - b.tokens)
 
-	now := time.Now()
-	elapsed := now.Sub(b.lastCheck).Seconds()
+		// 共享存储不可用时只在本地计数；只检查不消耗时仍同步被拒绝的键
+		if rl.shared != nil && rl.shared.Healthy() && (consume || !result.Allowed) {
+			if result.Allowed {
+				b.pending++
+			}
+			// 被拒绝的键也要同步，以便取得其他实例补充后的令牌数
+			if !b.dirty {
+				b.dirty = true
+				rl.markDirty(key)
+			}
+			if b.pending >= rl.shared.syncBatch {
+				rl.shared.kick()
+			}
+		}
+		return result
+	})
+}
 
-	// 添加新令牌
-	b.tokens += elapsed * rl.rate
-	if b.tokens > float64(rl.burst) {
-		b.tokens = float64(rl.burst)
-	}
-	b.lastCheck = now
+// markDirty 将键加入待同步列表
+func (rl *TokenBucketLimiter) markDirty(key string) {
+	rl.dirtyMu.Lock()
+	rl.dirty = append(rl.dirty, key)
+	rl.dirtyMu.Unlock()
+}
 
-	// 检查是否有可用令牌
-	if b.tokens >= 1.0 {
-		b.tokens -= 1.0
-		return true
-	}
+// takeDirty 取出待同步的键
+func (rl *TokenBucketLimiter) takeDirty() []string {
+	rl.dirtyMu.Lock()
+	defer rl.dirtyMu.Unlock()
 
-	return false
+	keys := rl.dirty
+	rl.dirty = nil
+	return keys
+}
+
+// refillTime 生成指定数量令牌所需的时间
+func (rl *TokenBucketLimiter) refillTime(tokens float64) time.Duration {
+	if rl.rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / rl.rate * float64(time.Second))
 }
 
 // Cleanup 手动清理
@@ -106,18 +181,11 @@ func (rl *TokenBucketLimiter) Cleanup() {
 		return
 	}
 
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
+	// 删除已经补满且没有待同步请求的桶，它们与新建的桶相同
 	now := time.Now()
-	for key, b := range rl.buckets {
-		b.mu.Lock()
-		// 删除超过 5 分钟未使用的桶
-		if now.Sub(b.lastCheck) > 5*time.Minute {
-			delete(rl.buckets, key)
-		}
-		b.mu.Unlock()
-	}
+	rl.buckets.sweep(func(b *bucket) bool {
+		return b.pending == 0 && b.tokens+now.Sub(b.lastCheck).Seconds()*rl.rate >= float64(rl.burst)
+	})
 }
 
 // cleanupRoutine 定期清理协程
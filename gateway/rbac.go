@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RBAC 拒绝原因（响应体 reason 字段）
+const (
+	RBACReasonUnauthenticated    = "unauthenticated"          // 路由有绑定但请求未认证
+	RBACReasonInsufficientAccess = "insufficient_permissions" // 角色不满足路由绑定
+	RBACReasonNoMatchingBinding  = "no_matching_binding"      // 默认拒绝且没有匹配的路由绑定
+	RBACReasonPolicyUnavailable  = "policy_unavailable"       // 授权策略尚未加载
+)
+
+const (
+	rbacPermissionAll     = "*"              // 授予全部权限的通配权限
+	rbacTokenExpiryLeeway = 30 * time.Second // 访问令牌提前过期，避免拉取时恰好失效
+	rbacPolicyMaxSize     = 10 << 20
+)
+
+// RBACPolicy 授权策略（与 auth 服务 /api/v1/rbac/policy 的格式一致）
+type RBACPolicy struct {
+	Roles    map[string][]string `json:"roles"` // 角色 -> 权限，"*" 表示全部权限
+	Bindings []RBACBinding       `json:"bindings"`
+}
+
+// RBACBinding 路由绑定：调用方拥有任一角色或任一权限即可访问
+type RBACBinding struct {
+	Route       string   `json:"route"` // "[METHOD ]PATH"
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// RBACDenial 拒绝访问的原因
+type RBACDenial struct {
+	Reason              string   `json:"reason"`
+	Route               string   `json:"route,omitempty"`
+	RequiredRoles       []string `json:"required_roles,omitempty"`
+	RequiredPermissions []string `json:"required_permissions,omitempty"`
+}
+
+// RBACAuthorizer 基于角色的路由授权，策略来自本地文件或 auth 服务，定期刷新
+type RBACAuthorizer struct {
+	config RBACConfig
+	client *http.Client
+
+	policy *RBACPolicy
+	mu     sync.RWMutex
+
+	// 拉取策略使用的客户端凭证访问令牌
+	token       string
+	tokenExpiry time.Time
+	refreshMu   sync.Mutex
+
+	stopRefresh chan struct{}
+}
+
+// NewRBACAuthorizer 创建 RBAC 授权器
+// 策略文件加载失败时返回错误；策略 URL 暂不可用时不阻止启动，加载成功前所有受保护路由拒绝访问
+func NewRBACAuthorizer(config RBACConfig) (*RBACAuthorizer, error) {
+	if config.PolicyURL == "" && config.PolicyFile == "" {
+		return nil, fmt.Errorf("RBAC requires RBAC_POLICY_URL or RBAC_POLICY_FILE")
+	}
+
+	a := &RBACAuthorizer{
+		config:      config,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		stopRefresh: make(chan struct{}),
+	}
+
+	if err := a.refresh(); err != nil {
+		if config.PolicyURL == "" {
+			return nil, err
+		}
+		GetLogger().Error("Failed to fetch RBAC policy", map[string]interface{}{
+			"url":   config.PolicyURL,
+			"error": err.Error(),
+		})
+	}
+	go a.refreshRoutine(config.RefreshInterval)
+
+	return a, nil
+}
+
+// refresh 重新加载策略，URL 优先于文件
+func (a *RBACAuthorizer) refresh() error {
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	var (
+		policy RBACPolicy
+		err    error
+	)
+	if a.config.PolicyURL != "" {
+		err = a.fetchPolicy(&policy)
+	} else {
+		err = loadJSONFile(a.config.PolicyFile, &policy)
+	}
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.policy = &policy
+	a.mu.Unlock()
+
+	GetLogger().Debug("RBAC policy refreshed", map[string]interface{}{
+		"roles":    len(policy.Roles),
+		"bindings": len(policy.Bindings),
+	})
+	return nil
+}
+
+// fetchPolicy 从 auth 服务拉取策略，访问令牌失效时重新获取一次
+func (a *RBACAuthorizer) fetchPolicy(policy *RBACPolicy) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, a.config.PolicyURL, nil)
+		if err != nil {
+			return err
+		}
+		if a.config.TokenURL != "" {
+			token, err := a.accessToken()
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && a.config.TokenURL != "" && attempt == 0 {
+			resp.Body.Close()
+			a.token = ""
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected RBAC policy status code: %d", resp.StatusCode)
+		}
+
+		err = json.NewDecoder(http.MaxBytesReader(nil, resp.Body, rbacPolicyMaxSize)).Decode(policy)
+		resp.Body.Close()
+		return err
+	}
+	return fmt.Errorf("RBAC policy request unauthorized")
+}
+
+// accessToken 通过客户端凭证模式获取访问令牌，过期前复用（调用方持有 refreshMu）
+func (a *RBACAuthorizer) accessToken() (string, error) {
+	if a.token != "" && time.Now().Before(a.tokenExpiry) {
+		return a.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", "rbac:read")
+
+	req, err := http.NewRequest(http.MethodPost, a.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(a.config.ClientID), url.QueryEscape(a.config.ClientSecret))
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected token endpoint status code: %d", resp.StatusCode)
+	}
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	if tokens.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint returned no access_token")
+	}
+
+	a.token = tokens.AccessToken
+	a.tokenExpiry = time.Now().Add(time.Duration(tokens.ExpiresIn)*time.Second - rbacTokenExpiryLeeway)
+	return a.token, nil
+}
+
+// refreshRoutine 定期刷新策略，失败时保留上次的策略
+func (a *RBACAuthorizer) refreshRoutine(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.refresh(); err != nil {
+				GetLogger().Warn("RBAC policy refresh failed, keeping cached policy", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		case <-a.stopRefresh:
+			return
+		}
+	}
+}
+
+// Stop 停止策略刷新
+func (a *RBACAuthorizer) Stop() {
+	close(a.stopRefresh)
+}
+
+// Authorize 检查调用方能否访问请求的路由，允许时返回 nil
+// 所有匹配的路由绑定都必须满足
+func (a *RBACAuthorizer) Authorize(identity *Identity, r *http.Request) *RBACDenial {
+	a.mu.RLock()
+	policy := a.policy
+	a.mu.RUnlock()
+
+	if policy == nil {
+		return &RBACDenial{Reason: RBACReasonPolicyUnavailable}
+	}
+
+	var roles []string
+	if identity != nil {
+		roles = identity.Roles
+	}
+	permissions := make(map[string]bool)
+	for _, role := range roles {
+		for _, permission := range policy.Roles[role] {
+			permissions[permission] = true
+		}
+	}
+
+	matched := false
+	for _, binding := range policy.Bindings {
+		if !matchRoute(binding.Route, r) {
+			continue
+		}
+		matched = true
+
+		if identity == nil {
+			return &RBACDenial{Reason: RBACReasonUnauthenticated, Route: binding.Route}
+		}
+		if !bindingSatisfied(binding, roles, permissions) {
+			return &RBACDenial{
+				Reason:              RBACReasonInsufficientAccess,
+				Route:               binding.Route,
+				RequiredRoles:       binding.Roles,
+				RequiredPermissions: binding.Permissions,
+			}
+		}
+	}
+
+	if !matched && a.config.DefaultDeny {
+		return &RBACDenial{Reason: RBACReasonNoMatchingBinding}
+	}
+	return nil
+}
+
+// bindingSatisfied 调用方拥有绑定中的任一角色或任一权限
+func bindingSatisfied(binding RBACBinding, roles []string, permissions map[string]bool) bool {
+	if permissions[rbacPermissionAll] {
+		return true
+	}
+	for _, required := range binding.Roles {
+		for _, role := range roles {
+			if role == required {
+				return true
+			}
+		}
+	}
+	for _, required := range binding.Permissions {
+		if permissions[required] {
+			return true
+		}
+	}
+	return false
+}
+
+// RBACMiddleware 基于角色的路由授权中间件（在认证之后执行），白名单路径不检查
+// 拒绝时返回 403（策略不可用时 503）和 JSON 格式的原因
+func RBACMiddleware(authorizer *RBACAuthorizer, pathWhitelist map[string]bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if authorizer == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pathWhitelist[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			identity := GetIdentity(r)
+			denial := authorizer.Authorize(identity, r)
+			if denial == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			subject := ""
+			if identity != nil {
+				subject = identity.Subject
+			}
+			requestID := r.Context().Value(RequestIDKey).(string)
+			GetLogger().WarnWithRequestID(requestID, "Access denied by RBAC", map[string]interface{}{
+				"path":    r.URL.Path,
+				"method":  r.Method,
+				"subject": subject,
+				"reason":  denial.Reason,
+				"route":   denial.Route,
+			})
+
+			status, code := http.StatusForbidden, "forbidden"
+			if denial.Reason == RBACReasonPolicyUnavailable {
+				status, code = http.StatusServiceUnavailable, "service_unavailable"
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(struct {
+				Error string `json:"error"`
+				*RBACDenial
+			}{Error: code, RBACDenial: denial})
+		})
+	}
+}
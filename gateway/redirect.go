@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPSRedirectHandler 将明文 HTTP 请求 308 重定向到 HTTPS，豁免路径交给 next 处理
+func HTTPSRedirectHandler(httpsPort string, exemptRoutes []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range exemptRoutes {
+			if matchRoute(route, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+// HSTSHeader 根据配置生成 Strict-Transport-Security 头，max-age 为 0 时返回空（不发送）
+func HSTSHeader(config HSTSConfig) string {
+	if config.MaxAge <= 0 {
+		return ""
+	}
+
+	value := "max-age=" + strconv.FormatInt(int64(config.MaxAge/time.Second), 10)
+	if config.IncludeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if config.Preload {
+		value += "; preload"
+	}
+	return value
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 最小的 Redis（RESP2）客户端：连接池 + 单条命令 + 流水线，足够限流共享存储使用
+
+// redisPoolSize 连接池保留的空闲连接数
+const redisPoolSize = 4
+
+// RedisError Redis 返回的错误回复（如 NOSCRIPT），连接本身仍可用
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// RedisClient Redis 客户端
+type RedisClient struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	timeout  time.Duration
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// NewRedisClient 解析 redis://[user:password@]host:port[/db] 或 rediss://（TLS），不立即建立连接
+func NewRedisClient(rawURL string, timeout time.Duration) (*RedisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid redis URL scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("redis URL has no host")
+	}
+
+	client := &RedisClient{
+		addr:    u.Host,
+		timeout: timeout,
+		pool:    make(chan *redisConn, redisPoolSize),
+	}
+	if u.Port() == "" {
+		client.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		client.password, _ = u.User.Password()
+		client.username = u.User.Username()
+		if client.password == "" {
+			// redis://:password@host 与 redis://password@host 都只表示密码
+			client.password, client.username = client.username, ""
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if client.db, err = strconv.Atoi(db); err != nil || client.db < 0 {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	if u.Scheme == "rediss" {
+		client.tls = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: u.Hostname()}
+	}
+	return client, nil
+}
+
+// Addr 服务器地址
+func (c *RedisClient) Addr() string {
+	return c.addr
+}
+
+// dial 建立连接并完成认证和选库
+func (c *RedisClient) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, c.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+	var setup [][]string
+	if c.password != "" {
+		if c.username != "" {
+			setup = append(setup, []string{"AUTH", c.username, c.password})
+		} else {
+			setup = append(setup, []string{"AUTH", c.password})
+		}
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) > 0 {
+		replies, err := rc.pipeline(setup, c.timeout)
+		if err == nil {
+			for _, reply := range replies {
+				if replyErr, ok := reply.(RedisError); ok {
+					err = replyErr
+					break
+				}
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// get 从连接池取出连接，没有空闲连接时新建
+func (c *RedisClient) get() (*redisConn, error) {
+	select {
+	case rc := <-c.pool:
+		return rc, nil
+	default:
+		return c.dial()
+	}
+}
+
+// put 归还连接，连接池已满时关闭
+func (c *RedisClient) put(rc *redisConn) {
+	select {
+	case c.pool <- rc:
+	default:
+		rc.conn.Close()
+	}
+}
+
+// Do 执行一条命令，错误回复以 RedisError 返回
+func (c *RedisClient) Do(args ...string) (interface{}, error) {
+	replies, err := c.Pipeline([][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := replies[0].(RedisError); ok {
+		return nil, replyErr
+	}
+	return replies[0], nil
+}
+
+// Pipeline 一次写入多条命令后依次读取回复（一次往返）；单条命令的错误回复以 RedisError 值出现在结果中，
+// 返回 error 时连接已失效
+func (c *RedisClient) Pipeline(commands [][]string) ([]interface{}, error) {
+	rc, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := rc.pipeline(commands, c.timeout)
+	if err != nil {
+		rc.conn.Close()
+		return nil, err
+	}
+	c.put(rc)
+	return replies, nil
+}
+
+// Close 关闭空闲连接
+func (c *RedisClient) Close() {
+	for {
+		select {
+		case rc := <-c.pool:
+			rc.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (rc *redisConn) pipeline(commands [][]string, timeout time.Duration) ([]interface{}, error) {
+	rc.conn.SetDeadline(time.Now().Add(timeout))
+
+	for _, args := range commands {
+		rc.writer.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+		for _, arg := range args {
+			rc.writer.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+			rc.writer.WriteString(arg)
+			rc.writer.WriteString("\r\n")
+		}
+	}
+	if err := rc.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(commands))
+	for i := range replies {
+		reply, err := rc.readReply()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// readReply 读取一个回复：简单字符串和批量字符串为 string，整数为 int64，
+// 空批量字符串 / 空数组为 nil，数组为 []interface{}，错误为 RedisError
+func (rc *redisConn) readReply() (interface{}, error) {
+	line, err := rc.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return RedisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("malformed redis bulk length %q", body)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("malformed redis array length %q", body)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = rc.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown redis reply type %q", kind)
+}
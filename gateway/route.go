@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// matchRoute 判断请求是否匹配路由模式 "[METHOD ]PATH"
+// PATH 以 / 结尾时按前缀匹配（与 ServeMux 一致），否则精确匹配；省略 METHOD 表示任意方法
+func matchRoute(pattern string, r *http.Request) bool {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+
+	if method != "" && method != r.Method {
+		return false
+	}
+
+	path = strings.TrimSpace(path)
+	if strings.HasSuffix(path, "/") {
+		return strings.HasPrefix(r.URL.Path, path)
+	}
+
+	return r.URL.Path == path
+}
+
+// matchRouteParams 与 matchRoute 规则相同，PATH 中的 {name} 段匹配任意非空的单个路径段，返回各参数的值
+func matchRouteParams(pattern string, r *http.Request) (map[string]string, bool) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+
+	if method != "" && method != r.Method {
+		return nil, false
+	}
+
+	path = strings.TrimSpace(path)
+	if !strings.Contains(path, "{") {
+		return nil, matchRoute(pattern, r)
+	}
+
+	prefix := strings.HasSuffix(path, "/")
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	requestSegments := strings.Split(r.URL.Path, "/")
+	if prefix && len(requestSegments) <= len(segments) || !prefix && len(requestSegments) != len(segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range segments {
+		if name, ok := routeParamName(segment); ok {
+			if requestSegments[i] == "" {
+				return nil, false
+			}
+			params[name] = requestSegments[i]
+			continue
+		}
+		if segment != requestSegments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// routeParams 返回路由模式中声明的参数名
+func routeParams(pattern string) []string {
+	_, path, found := strings.Cut(pattern, " ")
+	if !found {
+		path = pattern
+	}
+
+	var names []string
+	for _, segment := range strings.Split(strings.TrimSpace(path), "/") {
+		if name, ok := routeParamName(segment); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// routeParamName 解析 "{name}" 形式的路径段
+func routeParamName(segment string) (string, bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
@@ -0,0 +1,689 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 浏览器会话：网关作为 auth 服务的 OIDC 客户端（授权码 + PKCE）完成登录，
+// 会话保存在 AES-GCM 加密的 Cookie 中，无需服务端存储；
+// 使用会话 Cookie 认证的非安全方法请求必须携带与会话一致的 CSRF 令牌（同步令牌，另通过可读 Cookie 下发供页面双提交）
+
+var (
+	ErrInvalidSession = errors.New("invalid session cookie")
+	ErrSessionExpired = errors.New("session expired")
+)
+
+const (
+	sessionMinSecretLen    = 32
+	sessionLoginTTL        = 10 * time.Minute // 登录流程（state / PKCE）的有效期
+	sessionRenewInterval   = time.Minute      // 滑动续期的最大间隔，避免每个请求都下发 Cookie
+	sessionMaxCookieSize   = 4000
+	sessionCSRFFormField   = "_csrf"
+	sessionLoginCookieTail = "_login"
+	sessionCSRFCookieTail  = "_csrf"
+)
+
+// sessionDropClaims 不保存到会话中的令牌声明（由会话自身的时间戳代替或仅对令牌有意义）
+var sessionDropClaims = []string{"iss", "aud", "azp", "exp", "iat", "nbf", "jti", "nonce", "at_hash", "auth_time", "client_id"}
+
+// sessionData 会话 Cookie 的内容
+type sessionData struct {
+	Subject  string                 `json:"sub"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+	CSRF     string                 `json:"csrf"`
+	Created  int64                  `json:"created"`   // 登录时间，用于绝对超时
+	LastSeen int64                  `json:"last_seen"` // 最近活动时间，用于空闲超时
+}
+
+// sessionLogin 登录流程状态，保存在只发往回调路径的短期 Cookie 中
+type sessionLogin struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	ReturnTo string `json:"return_to"`
+	Expires  int64  `json:"exp"`
+}
+
+// SessionManager 网关管理的浏览器会话，同时是会话 Cookie 的认证器
+type SessionManager struct {
+	config        SessionConfig
+	aeads         []cipher.AEAD // 第一个用于加密
+	sameSite      http.SameSite
+	callbackPath  string
+	authorizeURL  string
+	tokenURL      string
+	logoutURL     string
+	forwardClaims map[string]string
+	renewAfter    time.Duration // 距最近活动超过该时间时续期
+	maxBody       int64
+	client        *http.Client
+}
+
+// NewSessionManager 创建会话管理器
+func NewSessionManager(config SessionConfig, maxBody int64) (*SessionManager, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("session requires SESSION_ISSUER, SESSION_CLIENT_ID and SESSION_REDIRECT_URL")
+	}
+	if len(config.Secrets) == 0 {
+		return nil, fmt.Errorf("session requires SESSION_SECRET")
+	}
+	redirect, err := url.Parse(config.RedirectURL)
+	if err != nil || !redirect.IsAbs() || redirect.Path == "" {
+		return nil, fmt.Errorf("invalid SESSION_REDIRECT_URL %q", config.RedirectURL)
+	}
+
+	m := &SessionManager{
+		config:        config,
+		callbackPath:  redirect.Path,
+		authorizeURL:  config.Issuer + "/oauth/authorize",
+		tokenURL:      config.TokenURL,
+		logoutURL:     config.Issuer + "/oauth/logout",
+		forwardClaims: parseForwardClaims(config.ForwardClaims),
+		renewAfter:    min(sessionRenewInterval, config.IdleTimeout/4),
+		maxBody:       maxBody,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+	if m.tokenURL == "" {
+		m.tokenURL = config.Issuer + "/oauth/token"
+	}
+
+	for _, secret := range config.Secrets {
+		secret = strings.TrimSpace(secret)
+		if len(secret) < sessionMinSecretLen {
+			return nil, fmt.Errorf("session secret must be at least %d bytes", sessionMinSecretLen)
+		}
+		key := sha256.Sum256([]byte(secret))
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		m.aeads = append(m.aeads, aead)
+	}
+
+	switch strings.ToLower(config.CookieSameSite) {
+	case "lax":
+		m.sameSite = http.SameSiteLaxMode
+	case "strict":
+		m.sameSite = http.SameSiteStrictMode
+	case "none":
+		if !config.CookieSecure {
+			return nil, fmt.Errorf("SESSION_COOKIE_SAMESITE=none requires SESSION_COOKIE_SECURE")
+		}
+		m.sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("invalid SESSION_COOKIE_SAMESITE %q", config.CookieSameSite)
+	}
+
+	for _, path := range []string{config.LoginPath, config.LogoutPath} {
+		if path == m.callbackPath {
+			return nil, fmt.Errorf("session login and logout paths must differ from the callback path %q", path)
+		}
+	}
+	return m, nil
+}
+
+// seal 加密 Cookie 内容，Cookie 名作为附加数据，防止不同 Cookie 的值互换
+func (m *SessionManager) seal(name string, v interface{}) (string, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	aead := m.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(name))), nil
+}
+
+// open 解密 Cookie 内容，依次尝试当前和轮换中的密钥
+func (m *SessionManager) open(name, value string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return ErrInvalidSession
+	}
+	for _, aead := range m.aeads {
+		if len(data) < aead.NonceSize() {
+			break
+		}
+		plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+		if err != nil {
+			continue
+		}
+		if err := json.Unmarshal(plaintext, v); err != nil {
+			return ErrInvalidSession
+		}
+		return nil
+	}
+	return ErrInvalidSession
+}
+
+// cookie 创建会话相关的 Cookie，maxAge 为负数时删除
+func (m *SessionManager) cookie(name, value, path string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   m.config.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   m.config.CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: m.sameSite,
+	}
+}
+
+// routesMatch 判断请求是否在接受会话 Cookie 的路由上
+func (m *SessionManager) routesMatch(r *http.Request) bool {
+	return basicAuthRoutesMatch(m.config.Routes, r)
+}
+
+// session 读取并校验请求的会话，没有会话 Cookie 时返回 (nil, nil)
+func (m *SessionManager) session(r *http.Request, now time.Time) (*sessionData, error) {
+	cookie, err := r.Cookie(m.config.CookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+
+	var session sessionData
+	if err := m.open(m.config.CookieName, cookie.Value, &session); err != nil {
+		return nil, err
+	}
+	if session.Subject == "" || session.CSRF == "" {
+		return nil, ErrInvalidSession
+	}
+	if now.Sub(time.Unix(session.Created, 0)) > m.config.AbsoluteTimeout || now.Sub(time.Unix(session.LastSeen, 0)) > m.config.IdleTimeout {
+		return nil, fmt.Errorf("%w: %s", ErrSessionExpired, session.Subject)
+	}
+	return &session, nil
+}
+
+// setSession 下发会话 Cookie 和 CSRF Cookie，有效期不超过会话的绝对超时
+func (m *SessionManager) setSession(w http.ResponseWriter, session *sessionData, now time.Time) error {
+	value, err := m.seal(m.config.CookieName, session)
+	if err != nil {
+		return err
+	}
+	if len(value) > sessionMaxCookieSize {
+		return fmt.Errorf("session cookie too large (%d bytes)", len(value))
+	}
+
+	maxAge := int(time.Unix(session.Created, 0).Add(m.config.AbsoluteTimeout).Sub(now) / time.Second)
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+	http.SetCookie(w, m.cookie(m.config.CookieName, value, "/", maxAge, true))
+	http.SetCookie(w, m.cookie(m.config.CookieName+sessionCSRFCookieTail, session.CSRF, "/", maxAge, false))
+	return nil
+}
+
+// clearSession 删除会话 Cookie 和 CSRF Cookie
+func (m *SessionManager) clearSession(w http.ResponseWriter) {
+	http.SetCookie(w, m.cookie(m.config.CookieName, "", "/", -1, true))
+	http.SetCookie(w, m.cookie(m.config.CookieName+sessionCSRFCookieTail, "", "/", -1, false))
+}
+
+// Authenticate 校验会话 Cookie
+func (m *SessionManager) Authenticate(r *http.Request) (*Identity, error) {
+	if !m.routesMatch(r) {
+		return nil, nil
+	}
+	session, err := m.session(r, time.Now())
+	if session == nil || err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string)
+	for claim, header := range m.forwardClaims {
+		if value, ok := session.Claims[claim]; ok {
+			headers[header] = claimString(value)
+		}
+	}
+
+	return &Identity{
+		Subject: session.Subject,
+		Method:  "session",
+		Scopes:  tokenScopes(session.Claims),
+		Roles:   claimStrings(session.Claims[m.config.RolesClaim]),
+		Claims:  session.Claims,
+		Headers: headers,
+	}, nil
+}
+
+// IdentityHeaders 实现 IdentityHeaderProvider
+func (m *SessionManager) IdentityHeaders() []string {
+	headers := make([]string, 0, len(m.forwardClaims))
+	for _, header := range m.forwardClaims {
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+// RedirectToLogin 实现 LoginRedirecter：浏览器直接访问页面（GET / HEAD 且接受 HTML）时跳转到登录，
+// 携带 Authorization 的 API 请求和脚本请求仍按普通认证失败处理
+func (m *SessionManager) RedirectToLogin(w http.ResponseWriter, r *http.Request) bool {
+	if !m.routesMatch(r) || r.Header.Get("Authorization") != "" {
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+
+	if _, err := r.Cookie(m.config.CookieName); err == nil {
+		m.clearSession(w)
+	}
+	m.startLogin(w, r, r.URL.RequestURI())
+	return true
+}
+
+// sessionReturnTo 只接受本站的相对路径作为登录后的返回地址，防止开放重定向。
+// 浏览器解析 URL 时会删除制表符和换行（"/\t/evil.com" 会变成 "//evil.com"），含控制字符的地址一律拒绝
+func sessionReturnTo(returnTo string) string {
+	if strings.IndexFunc(returnTo, func(c rune) bool { return c < 0x20 || c == 0x7f }) >= 0 {
+		return "/"
+	}
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return "/"
+	}
+	u, err := url.Parse(returnTo)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "/"
+	}
+	return returnTo
+}
+
+// sessionRandom 生成 base64url 编码的随机值
+func sessionRandom() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// startLogin 保存登录状态并跳转到 auth 服务的授权端点
+func (m *SessionManager) startLogin(w http.ResponseWriter, r *http.Request, returnTo string) {
+	login := sessionLogin{
+		State:    sessionRandom(),
+		Verifier: sessionRandom(),
+		Nonce:    sessionRandom(),
+		ReturnTo: sessionReturnTo(returnTo),
+		Expires:  time.Now().Add(sessionLoginTTL).Unix(),
+	}
+	name := m.config.CookieName + sessionLoginCookieTail
+	value, err := m.seal(name, &login)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// 回调是从 auth 服务跳转回来的跨站导航，登录状态 Cookie 必须是 Lax
+	loginCookie := m.cookie(name, value, m.callbackPath, int(sessionLoginTTL/time.Second), true)
+	if m.sameSite == http.SameSiteStrictMode {
+		loginCookie.SameSite = http.SameSiteLaxMode
+	}
+	http.SetCookie(w, loginCookie)
+
+	challenge := sha256.Sum256([]byte(login.Verifier))
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", m.config.ClientID)
+	query.Set("redirect_uri", m.config.RedirectURL)
+	query.Set("scope", strings.Join(m.config.Scopes, " "))
+	query.Set("state", login.State)
+	query.Set("nonce", login.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, m.authorizeURL+"?"+query.Encode(), http.StatusFound)
+}
+
+// handleCallback 校验 state，用授权码换取令牌并建立会话
+func (m *SessionManager) handleCallback(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value(RequestIDKey).(string)
+	w.Header().Set("Cache-Control", "no-store")
+
+	name := m.config.CookieName + sessionLoginCookieTail
+	http.SetCookie(w, m.cookie(name, "", m.callbackPath, -1, true))
+
+	fail := func(status int, reason string, err error) {
+		fields := map[string]interface{}{
+			"reason":    reason,
+			"remote_ip": getClientIP(r),
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		GetLogger().WarnWithRequestID(requestID, "Session login failed", fields)
+		http.Error(w, "Login failed", status)
+	}
+
+	var login sessionLogin
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		fail(http.StatusBadRequest, "missing_login_state", nil)
+		return
+	}
+	if err := m.open(name, cookie.Value, &login); err != nil || time.Now().Unix() > login.Expires {
+		fail(http.StatusBadRequest, "invalid_login_state", nil)
+		return
+	}
+
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(login.State)) != 1 {
+		fail(http.StatusBadRequest, "state_mismatch", nil)
+		return
+	}
+	if oauthErr := query.Get("error"); oauthErr != "" {
+		fail(http.StatusForbidden, oauthErr, errors.New(query.Get("error_description")))
+		return
+	}
+
+	claims, err := m.exchangeCode(query.Get("code"), &login)
+	if err != nil {
+		fail(http.StatusBadGateway, "token_exchange", err)
+		return
+	}
+
+	now := time.Now()
+	subject, _ := claims["sub"].(string)
+	session := &sessionData{
+		Subject:  subject,
+		Claims:   claims,
+		CSRF:     sessionRandom(),
+		Created:  now.Unix(),
+		LastSeen: now.Unix(),
+	}
+	if err := m.setSession(w, session, now); err != nil {
+		fail(http.StatusInternalServerError, "session_cookie", err)
+		return
+	}
+
+	GetLogger().InfoWithRequestID(requestID, "Session login", map[string]interface{}{
+		"subject":   subject,
+		"remote_ip": getClientIP(r),
+	})
+	http.Redirect(w, r, login.ReturnTo, http.StatusFound)
+}
+
+// exchangeCode 在令牌端点用授权码换取令牌，返回会话保存的声明
+// ID 令牌直接从令牌端点的 TLS 连接取得，按 OIDC Core 3.1.3.7 可不校验签名，只校验 iss / aud / nonce / exp
+func (m *SessionManager) exchangeCode(code string, login *sessionLogin) (map[string]interface{}, error) {
+	if code == "" {
+		return nil, fmt.Errorf("missing authorization code")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", m.config.RedirectURL)
+	form.Set("code_verifier", login.Verifier)
+
+	req, err := http.NewRequest(http.MethodPost, m.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(m.config.ClientID), url.QueryEscape(m.config.ClientSecret))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected token endpoint status code: %d", resp.StatusCode)
+	}
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Scope       string `json:"scope"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint returned no id_token")
+	}
+
+	idClaims, err := jwtPayload(tokens.IDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if iss, _ := idClaims["iss"].(string); iss != m.config.Issuer {
+		return nil, fmt.Errorf("unexpected id_token issuer %q", iss)
+	}
+	audienceOK := false
+	for _, aud := range claimStrings(idClaims["aud"]) {
+		audienceOK = audienceOK || aud == m.config.ClientID
+	}
+	if !audienceOK {
+		return nil, fmt.Errorf("id_token audience does not include %q", m.config.ClientID)
+	}
+	if nonce, _ := idClaims["nonce"].(string); subtle.ConstantTimeCompare([]byte(nonce), []byte(login.Nonce)) != 1 {
+		return nil, fmt.Errorf("id_token nonce mismatch")
+	}
+	if exp, ok := idClaims["exp"].(float64); !ok || time.Now().After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("id_token expired")
+	}
+	if sub, _ := idClaims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("id_token has no subject")
+	}
+
+	// 角色等授权声明在访问令牌中（auth 服务签发的是 JWT），ID 令牌的身份声明优先
+	claims := make(map[string]interface{})
+	if accessClaims, err := jwtPayload(tokens.AccessToken); err == nil {
+		for key, value := range accessClaims {
+			claims[key] = value
+		}
+	}
+	for key, value := range idClaims {
+		claims[key] = value
+	}
+	if tokens.Scope != "" {
+		claims["scope"] = tokens.Scope
+	}
+	for _, key := range sessionDropClaims {
+		delete(claims, key)
+	}
+	return claims, nil
+}
+
+// jwtPayload 解码 JWT 的声明部分（不校验签名）
+func jwtPayload(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// handleLogout 删除会话，配置了 SESSION_POST_LOGOUT_URL 时同时退出 auth 服务的登录
+func (m *SessionManager) handleLogout(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value(RequestIDKey).(string)
+	if session, _ := m.session(r, time.Now()); session != nil {
+		GetLogger().InfoWithRequestID(requestID, "Session logout", map[string]interface{}{
+			"subject":   session.Subject,
+			"remote_ip": getClientIP(r),
+		})
+	}
+
+	m.clearSession(w)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if m.config.PostLogoutURL == "" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	query := url.Values{}
+	query.Set("client_id", m.config.ClientID)
+	query.Set("post_logout_redirect_uri", m.config.PostLogoutURL)
+	http.Redirect(w, r, m.logoutURL+"?"+query.Encode(), http.StatusFound)
+}
+
+// csrfToken 读取请求携带的 CSRF 令牌：请求头优先，其次为表单字段（读取后放回请求体）
+func (m *SessionManager) csrfToken(r *http.Request) string {
+	if token := r.Header.Get(m.config.CSRFHeader); token != "" {
+		return token
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" || r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, m.maxBody+1))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || int64(len(body)) > m.maxBody {
+		return ""
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	return form.Get(sessionCSRFFormField)
+}
+
+// stripCookies 删除转发给上游的会话 Cookie 和登录状态 Cookie
+func (m *SessionManager) stripCookies(r *http.Request) {
+	cookies := r.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+
+	kept := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		if cookie.Name == m.config.CookieName || cookie.Name == m.config.CookieName+sessionLoginCookieTail {
+			continue
+		}
+		kept = append(kept, cookie.String())
+	}
+	if len(kept) == len(cookies) {
+		return
+	}
+	if len(kept) == 0 {
+		r.Header.Del("Cookie")
+		return
+	}
+	r.Header.Set("Cookie", strings.Join(kept, "; "))
+}
+
+// isSafeMethod 不改变状态、无需 CSRF 校验的方法
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// SessionEndpointMiddleware 处理登录、登录回调和退出登录路径（在认证之前）
+func SessionEndpointMiddleware(manager *SessionManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if manager == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == manager.callbackPath && r.Method == http.MethodGet:
+				manager.handleCallback(w, r)
+			case r.URL.Path == manager.config.LoginPath && r.Method == http.MethodGet:
+				manager.startLogin(w, r, r.URL.Query().Get("return_to"))
+			case r.URL.Path == manager.config.LogoutPath && (r.Method == http.MethodGet || r.Method == http.MethodPost):
+				manager.handleLogout(w, r)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// SessionMiddleware 会话认证后的处理（在认证之后）：非安全方法校验 CSRF 令牌、滑动续期，
+// 并且不把会话 Cookie 转发给上游
+func SessionMiddleware(manager *SessionManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if manager == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := GetIdentity(r)
+			if identity == nil || identity.Method != "session" {
+				manager.stripCookies(r)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := time.Now()
+			session, err := manager.session(r, now)
+			if session == nil || err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !isSafeMethod(r.Method) {
+				token := manager.csrfToken(r)
+				if subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRF)) != 1 {
+					requestID := r.Context().Value(RequestIDKey).(string)
+					GetLogger().WarnWithRequestID(requestID, "CSRF token mismatch", map[string]interface{}{
+						"path":      r.URL.Path,
+						"method":    r.Method,
+						"subject":   session.Subject,
+						"remote_ip": getClientIP(r),
+						"missing":   token == "",
+					})
+
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("Cache-Control", "no-store")
+					w.WriteHeader(http.StatusForbidden)
+					json.NewEncoder(w).Encode(map[string]string{
+						"error":  "forbidden",
+						"reason": "csrf_token_invalid",
+					})
+					return
+				}
+			}
+
+			// 滑动续期：空闲超时从最近一次活动算起
+			if now.Sub(time.Unix(session.LastSeen, 0)) >= manager.renewAfter {
+				session.LastSeen = now.Unix()
+				if err := manager.setSession(w, session, now); err != nil {
+					requestID := r.Context().Value(RequestIDKey).(string)
+					GetLogger().ErrorWithRequestID(requestID, "Session renewal failed", map[string]interface{}{
+						"subject": session.Subject,
+						"error":   err.Error(),
+					})
+				}
+			}
+
+			manager.stripCookies(r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
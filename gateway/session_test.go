@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionReturnTo(t *testing.T) {
+	for _, v := range []struct {
+		returnTo, want string
+	}{
+		{"/", "/"},
+		{"/orders?id=1#top", "/orders?id=1#top"},
+		{"/a/b//c", "/a/b//c"},
+		{"/search?next=https://example.com", "/search?next=https://example.com"},
+
+		// 浏览器删除制表符和换行后变成 //evil.com
+		{"/\t/evil.com", "/"},
+		{"/\n/evil.com", "/"},
+		{"/\r\n/evil.com", "/"},
+		{"\t//evil.com", "/"},
+		{"/orders\x00", "/"},
+		{"/orders\x7f", "/"},
+
+		{"//evil.com", "/"},
+		{"///evil.com", "/"},
+		{"/\\evil.com", "/"},
+		{"/\\/evil.com", "/"},
+		{"https://evil.com", "/"},
+		{"https:evil.com", "/"},
+		{"javascript:alert(1)", "/"},
+		{"evil.com", "/"},
+		{"", "/"},
+	} {
+		if got := sessionReturnTo(v.returnTo); got != v.want {
+			t.Errorf("sessionReturnTo(%q) = %q, want %q", v.returnTo, got, v.want)
+		}
+	}
+}
+
+func TestSessionLoginSanitizesReturnTo(t *testing.T) {
+	manager, err := NewSessionManager(SessionConfig{
+		Issuer:         "https://auth.example.com",
+		ClientID:       "gateway",
+		RedirectURL:    "https://gw.example.com/oauth/callback",
+		LoginPath:      "/login",
+		LogoutPath:     "/logout",
+		Secrets:        []string{strings.Repeat("s", sessionMinSecretLen)},
+		CookieName:     "gw_session",
+		CookieSameSite: "lax",
+		IdleTimeout:    time.Hour,
+	}, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := SessionEndpointMiddleware(manager)(http.NotFoundHandler())
+
+	for query, want := range map[string]string{
+		"/orders%3Fid%3D1": "/orders?id=1",
+		"/%09/evil.com":    "/",
+		"/%0d%0a/evil.com": "/",
+		"/%5Cevil.com":     "/",
+		"//evil.com":       "/",
+		"https:evil.com":   "/",
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/login?return_to="+query, nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("%s: status = %d", query, w.Code)
+		}
+
+		var login sessionLogin
+		name := "gw_session" + sessionLoginCookieTail
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == name {
+				if err := manager.open(name, cookie.Value, &login); err != nil {
+					t.Fatalf("%s: open login cookie: %v", query, err)
+				}
+			}
+		}
+		if login.ReturnTo != want {
+			t.Errorf("return_to=%s: saved %q, want %q", query, login.ReturnTo, want)
+		}
+	}
+}
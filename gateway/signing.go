@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 请求签名方案
+const (
+	SigningSchemeGateway = "gateway" // 网关规范签名（Authorization: HMAC-SHA256 ...）
+	SigningSchemeGitHub  = "github"  // X-Hub-Signature-256: sha256=<hex>，按请求体哈希防重放
+	SigningSchemeStripe  = "stripe"  // Stripe-Signature: t=<ts>,v1=<hex>
+	SigningSchemeSlack   = "slack"   // X-Slack-Signature: v0=<hex>，X-Slack-Request-Timestamp
+)
+
+// 网关规范签名使用的请求头
+const (
+	SigningAuthScheme      = "HMAC-SHA256"
+	SigningTimestampHeader = "X-Signature-Timestamp" // Unix 秒
+	SigningNonceHeader     = "X-Signature-Nonce"
+	SigningPartnerHeader   = "X-Signature-Partner" // 转发给上游的合作方 ID
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid request signature")
+	ErrStaleSignature   = errors.New("request signature timestamp outside allowed window")
+	ErrReplayedRequest  = errors.New("replayed request")
+	ErrUnknownPartner   = errors.New("unknown signing partner")
+)
+
+// SigningPartner 签名合作方，secrets 支持多个以便轮换，"env:NAME" 表示从环境变量读取
+type SigningPartner struct {
+	ID      string   `json:"id"`
+	Scheme  string   `json:"scheme"` // 为空时使用 gateway
+	Secrets []string `json:"secrets"`
+	Routes  []string `json:"routes"` // 允许访问的路由；webhook 方案据此识别合作方，必须配置
+	Scopes  []string `json:"scopes"`
+
+	secrets [][]byte
+}
+
+// RequestSigner HMAC 请求签名校验（认证器）
+type RequestSigner struct {
+	partners []*SigningPartner
+	byID     map[string]*SigningPartner
+	maxSkew  time.Duration
+	maxBody  int64
+	nonces   *replayCache
+}
+
+// NewRequestSigner 加载合作方配置
+func NewRequestSigner(config SigningConfig, maxBody int64) (*RequestSigner, error) {
+	if config.PartnersFile == "" {
+		return nil, fmt.Errorf("request signing requires SIGNING_PARTNERS_FILE")
+	}
+
+	var partners []*SigningPartner
+	if err := loadJSONFile(config.PartnersFile, &partners); err != nil {
+		return nil, fmt.Errorf("failed to load signing partners: %w", err)
+	}
+
+	s := &RequestSigner{
+		byID:    make(map[string]*SigningPartner),
+		maxSkew: config.MaxSkew,
+		maxBody: maxBody,
+		// nonce 至少保留到时间戳过期，之后的重放会因时间戳被拒绝
+		nonces: newReplayCache(max(config.NonceTTL, 2*config.MaxSkew), config.NonceCacheSize),
+	}
+	for _, partner := range partners {
+		if partner.ID == "" || s.byID[partner.ID] != nil {
+			return nil, fmt.Errorf("signing partner id %q is empty or duplicated", partner.ID)
+		}
+		if partner.Scheme == "" {
+			partner.Scheme = SigningSchemeGateway
+		}
+		switch partner.Scheme {
+		case SigningSchemeGateway:
+		case SigningSchemeGitHub, SigningSchemeStripe, SigningSchemeSlack:
+			if len(partner.Routes) == 0 {
+				return nil, fmt.Errorf("signing partner %s: %s scheme requires routes", partner.ID, partner.Scheme)
+			}
+		default:
+			return nil, fmt.Errorf("signing partner %s: unknown scheme %q", partner.ID, partner.Scheme)
+		}
+
+		for _, secret := range partner.Secrets {
+			if name, ok := strings.CutPrefix(secret, "env:"); ok {
+				secret = os.Getenv(name)
+			}
+			if secret == "" {
+				return nil, fmt.Errorf("signing partner %s: empty secret", partner.ID)
+			}
+			partner.secrets = append(partner.secrets, []byte(secret))
+		}
+		if len(partner.secrets) == 0 {
+			return nil, fmt.Errorf("signing partner %s: no secrets", partner.ID)
+		}
+
+		s.partners = append(s.partners, partner)
+		s.byID[partner.ID] = partner
+	}
+	return s, nil
+}
+
+// allowsRoute 检查合作方是否可以访问该路由，未配置路由时允许全部路由
+func (p *SigningPartner) allowsRoute(r *http.Request) bool {
+	if len(p.Routes) == 0 {
+		return true
+	}
+	for _, route := range p.Routes {
+		if matchRoute(route, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// verify 用合作方的任一密钥校验签名（常量时间比较）
+func (p *SigningPartner) verify(message []byte, signatures [][]byte) bool {
+	for _, secret := range p.secrets {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(message)
+		sum := mac.Sum(nil)
+		for _, signature := range signatures {
+			if hmac.Equal(sum, signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authenticate 校验网关规范签名或 webhook 签名；请求不带签名时返回 (nil, nil)
+func (s *RequestSigner) Authenticate(r *http.Request) (*Identity, error) {
+	if scheme, params, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && scheme == SigningAuthScheme {
+		return s.authenticateGateway(r, params)
+	}
+
+	var lastErr error
+	for _, partner := range s.partners {
+		if partner.Scheme == SigningSchemeGateway || !partner.allowsRoute(r) || !webhookSigned(partner.Scheme, r) {
+			continue
+		}
+		identity, err := s.authenticateWebhook(r, partner)
+		if err == nil {
+			return identity, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// authenticateGateway 校验 Authorization: HMAC-SHA256 Credential=<id>, SignedHeaders=<a;b>, Signature=<hex>
+func (s *RequestSigner) authenticateGateway(r *http.Request, value string) (*Identity, error) {
+	params := make(map[string]string)
+	for _, param := range strings.Split(value, ",") {
+		name, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+		params[name] = v
+	}
+
+	partner := s.byID[params["Credential"]]
+	if partner == nil || partner.Scheme != SigningSchemeGateway {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPartner, params["Credential"])
+	}
+	if !partner.allowsRoute(r) {
+		return nil, fmt.Errorf("%w: %s is not allowed on this route", ErrInvalidSignature, partner.ID)
+	}
+	signature, err := hex.DecodeString(params["Signature"])
+	if err != nil || len(signature) == 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	timestamp := r.Header.Get(SigningTimestampHeader)
+	nonce := r.Header.Get(SigningNonceHeader)
+	if nonce == "" {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidSignature, SigningNonceHeader)
+	}
+	if err := s.checkTimestamp(timestamp); err != nil {
+		return nil, err
+	}
+
+	body, err := s.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var signedHeaders []string
+	if params["SignedHeaders"] != "" {
+		signedHeaders = strings.Split(params["SignedHeaders"], ";")
+	}
+	if !partner.verify(canonicalRequest(r, timestamp, nonce, signedHeaders, body), [][]byte{signature}) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, partner.ID)
+	}
+
+	if !s.nonces.Add(partner.ID + ":" + nonce) {
+		return nil, fmt.Errorf("%w: %s", ErrReplayedRequest, partner.ID)
+	}
+	return partner.identity(), nil
+}
+
+// canonicalRequest 生成网关规范签名的待签字符串：
+//
+//	HMAC-SHA256\n<timestamp>\n<nonce>\n<METHOD>\n<path>\n<query>\n<header:value\n...><signed headers>\n<hex(sha256(body))>
+//
+// query 按参数名和值排序后编码；签名头按 SignedHeaders 的顺序，名称小写、值去掉首尾空白
+func canonicalRequest(r *http.Request, timestamp, nonce string, signedHeaders []string, body []byte) []byte {
+	var b strings.Builder
+	b.WriteString(SigningAuthScheme + "\n" + timestamp + "\n" + nonce + "\n")
+	b.WriteString(r.Method + "\n")
+	b.WriteString(r.URL.EscapedPath() + "\n")
+
+	query := r.URL.Query()
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+	b.WriteString(strings.Join(pairs, "&") + "\n")
+
+	for i, name := range signedHeaders {
+		name = strings.ToLower(strings.TrimSpace(name))
+		signedHeaders[i] = name
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		b.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	b.WriteString(strings.Join(signedHeaders, ";") + "\n")
+
+	sum := sha256.Sum256(body)
+	b.WriteString(hex.EncodeToString(sum[:]))
+	return []byte(b.String())
+}
+
+// webhookSigned 请求是否带有该 webhook 方案的签名头
+func webhookSigned(scheme string, r *http.Request) bool {
+	switch scheme {
+	case SigningSchemeGitHub:
+		return r.Header.Get("X-Hub-Signature-256") != ""
+	case SigningSchemeStripe:
+		return r.Header.Get("Stripe-Signature") != ""
+	case SigningSchemeSlack:
+		return r.Header.Get("X-Slack-Signature") != ""
+	}
+	return false
+}
+
+// authenticateWebhook 按 webhook 方案校验签名
+func (s *RequestSigner) authenticateWebhook(r *http.Request, partner *SigningPartner) (*Identity, error) {
+	body, err := s.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var message []byte
+	var signatures [][]byte
+	var nonce string
+
+	switch partner.Scheme {
+	case SigningSchemeGitHub:
+		// GitHub 不带时间戳，X-GitHub-Delivery 不在签名范围内可被随意改写，只能按签名的请求体去重
+		value, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+		signature, err := hex.DecodeString(value)
+		if !ok || err != nil {
+			return nil, ErrInvalidSignature
+		}
+		message, signatures = body, [][]byte{signature}
+		nonce = hex.EncodeToString(sha256Sum(body))
+
+	case SigningSchemeStripe:
+		var timestamp string
+		for _, item := range strings.Split(r.Header.Get("Stripe-Signature"), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				if signature, err := hex.DecodeString(value); err == nil {
+					signatures = append(signatures, signature)
+				}
+			}
+		}
+		if err := s.checkTimestamp(timestamp); err != nil {
+			return nil, err
+		}
+		message = append([]byte(timestamp+"."), body...)
+		nonce = timestamp + "." + hex.EncodeToString(sha256Sum(body))
+
+	case SigningSchemeSlack:
+		timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+		if err := s.checkTimestamp(timestamp); err != nil {
+			return nil, err
+		}
+		value, ok := strings.CutPrefix(r.Header.Get("X-Slack-Signature"), "v0=")
+		signature, err := hex.DecodeString(value)
+		if !ok || err != nil {
+			return nil, ErrInvalidSignature
+		}
+		message = append([]byte("v0:"+timestamp+":"), body...)
+		signatures = [][]byte{signature}
+		nonce = timestamp + "." + value
+	}
+
+	if len(signatures) == 0 || !partner.verify(message, signatures) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, partner.ID)
+	}
+	if nonce == "" {
+		return nil, fmt.Errorf("%w: %s: no replay key", ErrInvalidSignature, partner.ID)
+	}
+	if !s.nonces.Add(partner.ID + ":" + nonce) {
+		return nil, fmt.Errorf("%w: %s", ErrReplayedRequest, partner.ID)
+	}
+	return partner.identity(), nil
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// checkTimestamp 检查 Unix 秒时间戳是否在允许的偏差内
+func (s *RequestSigner) checkTimestamp(value string) error {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: missing or invalid timestamp", ErrInvalidSignature)
+	}
+	skew := time.Since(time.Unix(seconds, 0))
+	if skew > s.maxSkew || skew < -s.maxSkew {
+		return ErrStaleSignature
+	}
+	return nil
+}
+
+// readBody 读取请求体用于计算签名，并放回请求供后续转发
+func (s *RequestSigner) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.maxBody+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > s.maxBody {
+		return nil, fmt.Errorf("%w: body too large", ErrInvalidSignature)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// identity 合作方身份
+func (p *SigningPartner) identity() *Identity {
+	return &Identity{
+		Subject: p.ID,
+		Method:  "hmac",
+		Scopes:  p.Scopes,
+		Headers: map[string]string{SigningPartnerHeader: p.ID},
+	}
+}
+
+// IdentityHeaders 实现 IdentityHeaderProvider
+func (s *RequestSigner) IdentityHeaders() []string {
+	return []string{SigningPartnerHeader}
+}
+
+// replayCache 已使用的 nonce，过期后自动清理；已满时拒绝新 nonce（宁可拒绝也不放过重放）
+type replayCache struct {
+	ttl       time.Duration
+	maxSize   int
+	mu        sync.Mutex
+	seen      map[string]time.Time // nonce -> 过期时间
+	lastPrune time.Time
+}
+
+func newReplayCache(ttl time.Duration, maxSize int) *replayCache {
+	return &replayCache{ttl: ttl, maxSize: maxSize, seen: make(map[string]time.Time), lastPrune: time.Now()}
+}
+
+// Add 记录 nonce，nonce 已使用过或缓存已满时返回 false
+func (c *replayCache) Add(nonce string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.seen) >= c.maxSize || now.Sub(c.lastPrune) > c.ttl/2 {
+		for key, expires := range c.seen {
+			if now.After(expires) {
+				delete(c.seen, key)
+			}
+		}
+		c.lastPrune = now
+	}
+
+	if expires, ok := c.seen[nonce]; ok && now.Before(expires) {
+		return false
+	}
+	if len(c.seen) >= c.maxSize {
+		return false
+	}
+	c.seen[nonce] = now.Add(c.ttl)
+	return true
+}
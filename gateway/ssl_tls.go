@@ -2,19 +2,321 @@ package main
 
 import (
 	"crypto/tls"
-	"log"
-	"net/http"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
-// 启用 SSL/TLS
-func startTLSServer(handler http.Handler) {
-	srv := &http.Server{
-		Addr:    ":8443",
-		Handler: handler,
-		TLSConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12,
-			// 可以配置更多的 TLS 选项，如证书等
-		},
-	}
-	log.Fatal(srv.ListenAndServeTLS("server.crt", "server.key")) // 启动 HTTPS 服务器
+// storedCert 证书存储中的一张证书
+type storedCert struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	names    []string // SAN 中的 DNS 名称（小写）
+	notAfter time.Time
+}
+
+// CertStore 多证书存储，按 SNI 选择证书并在文件变化时热加载
+type CertStore struct {
+	dir           string
+	explicit      [][2]string // 显式配置的证书/私钥对（默认证书、虚拟主机证书）
+	expiryWarning time.Duration
+	certs         []*storedCert
+	byFile        map[string]*storedCert
+	modTimes      map[string]time.Time
+	warned        map[string]time.Time // 上次过期告警时间，避免每次检查都告警
+	mu            sync.RWMutex
+	stopReload    chan struct{}
+}
+
+// NewCertStore 创建证书存储
+func NewCertStore(dir string, expiryWarning time.Duration) *CertStore {
+	return &CertStore{
+		dir:           dir,
+		expiryWarning: expiryWarning,
+		byFile:        make(map[string]*storedCert),
+		modTimes:      make(map[string]time.Time),
+		warned:        make(map[string]time.Time),
+		stopReload:    make(chan struct{}),
+	}
+}
+
+// AddPair 添加显式配置的证书/私钥对，需在 Load 之前调用
+func (cs *CertStore) AddPair(certFile, keyFile string) {
+	cs.explicit = append(cs.explicit, [2]string{certFile, keyFile})
+}
+
+// Load 加载全部证书；单个证书加载失败时保留其旧版本
+func (cs *CertStore) Load() error {
+	pairs := cs.pairs()
+	modTimes := make(map[string]time.Time)
+
+	cs.mu.RLock()
+	previous := cs.byFile
+	cs.mu.RUnlock()
+
+	var certs []*storedCert
+	byFile := make(map[string]*storedCert)
+
+	for _, pair := range pairs {
+		for _, file := range pair {
+			if info, err := os.Stat(file); err == nil {
+				modTimes[file] = info.ModTime()
+			}
+		}
+
+		sc, err := loadStoredCert(pair[0], pair[1])
+		if err != nil {
+			GetLogger().Error("Failed to load certificate", map[string]interface{}{
+				"cert_file": pair[0],
+				"error":     err.Error(),
+			})
+			if old, ok := previous[pair[0]]; ok {
+				sc = old
+			} else {
+				continue
+			}
+		}
+
+		if _, dup := byFile[sc.certFile]; dup {
+			continue
+		}
+		certs = append(certs, sc)
+		byFile[sc.certFile] = sc
+	}
+
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificates loaded")
+	}
+
+	cs.mu.Lock()
+	cs.certs = certs
+	cs.byFile = byFile
+	cs.modTimes = modTimes
+	cs.mu.Unlock()
+
+	cs.checkExpiry()
+
+	return nil
+}
+
+// pairs 返回显式配置的证书对以及证书目录中的 name.crt / name.key 对
+func (cs *CertStore) pairs() [][2]string {
+	pairs := append([][2]string{}, cs.explicit...)
+
+	if cs.dir == "" {
+		return pairs
+	}
+
+	matches, err := filepath.Glob(filepath.Join(cs.dir, "*.crt"))
+	if err != nil {
+		return pairs
+	}
+
+	for _, certFile := range matches {
+		keyFile := strings.TrimSuffix(certFile, ".crt") + ".key"
+		if _, err := os.Stat(keyFile); err != nil {
+			GetLogger().Warn("Certificate without matching key skipped", map[string]interface{}{
+				"cert_file": certFile,
+			})
+			continue
+		}
+		pairs = append(pairs, [2]string{certFile, keyFile})
+	}
+
+	return pairs
+}
+
+// loadStoredCert 加载证书/私钥对并解析叶子证书
+func loadStoredCert(certFile, keyFile string) (*storedCert, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf = leaf
+
+	names := make([]string, 0, len(leaf.DNSNames)+1)
+	for _, name := range leaf.DNSNames {
+		names = append(names, strings.ToLower(name))
+	}
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = append(names, strings.ToLower(leaf.Subject.CommonName))
+	}
+
+	return &storedCert{
+		certFile: certFile,
+		keyFile:  keyFile,
+		cert:     &cert,
+		names:    names,
+		notAfter: leaf.NotAfter,
+	}, nil
+}
+
+// Certificate 返回指定证书文件当前加载的证书
+func (cs *CertStore) Certificate(certFile string) *tls.Certificate {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if sc, ok := cs.byFile[certFile]; ok {
+		return sc.cert
+	}
+	return nil
+}
+
+// GetCertificate 按 SNI 选择证书（精确名称 > 通配符 > 第一张证书）
+func (cs *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if len(cs.certs) == 0 {
+		return nil, fmt.Errorf("no certificates available")
+	}
+
+	serverName := normalizeHost(hello.ServerName)
+	if serverName != "" {
+		for _, sc := range cs.certs {
+			for _, name := range sc.names {
+				if name == serverName {
+					return sc.cert, nil
+				}
+			}
+		}
+
+		for _, sc := range cs.certs {
+			for _, name := range sc.names {
+				if matchWildcardName(name, serverName) {
+					return sc.cert, nil
+				}
+			}
+		}
+	}
+
+	return cs.certs[0].cert, nil
+}
+
+// matchWildcardName 证书通配符只匹配一级子域名
+func matchWildcardName(pattern, host string) bool {
+	if !strings.HasPrefix(pattern, "*.") {
+		return false
+	}
+
+	dot := strings.IndexByte(host, '.')
+	return dot > 0 && host[dot:] == pattern[1:]
+}
+
+// StartReload 定期检查证书文件变化并热加载，同时检查证书过期
+func (cs *CertStore) StartReload(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if cs.changed() {
+				GetLogger().Info("Certificate change detected, reloading", map[string]interface{}{
+					"dir": cs.dir,
+				})
+				if err := cs.Load(); err != nil {
+					GetLogger().Error("Certificate reload failed", map[string]interface{}{
+						"error": err.Error(),
+					})
+				}
+			} else {
+				cs.checkExpiry()
+			}
+		case <-cs.stopReload:
+			return
+		}
+	}
+}
+
+// Stop 停止热加载
+func (cs *CertStore) Stop() {
+	close(cs.stopReload)
+}
+
+// changed 检查证书文件是否有新增、删除或修改
+func (cs *CertStore) changed() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	seen := 0
+	for _, pair := range cs.pairs() {
+		for _, file := range pair {
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			seen++
+			if modTime, ok := cs.modTimes[file]; !ok || !modTime.Equal(info.ModTime()) {
+				return true
+			}
+		}
+	}
+
+	return seen != len(cs.modTimes)
+}
+
+// checkExpiry 记录证书剩余有效期，即将过期时告警（每张证书每天最多一次）
+func (cs *CertStore) checkExpiry() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, sc := range cs.certs {
+		remaining := time.Until(sc.notAfter)
+		GetMetrics().UpdateCertificateExpiry(sc.certFile, sc.notAfter)
+
+		if remaining < cs.expiryWarning && time.Since(cs.warned[sc.certFile]) > 24*time.Hour {
+			cs.warned[sc.certFile] = time.Now()
+			GetLogger().Warn("Certificate expiring soon", map[string]interface{}{
+				"cert_file":      sc.certFile,
+				"names":          sc.names,
+				"not_after":      sc.notAfter.UTC().Format(time.RFC3339),
+				"remaining_days": int(remaining.Hours() / 24),
+			})
+		}
+	}
+}
+
+// NewServerTLSConfig 根据监听器配置构建 TLS 配置
+func NewServerTLSConfig(config TLSListenerConfig, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: getCertificate,
+		NextProtos:     config.ALPN,
+	}
+
+	switch config.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS min version: %s", config.MinVersion)
+	}
+
+	if len(config.CipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+
+		for _, name := range config.CipherSuites {
+			id, ok := suites[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("unsupported cipher suite: %s", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+
+	return tlsConfig, nil
 }
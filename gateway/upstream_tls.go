@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// enabled 是否配置了任何上游 TLS 选项
+func (c UpstreamTLSConfig) enabled() bool {
+	return c.CAFile != "" || c.CertFile != "" || c.ServerName != "" || c.InsecureSkipVerify
+}
+
+// NewUpstreamTLSConfig 根据后端池配置构建发往后端的 TLS 配置
+func NewUpstreamTLSConfig(config UpstreamTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if config.InsecureSkipVerify {
+		GetLogger().Warn("Upstream TLS verification disabled, do not use in production", map[string]interface{}{
+			"server_name": config.ServerName,
+		})
+	}
+
+	if config.CAFile != "" {
+		data, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no CA certificates found in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// 客户端证书（mTLS 到后端）
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+		cert.Leaf = leaf
+		tlsConfig.Certificates = []tls.Certificate{cert}
+
+		GetMetrics().UpdateCertificateExpiry("upstream-client:"+config.CertFile, leaf.NotAfter)
+	}
+
+	return tlsConfig, nil
+}
+
+// NewBackendClient 创建后端池共用的 HTTP 客户端（连接池 + 上游 TLS）
+func NewBackendClient(config BackendConfig) (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          config.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.MaxConnsPerHost,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	if config.TLS.enabled() {
+		tlsConfig, err := NewUpstreamTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// recordBackendCertExpiry 记录后端服务端证书的过期时间
+func recordBackendCertExpiry(backend *Backend, state *tls.ConnectionState) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	GetMetrics().UpdateCertificateExpiry("backend:"+backend.URL.String(), state.PeerCertificates[0].NotAfter)
+}
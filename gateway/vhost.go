@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// VirtualHost 虚拟主机
+type VirtualHost struct {
+	Name     string
+	Handler  http.Handler
+	CertFile string // 证书存储中该虚拟主机使用的证书文件
+}
+
+// wildcardHost 通配符虚拟主机（*.example.com）
+type wildcardHost struct {
+	suffix string // ".example.com"
+	vhost  *VirtualHost
+}
+
+// VirtualHostRouter 基于 Host / SNI 的虚拟主机路由器
+type VirtualHostRouter struct {
+	exact          map[string]*VirtualHost
+	wildcards      []wildcardHost
+	defaultHost    *VirtualHost
+	certStore      *CertStore
+	healthCheckers []*HealthChecker
+}
+
+// NewVirtualHostRouter 创建虚拟主机路由器
+// defaultHost 为未匹配任何主机名时使用的虚拟主机，配置中标记为 default 的虚拟主机会覆盖它；
+// 虚拟主机的证书会加入 certStore（可为 nil）；任一路由的后端池无法创建时返回错误
+func NewVirtualHostRouter(configs []VirtualHostConfig, defaultHost *VirtualHost, certStore *CertStore, deps chainDeps) (*VirtualHostRouter, error) {
+	vr := &VirtualHostRouter{
+		exact:       make(map[string]*VirtualHost),
+		defaultHost: defaultHost,
+		certStore:   certStore,
+	}
+
+	for _, config := range configs {
+		vhost, err := vr.buildVirtualHost(config, deps)
+		if err != nil {
+			vr.Stop()
+			return nil, fmt.Errorf("virtual host %q: %w", config.Name, err)
+		}
+
+		for _, host := range config.Hosts {
+			host = normalizeHost(host)
+			if strings.HasPrefix(host, "*.") {
+				vr.wildcards = append(vr.wildcards, wildcardHost{suffix: host[1:], vhost: vhost})
+			} else {
+				vr.exact[host] = vhost
+			}
+		}
+
+		if config.Default {
+			vr.defaultHost = vhost
+		}
+
+		GetLogger().Info("Virtual host loaded", map[string]interface{}{
+			"name":    config.Name,
+			"hosts":   config.Hosts,
+			"routes":  len(config.Routes),
+			"default": config.Default,
+		})
+	}
+
+	// 最长后缀优先匹配
+	sort.SliceStable(vr.wildcards, func(i, j int) bool {
+		return len(vr.wildcards[i].suffix) > len(vr.wildcards[j].suffix)
+	})
+
+	return vr, nil
+}
+
+// buildVirtualHost 根据配置构建虚拟主机（独立的路由、后端池、CORS 与安全头）
+func (vr *VirtualHostRouter) buildVirtualHost(config VirtualHostConfig, deps chainDeps) (*VirtualHost, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", HealthCheckHandler)
+
+	for _, route := range config.Routes {
+		backendConfig := cfg.Backend
+		backendConfig.URLs = route.Backends
+		if route.TLS != nil {
+			backendConfig.TLS = *route.TLS
+		}
+
+		strategy := route.LoadBalanceStrategy
+		if strategy == "" {
+			strategy = cfg.Backend.LoadBalanceStrategy
+		}
+
+		lb, backends, err := NewLoadBalancer(backendConfig, strategy)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", route.Path, err)
+		}
+		healthChecker := NewHealthChecker(backends, lb, backendConfig)
+		go healthChecker.Start()
+		vr.healthCheckers = append(vr.healthCheckers, healthChecker)
+
+		if route.Concurrency != nil {
+			backendConfig.Concurrency = *route.Concurrency
+		}
+		limiter, err := NewConcurrencyLimiter(config.Name+" "+route.Path, backendConfig.Concurrency)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: invalid concurrency configuration: %w", route.Path, err)
+		}
+
+		breaker := NewCircuitBreaker(cfg.CircuitBreaker)
+		mux.Handle(route.Path, ProxyMiddleware(lb, breaker, limiter, backendConfig, nil)(http.NotFoundHandler()))
+	}
+
+	// 虚拟主机自己的 CORS 与安全头策略
+	if config.CORS != nil {
+		deps.security.EnableCORS = config.CORS.Enabled
+		deps.security.AllowedOrigins = config.CORS.AllowedOrigins
+		deps.security.AllowedMethods = config.CORS.AllowedMethods
+		deps.security.AllowedHeaders = config.CORS.AllowedHeaders
+	}
+	deps.securityHeaders = mergeSecurityHeaders(deps.securityHeaders, config.SecurityHeaders)
+
+	// 路由内部自行代理，不再需要链上的代理中间件
+	deps.loadBalancer = nil
+	deps.pathWhitelist = map[string]bool{"/health": true}
+
+	vhost := &VirtualHost{
+		Name:    config.Name,
+		Handler: buildHostChain(mux, deps),
+	}
+
+	if config.CertFile != "" && config.KeyFile != "" && vr.certStore != nil {
+		vr.certStore.AddPair(config.CertFile, config.KeyFile)
+		vhost.CertFile = config.CertFile
+	}
+
+	return vhost, nil
+}
+
+// Match 根据主机名查找虚拟主机（精确匹配 > 最长通配符 > 默认）
+func (vr *VirtualHostRouter) Match(host string) *VirtualHost {
+	host = normalizeHost(host)
+
+	if vhost, ok := vr.exact[host]; ok {
+		return vhost
+	}
+
+	for _, wildcard := range vr.wildcards {
+		if strings.HasSuffix(host, wildcard.suffix) && len(host) > len(wildcard.suffix) {
+			return wildcard.vhost
+		}
+	}
+
+	return vr.defaultHost
+}
+
+// ServeHTTP 按 Host 头分发请求
+func (vr *VirtualHostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vhost := vr.Match(r.Host)
+	if vhost == nil {
+		http.Error(w, "Misdirected Request", http.StatusMisdirectedRequest)
+		return
+	}
+
+	vhost.Handler.ServeHTTP(w, r)
+}
+
+// GetCertificate 按 SNI 选择证书：优先使用匹配虚拟主机的证书，否则按证书名称从证书存储中选择
+func (vr *VirtualHostRouter) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if vhost := vr.Match(hello.ServerName); vhost != nil && vhost.CertFile != "" {
+		if cert := vr.certStore.Certificate(vhost.CertFile); cert != nil {
+			return cert, nil
+		}
+	}
+
+	return vr.certStore.GetCertificate(hello)
+}
+
+// Stop 停止虚拟主机后端池的健康检查
+func (vr *VirtualHostRouter) Stop() {
+	for _, healthChecker := range vr.healthCheckers {
+		healthChecker.Stop()
+	}
+}
+
+// normalizeHost 去掉端口和末尾的点并转为小写
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// mergeSecurityHeaders 合并安全头，覆盖值为空时移除该头
+func mergeSecurityHeaders(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base))
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range overrides {
+		if value == "" {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+
+	return merged
+}